@@ -14,12 +14,12 @@ function printCompletionRateRelayChain(name, datas) {
             <tbody>
         `;
     datas.forEach((data) => {
-        if (data.RelayChain === name) {
+        if (data.relayChain === name) {
             html += `
                 <tr>
-                    <td>${data.Chain}</td>
-                    <td class="has-text-right">${data.percent_completion.toFixed(2)}</td>
-                    <td class="has-text-right">${data.head_id.toLocaleString('en-US')}</td>
+                    <td>${data.chain}</td>
+                    <td class="has-text-right">${data.percentCompletion.toFixed(2)}</td>
+                    <td class="has-text-right">${data.headId.toLocaleString('en-US')}</td>
                 </tr>
               `;
         }
@@ -59,12 +59,12 @@ function plotMonthlyStats(allDatas) {
     const plotDiv = document.getElementById('monthly-chart');
 
     function addTrace(relay) {
-        const datas = allDatas.filter((d) => d.Relaychain === relay);
-        const chains = new Set(datas.map((d) => d.Chain));
+        const datas = allDatas.filter((d) => d.relayChain === relay);
+        const chains = new Set(datas.map((d) => d.chain));
         return [...chains].map((chain) => ({
             name: '#' + chain + '.' + relay.slice(0, 3),
-            x: datas.filter((d) => d.Chain == chain).map((d) => d.date),
-            y: datas.filter((d) => d.Chain == chain).map((d) => d.count),
+            x: datas.filter((d) => d.chain == chain).map((d) => d.date),
+            y: datas.filter((d) => d.chain == chain).map((d) => d.count),
             type: 'bar',
         }));
     }
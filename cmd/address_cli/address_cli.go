@@ -10,7 +10,11 @@ import (
 
 func main() {
 	address := flag.String("address", "", "a Polkadot address")
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("address_cli", *showVersion) {
+		return
+	}
 
 	if address == nil || *address == "" {
 		log.Fatal("Please provide an address")
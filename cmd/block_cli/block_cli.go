@@ -17,7 +17,11 @@ func main() {
 	blockCount := flag.Int("count", 1, "Number of blocks to process")
 	printOutput := flag.Bool("print", false, "Print decoded extrinsics and events")
 
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("block_cli", *showVersion) {
+		return
+	}
 
 	if *wsURL == "" {
 		fmt.Println("WebSocket URL (-ws) is required")
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// blockCap stops a run of one chain once it sent -max-blocks blocks to the
+// workers and leaves a checkpoint, the next capped run of the chain starts
+// from it. A nil blockCap does not stop anything.
+type blockCap struct {
+	max  int
+	sent int
+	// checkpoint file of the chain
+	path string
+	// lowest block a save failed for, see track
+	mu        sync.Mutex
+	unsaved   int
+	hasFailed bool
+}
+
+// checkpoint is where a capped run stopped
+type checkpoint struct {
+	RelayChain string    `json:"relayChain"`
+	Chain      string    `json:"chain"`
+	NextBlock  int       `json:"nextBlock"`
+	Indexed    int       `json:"indexed"`
+	Time       time.Time `json:"time"`
+}
+
+// newBlockCap returns the cap of relayChain:chain with its checkpoint in
+// dir, nil when maxBlocks is 0 or less
+func newBlockCap(maxBlocks int, dir, relayChain, chain string) *blockCap {
+	if maxBlocks <= 0 {
+		return nil
+	}
+	return &blockCap{
+		max:  maxBlocks,
+		path: filepath.Join(dir, fmt.Sprintf("dixbatch-%s-%s.checkpoint", relayChain, chain)),
+	}
+}
+
+// reached reports whether the run sent all the blocks it may
+func (c *blockCap) reached() bool {
+	return c != nil && c.sent >= c.max
+}
+
+// count records one more block sent to the workers
+func (c *blockCap) count() {
+	if c != nil {
+		c.sent++
+	}
+}
+
+// resume returns the block the last capped run stopped at, ok is false
+// without a checkpoint
+func (c *blockCap) resume() (next int, ok bool) {
+	if c == nil {
+		return 0, false
+	}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false
+	}
+	var cp checkpoint
+	if err == nil {
+		err = json.Unmarshal(data, &cp)
+	}
+	if err != nil {
+		log.Printf("Ignoring checkpoint %s: %v", c.path, err)
+		return 0, false
+	}
+	return cp.NextBlock, true
+}
+
+// track returns db recording the blocks it could not save, the checkpoint
+// then starts from the lowest of them rather than skipping it, see failed
+func (c *blockCap) track(db dix.Database) dix.Database {
+	if c == nil {
+		return db
+	}
+	return &trackedDatabase{Database: db, limit: c}
+}
+
+// failed records blocks which were not indexed: their fetch or their save
+// failed, or they were left out for a broken parent hash
+func (c *blockCap) failed(ids []int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if !c.hasFailed || id < c.unsaved {
+			c.unsaved, c.hasFailed = id, true
+		}
+	}
+}
+
+// failedSave records that the save of items failed
+func (c *blockCap) failedSave(items []dix.BlockData) {
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		if id, err := strconv.Atoi(item.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	c.failed(ids)
+}
+
+// next returns the block the next run starts from when this one stopped
+// before stoppedAt
+func (c *blockCap) next(stoppedAt int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hasFailed && c.unsaved < stoppedAt {
+		return c.unsaved
+	}
+	return stoppedAt
+}
+
+// stop writes the checkpoint of a run which stopped before next
+func (c *blockCap) stop(relayChain, chain string, next int) error {
+	data, err := json.Marshal(checkpoint{
+		RelayChain: relayChain,
+		Chain:      chain,
+		NextBlock:  next,
+		Indexed:    c.sent,
+		Time:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	// a run killed while writing keeps the previous checkpoint
+	return dix.WriteFileAtomic(c.path, 0o644, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// clear removes the checkpoint once a run reached the end of its range
+func (c *blockCap) clear() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// contextSaver is a Database whose Save records spans
+type contextSaver interface {
+	SaveContext(ctx context.Context, items []dix.BlockData, relayChain, chain string) error
+}
+
+// trackedDatabase reports the failed saves to its blockCap
+type trackedDatabase struct {
+	dix.Database
+	limit *blockCap
+}
+
+func (d *trackedDatabase) Save(items []dix.BlockData, relayChain, chain string) error {
+	err := d.Database.Save(items, relayChain, chain)
+	if err != nil {
+		d.limit.failedSave(items)
+	}
+	return err
+}
+
+func (d *trackedDatabase) SaveContext(ctx context.Context, items []dix.BlockData, relayChain, chain string) error {
+	saver, ok := d.Database.(contextSaver)
+	if !ok {
+		return d.Save(items, relayChain, chain)
+	}
+	err := saver.SaveContext(ctx, items, relayChain, chain)
+	if err != nil {
+		d.limit.failedSave(items)
+	}
+	return err
+}
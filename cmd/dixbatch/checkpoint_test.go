@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// memoryDatabase keeps the ids of the saved blocks
+type memoryDatabase struct {
+	dix.Database
+	mu    sync.Mutex
+	saved map[int]bool
+	// first block of each GetExistingBlocks
+	scanned []int
+	// blocks from failFrom on are not saved, when set
+	failFrom int
+}
+
+func (d *memoryDatabase) Save(items []dix.BlockData, relayChain, chain string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, item := range items {
+		var id int
+		fmt.Sscan(item.ID, &id)
+		if d.failFrom > 0 && id >= d.failFrom {
+			return fmt.Errorf("disk full")
+		}
+	}
+	for _, item := range items {
+		var id int
+		fmt.Sscan(item.ID, &id)
+		d.saved[id] = true
+	}
+	return nil
+}
+
+func (d *memoryDatabase) GetExistingBlocks(relayChain, chain string, startRange, endRange int) (map[int]bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.scanned = append(d.scanned, startRange)
+	existing := make(map[int]bool)
+	for id := range d.saved {
+		if id >= startRange && id <= endRange {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+// headReader answers any range up to its head
+type headReader struct {
+	dix.ChainReader
+	head int
+}
+
+func (r *headReader) GetChainHeadID() (int, error) {
+	return r.head, nil
+}
+
+func (r *headReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]dix.BlockData, error) {
+	blocks := make([]dix.BlockData, 0, len(blockIDs))
+	for _, id := range blockIDs {
+		blocks = append(blocks, dix.BlockData{ID: fmt.Sprintf("%d", id)})
+	}
+	return blocks, nil
+}
+
+func (r *headReader) GetRuntimeVersion(ctx context.Context, blockID int) (dix.RuntimeVersion, error) {
+	return dix.RuntimeVersion{}, fmt.Errorf("not implemented")
+}
+
+func TestMaxBlocksCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	db := &memoryDatabase{saved: make(map[int]bool)}
+	reader := &headReader{head: 100}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 100
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+
+	run := func(maxBlocks int) {
+		limit := newBlockCap(maxBlocks, dir, "polkadot", "polkadot")
+		if err := startWorkers("polkadot", "polkadot", context.Background(), config, db, reader, reader.head, nil, nil, limit, nil); err != nil {
+			t.Fatalf("startWorkers: %v", err)
+		}
+	}
+	readCheckpoint := func() checkpoint {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, "dixbatch-polkadot-polkadot.checkpoint"))
+		if err != nil {
+			t.Fatalf("Expected a checkpoint: %v", err)
+		}
+		var cp checkpoint
+		if err := json.Unmarshal(data, &cp); err != nil {
+			t.Fatalf("Invalid checkpoint: %v", err)
+		}
+		return cp
+	}
+
+	run(25)
+	if len(db.saved) != 25 {
+		t.Fatalf("Expected the run to stop after 25 blocks, %d were saved", len(db.saved))
+	}
+	for id := 1; id <= 25; id++ {
+		if !db.saved[id] {
+			t.Errorf("Expected block %d to be saved", id)
+		}
+	}
+	cp := readCheckpoint()
+	if cp.NextBlock != 26 || cp.Indexed != 25 || cp.RelayChain != "polkadot" || cp.Chain != "polkadot" {
+		t.Errorf("Unexpected checkpoint %+v", cp)
+	}
+
+	// the next run starts from the checkpoint rather than scanning again
+	run(25)
+	if len(db.saved) != 50 {
+		t.Fatalf("Expected 50 blocks after the second run, got %d", len(db.saved))
+	}
+	if first := db.scanned[len(db.scanned)-1]; first != 26 {
+		t.Errorf("Expected the second run to start at block 26, got %d", first)
+	}
+	if cp := readCheckpoint(); cp.NextBlock != 51 {
+		t.Errorf("Expected the checkpoint at block 51, got %d", cp.NextBlock)
+	}
+
+	// reaching the end of the range removes the checkpoint
+	run(1000)
+	if len(db.saved) != 100 {
+		t.Fatalf("Expected every block to be saved, got %d", len(db.saved))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dixbatch-polkadot-polkadot.checkpoint")); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestFailedSaveFailsTheRun(t *testing.T) {
+	dir := t.TempDir()
+	db := &memoryDatabase{saved: make(map[int]bool), failFrom: 11}
+	reader := &headReader{head: 100}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 100
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+	config.DotidxBatch.SaveQueue = 2
+
+	limit := newBlockCap(50, dir, "polkadot", "polkadot")
+	err := startWorkers("polkadot", "polkadot", context.Background(), config, db, reader, reader.head, nil, nil, limit, nil)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected the failed save to fail the run, got %v", err)
+	}
+	// the next run starts over instead of skipping the lost blocks
+	if _, err := os.Stat(filepath.Join(dir, "dixbatch-polkadot-polkadot.checkpoint")); !os.IsNotExist(err) {
+		t.Errorf("Expected no checkpoint, got %v", err)
+	}
+}
+
+func TestCheckpointKeepsTheUnsavedBlocks(t *testing.T) {
+	dir := t.TempDir()
+	db := &memoryDatabase{saved: make(map[int]bool), failFrom: 21}
+	reader := &headReader{head: 100}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 100
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+
+	run := func() {
+		limit := newBlockCap(50, dir, "polkadot", "polkadot")
+		if err := startWorkers("polkadot", "polkadot", context.Background(), config, db, reader, reader.head, nil, nil, limit, nil); err != nil {
+			t.Fatalf("startWorkers: %v", err)
+		}
+	}
+
+	// without a save queue a failed save is only logged
+	run()
+	data, err := os.ReadFile(filepath.Join(dir, "dixbatch-polkadot-polkadot.checkpoint"))
+	if err != nil {
+		t.Fatalf("Expected a checkpoint: %v", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatalf("Invalid checkpoint: %v", err)
+	}
+	if cp.NextBlock != 21 {
+		t.Errorf("Expected the checkpoint at the first unsaved block 21, got %d", cp.NextBlock)
+	}
+
+	db.failFrom = 0
+	run()
+	if first := db.scanned[len(db.scanned)-1]; first != 21 {
+		t.Errorf("Expected the second run to start at block 21, got %d", first)
+	}
+	for id := 1; id <= 70; id++ {
+		if !db.saved[id] {
+			t.Errorf("Expected block %d to be saved", id)
+		}
+	}
+}
+
+// brokenReader cannot fetch the blocks from broken on
+type brokenReader struct {
+	*headReader
+	broken int
+}
+
+func (r *brokenReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]dix.BlockData, error) {
+	if blockIDs[len(blockIDs)-1] >= r.broken && blockIDs[0] < r.broken+10 {
+		return nil, fmt.Errorf("sidecar timeout")
+	}
+	return r.headReader.FetchBlockRange(ctx, blockIDs)
+}
+
+func TestCheckpointKeepsTheUnfetchedBlocks(t *testing.T) {
+	dir := t.TempDir()
+	db := &memoryDatabase{saved: make(map[int]bool)}
+	// blocks 21 to 30 cannot be fetched
+	reader := &brokenReader{headReader: &headReader{head: 100}, broken: 21}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 100
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+
+	limit := newBlockCap(50, dir, "polkadot", "polkadot")
+	if err := startWorkers("polkadot", "polkadot", context.Background(), config, db, reader, reader.head, nil, nil, limit, nil); err != nil {
+		t.Fatalf("startWorkers: %v", err)
+	}
+	if db.saved[21] {
+		t.Fatalf("Expected block 21 not to be indexed")
+	}
+	if next, ok := limit.resume(); !ok || next != 21 {
+		t.Errorf("Expected the checkpoint at the first unfetched block 21, got %d %v", next, ok)
+	}
+}
+
+// countingReader counts the blocks it fetched
+type countingReader struct {
+	*headReader
+	fetched atomic.Int64
+}
+
+func (r *countingReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]dix.BlockData, error) {
+	r.fetched.Add(int64(len(blockIDs)))
+	return r.headReader.FetchBlockRange(ctx, blockIDs)
+}
+
+func TestFailedSaveStopsTheFetching(t *testing.T) {
+	db := &memoryDatabase{saved: make(map[int]bool), failFrom: 11}
+	reader := &countingReader{headReader: &headReader{head: 10000}}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 10000
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+	config.DotidxBatch.SaveQueue = 2
+
+	err := startWorkers("polkadot", "polkadot", context.Background(), config, db, reader, reader.head, nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected the failed save to fail the run, got %v", err)
+	}
+	// a few batches were on their way, not the rest of the range
+	if fetched := reader.fetched.Load(); fetched > 1000 {
+		t.Errorf("Expected the fetching to stop after the failed save, %d blocks were fetched", fetched)
+	}
+}
+
+// cancellingDatabase interrupts the run on every save, which takes a while
+type cancellingDatabase struct {
+	*memoryDatabase
+	cancel context.CancelFunc
+}
+
+func (d *cancellingDatabase) Save(items []dix.BlockData, relayChain, chain string) error {
+	d.cancel()
+	time.Sleep(20 * time.Millisecond)
+	return d.memoryDatabase.Save(items, relayChain, chain)
+}
+
+func TestInterruptedRunDrainsTheSaveQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := &cancellingDatabase{memoryDatabase: &memoryDatabase{saved: make(map[int]bool)}, cancel: cancel}
+	reader := &headReader{head: 100}
+	var config dix.MgrConfig
+	config.DotidxBatch.StartRange = 1
+	config.DotidxBatch.EndRange = 100
+	config.DotidxBatch.BatchSize = 10
+	config.DotidxBatch.MaxWorkers = 2
+	config.DotidxBatch.SaveQueue = 2
+
+	limit := newBlockCap(0, t.TempDir(), "polkadot", "polkadot")
+	if err := startWorkers("polkadot", "polkadot", ctx, config, db, reader, reader.head, nil, nil, limit, nil); err != nil {
+		t.Fatalf("startWorkers: %v", err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(db.saved) == 0 {
+		t.Errorf("Expected the queued batches to be saved before returning")
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"sync"
 	"time"
@@ -18,9 +22,21 @@ func main() {
 	configFile := flag.String("conf", "", "toml configuration file")
 	chain := flag.String("chain", "", "chain")
 	relayChain := flag.String("relayChain", "polkadot", "relay chain")
+	allChains := flag.Bool("all", false, "index every configured chain, sharing global_workers between them")
+	sinceDays := flag.Int("since-days", 0, "index the last N days, replaces start_range and end_range")
+	blockTime := flag.Duration("block-time", 0, "average block time used by -since-days, measured on chain if not set")
+	selfTest := flag.Bool("selftest", false, "fetch and decode the head block, then exit")
+	maxBlocks := flag.Int("max-blocks", 0, "stop each chain after sending this many blocks to index and write a checkpoint the next run starts from, 0 does not stop")
+	checkpointDir := flag.String("checkpoint-dir", ".", "directory of the -max-blocks checkpoints")
+	metricsAddr := flag.String("metrics-addr", "", "serve per chain Prometheus gauges on this address, e.g. 127.0.0.1:9100")
+	overrides := dix.RegisterConfigFlags(flag.CommandLine, true)
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixbatch", *showVersion) {
+		return
+	}
 
-	if chain == nil || *chain == "" {
+	if !*allChains && (chain == nil || *chain == "") {
 		log.Fatal("Chain must be specified")
 	}
 
@@ -32,44 +48,29 @@ func main() {
 	if err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
-
-	// Set up logging
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-
-	log.Printf("Starting block ingestion for %s:%s", *relayChain, *chain)
-
-	// ----------------------------------------------------------------------
-	// ChainReader
-	// ----------------------------------------------------------------------
-	chainReaderURL := fmt.Sprintf(`http://%s:%d`,
-		config.Parachains[*relayChain][*chain].ChainreaderIP,
-		config.Parachains[*relayChain][*chain].ChainreaderPort,
-	)
-	reader := dix.NewSidecar(*relayChain, *chain, chainReaderURL)
-	// Test the sidecar service
-	if err := reader.Ping(); err != nil {
-		log.Fatalf("Sidecar service test failed: %v", err)
+	if err := overrides.Apply(config, *relayChain, *chain); err != nil {
+		log.Fatalf("Invalid flag: %v", err)
 	}
-	log.Println("Successfully connected to Sidecar service")
-
-	headBlockID, err := reader.GetChainHeadID()
-	if err != nil {
-		log.Fatalf("Failed to fetch head block: %v", err)
+	if err := dix.CheckTableNameCollisions(config.Parachains); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-	log.Printf("Current head block is %d", headBlockID)
 
-	if config.DotidxBatch.EndRange == -1 && headBlockID == 0 {
-		log.Fatal("Cannot get head block and EndRange is not set")
+	if err := checkSinceDays(*sinceDays, config.DotidxBatch); err != nil {
+		log.Fatalf("%v", err)
 	}
 
-	if config.DotidxBatch.EndRange == -1 {
-		config.DotidxBatch.EndRange = headBlockID
-	}
+	// Set up logging
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
-	if headBlockID == 0 {
-		headBlockID = config.DotidxBatch.EndRange
+	workers, capped := dix.EffectiveWorkers(*config)
+	if capped {
+		log.Printf("WARNING: max_workers=%d exceeds the %d database connections, running %d workers",
+			config.DotidxBatch.MaxWorkers, dix.DBPoolConfigFromMgrConfig(*config).MaxOpenConns, workers)
 	}
+	config.DotidxBatch.MaxWorkers = workers
+	log.Printf("Using %d workers, batch size %d, database pool of %d connections",
+		workers, config.DotidxBatch.BatchSize, dix.DBPoolConfigFromMgrConfig(*config).MaxOpenConns)
 
 	// ----------------------------------------------------------------------
 	// Set up context with cancellation for graceful shutdown
@@ -80,6 +81,16 @@ func main() {
 	// Handle OS signals for graceful shutdown
 	dix.SetupSignalHandler(cancel)
 
+	// tracing is opt-in, the last spans are exported once the workers are done
+	var stopTracing func(context.Context) error
+	if endpoint := config.DotidxBatch.TracingEndpoint; endpoint != "" {
+		stopTracing, err = dix.SetupTracing(ctx, endpoint, "dixbatch", tracingInterval)
+		if err != nil {
+			log.Fatalf("Cannot set up tracing: %v", err)
+		}
+		log.Printf("Exporting traces to %s", endpoint)
+	}
+
 	// ----------------------------------------------------------------------
 	// Database
 	// ----------------------------------------------------------------------
@@ -92,10 +103,165 @@ func main() {
 
 	log.Printf("Successfully connected to database %s", dix.DBUrlSecure(*config))
 
+	// the saved blocks go through the bus only when addresses are watched
+	if watchList := dix.StartWatchList(ctx, *config, database, dix.NewEventBus()); watchList != nil {
+		log.Printf("Watching %d addresses", len(watchList.List()))
+	}
+
+	opts := indexOptions{
+		sinceDays:     *sinceDays,
+		blockTime:     *blockTime,
+		selfTest:      *selfTest,
+		inflight:      dix.NewInFlightBatches(config.DotidxBatch.MaxInFlightBatches),
+		maxBlocks:     *maxBlocks,
+		checkpointDir: *checkpointDir,
+	}
+	if size := opts.inflight.Size(); size > 0 {
+		log.Printf("At most %d batches fetched and not yet saved at once", size)
+	}
+	if *metricsAddr != "" {
+		opts.metrics = newProgressCollector(database)
+		opts.metrics.watchInFlight(opts.inflight)
+		go func() {
+			log.Printf("Serving metrics at http://%s/metrics", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, metricsHandler(opts.metrics)); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+	if *allChains {
+		// the chains share the database pool, the budget keeps a busy
+		// chain from holding every connection
+		budget := dix.GlobalWorkerBudget(*config)
+		log.Printf("Indexing every configured chain with %d workers at once", budget.Size())
+		err = dix.LaunchChains(ctx, config.Parachains, budget, func(ctx context.Context, relayChain, chain string, budget *dix.WorkerBudget) error {
+			return indexChain(ctx, *config, relayChain, chain, database, budget, opts)
+		})
+	} else {
+		err = indexChain(ctx, *config, *relayChain, *chain, database, nil, opts)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *selfTest {
+		return
+	}
+
+	// a high rewrite count means this range overlapped an earlier run
+	inserted, updated := database.UpsertCounts()
+	log.Printf("All tasks completed, %d blocks inserted, %d rewritten", inserted, updated)
+	if skipped := database.BlocksWithoutAddresses(); skipped > 0 {
+		log.Printf("WARNING: %d blocks were saved without their addresses, an address2blocks partition is missing", skipped)
+	}
+
+	if stopTracing != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := stopTracing(flushCtx); err != nil {
+			log.Printf("Error exporting the last spans: %v", err)
+		}
+	}
+}
+
+type indexOptions struct {
+	sinceDays int
+	blockTime time.Duration
+	selfTest  bool
+	// gauges of the indexed chains, nil when not served
+	metrics *progressCollector
+	// shared by the chains, nil when max_inflight_batches is not set
+	inflight *dix.InFlightBatches
+	// -max-blocks per chain and where the checkpoints go
+	maxBlocks     int
+	checkpointDir string
+}
+
+// checkSinceDays rejects -since-days with a range set in the configuration,
+// start_range other than the genesis block or end_range other than -1
+func checkSinceDays(sinceDays int, batch dix.DotidxBatch) error {
+	if sinceDays != 0 && (batch.StartRange != dix.GenesisBlockID || batch.EndRange != -1) {
+		return fmt.Errorf("-since-days cannot be combined with start_range=%d end_range=%d",
+			batch.StartRange, batch.EndRange)
+	}
+	return nil
+}
+
+// indexChain indexes the configured range of relayChain:chain. The workers
+// take their slots from budget, nil leaves them unbounded.
+func indexChain(
+	ctx context.Context,
+	config dix.MgrConfig,
+	relayChain, chain string,
+	database *dix.SQLDatabase,
+	budget *dix.WorkerBudget,
+	opts indexOptions) error {
+
+	log.Printf("Starting block ingestion for %s:%s", relayChain, chain)
+
+	// ----------------------------------------------------------------------
+	// ChainReader
+	// ----------------------------------------------------------------------
+	chainReaderURL := dix.ChainreaderURL(config.Parachains[relayChain][chain])
+	reader := dix.NewSidecar(relayChain, chain, chainReaderURL)
+	reader.SetMaxResponseBytes(config.DotidxBatch.MaxResponseBytes)
+	if err := dix.ConfigureSidecar(reader, config.Parachains[relayChain][chain]); err != nil {
+		return err
+	}
+	// Test the sidecar service
+	if err := reader.Ping(); err != nil {
+		return fmt.Errorf("sidecar service test failed: %w", err)
+	}
+	log.Printf("Successfully connected to Sidecar service of %s:%s", relayChain, chain)
+
+	if opts.selfTest {
+		if err := dix.SelfTest(ctx, reader); err != nil {
+			return fmt.Errorf("self-test failed: %w", err)
+		}
+		return nil
+	}
+
+	headBlockID, err := dix.IndexableHeadID(reader, config.DotidxBatch.FinalizedOnly)
+	if err != nil {
+		return fmt.Errorf("failed to fetch head block: %w", err)
+	}
+	log.Printf("Current head block of %s:%s is %d", relayChain, chain, headBlockID)
+	tracked := opts.metrics.track(relayChain, chain, reader)
+	tracked.SetHead(headBlockID)
+
+	if opts.sinceDays != 0 {
+		blockTime := opts.blockTime
+		if blockTime == 0 {
+			fallback := time.Duration(config.Parachains[relayChain][chain].BlockTime)
+			if fallback == 0 {
+				fallback = dix.DefaultBlockTime
+			}
+			blockTime = dix.EstimateBlockTime(ctx, reader, headBlockID, fallback)
+			log.Printf("Average block time is %s", blockTime)
+		}
+		start, end, err := dix.SinceDaysRange(headBlockID, blockTime, opts.sinceDays)
+		if err != nil {
+			return fmt.Errorf("invalid -since-days: %w", err)
+		}
+		config.DotidxBatch.StartRange, config.DotidxBatch.EndRange = start, end
+		log.Printf("Indexing the last %d days: blocks %d to %d", opts.sinceDays, start, end)
+	}
+
+	if config.DotidxBatch.EndRange == -1 && headBlockID == 0 {
+		return fmt.Errorf("cannot get head block and EndRange is not set")
+	}
+
+	if config.DotidxBatch.EndRange == -1 {
+		config.DotidxBatch.EndRange = headBlockID
+	}
+
+	if headBlockID == 0 {
+		headBlockID = config.DotidxBatch.EndRange
+	}
+
 	// Create tables
 	firstBlock, err := reader.FetchBlock(ctx, 1)
 	if err != nil {
-		log.Fatalf("Cannot get block 1: %v", err)
+		return fmt.Errorf("cannot get block 1: %w", err)
 	}
 	firstTimestamp, err := dix.ExtractTimestamp(firstBlock.Extrinsics)
 	if err != nil {
@@ -104,38 +270,72 @@ func main() {
 	}
 	lastBlock, err := reader.FetchBlock(ctx, headBlockID)
 	if err != nil {
-		log.Fatalf("Cannot get head block %d: %v", headBlockID, err)
+		return fmt.Errorf("cannot get head block %d: %w", headBlockID, err)
 	}
 	lastTimestamp, err := dix.ExtractTimestamp(lastBlock.Extrinsics)
 	if err != nil {
 		lastTimestamp = time.Now().Format("2006-01-02 15:04:05")
 	}
 
-	if err := database.CreateTable(*relayChain, *chain, firstTimestamp, lastTimestamp); err != nil {
-		log.Fatalf("Error creating tables: %v", err)
+	if err := database.CreateTable(relayChain, chain, firstTimestamp, lastTimestamp); err != nil {
+		return fmt.Errorf("error creating tables: %w", err)
 	}
 
-	// print some stats
+	// print some stats until the chain is indexed
+	statsCtx, stopStats := context.WithCancel(ctx)
+	defer stopStats()
 	go func() {
-		if err := NewStats(ctx, database, reader).Print(); err != nil {
+		stats := NewStats(statsCtx, database, reader)
+		if config.DotidxBatch.StatsFormat == "json" {
+			stats.SetJSONOutput(os.Stdout)
+		}
+		if err := stats.Print(); err != nil && !errors.Is(err, context.Canceled) {
 			log.Fatalf("Error monitoring stats: %v", err)
 		}
 	}()
 
-	startWorkers(*relayChain, *chain, ctx, *config, database, reader, headBlockID)
-
-	log.Println("All tasks completed")
+	limit := newBlockCap(opts.maxBlocks, opts.checkpointDir, relayChain, chain)
+	return startWorkers(relayChain, chain, ctx, config, database, reader, headBlockID, budget, opts.inflight, limit, tracked)
 }
 
+const (
+	defaultProgressInterval = time.Minute
+	tracingInterval         = 5 * time.Second
+)
+
 func startWorkers(
 	relayChain, chain string,
 	ctx context.Context,
 	config dix.MgrConfig,
 	db dix.Database,
 	reader dix.ChainReader,
-	headID int) {
+	headID int,
+	budget *dix.WorkerBudget,
+	inflight *dix.InFlightBatches,
+	limit *blockCap,
+	tracked *chainProgress) error {
 
 	config.DotidxBatch.EndRange = min(config.DotidxBatch.EndRange, headID)
+	if next, ok := limit.resume(); ok && next > config.DotidxBatch.StartRange && next <= config.DotidxBatch.EndRange {
+		log.Printf("Resuming %s:%s from the checkpoint at block %d", relayChain, chain, next)
+		config.DotidxBatch.StartRange = next
+	}
+
+	// a capped run resumes from the first block it could not save
+	db = limit.track(db)
+
+	// with a save queue, the workers fetch while the database saves and
+	// block when it falls behind. A failed save stops the run, the queue
+	// would refuse every batch fetched afterwards.
+	var saveQueue *dix.SaveQueue
+	if config.DotidxBatch.SaveQueue > 0 {
+		var stopRun context.CancelFunc
+		ctx, stopRun = context.WithCancel(ctx)
+		defer stopRun()
+		saveQueue = dix.NewSaveQueue(db, config.DotidxBatch.SaveQueue, max(config.DotidxBatch.MaxWorkers/2, 1))
+		saveQueue.CancelOnFailure(stopRun)
+		db = saveQueue
+	}
 
 	log.Printf("Starting %d workers to process blocks %d to %d head is at %d",
 		config.DotidxBatch.MaxWorkers, config.DotidxBatch.StartRange, config.DotidxBatch.EndRange, headID)
@@ -146,6 +346,8 @@ func startWorkers(
 	// Create a channel for batch processing
 	batchCh := make(chan []int, config.DotidxBatch.MaxWorkers)
 
+	progress := dix.NewProgress(config.DotidxBatch.EndRange - config.DotidxBatch.StartRange + 1)
+
 	// Create a wait group to wait for all workers to finish
 	var wg sync.WaitGroup
 
@@ -164,6 +366,9 @@ func startWorkers(
 					if !ok {
 						return
 					}
+					if err := budget.Acquire(ctx); err != nil {
+						return
+					}
 					dix.ProcessSingleBlock(
 						ctx,
 						blockID,
@@ -172,6 +377,8 @@ func startWorkers(
 						db,
 						reader,
 					)
+					budget.Release()
+					progress.Done(1)
 				}
 			}
 		}(i)
@@ -191,23 +398,70 @@ func startWorkers(
 					if !ok {
 						return
 					}
-					dix.ProcessBlockBatch(
-						ctx,
+					// the batch is held until saved, a save queue
+					// keeps its slot after the worker moved on
+					batchCtx, done, err := inflight.Acquire(ctx)
+					if err != nil {
+						return
+					}
+					if err := budget.Acquire(ctx); err != nil {
+						done()
+						return
+					}
+					unsaved := dix.ProcessBlockBatch(
+						batchCtx,
 						blockIDs,
 						relayChain,
 						chain,
 						db, reader,
+						config.DotidxBatch.FlushBytes,
 					)
+					limit.failed(unsaved)
+					budget.Release()
+					done()
+					progress.Done(len(blockIDs))
 				}
 			}
 		}(i)
 	}
 
+	progressInterval := time.Duration(config.DotidxBatch.ProgressInterval)
+	if progressInterval <= 0 {
+		progressInterval = defaultProgressInterval
+	}
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	defer stopProgress()
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressCtx.Done():
+				return
+			case <-ticker.C:
+				switch {
+				case saveQueue != nil && inflight != nil:
+					log.Printf("Progress: %s, save backlog %d batches, %d/%d in flight",
+						progress, saveQueue.Backlog(), inflight.InFlight(), inflight.Size())
+				case saveQueue != nil:
+					log.Printf("Progress: %s, save backlog %d batches", progress, saveQueue.Backlog())
+				case inflight != nil:
+					log.Printf("Progress: %s, %d/%d batches in flight", progress, inflight.InFlight(), inflight.Size())
+				default:
+					log.Printf("Progress: %s", progress)
+				}
+			}
+		}
+	}()
+
 	// Get existing blocks from the database, limited to 100k in one go
 	const stepRange = 100000
 	startRange := config.DotidxBatch.StartRange
 	endRange := min(config.DotidxBatch.StartRange+stepRange, config.DotidxBatch.EndRange)
+	// first block left out once the cap is reached
+	stoppedAt := -1
 
+ranges:
 	for startRange <= config.DotidxBatch.EndRange {
 
 		// Collect blocks to process, identifying continuous ranges for batch processing
@@ -233,6 +487,8 @@ func startWorkers(
 			}
 		}
 
+		progress.Skip(known)
+
 		unkown := len(existingBlocks) - known
 		log.Printf("batch [%d, %d] has %d blocks to index", startRange, endRange, unkown)
 
@@ -244,9 +500,7 @@ func startWorkers(
 					select {
 					case <-ctx.Done():
 						log.Println("Block sender stopped due to context cancellation")
-						close(blockCh)
-						close(batchCh)
-						return
+						break ranges
 					case batchCh <- currentBatch:
 						// Batch sent to channel
 						currentBatch = nil
@@ -257,6 +511,11 @@ func startWorkers(
 				continue
 			}
 
+			if limit.reached() {
+				stoppedAt = blockID
+				break
+			}
+
 			// Check if this block is continuous with the previous one
 			if lastBlockID != -1 && blockID == lastBlockID+1 {
 				// Add to the current batch
@@ -267,9 +526,7 @@ func startWorkers(
 					select {
 					case <-ctx.Done():
 						log.Println("Block sender stopped due to context cancellation")
-						close(blockCh)
-						close(batchCh)
-						return
+						break ranges
 					case batchCh <- currentBatch:
 						// Batch sent to channel
 					}
@@ -280,15 +537,14 @@ func startWorkers(
 			}
 
 			lastBlockID = blockID
+			limit.count()
 
 			// If the batch is large enough, send it
 			if len(currentBatch) >= config.DotidxBatch.BatchSize {
 				select {
 				case <-ctx.Done():
 					log.Println("Block sender stopped due to context cancellation")
-					close(blockCh)
-					close(batchCh)
-					return
+					break ranges
 				case batchCh <- currentBatch:
 					// Batch sent to channel
 					currentBatch = nil
@@ -303,21 +559,26 @@ func startWorkers(
 			select {
 			case <-ctx.Done():
 				log.Println("Block sender stopped due to context cancellation")
-				close(blockCh)
-				close(batchCh)
-				return
+				break ranges
 			case batchCh <- currentBatch:
 				// Batch sent to channel
 			}
 		}
+		if stoppedAt != -1 {
+			break
+		}
 
 		startRange = endRange
 		if startRange >= config.DotidxBatch.EndRange {
 			// execution can take a long time and head could move significantly in the meantime
-			headBlockID, err := reader.GetChainHeadID()
+			headBlockID, err := dix.IndexableHeadID(reader, config.DotidxBatch.FinalizedOnly)
 			if err != nil {
 				log.Fatalf("Failed to fetch head block: %v", err)
 			}
+			tracked.SetHead(headBlockID)
+			if headBlockID > config.DotidxBatch.EndRange {
+				progress.Grow(headBlockID - config.DotidxBatch.EndRange)
+			}
 			config.DotidxBatch.EndRange = headBlockID
 			if startRange >= headBlockID {
 				break
@@ -329,7 +590,29 @@ func startWorkers(
 	close(blockCh)
 	close(batchCh)
 
+	// the batches fetched before a cancellation are saved too
 	wg.Wait()
+	if saveQueue != nil {
+		if err := saveQueue.Drain(); err != nil {
+			// the checkpoint stays where it was, the next run fetches the
+			// missing blocks again
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if stoppedAt != -1 {
+		next := limit.next(stoppedAt)
+		if err := limit.stop(relayChain, chain, next); err != nil {
+			log.Printf("Error saving the checkpoint of %s:%s: %v", relayChain, chain, err)
+		}
+		log.Printf("Stopped %s:%s after %d blocks, the next run starts at block %d", relayChain, chain, limit.max, next)
+	} else if err := limit.clear(); err != nil {
+		log.Printf("Error clearing the checkpoint of %s:%s: %v", relayChain, chain, err)
+	}
+	log.Printf("Done: %s", progress)
+	return nil
 }
 
 // Stats struct to track and print statistics
@@ -339,6 +622,8 @@ type Stats struct {
 	tickerHeader *time.Ticker
 	tickerInfo   *time.Ticker
 	context      context.Context
+	// when set, stats are written as one JSON object per line
+	jsonOut io.Writer
 }
 
 // NewStats creates a new Stats instance
@@ -352,6 +637,11 @@ func NewStats(ctx context.Context, db dix.Database, reader dix.ChainReader) *Sta
 	}
 }
 
+// SetJSONOutput switches Print to JSON lines written to w
+func (s *Stats) SetJSONOutput(w io.Writer) {
+	s.jsonOut = w
+}
+
 // Print prints statistics
 func (s *Stats) Print() error {
 	for {
@@ -359,14 +649,76 @@ func (s *Stats) Print() error {
 		case <-s.context.Done():
 			return s.context.Err()
 		case <-s.tickerHeader.C:
-			s.printHeader()
+			if s.jsonOut == nil {
+				s.printHeader()
+			}
 		case <-s.tickerInfo.C:
 			stats := s.db.GetStats()
-			s.printStats(stats)
+			if s.jsonOut == nil {
+				s.printStats(stats)
+				continue
+			}
+			if err := s.printJSON(time.Now(), stats, s.reader.GetStats()); err != nil {
+				log.Printf("Error writing stats: %v", err)
+			}
 		}
 	}
 }
 
+// bucketWindows names the windows of the buckets of dix.Metrics
+var bucketWindows = [...]string{"1d", "1h", "5m", "1m"}
+
+type bucketSnapshot struct {
+	Window      string  `json:"window"`
+	Count       int     `json:"count"`
+	Failures    int     `json:"failures"`
+	Rate        float64 `json:"rate"`
+	FailureRate float64 `json:"failure_rate"`
+	MinMs       int64   `json:"min_ms"`
+	AvgMs       int64   `json:"avg_ms"`
+	MaxMs       int64   `json:"max_ms"`
+}
+
+type statsSnapshot struct {
+	Time        time.Time        `json:"time"`
+	Database    []bucketSnapshot `json:"database"`
+	ChainReader []bucketSnapshot `json:"chain_reader"`
+	// blocks quarantined by the database for a broken parent hash
+	ParentHashMismatches int64 `json:"parent_hash_mismatches"`
+}
+
+func newBucketSnapshots(stats *dix.MetricsStats) []bucketSnapshot {
+	snapshots := make([]bucketSnapshot, 0, len(bucketWindows))
+	if stats == nil {
+		return snapshots
+	}
+	for i, bs := range stats.BucketsStats {
+		snapshots = append(snapshots, bucketSnapshot{
+			Window:      bucketWindows[i],
+			Count:       bs.Count,
+			Failures:    bs.Failures,
+			Rate:        bs.Rate,
+			FailureRate: bs.RateSinceStart(),
+			MinMs:       bs.Min.Milliseconds(),
+			AvgMs:       bs.Avg.Milliseconds(),
+			MaxMs:       bs.Max.Milliseconds(),
+		})
+	}
+	return snapshots
+}
+
+func (s *Stats) printJSON(now time.Time, dbStats, readerStats *dix.MetricsStats) error {
+	snapshot := statsSnapshot{
+		Time:        now,
+		Database:    newBucketSnapshots(dbStats),
+		ChainReader: newBucketSnapshots(readerStats),
+	}
+	if dbStats != nil {
+		snapshot.ParentHashMismatches = dbStats.ParentHashMismatches
+	}
+	return json.NewEncoder(s.jsonOut).Encode(snapshot)
+}
+
 // printStats prints the database statistics
 func (s *Stats) printHeader() {
 	log.Printf("+--- Blocks ----------------|------ Chain Reader ----|------- DBwriter ---------------+")
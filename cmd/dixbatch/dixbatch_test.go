@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func TestStatsPrintJSON(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	database := dix.NewSQLDatabaseWithDB(db)
+	reader := dix.NewSidecar("polkadot", "polkadot", "http://127.0.0.1:10800")
+
+	var out bytes.Buffer
+	stats := NewStats(context.Background(), database, reader)
+	stats.SetJSONOutput(&out)
+
+	dbStats := dix.NewMetricsStats()
+	dbStats.BucketsStats[0] = dix.BucketStats{Count: 90, Failures: 10, Rate: 1.5, Min: 2 * time.Millisecond, Avg: 5 * time.Millisecond, Max: 9 * time.Millisecond}
+	dbStats.ParentHashMismatches = 3
+	readerStats := dix.NewMetricsStats()
+	readerStats.BucketsStats[3] = dix.BucketStats{Count: 4, Rate: 0.5}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := stats.printJSON(now, dbStats, readerStats); err != nil {
+		t.Fatalf("printJSON failed: %v", err)
+	}
+
+	var snapshot statsSnapshot
+	if err := json.Unmarshal(out.Bytes(), &snapshot); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if !snapshot.Time.Equal(now) {
+		t.Errorf("time = %v, want %v", snapshot.Time, now)
+	}
+	if len(snapshot.Database) != 4 || len(snapshot.ChainReader) != 4 {
+		t.Fatalf("expected 4 windows each, got %d and %d", len(snapshot.Database), len(snapshot.ChainReader))
+	}
+	day := snapshot.Database[0]
+	if day.Window != "1d" || day.Count != 90 || day.Failures != 10 || day.FailureRate != 10 {
+		t.Errorf("unexpected database 1d stats: %+v", day)
+	}
+	if day.MinMs != 2 || day.AvgMs != 5 || day.MaxMs != 9 {
+		t.Errorf("unexpected database 1d latencies: %+v", day)
+	}
+	if minute := snapshot.ChainReader[3]; minute.Window != "1m" || minute.Count != 4 || minute.Rate != 0.5 {
+		t.Errorf("unexpected chain reader 1m stats: %+v", minute)
+	}
+	if snapshot.ParentHashMismatches != 3 {
+		t.Errorf("parent_hash_mismatches = %d, want 3", snapshot.ParentHashMismatches)
+	}
+
+	// one object per line
+	if bytes.Count(out.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("expected a single line, got %q", out.String())
+	}
+}
+
+func TestCheckSinceDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    dix.DotidxBatch
+		expected bool
+	}{
+		{"whole chain", dix.DotidxBatch{StartRange: dix.GenesisBlockID, EndRange: -1}, true},
+		{"start_range=1", dix.DotidxBatch{StartRange: 1, EndRange: -1}, false},
+		{"start_range=1000", dix.DotidxBatch{StartRange: 1000, EndRange: -1}, false},
+		{"end_range=1000", dix.DotidxBatch{StartRange: dix.GenesisBlockID, EndRange: 1000}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkSinceDays(7, tt.batch); (err == nil) != tt.expected {
+				t.Errorf("checkSinceDays(7, %+v) = %v", tt.batch, err)
+			}
+			if err := checkSinceDays(0, tt.batch); err != nil {
+				t.Errorf("Expected no -since-days to accept any range, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// savedBlocks is the part of dix.SQLDatabase read by the collector
+type savedBlocks interface {
+	MaxSavedBlock(relayChain, chain string) (int, bool)
+}
+
+// chainProgress is what the collector knows about one chain
+type chainProgress struct {
+	relayChain string
+	chain      string
+	reader     dix.ChainReader
+	head       atomic.Int64
+}
+
+// SetHead records the head of the chain, it is safe on a nil progress
+func (p *chainProgress) SetHead(head int) {
+	if p != nil {
+		p.head.Store(int64(head))
+	}
+}
+
+// progressCollector exposes the indexing progress of every chain indexed by
+// the process as Prometheus gauges labeled by relay_chain and chain
+type progressCollector struct {
+	database savedBlocks
+	mu       sync.Mutex
+	chains   []*chainProgress
+	inflight *dix.InFlightBatches
+
+	indexedMaxBlock *prometheus.Desc
+	headBlock       *prometheus.Desc
+	lag             *prometheus.Desc
+	rate            *prometheus.Desc
+	inflightBatches *prometheus.Desc
+}
+
+func newProgressCollector(database savedBlocks) *progressCollector {
+	labels := []string{"relay_chain", "chain"}
+	return &progressCollector{
+		database: database,
+		indexedMaxBlock: prometheus.NewDesc("dotidx_indexed_max_block",
+			"Highest block saved by this process", labels, nil),
+		headBlock: prometheus.NewDesc("dotidx_head_block",
+			"Head of the chain as last seen by the indexer", labels, nil),
+		lag: prometheus.NewDesc("dotidx_lag_blocks",
+			"Blocks between the head and the highest saved block", labels, nil),
+		rate: prometheus.NewDesc("dotidx_fetch_rate_blocks_per_second",
+			"Blocks fetched per second from the chain reader over the last minute", labels, nil),
+		inflightBatches: prometheus.NewDesc("dotidx_inflight_batches",
+			"Batches fetched and not yet saved, across all the chains", nil, nil),
+	}
+}
+
+// track adds a chain, its rate is read from the metrics of reader. It
+// returns nil on a nil collector.
+func (c *progressCollector) track(relayChain, chain string, reader dix.ChainReader) *chainProgress {
+	if c == nil {
+		return nil
+	}
+	p := &chainProgress{relayChain: relayChain, chain: chain, reader: reader}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chains = append(c.chains, p)
+	return p
+}
+
+// watchInFlight exposes the batches held by inflight, nil when there is no
+// limit
+func (c *progressCollector) watchInFlight(inflight *dix.InFlightBatches) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inflight = inflight
+}
+
+func (c *progressCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.indexedMaxBlock
+	ch <- c.headBlock
+	ch <- c.lag
+	ch <- c.rate
+	ch <- c.inflightBatches
+}
+
+func (c *progressCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	chains := append([]*chainProgress(nil), c.chains...)
+	inflight := c.inflight
+	c.mu.Unlock()
+
+	if inflight != nil {
+		ch <- prometheus.MustNewConstMetric(c.inflightBatches, prometheus.GaugeValue, float64(inflight.InFlight()))
+	}
+
+	for _, p := range chains {
+		head := float64(p.head.Load())
+		ch <- prometheus.MustNewConstMetric(c.headBlock, prometheus.GaugeValue, head, p.relayChain, p.chain)
+		if saved, ok := c.database.MaxSavedBlock(p.relayChain, p.chain); ok {
+			ch <- prometheus.MustNewConstMetric(c.indexedMaxBlock, prometheus.GaugeValue, float64(saved), p.relayChain, p.chain)
+			ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, max(head-float64(saved), 0), p.relayChain, p.chain)
+		}
+		rate := 0.0
+		if stats := p.reader.GetStats(); stats != nil {
+			// the last bucket is the 1 minute window, see bucketWindows
+			rate = stats.BucketsStats[len(stats.BucketsStats)-1].Rate
+		}
+		ch <- prometheus.MustNewConstMetric(c.rate, prometheus.GaugeValue, rate, p.relayChain, p.chain)
+	}
+}
+
+// metricsHandler serves the gauges of collector and the build information
+// on GET /metrics, and GET /version
+func metricsHandler(collector *progressCollector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector, dix.NewBuildInfoCollector())
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /version", dix.HandleVersion)
+	return mux
+}
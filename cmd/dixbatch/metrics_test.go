@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+type fixedSaved map[string]int
+
+func (f fixedSaved) MaxSavedBlock(relayChain, chain string) (int, bool) {
+	block, ok := f[relayChain+":"+chain]
+	return block, ok
+}
+
+// ratedReader reports a fixed rate in its 1 minute bucket
+type ratedReader struct {
+	dix.ChainReader
+	rate float64
+}
+
+func (r *ratedReader) GetStats() *dix.MetricsStats {
+	stats := dix.NewMetricsStats()
+	stats.BucketsStats[3].Rate = r.rate
+	return stats
+}
+
+func TestMetricsPerChain(t *testing.T) {
+	collector := newProgressCollector(fixedSaved{"polkadot:polkadot": 90, "kusama:assethub": 480})
+	collector.track("polkadot", "polkadot", &ratedReader{rate: 12.5}).SetHead(100)
+	collector.track("kusama", "assethub", &ratedReader{rate: 3}).SetHead(500)
+	inflight := dix.NewInFlightBatches(4)
+	collector.watchInFlight(inflight)
+	if _, _, err := inflight.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	server := httptest.NewServer(metricsHandler(collector))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Error scraping: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics: %v", err)
+	}
+
+	for _, series := range []string{
+		`dotidx_indexed_max_block{chain="polkadot",relay_chain="polkadot"} 90`,
+		`dotidx_head_block{chain="polkadot",relay_chain="polkadot"} 100`,
+		`dotidx_lag_blocks{chain="polkadot",relay_chain="polkadot"} 10`,
+		`dotidx_fetch_rate_blocks_per_second{chain="polkadot",relay_chain="polkadot"} 12.5`,
+		`dotidx_indexed_max_block{chain="assethub",relay_chain="kusama"} 480`,
+		`dotidx_head_block{chain="assethub",relay_chain="kusama"} 500`,
+		`dotidx_lag_blocks{chain="assethub",relay_chain="kusama"} 20`,
+		`dotidx_fetch_rate_blocks_per_second{chain="assethub",relay_chain="kusama"} 3`,
+		`dotidx_inflight_batches 1`,
+		`dotidx_build_info{`,
+	} {
+		if !strings.Contains(string(body), series) {
+			t.Errorf("Missing %s in\n%s", series, body)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"flag"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -15,7 +17,11 @@ import (
 func main() {
 
 	configFile := flag.String("conf", "", "toml configuration file")
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixcron", *showVersion) {
+		return
+	}
 
 	if configFile == nil || *configFile == "" {
 		log.Fatal("Configuration file must be specified")
@@ -32,6 +38,7 @@ func main() {
 
 	database := dix.NewSQLDatabase(*config)
 	database.CreateTableMonthlyQueryResults()
+	database.CreateTableRangeQueryResults()
 	addRegisteredQueries()
 
 	if err := database.Ping(); err != nil {
@@ -40,66 +47,46 @@ func main() {
 
 	log.Printf("Successfully connected to database %s", dix.DBUrlSecure(*config))
 
-	cronMonthly := time.NewTicker(24 * time.Hour)
-	go func() {
-		fillRegisteredQueries(context.Background(), cronMonthly, database)
-	}()
-
-	cronTicker := time.NewTicker(1 * time.Hour)
-	computeIndexedBlocks(context.Background(), cronTicker, database)
-}
-
-func addRegisteredQueries() (err error) {
-
-	err = dix.RegisterQuery(
-		"total_blocks_in_month",
-		`
-SELECT COUNT(*) as total_blocks
-FROM
-  chain.blocks_{{.Relaychain}}_{{.Chain}}
-WHERE
-  EXTRACT(YEAR FROM created_at) = {{.Year}}
-AND
-  EXTRACT(MONTH FROM created_at) = {{.Month}};
-`,
-		"Counts total blocks in a given month and year.",
-	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dix.SetupSignalHandler(cancel)
 
+	cron := config.DotidxCron
+	if cron.Backup != "" && cron.Backup != scheduleOff && cron.BackupCommand == "" {
+		log.Fatalf("Invalid configuration: dotidx_cron backup is scheduled without a backup_command")
+	}
+	vacuum := config.DotidxDB.MaintenanceVacuum
+	jobs, err := newJobs([]jobSpec{
+		{"stats", cron.Stats, "@hourly", func(ctx context.Context) { computeIndexedBlocks(ctx, database) }},
+		{"queries", cron.Queries, "@daily", func(ctx context.Context) { computeRegisteredQueries(database) }},
+		{"partitions", cron.Partitions, "@daily", func(ctx context.Context) { extendAllPartitions(database) }},
+		{"analyze", cron.Analyze, "", func(ctx context.Context) { maintainAllPartitions(ctx, database, vacuum) }},
+		{"backup", cron.Backup, "", func(ctx context.Context) { runBackup(ctx, cron.BackupCommand, config.DotidxBackup) }},
+	})
 	if err != nil {
-		log.Printf("Error registering query 'total_blocks_in_month': %v", err)
-	}
-
-	err = dix.RegisterQuery(
-		"total_addresses_in_month",
-		`
-WITH Boundaries (minBlock, maxBlock) AS (
-    SELECT
-        MIN(block_id) AS minBlock,
-        MAX(block_id) AS maxBlock
-    FROM
-        chain.blocks_{{.Relaychain}}_{{.Chain}}
-    WHERE
-        EXTRACT(YEAR FROM created_at) = {{.Year}}
-    AND
-        EXTRACT(MONTH FROM created_at) = {{.Month}}
-)
-SELECT
-  count(distinct address) AS total_addresses
-FROM
-  chain.address2blocks_{{.Relaychain}}_{{.Chain}}
-WHERE
-  block_id <= (SELECT maxBlock FROM Boundaries)
-AND
-  block_id >= (SELECT minBlock FROM Boundaries)
-;
-`,
-		"Counts unique addresses active in a given month and year.",
-	)
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	if err != nil {
-		log.Printf("Error registering query 'total_addresses_in_month': %v", err)
+	// the months not computed yet are filled at startup, as before the
+	// queries job existed
+	go computeRegisteredQueries(database)
+
+	// maintenance_interval predates the analyze schedule and still works
+	// when the latter is not set
+	if interval := time.Duration(config.DotidxDB.MaintenanceInterval); interval > 0 && cron.Analyze == "" {
+		maintenanceTicker := time.NewTicker(interval)
+		go func() {
+			maintainPartitions(ctx, maintenanceTicker, database, vacuum)
+		}()
 	}
 
+	runScheduler(ctx, jobs)
+}
+
+func addRegisteredQueries() (err error) {
+	if err = dix.RegisterMonthlyQueries(); err != nil {
+		log.Printf("%v", err)
+	}
 	return
 }
 
@@ -131,6 +118,13 @@ func computeRegisteredQuery(db dix.Database, relayChain, chain string) (err erro
 					log.Printf("Error %s for %s/%s - %d/%d", query.Name, relayChain, chain, year, month)
 				}
 			}
+			// the current year is rolled up over its complete months
+			months, err := db.RollupYear(context.Background(), relayChain, chain, query.Name, year)
+			if err != nil {
+				log.Printf("Error rolling up %s for %s/%s - %d: %v", query.Name, relayChain, chain, year, err)
+			} else if months > 0 {
+				log.Printf("Rolled up %s for %s/%s - %d over %d months", query.Name, relayChain, chain, year, months)
+			}
 		}
 	}
 	return
@@ -155,42 +149,81 @@ func computeRegisteredQueries(db dix.Database) {
 	}
 }
 
-func fillRegisteredQueries(ctx context.Context, ticker *time.Ticker, db dix.Database) {
-	computeRegisteredQueries(db)
-	for {
-		select {
-		case <-ctx.Done():
-			break
-		case <-ticker.C:
-			computeRegisteredQueries(db)
+func computeIndexedBlocks(ctx context.Context, db dix.Database) {
+	currentYear, currentMonth, _ := time.Now().Date()
+	infos, err := db.GetDatabaseInfo()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	for i := range infos {
+		info := infos[i]
+		if err := db.ExecuteAndStoreNamedQuery(
+			ctx,
+			info.Relaychain, info.Chain,
+			"total_blocks_in_month",
+			currentYear, int(currentMonth)); err != nil {
+			log.Printf("Error executing and storing query '%s' for %s/%s - %d/%d: %v",
+				"total_blocks_in_month", info.Relaychain, info.Chain, currentYear, int(currentMonth), err)
+		}
+		log.Printf("Computed total_blocks_in_month for %s/%s - %d/%d", info.Relaychain, info.Chain, currentYear, int(currentMonth))
+	}
+}
+
+// extendAllPartitions creates the monthly partitions of the blocks tables
+// which do not exist yet, up to the end of next year
+func extendAllPartitions(db *dix.SQLDatabase) {
+	infos, err := db.GetDatabaseInfo()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	for _, info := range infos {
+		if err := db.CreateTableBlocksPartitions(info.Relaychain, info.Chain, "", ""); err != nil {
+			log.Printf("Extending the partitions of %s:%s failed: %v", info.Relaychain, info.Chain, err)
+			continue
+		}
+		log.Printf("Extended the partitions of %s:%s", info.Relaychain, info.Chain)
+	}
+}
+
+// runBackup runs command with the shell, DOTIDX_BACKUP tells it where the
+// backups go
+func runBackup(ctx context.Context, command, backupDir string) {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), "DOTIDX_BACKUP="+backupDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Backup failed: %v\n%s", err, output)
+		return
+	}
+	log.Printf("Backup done: %s", strings.TrimSpace(string(output)))
+}
+
+func maintainAllPartitions(ctx context.Context, db *dix.SQLDatabase, vacuum bool) {
+	infos, err := db.GetDatabaseInfo()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	for _, info := range infos {
+		partitions, err := db.MaintainPartitions(ctx, info.Relaychain, info.Chain, vacuum, time.Now().UTC())
+		if err != nil {
+			log.Printf("Maintenance of %s:%s failed: %v", info.Relaychain, info.Chain, err)
+			continue
 		}
+		log.Printf("Maintained %d partitions for %s:%s", len(partitions), info.Relaychain, info.Chain)
 	}
 }
 
-func computeIndexedBlocks(ctx context.Context, ticker *time.Ticker, db dix.Database) {
+func maintainPartitions(ctx context.Context, ticker *time.Ticker, db *dix.SQLDatabase, vacuum bool) {
+	maintainAllPartitions(ctx, db, vacuum)
 	for {
 		select {
 		case <-ctx.Done():
-			break
+			return
 		case <-ticker.C:
-			currentYear, currentMonth, _ := time.Now().Date()
-			infos, err := db.GetDatabaseInfo()
-			if err != nil {
-				log.Printf("%v", err)
-				return
-			}
-			for i := range infos {
-				info := infos[i]
-				if err := db.ExecuteAndStoreNamedQuery(
-					context.Background(),
-					info.Relaychain, info.Chain,
-					"total_blocks_in_month",
-					currentYear, int(currentMonth)); err != nil {
-					log.Printf("Error executing and storing query '%s' for %s/%s - %d/%d: %v",
-						"total_blocks_in_month", info.Relaychain, info.Chain, currentYear, int(currentMonth), err)
-				}
-				log.Printf("Computed total_blocks_in_month for %s/%s - %d/%d", info.Relaychain, info.Chain, currentYear, int(currentMonth))
-			}
+			maintainAllPartitions(ctx, db, vacuum)
 		}
 	}
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// scheduleOff disables a job in the dotidx_cron section
+const scheduleOff = "off"
+
+// jobSpec describes a job before its schedule is parsed, spec is the
+// configured schedule and fallback the one used when spec is empty
+type jobSpec struct {
+	name     string
+	spec     string
+	fallback string
+	run      func(ctx context.Context)
+}
+
+// job is a maintenance task run by dixcron on a cron schedule
+type job struct {
+	name     string
+	schedule dix.Schedule
+	run      func(ctx context.Context)
+	// set while run is in progress, a job is never run twice at once
+	running atomic.Bool
+}
+
+// newJobs parses the schedules of specs and leaves out the disabled jobs
+func newJobs(specs []jobSpec) ([]*job, error) {
+	jobs := make([]*job, 0, len(specs))
+	for _, spec := range specs {
+		expr := spec.spec
+		if expr == "" {
+			expr = spec.fallback
+		}
+		if expr == "" || expr == scheduleOff {
+			continue
+		}
+		schedule, err := dix.ParseSchedule(expr)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", spec.name, err)
+		}
+		jobs = append(jobs, &job{name: spec.name, schedule: schedule, run: spec.run})
+	}
+	return jobs, nil
+}
+
+// dueJobs returns the jobs whose schedule fires during the minute of now
+func dueJobs(jobs []*job, now time.Time) []*job {
+	var due []*job
+	for _, j := range jobs {
+		if j.schedule.Matches(now) {
+			due = append(due, j)
+		}
+	}
+	return due
+}
+
+// start runs the job unless the previous run is still going
+func (j *job) start(ctx context.Context) {
+	if !j.running.CompareAndSwap(false, true) {
+		log.Printf("Skipping %s, the previous run is not finished", j.name)
+		return
+	}
+	defer j.running.Store(false)
+	log.Printf("Running %s", j.name)
+	start := time.Now()
+	j.run(ctx)
+	log.Printf("Finished %s in %s, next run at %s", j.name, time.Since(start).Round(time.Second), j.schedule.Next(time.Now()).Format(time.DateTime))
+}
+
+// runScheduler wakes up at the start of every minute and starts the jobs due
+// then, until ctx is done
+func runScheduler(ctx context.Context, jobs []*job) {
+	for _, j := range jobs {
+		log.Printf("Scheduled %s at %q, next run at %s", j.name, j.schedule, j.schedule.Next(time.Now()).Format(time.DateTime))
+	}
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case tick := <-timer.C:
+			for _, j := range dueJobs(jobs, tick) {
+				go j.start(ctx)
+			}
+		}
+	}
+}
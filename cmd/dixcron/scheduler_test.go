@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewJobs(t *testing.T) {
+	noop := func(ctx context.Context) {}
+	jobs, err := newJobs([]jobSpec{
+		{"stats", "", "@hourly", noop},
+		{"queries", "30 2 * * *", "@daily", noop},
+		{"partitions", "off", "@daily", noop},
+		{"backup", "", "", noop},
+	})
+	if err != nil {
+		t.Fatalf("newJobs: %v", err)
+	}
+	var names []string
+	for _, j := range jobs {
+		names = append(names, j.name)
+	}
+	if !slices.Equal(names, []string{"stats", "queries"}) {
+		t.Errorf("Expected the stats and queries jobs, got %v", names)
+	}
+	if jobs[0].schedule.String() != "@hourly" || jobs[1].schedule.String() != "30 2 * * *" {
+		t.Errorf("Unexpected schedules %s and %s", jobs[0].schedule, jobs[1].schedule)
+	}
+
+	if _, err := newJobs([]jobSpec{{"stats", "61 * * * *", "", noop}}); err == nil {
+		t.Errorf("Expected an invalid schedule to be rejected")
+	}
+}
+
+func TestDueJobs(t *testing.T) {
+	noop := func(ctx context.Context) {}
+	jobs, err := newJobs([]jobSpec{
+		{"stats", "", "@hourly", noop},
+		{"queries", "", "@daily", noop},
+		{"analyze", "*/30 * * * *", "", noop},
+	})
+	if err != nil {
+		t.Fatalf("newJobs: %v", err)
+	}
+	tests := []struct {
+		time string
+		due  []string
+	}{
+		{"2026-10-16 00:00:12", []string{"stats", "queries", "analyze"}},
+		{"2026-10-16 13:00:00", []string{"stats", "analyze"}},
+		{"2026-10-16 13:30:00", []string{"analyze"}},
+		{"2026-10-16 13:31:00", nil},
+	}
+	for _, tc := range tests {
+		now, _ := time.Parse(time.DateTime, tc.time)
+		var due []string
+		for _, j := range dueJobs(jobs, now) {
+			due = append(due, j.name)
+		}
+		if !slices.Equal(due, tc.due) {
+			t.Errorf("At %s: expected %v, got %v", tc.time, tc.due, due)
+		}
+	}
+}
+
+func TestJobDoesNotOverlap(t *testing.T) {
+	release := make(chan struct{})
+	runs := 0
+	j := &job{name: "slow", run: func(ctx context.Context) {
+		runs++
+		<-release
+	}}
+	done := make(chan struct{})
+	go func() {
+		j.start(context.Background())
+		close(done)
+	}()
+	for !j.running.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	// returns at once, the first run holds the job
+	j.start(context.Background())
+	close(release)
+	<-done
+	if runs != 1 {
+		t.Errorf("Expected 1 run, got %d", runs)
+	}
+}
@@ -15,9 +15,9 @@ import (
 )
 
 const (
-	// Average block time for Polkadot (6 seconds)
+	// Expected block time for Polkadot, used if it cannot be measured
 	polkadotBlockTime = 6 * time.Second
-	// Average block time for AssetHub (12 seconds)
+	// Expected block time for AssetHub, used if it cannot be measured
 	assetHubBlockTime = 12 * time.Second
 	// Number of days to index
 	testDays = 10
@@ -56,7 +56,11 @@ type QueryResult struct {
 
 func main() {
 	configFile := flag.String("conf", "conf/conf-e2e-test.toml", "toml configuration file")
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixe2e", *showVersion) {
+		return
+	}
 
 	if configFile == nil || *configFile == "" {
 		log.Fatal("Configuration file must be specified")
@@ -134,13 +138,13 @@ func main() {
 		}
 		log.Printf("✓ Current head block: %d", headBlockID)
 
+		chainCfg.AvgBlockTime = dix.EstimateBlockTime(ctx, reader, headBlockID, chainCfg.AvgBlockTime)
+		log.Printf("✓ Average block time: %s", chainCfg.AvgBlockTime)
+
 		// Calculate block range for last 10 days
-		blocksPerDay := int(24 * time.Hour / chainCfg.AvgBlockTime)
-		blocksToIndex := blocksPerDay * testDays
-		chainCfg.EndBlock = headBlockID
-		chainCfg.StartBlock = headBlockID - blocksToIndex
-		if chainCfg.StartBlock < 1 {
-			chainCfg.StartBlock = 1
+		chainCfg.StartBlock, chainCfg.EndBlock, err = dix.SinceDaysRange(headBlockID, chainCfg.AvgBlockTime, testDays)
+		if err != nil {
+			log.Fatalf("✗ Cannot compute block range for %s: %v", chainCfg.Chain, err)
 		}
 
 		log.Printf("✓ Block range calculated: %d to %d (%d blocks, ~%d days)",
@@ -271,7 +275,7 @@ func indexChain(ctx context.Context, config *dix.MgrConfig, db dix.Database, cha
 					if !ok {
 						return
 					}
-					dix.ProcessBlockBatch(ctx, blockIDs, chainCfg.RelayChain, chainCfg.Chain, db, reader)
+					dix.ProcessBlockBatch(ctx, blockIDs, chainCfg.RelayChain, chainCfg.Chain, db, reader, config.DotidxBatch.FlushBytes)
 					mu.Lock()
 					chainCfg.BlocksIndexed += len(blockIDs)
 					mu.Unlock()
@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,7 +24,14 @@ func main() {
 
 	configFile := flag.String("conf", "", "toml configuration file")
 	overridePort := flag.Int("port", -1, "override default port in configuration file")
+	overrideAdminPort := flag.Int("admin-port", -1, "override admin port in configuration file, 0 disables it")
+	liveURL := flag.String("live", "", "url of the event stream of dixlive, e.g. http://127.0.0.1:8090, to drop the cached pages of the addresses of its new blocks")
+	explainSlow := flag.Duration("explain-slow", 0, "debug: log the plan of the queries slower than this, overrides explain_slow_queries")
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixfe", *showVersion) {
+		return
+	}
 
 	config, err := dix.LoadMgrConfig(*configFile)
 	if err != nil {
@@ -31,6 +41,15 @@ func main() {
 	if *overridePort != -1 && *overridePort > 1024 {
 		config.DotidxFE.Port = *overridePort
 	}
+	if *overrideAdminPort != -1 {
+		config.DotidxFE.AdminPort = *overrideAdminPort
+	}
+	if *explainSlow > 0 {
+		config.DotidxFE.ExplainSlowQueries = dix.Duration(*explainSlow)
+	}
+	if err := validateListeners(config.DotidxFE); err != nil {
+		log.Fatalf("Invalid frontend configuration: %v", err)
+	}
 
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
@@ -53,31 +72,107 @@ func main() {
 	}
 
 	database := dix.NewSQLDatabaseWithDB(db)
+	database.SetDebugSQL(config.DotidxDB.DebugSQL)
 	if err := database.Ping(); err != nil {
 		log.Fatalf("Failed to ping PostgreSQL: %v", err)
 	}
 	log.Printf("Successfully connected to database %s", dix.DBUrlSecure(*config))
 
+	// the admin endpoints refresh the same statistics as dixcron
+	if err := dix.RegisterMonthlyQueries(); err != nil {
+		log.Printf("%v", err)
+	}
+
 	// ----------------------------------------------------------------------
 	// REST Frontend
 	// ----------------------------------------------------------------------
 	frontend := NewFrontend(database, db, *config)
 
+	if dix.HasDBReplica(*config) {
+		replica, err := sql.Open("postgres", dix.DBReplicaUrl(*config))
+		if err != nil {
+			log.Fatalf("Error opening read replica: %v", err)
+		}
+		defer replica.Close()
+		if err := replica.Ping(); err != nil {
+			log.Fatalf("Failed to ping read replica: %v", err)
+		}
+		log.Printf("Successfully connected to read replica %s", dix.DBReplicaUrlSecure(*config))
+		frontend.SetReplica(replica)
+	}
+
+	if *liveURL != "" && frontend.addressCache != nil {
+		frontend.watchLiveAddresses(ctx, *liveURL)
+	}
+
 	if err := frontend.Start(ctx.Done()); err != nil {
 		log.Printf("Error starting frontend server: %v", err)
 	}
 }
 
+const defaultQueryTimeout = 30 * time.Second
+
+// a cached page can miss the blocks indexed since, for that long at most
+const defaultAddressCacheTTL = 30 * time.Second
+
+const defaultAdminIP = "127.0.0.1"
+
+// validateListeners checks that the admin listener is private and does not
+// collide with the public one
+func validateListeners(config dix.DotidxFE) error {
+	if config.Port <= 0 || config.Port > 65535 {
+		return fmt.Errorf("invalid port %d", config.Port)
+	}
+	if config.AdminPort == 0 {
+		return nil
+	}
+	if config.AdminPort < 0 || config.AdminPort > 65535 {
+		return fmt.Errorf("invalid admin_port %d", config.AdminPort)
+	}
+	adminIP := config.AdminIP
+	if adminIP == "" {
+		adminIP = defaultAdminIP
+	}
+	ip := net.ParseIP(adminIP)
+	if ip == nil {
+		return fmt.Errorf("invalid admin_ip %q", adminIP)
+	}
+	if !ip.IsLoopback() && !ip.IsPrivate() {
+		return fmt.Errorf("admin_ip %s is neither a loopback nor a private address", adminIP)
+	}
+	if config.AdminPort == config.Port {
+		publicIP := net.ParseIP(config.IP)
+		if config.IP == "" || publicIP == nil || publicIP.IsUnspecified() || publicIP.Equal(ip) {
+			return fmt.Errorf("admin_port %d collides with the public port", config.AdminPort)
+		}
+	}
+	return nil
+}
+
 // Frontend handles the REST API for dix
 type Frontend struct {
 	// abstraction
 	database *dix.SQLDatabase
 	// underlying db
 	db *sql.DB
+	// optional read-only replica, nil means read from db
+	replica *sql.DB
+	// maximum duration of a database query issued by a request
+	queryTimeout time.Duration
+	// queries slower than this get their plan logged, 0 disables it
+	explainThreshold time.Duration
+	// pages of blocks per address and chain, nil when disabled. They
+	// expire after address_cache_ttl, or as soon as dixlive streams a new
+	// block of the address when dixfe is started with -live.
+	addressCache *dix.Cache[addressCacheKey, []dix.BlockData]
+	// answer of /schema, for schemaCacheTTL
+	schemaCache *dix.Cache[schemaCacheKey, SchemaResponse]
 	// general configuration
 	config dix.MgrConfig
 	// address where FE is exposed
 	listenAddr string
+	// private address for admin and metrics, empty means not served
+	adminAddr string
 	// 1 only for the whole FE
 	metricsHandler *dix.Metrics
 	// path to the directory with the static files
@@ -105,53 +200,173 @@ func NewFrontend(database *dix.SQLDatabase, db *sql.DB, config dix.MgrConfig) *F
 			sidecars[relay][chain] = remote.String()
 		}
 	}
+	adminAddr := ""
+	if config.DotidxFE.AdminPort > 0 {
+		adminIP := config.DotidxFE.AdminIP
+		if adminIP == "" {
+			adminIP = defaultAdminIP
+		}
+		adminAddr = net.JoinHostPort(adminIP, strconv.Itoa(config.DotidxFE.AdminPort))
+	}
+	queryTimeout := time.Duration(config.DotidxFE.QueryTimeout)
+	if queryTimeout <= 0 {
+		queryTimeout = defaultQueryTimeout
+	}
+	addressCacheTTL := time.Duration(config.DotidxFE.AddressCacheTTL)
+	if addressCacheTTL <= 0 {
+		addressCacheTTL = defaultAddressCacheTTL
+	}
 	return &Frontend{
-		database:       database,
-		db:             db,
-		config:         config,
-		listenAddr:     listenAddr,
-		metricsHandler: dix.NewMetrics("Frontend"),
-		staticPath:     config.DotidxFE.StaticPath,
-		sidecars:       sidecars,
-		proxys:         proxys,
+		database:         database,
+		db:               db,
+		config:           config,
+		queryTimeout:     queryTimeout,
+		explainThreshold: time.Duration(config.DotidxFE.ExplainSlowQueries),
+		addressCache:     dix.NewCache[addressCacheKey, []dix.BlockData](config.DotidxFE.AddressCacheSize, addressCacheTTL),
+		schemaCache:      dix.NewCache[schemaCacheKey, SchemaResponse](1, schemaCacheTTL),
+		listenAddr:       listenAddr,
+		adminAddr:        adminAddr,
+		metricsHandler:   dix.NewMetrics("Frontend"),
+		staticPath:       config.DotidxFE.StaticPath,
+		sidecars:         sidecars,
+		proxys:           proxys,
 	}
 }
 
-// Start initializes and starts the HTTP server
-func (f *Frontend) Start(cancelCtx <-chan struct{}) error {
-	mux := http.NewServeMux()
+// SetReplica routes the frontend read queries to a read-only replica
+func (f *Frontend) SetReplica(replica *sql.DB) {
+	f.replica = replica
+}
 
-	log.Printf("Serving at http://%s/index.html", f.listenAddr)
+// readDB returns the pool used for read queries
+func (f *Frontend) readDB() *sql.DB {
+	if f.replica != nil {
+		return f.replica
+	}
+	return f.db
+}
+
+// queryContext bounds the database queries of a request; the driver cancels
+// the running statement when the deadline expires.
+func (f *Frontend) queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), f.queryTimeout)
+}
+
+// queryError wraps a failed query with the context error, if any, so that a
+// timeout can be detected with errors.Is whatever the driver returned.
+func queryError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("database query failed: %w (%v)", ctxErr, err)
+	}
+	return fmt.Errorf("database query failed: %w", err)
+}
+
+// writeQueryError answers 504 when the query timed out and 500 otherwise
+func writeQueryError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Query timeout", http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// publicRoutes returns the handler of the public listener
+func (f *Frontend) publicRoutes() http.Handler {
+	mux := http.NewServeMux()
 
 	// serving static files for convenience
-	log.Printf("Serving static files from: %s", f.staticPath)
 	fs := http.FileServer(http.Dir(f.staticPath))
 
 	mux.Handle("GET /index.html", http.StripPrefix("/", fs))
 	mux.Handle("GET /", http.StripPrefix("/", fs))
 
+	mux.HandleFunc("GET /health", f.handleHealth)
+	mux.HandleFunc("GET /ready", f.handleReady)
+	mux.HandleFunc("GET /version", dix.HandleVersion)
+	mux.HandleFunc("GET /schema", f.handleSchema)
+
 	// fe functions
 	mux.HandleFunc("GET /fe/address2blocks", f.handleAddressToBlocks)
 	mux.HandleFunc("GET /fe/balances", f.handleBalances)
 	mux.HandleFunc("GET /fe/staking", f.handleStaking)
 	mux.HandleFunc("GET /fe/stats/completion_rate", f.handleCompletionRate)
 	mux.HandleFunc("GET /fe/stats/per_month", f.handleStatsPerMonth)
+	mux.HandleFunc("GET /fe/runtime/upgrades", f.handleRuntimeUpgrades)
+	// named queries
+	mux.HandleFunc("GET /queries", f.handleListQueries)
+	mux.HandleFunc("GET /queries/{name}/result", f.handleQueryResult)
+	mux.HandleFunc("GET /queries/{name}/result.csv", f.handleQueryResultCSV)
 	// per chain
 	mux.HandleFunc("GET /fe/{relay}/{chain}/blocks/{blockid}", f.handleBlock)
 	// proxy to sidecar
 	mux.HandleFunc("GET /proxy/{relay}/{chain}/accounts/{address}/balance-info", f.handleProxy)
 	mux.HandleFunc("GET /proxy/{relay}/{chain}/blocks/head/header", f.handleProxy)
 
-	server := &http.Server{
-		Addr:    f.listenAddr,
-		Handler: mux,
+	return mux
+}
+
+// privateRoutes returns the handler of the admin listener
+func (f *Frontend) privateRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", f.handleMetrics)
+	// admin, behind a bearer token
+	mux.Handle("/admin/", f.adminRoutes())
+	return mux
+}
+
+// Start initializes and starts the HTTP servers
+func (f *Frontend) Start(cancelCtx <-chan struct{}) error {
+	listeners, err := f.listen()
+	if err != nil {
+		return err
 	}
+	return f.serve(listeners, cancelCtx)
+}
 
-	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
+// listen binds the public listener and, when configured, the admin one so
+// that an unavailable port is reported before serving
+func (f *Frontend) listen() ([]net.Listener, error) {
+	addrs := []string{f.listenAddr}
+	if f.adminAddr != "" {
+		addrs = append(addrs, f.adminAddr)
+	}
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("cannot listen on %s: %w", addr, err)
 		}
-	}()
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// serve runs the public routes on listeners[0] and the private ones on
+// listeners[1] if present until cancelCtx is closed
+func (f *Frontend) serve(listeners []net.Listener, cancelCtx <-chan struct{}) error {
+	log.Printf("Serving at http://%s/index.html", listeners[0].Addr())
+	log.Printf("Serving static files from: %s", f.staticPath)
+
+	servers := []*http.Server{{
+		Handler: f.publicRoutes(),
+	}}
+	if len(listeners) > 1 {
+		log.Printf("Serving admin and metrics at http://%s", listeners[1].Addr())
+		servers = append(servers, &http.Server{
+			Handler: f.privateRoutes(),
+		})
+	}
+
+	for i, server := range servers {
+		go func() {
+			if err := server.Serve(listeners[i]); err != http.ErrServerClosed {
+				log.Printf("HTTP server error on %s: %v", listeners[i].Addr(), err)
+			}
+		}()
+	}
 
 	// Wait for cancel context
 	<-cancelCtx
@@ -160,8 +375,10 @@ func (f *Frontend) Start(cancelCtx <-chan struct{}) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server shutdown error: %w", err)
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			return fmt.Errorf("server shutdown error: %w", err)
+		}
 	}
 
 	return nil
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -194,3 +201,1353 @@ func TestFrontendStart(t *testing.T) {
 		t.Fatalf("Timeout waiting for server to shut down")
 	}
 }
+
+func TestFrontendServesHealth(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectPing()
+
+	config := dix.MgrConfig{DotidxFE: dix.DotidxFE{IP: "127.0.0.1"}}
+	frontend := NewFrontend(nil, db, config)
+	listeners, err := frontend.listen()
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- frontend.serve(listeners, ctx.Done())
+	}()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/health", listeners[0].Addr()))
+	if err != nil {
+		t.Fatalf("Error calling /health: %v", err)
+	}
+	var health map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		t.Errorf("Invalid /health body: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || health["status"] != "ok" {
+		t.Errorf("Expected a healthy frontend, got %d %v", resp.StatusCode, health)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Fatalf("Frontend.serve returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for server to shut down")
+	}
+}
+
+func TestHealthWithoutDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+
+	frontend := NewFrontend(nil, db, dix.MgrConfig{})
+	rec := httptest.NewRecorder()
+	frontend.publicRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+}
+
+func TestReadyWithoutCurrentPartition(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, dix.MgrConfig{})
+
+	expectPartitions := func(partition string) {
+		mock.ExpectPing()
+		mock.ExpectQuery("(?i)from chain\\.dotidx").
+			WillReturnRows(sqlmock.NewRows([]string{"relaychain", "chain"}).AddRow("polkadot", "polkadot"))
+		mock.ExpectQuery("FROM pg_inherits").
+			WithArgs("chain", "blocks_polkadot_polkadot").
+			WillReturnRows(sqlmock.NewRows([]string{"relname"}).AddRow(partition))
+	}
+
+	expectPartitions("blocks_polkadot_polkadot_" + time.Now().UTC().Format("2006_01"))
+	rec := httptest.NewRecorder()
+	frontend.publicRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the current partition, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	expectPartitions("blocks_polkadot_polkadot_2020_01")
+	rec = httptest.NewRecorder()
+	frontend.publicRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without the current partition, got %d", rec.Code)
+	}
+	var response ReadyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(response.MissingPartitions) != 1 || response.MissingPartitions[0] != "polkadot:polkadot" {
+		t.Errorf("Expected polkadot:polkadot to miss its partition, got %v", response.MissingPartitions)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestHandleAddressToBlocksKeysetPagination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	// newest first, two blocks share block_id 3 (elastic scaling)
+	type row struct {
+		id   int
+		hash string
+	}
+	dataset := []row{{5, "0x5"}, {4, "0x4"}, {3, "0x3b"}, {3, "0x3a"}, {2, "0x2"}}
+	columns := []string{"block_id", "created_at", "hash", "parent_hash", "state_root", "extrinsics_root",
+		"author_id", "finalized", "on_initialize", "on_finalize", "logs", "extrinsics"}
+	const pageSize = 2
+	address := "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+
+	seen := make(map[string]bool)
+	var order []string
+	cursor := ""
+	var after *row
+	for page := 0; page < 10; page++ {
+		// emulate the seek predicate on the dataset
+		var pageRows []row
+		for _, r := range dataset {
+			if after != nil && (r.id > after.id || (r.id == after.id && r.hash >= after.hash)) {
+				continue
+			}
+			if len(pageRows) < pageSize {
+				pageRows = append(pageRows, r)
+			}
+		}
+		rows := sqlmock.NewRows(columns)
+		for i := len(pageRows) - 1; i >= 0; i-- {
+			rows.AddRow(pageRows[i].id, time.Now(), pageRows[i].hash, "", "", "", "", true,
+				[]byte("{}"), []byte("{}"), []byte("[]"), []byte("[]"))
+		}
+		if after == nil {
+			mock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot b").WillReturnRows(rows)
+		} else {
+			mock.ExpectQuery("\\(b\\.block_id, b\\.hash\\) < \\(\\$2, \\$3\\)").
+				WithArgs(address, after.id, after.hash).
+				WillReturnRows(rows)
+		}
+
+		url := fmt.Sprintf("/fe/address2blocks?address=%s&count=%d&cursor=%s", address, pageSize, cursor)
+		rec := httptest.NewRecorder()
+		frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d: expected status 200, got %d: %s", page, rec.Code, rec.Body.String())
+		}
+
+		var resp AddressBlocksPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("page %d: failed to decode response: %v", page, err)
+		}
+		for _, block := range resp.Blocks["polkadot"]["polkadot"] {
+			key := block.ID + "/" + block.Hash
+			if seen[key] {
+				t.Errorf("block %s returned twice", key)
+			}
+			seen[key] = true
+			order = append(order, key)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+		last := pageRows[len(pageRows)-1]
+		after = &last
+	}
+
+	if len(seen) != len(dataset) {
+		t.Errorf("expected %d distinct blocks across pages, got %d: %v", len(dataset), len(seen), order)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNextAddressCursorRetriesFailedChains(t *testing.T) {
+	full := []dix.BlockData{{ID: "7", Hash: "0x7"}, {ID: "9", Hash: "0x9"}}
+	blocks := map[string]map[string][]dix.BlockData{
+		"polkadot": {"polkadot": full, "assethub": {}, "people": {}},
+	}
+	previous := addressCursor{
+		"polkadot/assethub": {BlockID: 42, Hash: "0x42"},
+	}
+	failed := map[string]bool{"polkadot/assethub": true, "polkadot/people": true}
+
+	next, err := nextAddressCursor(blocks, failed, 2, previous)
+	if err != nil {
+		t.Fatalf("nextAddressCursor: %v", err)
+	}
+	if next["polkadot/polkadot"] != (blockPosition{BlockID: 7, Hash: "0x7"}) {
+		t.Errorf("Expected polkadot to continue after block 7, got %+v", next["polkadot/polkadot"])
+	}
+	// the failed chains are not done: assethub stays where it was, people
+	// had no position and starts again
+	if next["polkadot/assethub"] != previous["polkadot/assethub"] {
+		t.Errorf("Expected assethub to keep its position, got %+v", next["polkadot/assethub"])
+	}
+	if position, ok := next["polkadot/people"]; ok {
+		t.Errorf("Expected people to start again, got %+v", position)
+	}
+
+	// a single chain failing on the first page still has a next page
+	next, err = nextAddressCursor(map[string]map[string][]dix.BlockData{"polkadot": {"polkadot": {}}},
+		map[string]bool{"polkadot/polkadot": true}, 2, nil)
+	if err != nil {
+		t.Fatalf("nextAddressCursor: %v", err)
+	}
+	encoded, err := encodeAddressCursor(next)
+	if err != nil || encoded == "" {
+		t.Fatalf("Expected a next cursor, got %q %v", encoded, err)
+	}
+	decoded, err := decodeAddressCursor(encoded)
+	if err != nil || len(decoded) != 0 {
+		t.Errorf("Expected an empty cursor, got %v %v", decoded, err)
+	}
+
+	// without failures, done chains end the pagination
+	next, err = nextAddressCursor(map[string]map[string][]dix.BlockData{"polkadot": {"polkadot": {}}}, nil, 2, nil)
+	if err != nil || next != nil {
+		t.Errorf("Expected no next cursor, got %v %v", next, err)
+	}
+}
+
+func TestHandleAddressToBlocksInvalidCursor(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	frontend := NewFrontend(nil, db, dix.MgrConfig{})
+	url := "/fe/address2blocks?address=5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty&cursor=***"
+	rec := httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestReadQueriesUseReplica(t *testing.T) {
+	primary, primaryMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer primary.Close()
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock replica: %v", err)
+	}
+	defer replica.Close()
+
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, primary, config)
+	if frontend.readDB() != primary {
+		t.Fatalf("expected reads to go to the primary when no replica is set")
+	}
+	frontend.SetReplica(replica)
+
+	rows := sqlmock.NewRows([]string{"block_id", "created_at", "hash", "parent_hash", "state_root", "extrinsics_root",
+		"author_id", "finalized", "on_initialize", "on_finalize", "logs", "extrinsics"}).
+		AddRow(1, time.Now(), "0x1", "", "", "", "", true, []byte("{}"), []byte("{}"), []byte("[]"), []byte("[]"))
+	replicaMock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot b").WillReturnRows(rows)
+
+	url := "/fe/address2blocks?address=5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	rec := httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var blocks map[string]map[string][]dix.BlockData
+	if err := json.Unmarshal(rec.Body.Bytes(), &blocks); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if len(blocks["polkadot"]["polkadot"]) != 1 {
+		t.Errorf("Expected 1 block from the replica, got %d", len(blocks["polkadot"]["polkadot"]))
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled replica expectations: %s", err)
+	}
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected primary usage: %s", err)
+	}
+}
+
+func TestHandleAddressToBlocksQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		DotidxFE: dix.DotidxFE{QueryTimeout: dix.Duration(50 * time.Millisecond)},
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	mock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot b").
+		WillDelayFor(2 * time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"block_id"}))
+
+	url := "/fe/address2blocks?address=5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+	if elapsed > time.Second {
+		t.Errorf("Expected the query to be cancelled after ~50ms, took %v", elapsed)
+	}
+}
+
+func TestHandleRefreshStats(t *testing.T) {
+	if err := dix.RegisterMonthlyQueries(); err != nil {
+		t.Fatalf("Error registering queries: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+
+	queries, err := dix.GetListOfRegisteredQueries()
+	if err != nil {
+		t.Fatalf("Error listing queries: %v", err)
+	}
+	registered := 0
+	for range queries {
+		registered++
+	}
+
+	mock.MatchExpectationsInOrder(false)
+	for range registered {
+		mock.ExpectQuery("FROM\\s+chain\\.(blocks|address2blocks)_polkadot_polkadot").
+			WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(42))
+		mock.ExpectExec("INSERT INTO\\s+chain\\.dotidx_monthly_query_results").
+			WithArgs("polkadot", "polkadot", sqlmock.AnyArg(), 2025, 3, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	url := "/admin/refresh-stats?relay=polkadot&chain=polkadot&year=2025&month=3"
+	rec := httptest.NewRecorder()
+	frontend.handleRefreshStats(rec, httptest.NewRequest(http.MethodPost, url, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response RefreshStatsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(response.Queries) != registered {
+		t.Errorf("Expected %d refreshed queries, got %v", registered, response.Queries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRequireBearerToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", "Bearer nope", http.StatusUnauthorized},
+		{"token prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/refresh-stats", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			requireBearerToken(tc.token, ok).ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("Expected status %d, got %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		DotidxFE: dix.DotidxFE{AdminToken: "secret"},
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+
+	rec := httptest.NewRecorder()
+	url := "/admin/refresh-stats?relay=polkadot&chain=polkadot"
+	frontend.adminRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// authorized but invalid, the request reaches the handler
+	req := httptest.NewRequest(http.MethodPost, "/admin/refresh-stats?relay=kusama&chain=kusama", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	frontend.adminRoutes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected database access: %v", err)
+	}
+}
+
+func TestValidateListeners(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  dix.DotidxFE
+		wantErr bool
+	}{
+		{"public only", dix.DotidxFE{IP: "0.0.0.0", Port: 8080}, false},
+		{"default admin ip", dix.DotidxFE{IP: "0.0.0.0", Port: 8080, AdminPort: 8081}, false},
+		{"private admin ip", dix.DotidxFE{IP: "0.0.0.0", Port: 8080, AdminIP: "10.0.0.2", AdminPort: 8081}, false},
+		{"ipv6 loopback", dix.DotidxFE{IP: "0.0.0.0", Port: 8080, AdminIP: "::1", AdminPort: 8081}, false},
+		{"distinct ips same port", dix.DotidxFE{IP: "192.168.1.2", Port: 8080, AdminIP: "127.0.0.1", AdminPort: 8080}, false},
+		{"invalid port", dix.DotidxFE{Port: 0}, true},
+		{"invalid admin port", dix.DotidxFE{Port: 8080, AdminPort: 70000}, true},
+		{"public admin ip", dix.DotidxFE{Port: 8080, AdminIP: "8.8.8.8", AdminPort: 8081}, true},
+		{"unspecified admin ip", dix.DotidxFE{Port: 8080, AdminIP: "0.0.0.0", AdminPort: 8081}, true},
+		{"hostname admin ip", dix.DotidxFE{Port: 8080, AdminIP: "localhost", AdminPort: 8081}, true},
+		{"same port", dix.DotidxFE{IP: "0.0.0.0", Port: 8080, AdminPort: 8080}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateListeners(tc.config)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateListeners(%+v) = %v, wantErr %v", tc.config, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesOnlyOnPrivateListener(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		DotidxFE: dix.DotidxFE{
+			StaticPath: t.TempDir(),
+			AdminToken: "secret",
+			AdminPort:  8081,
+		},
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+	if frontend.adminAddr != "127.0.0.1:8081" {
+		t.Errorf("Expected admin address 127.0.0.1:8081, got %s", frontend.adminAddr)
+	}
+
+	serve := func(handler http.Handler, method, url string) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// an unknown chain answers 400 once the request reached the handler
+	refresh := "/admin/refresh-stats?relay=kusama&chain=kusama"
+
+	public := frontend.publicRoutes()
+	if code := serve(public, http.MethodPost, refresh); code == http.StatusBadRequest || code == http.StatusOK {
+		t.Errorf("Admin route served on the public listener, status %d", code)
+	}
+	if code := serve(public, http.MethodGet, "/metrics"); code == http.StatusOK {
+		t.Errorf("Metrics served on the public listener")
+	}
+
+	private := frontend.privateRoutes()
+	if code := serve(private, http.MethodPost, refresh); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d on the private listener, got %d", http.StatusBadRequest, code)
+	}
+	if code := serve(private, http.MethodGet, "/metrics"); code != http.StatusOK {
+		t.Errorf("Expected status %d for metrics, got %d", http.StatusOK, code)
+	}
+	if code := serve(private, http.MethodGet, "/fe/stats/per_month"); code != http.StatusNotFound {
+		t.Errorf("Expected public routes to be absent from the private listener, got %d", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unexpected database access: %v", err)
+	}
+}
+
+func TestHandleListQueries(t *testing.T) {
+	frontend := NewFrontend(nil, nil, dix.MgrConfig{})
+
+	rec := httptest.NewRecorder()
+	frontend.publicRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queries", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var infos []QueryInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.Description == "" {
+			t.Errorf("Query %s has no description", info.Name)
+		}
+		names = append(names, info.Name)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Expected queries sorted by name, got %v", names)
+	}
+	for _, name := range []string{"total_blocks_in_month", "total_addresses_in_month", "average_extrinsics_in_month", "authors_in_month", "largest_transfers_in_month"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("Expected %s in %v", name, names)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	result := dix.SqlResult{
+		{"author_id": "alice", "blocks": float64(12), "finalized": true},
+		{"author_id": "bob, jr", "blocks": float64(1.5), "extra": map[string]any{"era": float64(3), "ids": []any{"a", "b"}}},
+		{"author_id": nil, "blocks": int64(7)},
+	}
+
+	var out strings.Builder
+	if err := writeDelimited(&out, result, ','); err != nil {
+		t.Fatalf("writeDelimited: %v", err)
+	}
+	expected := "author_id,blocks,extra,finalized\n" +
+		"alice,12,,true\n" +
+		"\"bob, jr\",1.5,\"{\"\"era\"\":3,\"\"ids\"\":[\"\"a\"\",\"\"b\"\"]}\",\n" +
+		",7,,\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestHandleQueryResultCSV(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+
+	mock.ExpectQuery("SELECT results\\s+FROM chain\\.dotidx_monthly_query_results").
+		WithArgs("polkadot", "polkadot", "total_blocks_in_month", 2025, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"results"}).AddRow([]byte(`[{"total_blocks":42}]`)))
+	mock.ExpectQuery("SELECT results\\s+FROM chain\\.dotidx_monthly_query_results").
+		WithArgs("polkadot", "polkadot", "total_blocks_in_month", 2025, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"results"}))
+
+	routes := frontend.publicRoutes()
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result.csv?relay=polkadot&chain=polkadot&year=2025&month=3", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected text/csv, got %s", ct)
+	}
+	if rec.Body.String() != "total_blocks\n42\n" {
+		t.Errorf("Unexpected CSV: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result.csv?relay=polkadot&chain=polkadot&year=2025&month=4", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing result, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result.csv?relay=polkadot&chain=unknown&year=2025&month=3", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown chain, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestHandleQueryResultYear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+
+	mock.ExpectQuery("SELECT results\\s+FROM chain\\.dotidx_monthly_query_results").
+		WithArgs("polkadot", "polkadot", "total_blocks_in_month", 2025, dix.YearlyRollupMonth).
+		WillReturnRows(sqlmock.NewRows([]string{"results"}).AddRow([]byte(`[{"total_blocks":600}]`)))
+
+	routes := frontend.publicRoutes()
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result.csv?relay=polkadot&chain=polkadot&year=2025", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != "total_blocks\n600\n" {
+		t.Errorf("Unexpected CSV: %q", rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `"total_blocks_in_month_polkadot_polkadot_2025.csv"`) {
+		t.Errorf("Unexpected Content-Disposition: %s", cd)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result?relay=polkadot&chain=polkadot&year=2025&month=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for month 0, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNegotiateTable(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"", contentJSON, true},
+		{"*/*", contentJSON, true},
+		{"application/json", contentJSON, true},
+		{"text/csv", contentCSV, true},
+		{"text/tab-separated-values", contentTSV, true},
+		{"text/*", contentCSV, true},
+		{"text/csv;q=0.5, text/tab-separated-values", contentTSV, true},
+		{"text/html, application/json;q=0.9", contentJSON, true},
+		{"text/csv;q=0", "", false},
+		{"image/png", "", false},
+	}
+	for _, tt := range tests {
+		contentType, ok := negotiateTable(tt.accept)
+		if contentType != tt.expected || ok != tt.ok {
+			t.Errorf("negotiateTable(%q) = %q, %v; expected %q, %v", tt.accept, contentType, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	result := dix.SqlResult{
+		{"author_id": "alice", "blocks": float64(12)},
+		{"author_id": "bob\tjr", "blocks": float64(3), "extra": []any{"a"}},
+	}
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		{contentJSON, `[{"author_id":"alice","blocks":12},{"author_id":"bob\tjr","blocks":3,"extra":["a"]}]` + "\n"},
+		{contentCSV, "author_id,blocks,extra\nalice,12,\nbob\tjr,3,\"[\"\"a\"\"]\"\n"},
+		{contentTSV, "author_id\tblocks\textra\nalice\t12\t\n\"bob\tjr\"\t3\t\"[\"\"a\"\"]\"\n"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeTable(rec, tt.contentType, result)
+		if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("Expected Content-Type %s, got %s", tt.contentType, ct)
+		}
+		if rec.Body.String() != tt.expected {
+			t.Errorf("%s: unexpected body %q, expected %q", tt.contentType, rec.Body.String(), tt.expected)
+		}
+	}
+}
+
+func TestHandleQueryResultNegotiation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+	routes := frontend.publicRoutes()
+
+	expected := map[string]string{
+		contentJSON: `[{"total_blocks":42}]` + "\n",
+		contentCSV:  "total_blocks\n42\n",
+		contentTSV:  "total_blocks\n42\n",
+	}
+	for _, contentType := range []string{contentJSON, contentCSV, contentTSV} {
+		mock.ExpectQuery("SELECT results\\s+FROM chain\\.dotidx_monthly_query_results").
+			WillReturnRows(sqlmock.NewRows([]string{"results"}).AddRow([]byte(`[{"total_blocks":42}]`)))
+
+		req := httptest.NewRequest(http.MethodGet,
+			"/queries/total_blocks_in_month/result?relay=polkadot&chain=polkadot&year=2025&month=3", nil)
+		req.Header.Set("Accept", contentType)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", contentType, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != contentType {
+			t.Errorf("Expected Content-Type %s, got %s", contentType, ct)
+		}
+		if rec.Body.String() != expected[contentType] {
+			t.Errorf("%s: unexpected body %q", contentType, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/queries/total_blocks_in_month/result?relay=polkadot&chain=polkadot&year=2025&month=3", nil)
+	req.Header.Set("Accept", "image/png")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status %d, got %d", http.StatusNotAcceptable, rec.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestExplainSlowQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		DotidxFE: dix.DotidxFE{ExplainSlowQueries: dix.Duration(10 * time.Millisecond)},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	upgrades := []string{"block_id", "spec_name", "old_spec_version", "new_spec_version", "created_at"}
+	// fast enough, no plan
+	mock.ExpectQuery("FROM chain\\.runtime_upgrades").
+		WithArgs("polkadot", "polkadot").
+		WillReturnRows(sqlmock.NewRows(upgrades))
+	// slow, the plan is logged
+	mock.ExpectQuery("FROM chain\\.runtime_upgrades").
+		WithArgs("polkadot", "polkadot").
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(upgrades))
+	mock.ExpectQuery("^EXPLAIN \\(ANALYZE, BUFFERS\\) SELECT block_id, spec_name").
+		WithArgs("polkadot", "polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).
+			AddRow("Seq Scan on runtime_upgrades  (actual time=0.010..0.011 rows=0 loops=1)").
+			AddRow("Buffers: shared hit=1"))
+
+	ctx := context.Background()
+	if _, err := frontend.getRuntimeUpgrades(ctx, "polkadot", "polkadot"); err != nil {
+		t.Fatalf("getRuntimeUpgrades: %v", err)
+	}
+	if strings.Contains(logs.String(), "Slow query") {
+		t.Errorf("Expected no plan for a fast query, got %s", logs.String())
+	}
+	if _, err := frontend.getRuntimeUpgrades(ctx, "polkadot", "polkadot"); err != nil {
+		t.Fatalf("getRuntimeUpgrades: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Seq Scan on runtime_upgrades") || !strings.Contains(logs.String(), "Buffers: shared hit=1") {
+		t.Errorf("Expected the plan to be logged, got %s", logs.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddressBlocksQueryPrunesPartitions(t *testing.T) {
+	address := "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	from, to := "2026-01-01 00:00:00.0000", "2026-02-01 00:00:00.0000"
+
+	query, args := addressBlocksQuery("polkadot", "polkadot", address, "10", "", "", nil)
+	if strings.Contains(query, "created_at >=") || strings.Contains(query, "created_at <=") || len(args) != 1 {
+		t.Errorf("Expected no created_at predicate without a range, got %s %v", query, args)
+	}
+
+	query, args = addressBlocksQuery("polkadot", "polkadot", address, "10", from, to, &blockPosition{BlockID: 42, Hash: "0x42"})
+	for _, predicate := range []string{
+		"a.address = $1",
+		"b.created_at >= CAST($2 AS timestamp)",
+		"b.created_at <= CAST($3 AS timestamp)",
+		"(b.block_id, b.hash) < ($4, $5)",
+	} {
+		if !strings.Contains(query, predicate) {
+			t.Errorf("Expected %q in %s", predicate, query)
+		}
+	}
+	if strings.Contains(query, address) || fmt.Sprint(args) != fmt.Sprint([]any{address, from, to, 42, "0x42"}) {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+
+	query, args = addressBlocksQuery("polkadot", "polkadot", address, "10", "", to, nil)
+	if !strings.Contains(query, "b.created_at <= CAST($2 AS timestamp)") || len(args) != 2 {
+		t.Errorf("Expected only the upper bound, got %s %v", query, args)
+	}
+}
+
+func TestHandleAddressToBlocksTimeRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	mock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot b(.|\\n)*b\\.created_at >= CAST\\(\\$2 AS timestamp\\) AND b\\.created_at <= CAST\\(\\$3 AS timestamp\\)").
+		WithArgs("5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty", "2026-01-01 00:00:00.0000", "2026-01-31 00:00:00.0000").
+		WillReturnRows(sqlmock.NewRows([]string{"block_id"}))
+
+	url := "/fe/address2blocks?address=5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty&from=2026-01-01&to=2026-01-31"
+	rec := httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleAddressToBlocksCountOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	address := "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM chain\\.blocks_polkadot_polkadot b\\s+JOIN chain\\.address2blocks_polkadot_polkadot a").
+		WithArgs(address).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+	rec := httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, "/fe/address2blocks?address="+address+"&count=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"count":42}` {
+		t.Errorf("Expected only the count, got %s", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddressCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		DotidxFE: dix.DotidxFE{AddressCacheSize: 10, AddressCacheTTL: dix.Duration(time.Minute)},
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	frontend.addressCache.SetClock(func() time.Time { return now })
+
+	address := "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	columns := []string{"block_id", "created_at", "hash", "parent_hash", "state_root", "extrinsics_root",
+		"author_id", "finalized", "on_initialize", "on_finalize", "logs", "extrinsics"}
+	expectBlock := func(id int) {
+		mock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot b").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(id, time.Now(), fmt.Sprintf("0x%d", id), "", "", "", "", true, []byte("{}"), []byte("{}"), []byte("[]"), []byte("[]")))
+	}
+	get := func(query string) []dix.BlockData {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, "/fe/address2blocks?address="+address+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var blocks map[string]map[string][]dix.BlockData
+		if err := json.Unmarshal(rec.Body.Bytes(), &blocks); err != nil {
+			t.Fatalf("Failed to decode response body: %v", err)
+		}
+		return blocks["polkadot"]["polkadot"]
+	}
+
+	// miss then hit
+	expectBlock(10)
+	get("")
+	if blocks := get(""); len(blocks) != 1 || blocks[0].ID != "10" {
+		t.Errorf("Expected block 10 from the cache, got %v", blocks)
+	}
+	// another page is another entry
+	expectBlock(10)
+	get("&count=5")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unexpected queries: %s", err)
+	}
+
+	// the blocks indexed since are read once the page expired
+	now = now.Add(time.Minute)
+	expectBlock(11)
+	if blocks := get(""); len(blocks) != 1 || blocks[0].ID != "11" {
+		t.Errorf("Expected block 11 from the database, got %v", blocks)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInvalidateAddresses(t *testing.T) {
+	config := dix.MgrConfig{DotidxFE: dix.DotidxFE{AddressCacheSize: 10}}
+	frontend := NewFrontend(nil, nil, config)
+	for _, key := range []addressCacheKey{
+		{relay: "polkadot", chain: "polkadot", address: "1abc"},
+		{relay: "polkadot", chain: "polkadot", address: "1abc", count: "5"},
+		{relay: "polkadot", chain: "polkadot", address: "1def"},
+		{relay: "polkadot", chain: "assethub", address: "1abc"},
+	} {
+		frontend.addressCache.Put(key, nil)
+	}
+	cached := func(chain, address string) bool {
+		_, ok := frontend.addressCache.Get(addressCacheKey{relay: "polkadot", chain: chain, address: address})
+		return ok
+	}
+
+	events := make(chan dix.Event)
+	done := make(chan struct{})
+	go func() {
+		frontend.invalidateAddresses(context.Background(), "polkadot", "polkadot", events)
+		close(done)
+	}()
+	events <- dix.Event{Topic: dix.TopicNewAddress, RelayChain: "polkadot", Chain: "polkadot", Address: "1abc", BlockID: "7"}
+	// received once the first one is handled
+	events <- dix.Event{Topic: dix.TopicNewAddress, RelayChain: "polkadot", Chain: "polkadot", Address: "1xyz", BlockID: "7"}
+	if n := frontend.addressCache.Len(); n != 2 || cached("polkadot", "1abc") || !cached("polkadot", "1def") || !cached("assethub", "1abc") {
+		t.Errorf("Expected the 2 pages of 1abc on polkadot to be dropped, %d left", n)
+	}
+
+	// once the stream ends the new blocks are unknown
+	close(events)
+	<-done
+	if cached("polkadot", "1def") || !cached("assethub", "1abc") {
+		t.Errorf("Expected the pages of polkadot to be dropped and assethub to be kept")
+	}
+}
+
+func TestSubscribeAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stream/addresses" || r.URL.Query().Get("relay") != "polkadot" || r.URL.Query().Get("chain") != "assethub" {
+			http.Error(w, "Invalid relay or chain", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: address\ndata: {\"address\":\"1abc\",\"blockId\":\"7\"}\n\n")
+		fmt.Fprint(w, "event: dropped\ndata: {}\n\n")
+		fmt.Fprint(w, "event: address\ndata: {\"address\":\"1def\",\"blockId\":\"8\"}\n\n")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := subscribeAddresses(ctx, server.URL+"/", "polkadot", "assethub")
+	if err != nil {
+		t.Fatalf("subscribeAddresses: %v", err)
+	}
+	var received []dix.Event
+	for event := range events {
+		received = append(received, event)
+	}
+	if len(received) != 1 || received[0].Topic != dix.TopicNewAddress || received[0].RelayChain != "polkadot" ||
+		received[0].Chain != "assethub" || received[0].Address != "1abc" || received[0].BlockID != "7" {
+		t.Errorf("Expected the address of block 7 up to the drop, got %+v", received)
+	}
+
+	if _, err := subscribeAddresses(ctx, server.URL, "polkadot", "kusama"); err == nil {
+		t.Errorf("Expected an error for an unknown chain")
+	}
+}
+
+func TestJSONFieldNames(t *testing.T) {
+	responses := []struct {
+		name     string
+		response any
+		current  []string
+		legacy   []string
+	}{
+		{
+			"completion rate",
+			[]CompletionRateResponse{{RelayChain: "polkadot", Chain: "polkadot", PercentCompletion: 99.5, HeadID: 100}},
+			[]string{"relayChain", "chain", "percentCompletion", "headId"},
+			[]string{"RelayChain", "Chain", "percent_completion", "head_id"},
+		},
+		{
+			"monthly stats",
+			[]MonthlyStats{{Relaychain: "polkadot", Chain: "polkadot", Date: "2026-10", Count: 10, MinBlock: 1, MaxBlock: 10}},
+			[]string{"relayChain", "chain", "date", "count", "minBlock", "maxBlock"},
+			[]string{"Relaychain", "Chain", "date", "count", "min_block", "max_block"},
+		},
+		{
+			"runtime upgrades",
+			[]dix.RuntimeUpgrade{{BlockID: 10, SpecName: "polkadot", OldSpecVersion: 1, NewSpecVersion: 2}},
+			[]string{"blockId", "specName", "oldSpecVersion", "newSpecVersion", "timestamp"},
+			[]string{"block_id", "spec_name", "old_spec_version", "new_spec_version", "timestamp"},
+		},
+		{
+			"address page",
+			AddressBlocksPage{Blocks: map[string]map[string][]dix.BlockData{}, NextCursor: "abc"},
+			[]string{"blocks", "nextCursor"},
+			[]string{"blocks", "next_cursor"},
+		},
+	}
+
+	for _, legacy := range []bool{false, true} {
+		frontend := NewFrontend(nil, nil, dix.MgrConfig{DotidxFE: dix.DotidxFE{LegacyJSONNames: legacy}})
+		for _, tc := range responses {
+			expected := tc.current
+			if legacy {
+				expected = tc.legacy
+			}
+			rec := httptest.NewRecorder()
+			frontend.writeJSON(rec, tc.response)
+			if got := rec.Header().Get("Content-Type"); got != contentJSON {
+				t.Errorf("%s: expected %s, got %s", tc.name, contentJSON, got)
+			}
+
+			var fields map[string]any
+			body := strings.TrimSpace(rec.Body.String())
+			if strings.HasPrefix(body, "[") {
+				var items []map[string]any
+				if err := json.Unmarshal([]byte(body), &items); err != nil || len(items) != 1 {
+					t.Fatalf("%s: cannot decode %s: %v", tc.name, body, err)
+				}
+				fields = items[0]
+			} else if err := json.Unmarshal([]byte(body), &fields); err != nil {
+				t.Fatalf("%s: cannot decode %s: %v", tc.name, body, err)
+			}
+			got := slices.Sorted(maps.Keys(fields))
+			slices.Sort(expected)
+			if !slices.Equal(got, expected) {
+				t.Errorf("%s (legacy %v): expected fields %v, got %v", tc.name, legacy, expected, got)
+			}
+		}
+	}
+}
+
+func TestHandleBlockNumericBlockNumber(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {"polkadot": {}},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	mock.ExpectQuery("FROM chain\\.blocks_polkadot_polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"block_id", "created_at", "hash", "parent_hash", "state_root", "extrinsics_root",
+			"author_id", "finalized", "on_initialize", "on_finalize", "logs", "extrinsics"}).
+			AddRow(12345, time.Now(), "0x12345", "", "", "", "", true, []byte("{}"), []byte("{}"), []byte("[]"), []byte("[]")))
+
+	req := httptest.NewRequest(http.MethodGet, "/fe/polkadot/polkadot/blocks/12345", nil)
+	req.SetPathValue("relay", "polkadot")
+	req.SetPathValue("chain", "polkadot")
+	req.SetPathValue("blockid", "12345")
+	rec := httptest.NewRecorder()
+	frontend.handleBlock(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("Failed to decode response body: %v", err)
+	}
+	if fields["blockNumber"] != float64(12345) {
+		t.Errorf("Expected blockNumber 12345, got %v (%T)", fields["blockNumber"], fields["blockNumber"])
+	}
+	if fields["number"] != "12345" {
+		t.Errorf("Expected number to stay the string 12345, got %v", fields["number"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+}
+
+func TestHandleAddressToBlocksSkipAddresses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	address := "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	config := dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {
+				"polkadot":    {},
+				"assethub":    {SkipAddresses: true},
+				"collectives": {SkipAddresses: true},
+			},
+		},
+	}
+	frontend := NewFrontend(nil, db, config)
+
+	// only the chain indexing addresses is counted
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)\\s+FROM chain\\.blocks_polkadot_polkadot b\\s+JOIN chain\\.address2blocks_polkadot_polkadot a").
+		WithArgs(address).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	rec := httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, "/fe/address2blocks?address="+address+"&count=true", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"count":3}` {
+		t.Errorf("Expected a count of 3, got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+
+	// without a chain indexing addresses the endpoint is not available
+	polkadot := config.Parachains["polkadot"]["polkadot"]
+	polkadot.SkipAddresses = true
+	config.Parachains["polkadot"]["polkadot"] = polkadot
+	frontend = NewFrontend(nil, db, config)
+	rec = httptest.NewRecorder()
+	frontend.handleAddressToBlocks(rec, httptest.NewRequest(http.MethodGet, "/fe/address2blocks?address="+address, nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "not indexed") {
+		t.Errorf("Expected a 404 explaining addresses are not indexed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, dix.MgrConfig{})
+
+	mock.ExpectQuery("(?i)from chain\\.dotidx").
+		WillReturnRows(sqlmock.NewRows([]string{"relaychain", "chain"}).
+			AddRow("polkadot", "polkadot").
+			AddRow("kusama", "assethub"))
+	mock.ExpectQuery("SELECT MIN\\(block_id\\), MAX\\(block_id\\) FROM chain\\.blocks_polkadot_polkadot;").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 24000000))
+	mock.ExpectQuery("FROM pg_inherits").
+		WithArgs("chain", "blocks_polkadot_polkadot", "address2blocks_polkadot_polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"parent", "child", "tablespace", "rows", "bytes"}).
+			AddRow("blocks_polkadot_polkadot", "blocks_polkadot_polkadot_2025_01", "slow0", 446400, 1<<30).
+			AddRow("blocks_polkadot_polkadot", "blocks_polkadot_polkadot_2025_02", "fast0", 403200, 1<<29).
+			AddRow("address2blocks_polkadot_polkadot", "address2blocks_polkadot_polkadot_0", "", 0, 8192))
+	// an empty chain
+	mock.ExpectQuery("FROM chain\\.blocks_kusama_assethub;").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+	mock.ExpectQuery("FROM pg_inherits").
+		WithArgs("chain", "blocks_kusama_assethub", "address2blocks_kusama_assethub").
+		WillReturnRows(sqlmock.NewRows([]string{"parent", "child", "tablespace", "rows", "bytes"}))
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		frontend.publicRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema", nil))
+		return rec
+	}
+	rec := get()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response SchemaResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(response.Chains) != 2 {
+		t.Fatalf("Expected 2 chains, got %+v", response.Chains)
+	}
+
+	polkadot := response.Chains[0]
+	if polkadot.RelayChain != "polkadot" || polkadot.Chain != "polkadot" {
+		t.Errorf("Expected polkadot:polkadot first, got %s:%s", polkadot.RelayChain, polkadot.Chain)
+	}
+	if polkadot.Tables.Blocks != "chain.blocks_polkadot_polkadot" || polkadot.Tables.Addresses != "chain.address2blocks_polkadot_polkadot" {
+		t.Errorf("Unexpected tables %+v", polkadot.Tables)
+	}
+	if polkadot.MinBlockID == nil || *polkadot.MinBlockID != 1 || polkadot.MaxBlockID == nil || *polkadot.MaxBlockID != 24000000 {
+		t.Errorf("Expected blocks 1 to 24000000, got %v %v", polkadot.MinBlockID, polkadot.MaxBlockID)
+	}
+	expected := []dix.PartitionStat{
+		{Table: "chain.blocks_polkadot_polkadot", Name: "chain.blocks_polkadot_polkadot_2025_01", Tablespace: "slow0", Rows: 446400, Bytes: 1 << 30},
+		{Table: "chain.blocks_polkadot_polkadot", Name: "chain.blocks_polkadot_polkadot_2025_02", Tablespace: "fast0", Rows: 403200, Bytes: 1 << 29},
+		{Table: "chain.address2blocks_polkadot_polkadot", Name: "chain.address2blocks_polkadot_polkadot_0", Rows: 0, Bytes: 8192},
+	}
+	if !slices.Equal(polkadot.Partitions, expected) {
+		t.Errorf("Expected partitions %+v, got %+v", expected, polkadot.Partitions)
+	}
+
+	assethub := response.Chains[1]
+	if assethub.MinBlockID != nil || assethub.MaxBlockID != nil || len(assethub.Partitions) != 0 {
+		t.Errorf("Expected an empty chain, got %+v", assethub)
+	}
+	if !strings.Contains(rec.Body.String(), `"minBlockId":null`) || !strings.Contains(rec.Body.String(), `"partitions":[]`) {
+		t.Errorf("Expected an empty chain to have null blocks and no partitions, got %s", rec.Body.String())
+	}
+
+	// the answer is cached, the database is not queried again
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() == "" {
+		t.Errorf("Expected the cached answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAdminWatchList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	config := dix.MgrConfig{DotidxFE: dix.DotidxFE{AdminToken: "secret"}}
+	frontend := NewFrontend(dix.NewSQLDatabaseWithDB(db), db, config)
+	const address = "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+
+	serve := func(method, url, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		frontend.adminRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodPost, "/admin/watchlist", `{"address":"`+address+`"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/admin/watchlist", `{"address":"0x1234"}`, "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid address, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	mock.ExpectExec("^INSERT INTO chain\\.watched_addresses ").WithArgs(address).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("^SELECT address FROM chain\\.watched_addresses").
+		WillReturnRows(sqlmock.NewRows([]string{"address"}).AddRow(address))
+	rec := serve(http.MethodPost, "/admin/watchlist", `{"address":"`+address+`"}`, "secret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), address) {
+		t.Errorf("Expected %s to be watched, got %d %s", address, rec.Code, rec.Body.String())
+	}
+
+	mock.ExpectExec("^DELETE FROM chain\\.watched_addresses ").WithArgs(address).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^SELECT address FROM chain\\.watched_addresses").
+		WillReturnRows(sqlmock.NewRows([]string{"address"}))
+	rec = serve(http.MethodDelete, "/admin/watchlist?address="+address, "", "secret")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"addresses":[]}` {
+		t.Errorf("Expected no watched address, got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
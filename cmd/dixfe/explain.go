@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// explainSlowQuery logs the plan of a query which took longer than the
+// explain threshold, a debug aid to check that partitions are pruned. The
+// query runs again under EXPLAIN (ANALYZE, BUFFERS), it is disabled when the
+// threshold is 0.
+func (f *Frontend) explainSlowQuery(query string, args []any, elapsed time.Duration) {
+	if f.explainThreshold <= 0 || elapsed < f.explainThreshold {
+		return
+	}
+	// the request context may be about to expire
+	ctx, cancel := context.WithTimeout(context.Background(), f.queryTimeout)
+	defer cancel()
+
+	rows, err := f.readDB().QueryContext(ctx, "EXPLAIN (ANALYZE, BUFFERS) "+strings.TrimSpace(query), args...)
+	if err != nil {
+		log.Printf("Slow query (%s), cannot explain it: %v", elapsed.Round(time.Millisecond), err)
+		return
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			log.Printf("Slow query (%s), cannot read its plan: %v", elapsed.Round(time.Millisecond), err)
+			return
+		}
+		plan = append(plan, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Slow query (%s), cannot read its plan: %v", elapsed.Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("Slow query (%s): %s\n%s", elapsed.Round(time.Millisecond), strings.TrimSpace(query), strings.Join(plan, "\n"))
+}
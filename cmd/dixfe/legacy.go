@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// The responses used to mix snake_case, camelCase and untagged Go names.
+// Their fields are now all camelCase, legacy_json_names keeps the former
+// names for the clients written against them. A legacy type has the fields
+// of its current type, so one converts to the other.
+
+type legacyCompletionRateResponse struct {
+	RelayChain        string
+	Chain             string
+	PercentCompletion float64 `json:"percent_completion"`
+	HeadID            int     `json:"head_id"`
+}
+
+type legacyMonthlyStats struct {
+	Relaychain string
+	Chain      string
+	Date       string `json:"date"`
+	Count      int    `json:"count"`
+	MinBlock   int    `json:"min_block"`
+	MaxBlock   int    `json:"max_block"`
+}
+
+type legacyRuntimeUpgrade struct {
+	BlockID        int       `json:"block_id"`
+	SpecName       string    `json:"spec_name"`
+	OldSpecVersion int       `json:"old_spec_version"`
+	NewSpecVersion int       `json:"new_spec_version"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+type legacyAddressBlocksPage struct {
+	Blocks     map[string]map[string][]dix.BlockData `json:"blocks"`
+	NextCursor string                                `json:"next_cursor,omitempty"`
+}
+
+func convertAll[T, L any](items []T, convert func(T) L) []L {
+	converted := make([]L, len(items))
+	for i, item := range items {
+		converted[i] = convert(item)
+	}
+	return converted
+}
+
+// legacyResponse returns response with the field names of earlier versions
+func legacyResponse(response any) any {
+	switch r := response.(type) {
+	case []CompletionRateResponse:
+		return convertAll(r, func(c CompletionRateResponse) legacyCompletionRateResponse {
+			return legacyCompletionRateResponse(c)
+		})
+	case []MonthlyStats:
+		return convertAll(r, func(s MonthlyStats) legacyMonthlyStats { return legacyMonthlyStats(s) })
+	case []dix.RuntimeUpgrade:
+		return convertAll(r, func(u dix.RuntimeUpgrade) legacyRuntimeUpgrade { return legacyRuntimeUpgrade(u) })
+	case AddressBlocksPage:
+		return legacyAddressBlocksPage(r)
+	}
+	return response
+}
+
+// writeJSON answers response as JSON, with the legacy field names when the
+// frontend is configured to keep them
+func (f *Frontend) writeJSON(w http.ResponseWriter, response any) {
+	if f.config.DotidxFE.LegacyJSONNames {
+		response = legacyResponse(response)
+	}
+	w.Header().Set("Content-Type", contentJSON)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +22,112 @@ type BlocksResponse struct {
 	Blocks []dix.BlockData `json:"blocks"`
 }
 
+// AddressBlocksPage is returned by the address endpoint when the caller
+// asks for keyset pagination with the cursor parameter.
+type AddressBlocksPage struct {
+	Blocks     map[string]map[string][]dix.BlockData `json:"blocks"`
+	NextCursor string                                `json:"nextCursor,omitempty"`
+}
+
+// AddressBlocksCount is returned by the address endpoint with count=true
+type AddressBlocksCount struct {
+	Count int64 `json:"count"`
+}
+
+// blockPosition is the last (block_id, hash) seen on a chain; Done marks a
+// chain with no more rows.
+type blockPosition struct {
+	BlockID int    `json:"b"`
+	Hash    string `json:"h,omitempty"`
+	Done    bool   `json:"d,omitempty"`
+}
+
+// addressCursor keeps one position per "relay/chain"
+type addressCursor map[string]blockPosition
+
+func cursorKey(relay, chain string) string {
+	return relay + "/" + chain
+}
+
+// encodeAddressCursor encodes cursor, an empty cursor still has a next page
+// where every chain starts again
+func encodeAddressCursor(cursor addressCursor) (string, error) {
+	if cursor == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeAddressCursor(s string) (addressCursor, error) {
+	cursor := make(addressCursor)
+	if s == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor content: %w", err)
+	}
+	return cursor, nil
+}
+
+// nextAddressCursor computes the cursor for the page following blocks.
+// A chain is done when it returned less than limit rows; when every chain
+// is done the returned cursor is nil. A chain of failed keeps its previous
+// position, or none to start again from the most recent blocks, so that
+// the next page retries it.
+func nextAddressCursor(blocks map[string]map[string][]dix.BlockData, failed map[string]bool, limit int, previous addressCursor) (addressCursor, error) {
+	next := make(addressCursor)
+	pending := false
+	for relay := range blocks {
+		for chain, chainBlocks := range blocks[relay] {
+			key := cursorKey(relay, chain)
+			if failed[key] {
+				if position, ok := previous[key]; ok {
+					next[key] = position
+				}
+				pending = true
+				continue
+			}
+			if previous[key].Done || len(chainBlocks) < limit {
+				next[key] = blockPosition{Done: true}
+				continue
+			}
+			// pages are sorted ascending, the oldest row is the seek position
+			id, err := strconv.Atoi(chainBlocks[0].ID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid block id %q: %w", chainBlocks[0].ID, err)
+			}
+			next[key] = blockPosition{BlockID: id, Hash: chainBlocks[0].Hash}
+			pending = true
+		}
+	}
+	if !pending {
+		return nil, nil
+	}
+	return next, nil
+}
+
+// addressChains returns the configured chains whose addresses are indexed,
+// the chains with skip_addresses have no address2blocks rows
+func (f *Frontend) addressChains() map[string][]string {
+	chains := make(map[string][]string)
+	for relay := range f.config.Parachains {
+		for chain, chainConfig := range f.config.Parachains[relay] {
+			if !chainConfig.SkipAddresses {
+				chains[relay] = append(chains[relay], chain)
+			}
+		}
+	}
+	return chains
+}
+
 func (f *Frontend) handleAddressToBlocks(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	defer func() {
@@ -32,10 +145,34 @@ func (f *Frontend) handleAddressToBlocks(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// every configured chain was indexed with skip_addresses
+	if len(f.config.Parachains) > 0 && len(f.addressChains()) == 0 {
+		http.Error(w, "Addresses are not indexed on any chain", http.StatusNotFound)
+		return
+	}
+
+	// count=true asks for the number of blocks instead of the blocks
 	count := r.URL.Query().Get("count")
-	if count == "" {
+	countOnly := count == "true"
+	if count == "" || countOnly {
 		count = "10"
 	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid count parameter", http.StatusBadRequest)
+		return
+	}
+
+	// keyset pagination is opt-in to keep the historical response shape
+	paginate := r.URL.Query().Has("cursor")
+	var cursor addressCursor
+	if paginate {
+		cursor, err = decodeAddressCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
+			return
+		}
+	}
 
 	from := r.URL.Query().Get("from")
 	var fromTimestamp string
@@ -72,32 +209,197 @@ func (f *Frontend) handleAddressToBlocks(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	blocks, err := f.getBlocksByAddress(address, count, fromTimestamp, toTimestamp)
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	if countOnly {
+		total, err := f.countBlocksByAddress(ctx, address, fromTimestamp, toTimestamp)
+		if err != nil {
+			log.Printf("Error counting blocks for address %s: %v", address, err)
+			writeQueryError(w, err, "Error counting blocks")
+			return
+		}
+		f.writeJSON(w, AddressBlocksCount{Count: total})
+		return
+	}
+	blocks, failed, err := f.getBlocksByAddress(ctx, address, count, fromTimestamp, toTimestamp, cursor)
 	if err != nil {
 		log.Printf("Error getting blocks for address %s: %v", address, err)
-		http.Error(w, "Error retrieving blocks", http.StatusInternalServerError)
+		writeQueryError(w, err, "Error retrieving blocks")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(blocks); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		return
+	var response interface{} = blocks
+	if paginate {
+		next, err := nextAddressCursor(blocks, failed, limit, cursor)
+		if err != nil {
+			log.Printf("Error computing cursor for address %s: %v", address, err)
+			http.Error(w, "Error retrieving blocks", http.StatusInternalServerError)
+			return
+		}
+		nextCursor, err := encodeAddressCursor(next)
+		if err != nil {
+			log.Printf("Error encoding cursor for address %s: %v", address, err)
+			http.Error(w, "Error retrieving blocks", http.StatusInternalServerError)
+			return
+		}
+		response = AddressBlocksPage{Blocks: blocks, NextCursor: nextCursor}
 	}
+
+	f.writeJSON(w, response)
 }
 
-func (f *Frontend) getBlocksByAddressForChain(relay, chain, address string, count, from, to string) ([]dix.BlockData, error) {
-	if !dix.IsValidAddress(address) {
-		return nil, fmt.Errorf("invalid address format")
+// addressCacheKey identifies a page of blocks of an address on one chain
+type addressCacheKey struct {
+	relay, chain, address string
+	count, from, to       string
+	// the cursor position, hasAfter is false on the first page
+	hasAfter  bool
+	afterID   int
+	afterHash string
+}
+
+func newAddressCacheKey(relay, chain, address, count, from, to string, after *blockPosition) addressCacheKey {
+	key := addressCacheKey{relay: relay, chain: chain, address: address, count: count, from: from, to: to}
+	if after != nil {
+		key.hasAfter, key.afterID, key.afterHash = true, after.BlockID, after.Hash
+	}
+	return key
+}
+
+// liveRetryDelay is the pause before reopening the address stream of dixlive
+const liveRetryDelay = 5 * time.Second
+
+// liveAddress is an "address" event of the address stream of dixlive
+type liveAddress struct {
+	Address string `json:"address"`
+	BlockID string `json:"blockId"`
+}
+
+// watchLiveAddresses drops the cached pages of the addresses dixlive finds
+// in the blocks it indexes, read from its /stream/addresses at liveURL,
+// until ctx is done. The events missed while the stream is down are
+// unknown, the pages of the chain are dropped each time it is opened.
+func (f *Frontend) watchLiveAddresses(ctx context.Context, liveURL string) {
+	for relay, chains := range f.addressChains() {
+		for _, chain := range chains {
+			go func() {
+				for ctx.Err() == nil {
+					events, err := subscribeAddresses(ctx, liveURL, relay, chain)
+					if err != nil {
+						log.Printf("Error streaming the addresses of %s:%s: %v", relay, chain, err)
+					} else {
+						f.addressCache.DeleteFunc(func(key addressCacheKey) bool {
+							return key.relay == relay && key.chain == chain
+						})
+						f.invalidateAddresses(ctx, relay, chain, events)
+					}
+					select {
+					case <-ctx.Done():
+					case <-time.After(liveRetryDelay):
+					}
+				}
+			}()
+		}
+	}
+}
+
+// subscribeAddresses opens the address stream of relay:chain at liveURL, the
+// channel is closed when the stream ends
+func subscribeAddresses(ctx context.Context, liveURL, relay, chain string) (<-chan dix.Event, error) {
+	query := url.Values{"relay": {relay}, "chain": {chain}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(liveURL, "/")+"/stream/addresses?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	events := make(chan dix.Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		name := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				name = value
+				continue
+			}
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			if name != "address" {
+				// dropped by dixlive, or unknown
+				return
+			}
+			var address liveAddress
+			if err := json.Unmarshal([]byte(data), &address); err != nil {
+				log.Printf("Error decoding address event %q: %v", data, err)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case events <- dix.Event{Topic: dix.TopicNewAddress, RelayChain: relay, Chain: chain, Address: address.Address, BlockID: address.BlockID}:
+			}
+		}
+	}()
+	return events, nil
+}
 
+// invalidateAddresses drops the pages of the addresses received on events
+// until ctx is done or events is closed, then the pages of relay:chain
+func (f *Frontend) invalidateAddresses(ctx context.Context, relay, chain string, events <-chan dix.Event) {
+	dropChain := func(key addressCacheKey) bool {
+		return key.relay == relay && key.chain == chain
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				f.addressCache.DeleteFunc(dropChain)
+				return
+			}
+			f.addressCache.DeleteFunc(func(key addressCacheKey) bool {
+				return dropChain(key) && key.address == event.Address
+			})
+		}
+	}
+}
+
+// addressBlocksQuery builds the query of getBlocksByAddressForChain.
+//
+// The blocks table is partitioned by month on created_at and the address
+// table carries no timestamp, so without a created_at predicate on the
+// blocks side PostgreSQL probes the index of every monthly partition for
+// each block of the address. When from or to is set the range is passed as
+// a timestamp on b.created_at, the planner then prunes the partitions
+// outside of it, which turns a scan of years of partitions into a scan of
+// the months asked for.
+func addressBlocksQuery(relay, chain, address, count, from, to string, after *blockPosition) (string, []any) {
+	args := []any{address}
 	cond := ""
 	if from != "" {
-		cond += fmt.Sprintf(" AND b.created_at >= '%s'", from)
+		args = append(args, from)
+		cond += fmt.Sprintf(" AND b.created_at >= CAST($%d AS timestamp)", len(args))
 	}
 	if to != "" {
-		cond += fmt.Sprintf("AND b.created_at <= '%s'", to)
+		args = append(args, to)
+		cond += fmt.Sprintf(" AND b.created_at <= CAST($%d AS timestamp)", len(args))
+	}
+	if after != nil {
+		// rows sharing a block_id (elastic scaling) are ordered by hash
+		args = append(args, after.BlockID, after.Hash)
+		cond += fmt.Sprintf(" AND (b.block_id, b.hash) < ($%d, $%d)", len(args)-1, len(args))
 	}
 
 	// With elastic scaling, multiple blocks may share the same block_id
@@ -109,25 +411,41 @@ func (f *Frontend) getBlocksByAddressForChain(relay, chain, address string, coun
 		              b.author_id, b.finalized, b.on_initialize, b.on_finalize, b.logs, b.extrinsics
 		       FROM %s b
 		       JOIN %s a ON b.block_id = a.block_id
-		       WHERE a.address = '%s'
+		       WHERE a.address = $1
 		       %s
 		       ORDER BY b.block_id DESC, b.hash DESC
 		       LIMIT %s) AS subquery
 		 ORDER BY block_id ASC, hash ASC;`,
 		dix.GetBlocksTableName(relay, chain),
 		dix.GetAddressTableName(relay, chain),
-		address,
 		cond,
 		count,
 	)
-	rows, err := f.db.Query(query)
+	return query, args
+}
+
+// getBlocksByAddressForChain returns the latest count blocks for address.
+// When after is set, only rows strictly older than (block_id, hash) are
+// returned so pages never rely on OFFSET.
+func (f *Frontend) getBlocksByAddressForChain(ctx context.Context, relay, chain, address string, count, from, to string, after *blockPosition) ([]dix.BlockData, error) {
+	if !dix.IsValidAddress(address) {
+		return nil, fmt.Errorf("invalid address format")
+	}
+
+	cacheKey := newAddressCacheKey(relay, chain, address, count, from, to, after)
+	if blocks, ok := f.addressCache.Get(cacheKey); ok {
+		return blocks, nil
+	}
+
+	query, args := addressBlocksQuery(relay, chain, address, count, from, to, after)
+	start := time.Now()
+	rows, err := f.readDB().QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("database query failed: %w", err)
+		f.database.LogSQL(query)
+		return nil, queryError(ctx, err)
 	}
 	defer rows.Close()
 
-	log.Printf("Query: %s", query)
-
 	var blocks []dix.BlockData
 
 	for rows.Next() {
@@ -154,39 +472,56 @@ func (f *Frontend) getBlocksByAddressForChain(relay, chain, address string, coun
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating blocks: %w", err)
+		return nil, queryError(ctx, err)
 	}
+	f.explainSlowQuery(query, args, time.Since(start))
+	f.addressCache.Put(cacheKey, blocks)
 
 	return blocks, nil
 }
 
-func (f *Frontend) getBlocksByAddress(address string, count, from, to string) (
-	map[string]map[string][]dix.BlockData,
-	error,
+// getBlocksByAddress queries every chain indexing addresses in parallel;
+// cursor may be nil to start from the most recent blocks. Failing chains are
+// returned empty and listed in failed by their cursor key unless ctx
+// expired, in which case the deadline error is returned.
+func (f *Frontend) getBlocksByAddress(ctx context.Context, address string, count, from, to string, cursor addressCursor) (
+	blocks map[string]map[string][]dix.BlockData,
+	failed map[string]bool,
+	err error,
 ) {
-	blocks := make(map[string]map[string][]dix.BlockData)
+	blocks = make(map[string]map[string][]dix.BlockData)
+	failed = make(map[string]bool)
 	var wg sync.WaitGroup
 	var mu sync.Mutex // Protect shared map writes
 	errorCount := 0
 	successCount := 0
 
 	// not too many chains atm but a thread pool would be a good idea at some point
-	for relay := range f.config.Parachains {
+	for relay, chains := range f.addressChains() {
 		blocks[relay] = make(map[string][]dix.BlockData)
-		for chain := range f.config.Parachains[relay] {
+		for _, chain := range chains {
+			var after *blockPosition
+			if position, ok := cursor[cursorKey(relay, chain)]; ok {
+				if position.Done {
+					blocks[relay][chain] = []dix.BlockData{}
+					continue
+				}
+				after = &position
+			}
 			wg.Add(1)
 			// Capture loop variables for goroutine
 			relay := relay
 			chain := chain
 			go func() {
 				defer wg.Done()
-				chainBlocks, err := f.getBlocksByAddressForChain(relay, chain, address, count, from, to)
+				chainBlocks, err := f.getBlocksByAddressForChain(ctx, relay, chain, address, count, from, to, after)
 
 				// Safely update shared map
 				mu.Lock()
 				if err != nil {
 					log.Printf("Error getting blocks for %s/%s address %s: %v", relay, chain, address, err)
 					blocks[relay][chain] = []dix.BlockData{} // Empty array for failed chain
+					failed[cursorKey(relay, chain)] = true
 					errorCount++
 				} else {
 					blocks[relay][chain] = chainBlocks
@@ -200,5 +535,66 @@ func (f *Frontend) getBlocksByAddress(address string, count, from, to string) (
 	wg.Wait()
 
 	log.Printf("Multi-chain query complete: %d chains succeeded, %d failed", successCount, errorCount)
-	return blocks, nil
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return blocks, failed, fmt.Errorf("address query for %s timed out: %w", address, ctx.Err())
+	}
+	return blocks, failed, nil
+}
+
+// addressCountQuery builds the query counting the blocks of address on
+// relay:chain, with the created_at range of addressBlocksQuery
+func addressCountQuery(relay, chain, address, from, to string) (string, []any) {
+	args := []any{address}
+	cond := ""
+	if from != "" {
+		args = append(args, from)
+		cond += fmt.Sprintf(" AND b.created_at >= CAST($%d AS timestamp)", len(args))
+	}
+	if to != "" {
+		args = append(args, to)
+		cond += fmt.Sprintf(" AND b.created_at <= CAST($%d AS timestamp)", len(args))
+	}
+	query := fmt.Sprintf(
+		`SELECT COUNT(*)
+		 FROM %s b
+		 JOIN %s a ON b.block_id = a.block_id
+		 WHERE a.address = $1%s;`,
+		dix.GetBlocksTableName(relay, chain),
+		dix.GetAddressTableName(relay, chain),
+		cond,
+	)
+	return query, args
+}
+
+// countBlocksByAddress returns the number of blocks of address over every
+// chain indexing addresses. Unlike getBlocksByAddress a failing chain fails
+// the count rather than silently lowering it.
+func (f *Frontend) countBlocksByAddress(ctx context.Context, address, from, to string) (int64, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var total int64
+	var errs []error
+	for relay, chains := range f.addressChains() {
+		for _, chain := range chains {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				query, args := addressCountQuery(relay, chain, address, from, to)
+				var count int64
+				err := f.readDB().QueryRowContext(ctx, query, args...).Scan(&count)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s: %w", relay, chain, queryError(ctx, err)))
+					return
+				}
+				total += count
+			}()
+		}
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+	return total, nil
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+type RefreshStatsResponse struct {
+	RelayChain string   `json:"relay"`
+	Chain      string   `json:"chain"`
+	Year       int      `json:"year"`
+	Month      int      `json:"month"`
+	Queries    []string `json:"queries"`
+}
+
+// adminRoutes returns the /admin/ route group, every route requires the
+// admin bearer token
+func (f *Frontend) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/refresh-stats", f.handleRefreshStats)
+	mux.HandleFunc("GET /admin/watchlist", f.handleWatchList)
+	mux.HandleFunc("POST /admin/watchlist", f.handleWatchList)
+	mux.HandleFunc("DELETE /admin/watchlist", f.handleWatchList)
+	return requireBearerToken(f.config.DotidxFE.AdminToken, mux)
+}
+
+// requireBearerToken rejects requests whose Authorization header does not
+// carry token, everything is rejected when token is empty
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleMetrics returns the request statistics of the frontend over the
+// last day, hour, 5 minutes and minute
+func (f *Frontend) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f.metricsHandler.GetStats()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleRefreshStats recomputes the monthly statistics of one chain, by
+// default for the current month
+func (f *Frontend) handleRefreshStats(w http.ResponseWriter, r *http.Request) {
+	relay := r.URL.Query().Get("relay")
+	chain := r.URL.Query().Get("chain")
+	if _, ok := f.config.Parachains[relay][chain]; !ok {
+		http.Error(w, "Invalid relay or chain", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	year, month := now.Year(), int(now.Month())
+	if value := r.URL.Query().Get("year"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 2019 || v > year {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = v
+	}
+	if value := r.URL.Query().Get("month"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 || v > 12 {
+			http.Error(w, "Invalid month", http.StatusBadRequest)
+			return
+		}
+		month = v
+	}
+
+	queries, err := dix.GetListOfRegisteredQueries()
+	if err != nil {
+		http.Error(w, "Error listing queries", http.StatusInternalServerError)
+		return
+	}
+
+	response := RefreshStatsResponse{
+		RelayChain: relay,
+		Chain:      chain,
+		Year:       year,
+		Month:      month,
+		Queries:    make([]string, 0),
+	}
+	for query := range queries {
+		if err := f.database.ExecuteAndStoreNamedQuery(r.Context(), relay, chain, query.Name, year, month); err != nil {
+			log.Printf("Error refreshing %s for %s:%s %d/%d: %v", query.Name, relay, chain, year, month, err)
+			http.Error(w, fmt.Sprintf("Error refreshing %s", query.Name), http.StatusInternalServerError)
+			return
+		}
+		response.Queries = append(response.Queries, query.Name)
+	}
+	log.Printf("Refreshed stats for %s:%s %d/%d", relay, chain, year, month)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleWatchList lists the addresses the indexers watch on top of their
+// configured ones on GET, adds the address of the {"address": ...} body on
+// POST and removes ?address= on DELETE. The indexers read the list again
+// within a minute.
+func (f *Frontend) handleWatchList(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Address string `json:"address"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !dix.IsValidAddress(body.Address) {
+			http.Error(w, fmt.Sprintf("Invalid address %q", body.Address), http.StatusBadRequest)
+			return
+		}
+		if err := f.database.WatchAddress(body.Address); err != nil {
+			log.Printf("Error watching address %s: %v", body.Address, err)
+			http.Error(w, "Error watching address", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Watching address %s", body.Address)
+	case http.MethodDelete:
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			http.Error(w, "Missing 'address' query parameter", http.StatusBadRequest)
+			return
+		}
+		if err := f.database.UnwatchAddress(address); err != nil {
+			log.Printf("Error unwatching address %s: %v", address, err)
+			http.Error(w, "Error unwatching address", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Stopped watching address %s", address)
+	}
+
+	addresses, err := f.database.WatchedAddresses()
+	if err != nil {
+		log.Printf("Error reading watched addresses: %v", err)
+		http.Error(w, "Error reading watched addresses", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"addresses": addresses}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -18,10 +19,12 @@ func (f *Frontend) handleBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := r.PathValue("blockid")
-	block, err := f.getBlock(relay, chain, id)
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	block, err := f.getBlock(ctx, relay, chain, id)
 	if err != nil {
 		log.Printf("Error getting block for id %s: %v", id, err)
-		http.Error(w, "Error retrieving a block", http.StatusInternalServerError)
+		writeQueryError(w, err, "Error retrieving a block")
 		return
 	}
 
@@ -33,7 +36,7 @@ func (f *Frontend) handleBlock(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (f *Frontend) getBlock(relay, chain, id string) (dix.BlockData, error) {
+func (f *Frontend) getBlock(ctx context.Context, relay, chain, id string) (dix.BlockData, error) {
 	// With elastic scaling, multiple blocks may have the same block_id
 	// Order by finalized DESC to prefer finalized blocks, then by created_at DESC for consistency
 	query := fmt.Sprintf(`
@@ -47,7 +50,7 @@ func (f *Frontend) getBlock(relay, chain, id string) (dix.BlockData, error) {
 		id,
 	)
 	var block dix.BlockData
-	if err := f.db.QueryRow(query).Scan(
+	if err := f.readDB().QueryRowContext(ctx, query).Scan(
 		&block.ID,
 		&block.Timestamp,
 		&block.Hash,
@@ -64,7 +67,7 @@ func (f *Frontend) getBlock(relay, chain, id string) (dix.BlockData, error) {
 		if err == sql.ErrNoRows {
 			return block, fmt.Errorf("no block with %s", id)
 		}
-		return block, fmt.Errorf("Cant scan block %s: %v", id, err)
+		return block, queryError(ctx, err)
 	}
 	return block, nil
 }
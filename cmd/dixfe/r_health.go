@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// handleHealth answers 200 when the database behind the read queries is
+// reachable and 503 otherwise, it is meant for load balancers and probes
+func (f *Frontend) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+
+	status, code := "ok", http.StatusOK
+	if err := f.readDB().PingContext(ctx); err != nil {
+		log.Printf("Health check failed: %v", err)
+		status, code = "database unavailable", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": status}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// ReadyResponse is the body of /ready
+type ReadyResponse struct {
+	Status string `json:"status"`
+	// relay:chain whose blocks table has no partition for the current month
+	MissingPartitions []string `json:"missingPartitions,omitempty"`
+}
+
+// handleReady answers 200 when the database is reachable and every indexed
+// chain has a partition for the current month, and 503 otherwise. Without
+// that partition the indexers fail to save the new blocks while the
+// frontend keeps answering.
+func (f *Frontend) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+
+	response, code := ReadyResponse{Status: "ok"}, http.StatusOK
+	if err := f.readDB().PingContext(ctx); err != nil {
+		log.Printf("Readiness check failed: %v", err)
+		response.Status, code = "database unavailable", http.StatusServiceUnavailable
+	} else if f.database != nil {
+		missing, err := f.database.MissingCurrentPartitions(time.Now())
+		switch {
+		case err != nil:
+			log.Printf("Readiness check failed: %v", err)
+			response.Status, code = "cannot list partitions", http.StatusServiceUnavailable
+		case len(missing) > 0:
+			for _, info := range missing {
+				response.MissingPartitions = append(response.MissingPartitions, info.Relaychain+":"+info.Chain)
+			}
+			log.Printf("Readiness check failed, no partition for the current month: %v", response.MissingPartitions)
+			response.Status, code = "missing partitions", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
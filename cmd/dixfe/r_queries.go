@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+type QueryInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// handleListQueries lists the registered named queries sorted by name
+func (f *Frontend) handleListQueries(w http.ResponseWriter, r *http.Request) {
+	queries, err := dix.GetListOfRegisteredQueries()
+	if err != nil {
+		http.Error(w, "Error listing queries", http.StatusInternalServerError)
+		return
+	}
+
+	infos := make([]QueryInfo, 0)
+	for query := range queries {
+		infos = append(infos, QueryInfo{Name: query.Name, Description: query.Description})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleQueryResultCSV returns the stored result of a monthly named query
+// as CSV, or its yearly rollup when no month is given
+func (f *Frontend) handleQueryResultCSV(w http.ResponseWriter, r *http.Request) {
+	f.serveQueryResult(w, r, contentCSV)
+}
+
+// handleQueryResult returns the stored result of a monthly named query in the
+// format asked for by the Accept header, or its yearly rollup when no month
+// is given
+func (f *Frontend) handleQueryResult(w http.ResponseWriter, r *http.Request) {
+	contentType, ok := negotiateTable(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "Not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	f.serveQueryResult(w, r, contentType)
+}
+
+func (f *Frontend) serveQueryResult(w http.ResponseWriter, r *http.Request, contentType string) {
+	name := r.PathValue("name")
+	relay := r.URL.Query().Get("relay")
+	chain := r.URL.Query().Get("chain")
+	if _, ok := f.config.Parachains[relay][chain]; !ok {
+		http.Error(w, "Invalid relay or chain", http.StatusBadRequest)
+		return
+	}
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil || year < 2019 {
+		http.Error(w, "Invalid year", http.StatusBadRequest)
+		return
+	}
+	month := dix.YearlyRollupMonth
+	if value := r.URL.Query().Get("month"); value != "" {
+		month, err = strconv.Atoi(value)
+		if err != nil || month < 1 || month > 12 {
+			http.Error(w, "Invalid month", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	result, err := f.getQueryResult(ctx, relay, chain, name, year, month)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No result for this query", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting result of %s for %s:%s %d/%d: %v", name, relay, chain, year, month, err)
+		writeQueryError(w, err, "Error retrieving query result")
+		return
+	}
+
+	if contentType != contentJSON {
+		period := fmt.Sprintf("%d_%02d", year, month)
+		if month == dix.YearlyRollupMonth {
+			period = strconv.Itoa(year)
+		}
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s_%s_%s_%s.%s"`,
+				name, relay, chain, period, tableExtensions[contentType]))
+	}
+	writeTable(w, contentType, result)
+}
+
+func (f *Frontend) getQueryResult(ctx context.Context, relay, chain, name string, year, month int) (dix.SqlResult, error) {
+	query := fmt.Sprintf(`
+SELECT results
+FROM %s
+WHERE relay_chain = $1 AND chain = $2 AND query_name = $3 AND year = $4 AND month = $5;`,
+		dix.MonthlyQueryResultsTableName())
+
+	var data []byte
+	if err := f.readDB().QueryRowContext(ctx, query, relay, chain, name, year, month).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, queryError(ctx, err)
+	}
+	var result dix.SqlResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("error decoding result of %s: %w", name, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func (f *Frontend) handleRuntimeUpgrades(w http.ResponseWriter, r *http.Request) {
+	relay := r.URL.Query().Get("relay")
+	chain := r.URL.Query().Get("chain")
+	if _, ok := f.config.Parachains[relay][chain]; !ok {
+		http.Error(w, "Invalid relay or chain", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	upgrades, err := f.getRuntimeUpgrades(ctx, relay, chain)
+	if err != nil {
+		log.Printf("Error getting runtime upgrades for %s:%s: %v", relay, chain, err)
+		writeQueryError(w, err, "Error retrieving runtime upgrades")
+		return
+	}
+
+	f.writeJSON(w, upgrades)
+}
+
+func (f *Frontend) getRuntimeUpgrades(ctx context.Context, relay, chain string) ([]dix.RuntimeUpgrade, error) {
+	query := fmt.Sprintf(`
+		SELECT block_id, spec_name, old_spec_version, new_spec_version, created_at
+		FROM %s
+		WHERE relay_chain = $1 AND chain = $2
+		ORDER BY block_id;`,
+		dix.RuntimeUpgradesTableName(),
+	)
+	start := time.Now()
+	rows, err := f.readDB().QueryContext(ctx, query, relay, chain)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	upgrades := make([]dix.RuntimeUpgrade, 0)
+	for rows.Next() {
+		var upgrade dix.RuntimeUpgrade
+		if err := rows.Scan(
+			&upgrade.BlockID,
+			&upgrade.SpecName,
+			&upgrade.OldSpecVersion,
+			&upgrade.NewSpecVersion,
+			&upgrade.Timestamp,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning runtime upgrade: %w", err)
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+	f.explainSlowQuery(query, []any{relay, chain}, time.Since(start))
+	return upgrades, nil
+}
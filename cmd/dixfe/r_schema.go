@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// the catalog does not change between two indexing batches, tools polling
+// /schema read it at most that often
+const schemaCacheTTL = 30 * time.Second
+
+// SchemaResponse is the body of /schema, what is indexed per chain
+type SchemaResponse struct {
+	Chains []ChainSchema `json:"chains"`
+}
+
+// ChainSchema describes the tables of one chain
+type ChainSchema struct {
+	RelayChain string      `json:"relayChain"`
+	Chain      string      `json:"chain"`
+	Tables     ChainTables `json:"tables"`
+	// range of the saved blocks, nil when there is none
+	MinBlockID *int64 `json:"minBlockId"`
+	MaxBlockID *int64 `json:"maxBlockId"`
+	// partitions of the blocks table, then of the address table, by name
+	Partitions []dix.PartitionStat `json:"partitions"`
+}
+
+// ChainTables are the tables of a chain, qualified with their schema
+type ChainTables struct {
+	Blocks        string `json:"blocks"`
+	Addresses     string `json:"addresses"`
+	StatsPerMonth string `json:"statsPerMonth"`
+	RuntimeSpecs  string `json:"runtimeSpecs"`
+}
+
+type schemaCacheKey struct{}
+
+// handleSchema answers, for every chain of GetDatabaseInfo, its tables, the
+// partitions with their rows and size and the range of the saved blocks
+func (f *Frontend) handleSchema(w http.ResponseWriter, r *http.Request) {
+	if response, ok := f.schemaCache.Get(schemaCacheKey{}); ok {
+		f.writeJSON(w, response)
+		return
+	}
+
+	infos, err := f.database.GetDatabaseInfo()
+	if err != nil {
+		log.Printf("Error listing the indexed chains: %v", err)
+		http.Error(w, "Error listing the indexed chains", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	response := SchemaResponse{Chains: make([]ChainSchema, 0, len(infos))}
+	for _, info := range infos {
+		chain, err := f.getChainSchema(ctx, info.Relaychain, info.Chain)
+		if err != nil {
+			log.Printf("Error describing %s:%s: %v", info.Relaychain, info.Chain, err)
+			writeQueryError(w, err, "Error describing the indexed chains")
+			return
+		}
+		response.Chains = append(response.Chains, chain)
+	}
+	f.schemaCache.Put(schemaCacheKey{}, response)
+
+	f.writeJSON(w, response)
+}
+
+// getChainSchema reads the tables of relay:chain from the catalog
+func (f *Frontend) getChainSchema(ctx context.Context, relay, chain string) (ChainSchema, error) {
+	schema := ChainSchema{
+		RelayChain: relay,
+		Chain:      chain,
+		Tables: ChainTables{
+			Blocks:        dix.GetBlocksTableName(relay, chain),
+			Addresses:     dix.GetAddressTableName(relay, chain),
+			StatsPerMonth: dix.GetStatsPerMonthTableName(relay, chain),
+			RuntimeSpecs:  dix.GetRuntimeSpecsTableName(relay, chain),
+		},
+	}
+
+	err := f.readDB().QueryRowContext(ctx,
+		fmt.Sprintf("SELECT MIN(block_id), MAX(block_id) FROM %s;", schema.Tables.Blocks),
+	).Scan(&schema.MinBlockID, &schema.MaxBlockID)
+	if err != nil {
+		return schema, queryError(ctx, err)
+	}
+
+	schema.Partitions, err = f.database.GetPartitionStats(relay, chain)
+	return schema, err
+}
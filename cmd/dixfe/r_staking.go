@@ -61,10 +61,12 @@ func (f *Frontend) handleStaking(w http.ResponseWriter, r *http.Request) {
 
 	// Retrieve blocks for this address using the existing function
 	count := "5000"
-	blocks, err := f.getBlocksByAddress(address, count, fromTimestamp, toTimestamp)
+	ctx, cancel := f.queryContext(r)
+	defer cancel()
+	blocks, _, err := f.getBlocksByAddress(ctx, address, count, fromTimestamp, toTimestamp, nil)
 	if err != nil {
 		log.Printf("Error getting blocks for address %s: %v", address, err)
-		http.Error(w, "Failed to retrieve blocks", http.StatusInternalServerError)
+		writeQueryError(w, err, "Failed to retrieve blocks")
 		return
 	}
 
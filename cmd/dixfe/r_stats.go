@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,10 +14,10 @@ import (
 )
 
 type CompletionRateResponse struct {
-	RelayChain        string
-	Chain             string
-	PercentCompletion float64 `json:"percent_completion"`
-	HeadID            int     `json:"head_id"`
+	RelayChain        string  `json:"relayChain"`
+	Chain             string  `json:"chain"`
+	PercentCompletion float64 `json:"percentCompletion"`
+	HeadID            int     `json:"headId"`
 }
 
 func (f *Frontend) getCompletionRate(relaychain, chain string) (float64, int, error) {
@@ -75,21 +76,22 @@ func (f *Frontend) getCompletionRate(relaychain, chain string) (float64, int, er
 SELECT
   sum((results -> 0 -> 'total_blocks')::int)
 FROM
-  chain.dotidx_monthly_query_results
+  %s
 WHERE
-  relay_chain = '%s'
+  relay_chain = $1
 AND
-  chain = '%s'
+  chain = $2
 AND
   query_name = 'total_blocks_in_month'
+AND
+  month BETWEEN 1 AND 12
 `,
-		relaychain, chain)
-
-	log.Printf("%s", query)
+		dix.MonthlyQueryResultsTableName())
 
 	var count int
-	err = f.db.QueryRow(query).Scan(&count)
+	err = f.readDB().QueryRow(query, relaychain, chain).Scan(&count)
 	if err != nil {
+		f.database.LogSQL(query)
 		return float64(0.0), 0, fmt.Errorf("database query failed: %w", err)
 	}
 
@@ -132,22 +134,16 @@ func (f *Frontend) handleCompletionRate(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	// Set content type and encode response as JSON
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(responses); err != nil {
-		log.Printf("Error encoding responses: %v", err)
-		http.Error(w, "Error encoding responses", http.StatusInternalServerError)
-		return
-	}
+	f.writeJSON(w, responses)
 }
 
 type MonthlyStats struct {
-	Relaychain string
-	Chain      string
+	Relaychain string `json:"relayChain"`
+	Chain      string `json:"chain"`
 	Date       string `json:"date"`
 	Count      int    `json:"count"`
-	MinBlock   int    `json:"min_block"`
-	MaxBlock   int    `json:"max_block"`
+	MinBlock   int    `json:"minBlock"`
+	MaxBlock   int    `json:"maxBlock"`
 }
 
 func (f *Frontend) handleStatsPerMonth(w http.ResponseWriter, r *http.Request) {
@@ -175,10 +171,12 @@ func (f *Frontend) handleStatsPerMonth(w http.ResponseWriter, r *http.Request) {
 
 	for i := range infos {
 
-		stats, err := f.getMonthlyStats(infos[i].Relaychain, infos[i].Chain)
+		ctx, cancel := f.queryContext(r)
+		stats, err := f.getMonthlyStats(ctx, infos[i].Relaychain, infos[i].Chain)
+		cancel()
 		if err != nil {
 			log.Printf("Error getting monthly stats: %v", err)
-			http.Error(w, "Error retrieving monthly statistics", http.StatusInternalServerError)
+			writeQueryError(w, err, "Error retrieving monthly statistics")
 			return
 		}
 
@@ -196,17 +194,11 @@ func (f *Frontend) handleStatsPerMonth(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Set content type and encode response as JSON
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(responses); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
-		return
-	}
+	f.writeJSON(w, responses)
 }
 
 // getMonthlyStats queries the database to get statistics per month
-func (f *Frontend) getMonthlyStats(relaychain, chain string) ([]MonthlyStats, error) {
+func (f *Frontend) getMonthlyStats(ctx context.Context, relaychain, chain string) ([]MonthlyStats, error) {
 	// SQL query to get block statistics per month
 	query := fmt.Sprintf(`
 		SELECT *
@@ -216,9 +208,10 @@ func (f *Frontend) getMonthlyStats(relaychain, chain string) ([]MonthlyStats, er
 	// log.Printf("%s", query)
 
 	// Execute the query
-	rows, err := f.db.Query(query)
+	start := time.Now()
+	rows, err := f.readDB().QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("database query failed: %w", err)
+		return nil, queryError(ctx, err)
 	}
 	defer rows.Close()
 
@@ -243,6 +236,7 @@ func (f *Frontend) getMonthlyStats(relaychain, chain string) ([]MonthlyStats, er
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
+	f.explainSlowQuery(query, nil, time.Since(start))
 
 	return stats, nil
 }
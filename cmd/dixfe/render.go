@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+const (
+	contentJSON = "application/json"
+	contentCSV  = "text/csv"
+	contentTSV  = "text/tab-separated-values"
+)
+
+var tableExtensions = map[string]string{
+	contentJSON: "json",
+	contentCSV:  "csv",
+	contentTSV:  "tsv",
+}
+
+// negotiateTable picks the table format with the highest quality in an
+// Accept header, JSON when the header is empty or accepts anything. ok is
+// false when none of the formats is acceptable.
+func negotiateTable(accept string) (contentType string, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return contentJSON, true
+	}
+	best := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		candidate := ""
+		switch mediaType {
+		case contentJSON, contentCSV, contentTSV:
+			candidate = mediaType
+		case "application/*", "*/*":
+			candidate = contentJSON
+		case "text/*":
+			candidate = contentCSV
+		}
+		if candidate != "" && quality > 0 && quality > best {
+			contentType, best = candidate, quality
+		}
+	}
+	return contentType, contentType != ""
+}
+
+// writeTable writes result as JSON, CSV or TSV
+func writeTable(w http.ResponseWriter, contentType string, result dix.SqlResult) {
+	w.Header().Set("Content-Type", contentType)
+	var err error
+	switch contentType {
+	case contentCSV:
+		err = writeDelimited(w, result, ',')
+	case contentTSV:
+		err = writeDelimited(w, result, '\t')
+	default:
+		err = json.NewEncoder(w).Encode(result)
+	}
+	if err != nil {
+		log.Printf("Error writing %s: %v", contentType, err)
+	}
+}
+
+// writeDelimited writes one row per result row, the columns are the union
+// of the row keys sorted by name. Nested values are written as JSON.
+func writeDelimited(w io.Writer, result dix.SqlResult, comma rune) error {
+	columns := make(map[string]struct{})
+	for _, row := range result {
+		for column := range row {
+			columns[column] = struct{}{}
+		}
+	}
+	header := slices.Sorted(maps.Keys(columns))
+
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	for _, row := range result {
+		for i, column := range header {
+			value, err := cellValue(row[column])
+			if err != nil {
+				return fmt.Errorf("column %s: %w", column, err)
+			}
+			record[i] = value
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func cellValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
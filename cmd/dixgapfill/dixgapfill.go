@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"sync"
+
+	_ "github.com/lib/pq"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// blocks checked per query, bounds the missing ids held at once
+const gapWindow = 1000000
+
+func main() {
+	configFile := flag.String("conf", "", "toml configuration file")
+	chain := flag.String("chain", "", "chain")
+	relayChain := flag.String("relayChain", "polkadot", "relay chain")
+	startRange := flag.Int("start", 1, "first block to check")
+	endRange := flag.Int("end", -1, "last block to check, the head when -1")
+	gapTolerance := flag.Int("gap", -1, "saved blocks fetched again to join two missing ones, gap_tolerance when -1")
+	dryRun := flag.Bool("dry-run", false, "print the ranges to fetch and exit")
+	showVersion := dix.VersionFlag()
+	flag.Parse()
+	if dix.PrintVersion("dixgapfill", *showVersion) {
+		return
+	}
+
+	if *chain == "" {
+		log.Fatal("Chain must be specified")
+	}
+	if *configFile == "" {
+		log.Fatal("Configuration file must be specified")
+	}
+	if *endRange != -1 && *startRange > *endRange {
+		log.Fatalf("Start %d is after end %d", *startRange, *endRange)
+	}
+
+	config, err := dix.LoadMgrConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dix.SetupSignalHandler(cancel)
+
+	database := dix.NewSQLDatabase(*config)
+	if err := database.Ping(); err != nil {
+		log.Fatalf("Failed to ping PostgreSQL: %v", err)
+	}
+
+	chainConfig := config.Parachains[*relayChain][*chain]
+	reader := dix.NewSidecar(*relayChain, *chain, dix.ChainreaderURL(chainConfig))
+	reader.SetMaxResponseBytes(config.DotidxBatch.MaxResponseBytes)
+	if err := dix.ConfigureSidecar(reader, chainConfig); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := reader.Ping(); err != nil {
+		log.Fatalf("Sidecar service test failed: %v", err)
+	}
+
+	if *endRange == -1 {
+		*endRange, err = dix.IndexableHeadID(reader, config.DotidxBatch.FinalizedOnly)
+		if err != nil {
+			log.Fatalf("Failed to fetch head block: %v", err)
+		}
+	}
+
+	if *gapTolerance < 0 {
+		*gapTolerance = config.DotidxBatch.GapTolerance
+	}
+	workers, _ := dix.EffectiveWorkers(*config)
+	filled := 0
+	for first := *startRange; first <= *endRange && ctx.Err() == nil; first += gapWindow {
+		last := min(first+gapWindow-1, *endRange)
+		missing, err := database.MissingBlocks(ctx, *relayChain, *chain, first, last)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ranges := dix.CoalesceBlockRanges(missing, config.DotidxBatch.BatchSize, *gapTolerance)
+		fetched := 0
+		for _, r := range ranges {
+			fetched += r.Len()
+		}
+		log.Printf("Blocks [%d, %d] of %s:%s: %d missing in %d ranges of %d blocks",
+			first, last, *relayChain, *chain, len(missing), len(ranges), fetched)
+		if *dryRun {
+			for _, r := range ranges {
+				log.Printf("  %s", r)
+			}
+			continue
+		}
+		fetchRanges(ctx, ranges, workers, *relayChain, *chain, database, reader, config.DotidxBatch.FlushBytes)
+		filled += len(missing)
+	}
+	if ctx.Err() != nil {
+		log.Printf("Interrupted after filling %d blocks of %s:%s", filled, *relayChain, *chain)
+		return
+	}
+	if !*dryRun {
+		log.Printf("Filled %d blocks of %s:%s", filled, *relayChain, *chain)
+	}
+}
+
+// fetchRanges fetches and saves the ranges with that many workers
+func fetchRanges(
+	ctx context.Context,
+	ranges []dix.BlockRange,
+	workers int,
+	relayChain, chain string,
+	db dix.Database,
+	reader dix.ChainReader,
+	flushBytes int64) {
+
+	rangeCh := make(chan dix.BlockRange)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rangeCh {
+				dix.ProcessBlockBatch(ctx, r.IDs(), relayChain, chain, db, reader, flushBytes)
+			}
+		}()
+	}
+
+send:
+	for _, r := range ranges {
+		select {
+		case <-ctx.Done():
+			break send
+		case rangeCh <- r:
+		}
+	}
+	close(rangeCh)
+	wg.Wait()
+}
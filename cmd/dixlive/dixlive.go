@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -23,11 +26,20 @@ type ChainState struct {
 	relayChain string
 	chain      string
 	url        string
+	// headers and client certificate of the chain reader
+	config dix.ParaChainConfig
+	// set while a pass of processLastBlocks runs
+	busy atomic.Bool
 }
 
 func main() {
 	configFile := flag.String("conf", "", "toml configuration file")
+	streamAddr := flag.String("stream-addr", "", "serve new blocks and their addresses as Server-Sent Events on this address, e.g. 127.0.0.1:8090")
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixlive", *showVersion) {
+		return
+	}
 
 	if configFile == nil || *configFile == "" {
 		log.Fatal("Configuration file must be specified")
@@ -37,6 +49,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	if err := dix.CheckTableNameCollisions(config.Parachains); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Set up logging
 	log.SetOutput(os.Stdout)
@@ -61,15 +76,17 @@ func main() {
 	for relayChain := range config.Parachains {
 		readers[relayChain] = make(map[string]*ChainState)
 		for chain := range config.Parachains[relayChain] {
-			ip := config.Parachains[relayChain][chain].ChainreaderIP
-			port := config.Parachains[relayChain][chain].ChainreaderPort
-			url := fmt.Sprintf("http://%s:%d", ip, port)
+			chainConfig := config.Parachains[relayChain][chain]
+			url := dix.ChainreaderURL(chainConfig)
 			reader := dix.NewSidecar(relayChain, chain, url)
+			if err := dix.ConfigureSidecar(reader, chainConfig); err != nil {
+				log.Fatalf("Invalid chain reader configuration for %s:%s: %v", relayChain, chain, err)
+			}
 			if err := reader.Ping(); err != nil {
 				log.Printf("Sidecar service test for %s:%s failed: %v", relayChain, chain, err)
 				continue
 			}
-			headBlockID, err := reader.GetChainHeadID()
+			headBlockID, err := dix.IndexableHeadID(reader, config.DotidxBatch.FinalizedOnly)
 			if err != nil {
 				log.Printf("Failed to fetch head block for %s:%s: %v", relayChain, chain, err)
 				continue
@@ -83,6 +100,7 @@ func main() {
 				relayChain: relayChain,
 				chain:      chain,
 				url:        url,
+				config:     chainConfig,
 			}
 		}
 	}
@@ -96,6 +114,31 @@ func main() {
 	}
 	log.Printf("Successfully connected to database %s", dix.DBUrl(*config))
 
+	if err := dix.ValidateWebhooks(config.Webhooks, config.Parachains); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	bus := dix.NewEventBus()
+	if *streamAddr != "" || len(config.Webhooks) > 0 {
+		database.SetEventBus(bus)
+	}
+	if watchList := dix.StartWatchList(ctx, *config, database, bus); watchList != nil {
+		log.Printf("Watching %d addresses", len(watchList.List()))
+	}
+	if len(config.Webhooks) > 0 {
+		log.Printf("Delivering %d webhooks", len(config.Webhooks))
+		go dix.NewWebhookDispatcher(bus, config.Webhooks).Run(ctx)
+	}
+	if *streamAddr != "" {
+		server := &http.Server{Addr: *streamAddr, Handler: streamRoutes(bus, config.Parachains)}
+		go func() {
+			log.Printf("Streaming new blocks on http://%s/stream/blocks and their addresses on /stream/addresses", *streamAddr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Stream server failed: %v", err)
+			}
+		}()
+		defer server.Close()
+	}
+
 	for relayChain := range readers {
 		for chain := range readers[relayChain] {
 			reader := readers[relayChain][chain].reader
@@ -126,14 +169,24 @@ func main() {
 	// ----------------------------------------------------------------------
 	// Monitoring
 	// ----------------------------------------------------------------------
+	if err := runLive(ctx, *config, database, readers); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Error monitoring blocks: %v", err)
+	}
+}
+
+// runLive follows the head of every chain in readers until ctx is done,
+// disconnected readers are retried in the background
+func runLive(
+	ctx context.Context,
+	config dix.MgrConfig,
+	db dix.Database,
+	readers map[string]map[string]*ChainState,
+) error {
 	log.Println("Starting reconnection loop...")
 	startReconnectionLoop(ctx, readers)
 
 	log.Println("Starting monitoring for new blocks...")
-	if err := monitorNewBlocks(ctx, *config, database, readers); err != nil {
-		log.Fatalf("Error monitoring blocks: %v", err)
-	}
-
+	return monitorNewBlocks(ctx, config, db, readers)
 }
 
 // markDisconnected marks a chain reader as disconnected
@@ -160,6 +213,10 @@ func (cs *ChainState) attemptReconnect() bool {
 
 	// Create a new reader
 	newReader := dix.NewSidecar(cs.relayChain, cs.chain, cs.url)
+	if err := dix.ConfigureSidecar(newReader, cs.config); err != nil {
+		log.Printf("Reconnect failed for %s:%s: %v", cs.relayChain, cs.chain, err)
+		return false
+	}
 
 	// Test connection
 	if err := newReader.Ping(); err != nil {
@@ -174,27 +231,36 @@ func (cs *ChainState) attemptReconnect() bool {
 		return false
 	}
 
-	// Success! Update the reader and mark as connected
+	// Success! Update the reader and mark as connected, current is kept so
+	// that the blocks produced while disconnected are filled
 	cs.reader = newReader
 	cs.head = headBlockID
-	cs.current = headBlockID
 	cs.connected = true
 	log.Printf("Successfully reconnected to %s:%s, head block: %d", cs.relayChain, cs.chain, headBlockID)
 	return true
 }
 
+// processLastBlocks saves the blocks from the current one up to the head,
+// or up to the finalized head with finalizedOnly so that the blocks above
+// it wait for a later pass
 func processLastBlocks(
 	relayChain, chain string,
 	ctx context.Context,
 	db dix.Database,
 	state *ChainState,
+	finalizedOnly bool,
 ) error {
 	// Skip if not connected
 	if !state.isConnected() {
 		return fmt.Errorf("reader not connected")
 	}
+	// Skip if the previous pass is still catching up
+	if !state.busy.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer state.busy.Store(false)
 
-	head, err := state.reader.GetChainHeadID()
+	head, err := dix.IndexableHeadID(state.reader, finalizedOnly)
 	if err != nil {
 		log.Printf("Error fetching head block for %s:%s: %v", relayChain, chain, err)
 		state.markDisconnected()
@@ -219,7 +285,8 @@ func processLastBlocks(
 		}
 		next++
 	}
-	state.current = head
+	// a block that failed is fetched again on the next pass
+	state.current = next
 	return nil
 }
 
@@ -274,6 +341,7 @@ func monitorNewBlocks(
 						ctx,
 						db,
 						readers[relayChain][chain],
+						config.DotidxBatch.FinalizedOnly,
 					)
 				}
 			}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// savedBlocks records the blocks saved by the live indexer
+type savedBlocks struct {
+	dix.Database
+	mu  sync.Mutex
+	ids []int
+}
+
+func (s *savedBlocks) Save(items []dix.BlockData, relayChain, chain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		id, _ := strconv.Atoi(item.ID)
+		s.ids = append(s.ids, id)
+	}
+	return nil
+}
+
+func (s *savedBlocks) saved() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ids)
+}
+
+// fixtureReader serves head as the chain head and finalized as the
+// finalized one, block failing answers 500 once
+func fixtureReader(head int, finalized *atomic.Int64, failing int) *httptest.Server {
+	var mu sync.Mutex
+	failed := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/blocks/")
+		switch {
+		case id == "head":
+			id = strconv.Itoa(head)
+		case id == "head/header" && r.URL.Query().Get("finalized") == "true":
+			id = strconv.FormatInt(finalized.Load(), 10)
+		}
+		mu.Lock()
+		fail := id == strconv.Itoa(failing) && !failed
+		failed = failed || fail
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dix.BlockData{ID: id, Extrinsics: json.RawMessage(`[]`)})
+	}))
+}
+
+func TestRunLiveFollowsHead(t *testing.T) {
+	var finalized atomic.Int64
+	server := fixtureReader(12, &finalized, 11)
+	defer server.Close()
+
+	readers := map[string]map[string]*ChainState{
+		"polkadot": {"polkadot": {
+			reader:     dix.NewSidecar("polkadot", "polkadot", server.URL),
+			current:    10,
+			head:       10,
+			connected:  true,
+			relayChain: "polkadot",
+			chain:      "polkadot",
+			url:        server.URL,
+		}},
+	}
+	database := &savedBlocks{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- runLive(ctx, dix.MgrConfig{}, database, readers)
+	}()
+
+	// block 11 fails on the first pass and disconnects the reader, the pass
+	// after the reconnection starts again from it
+	state := readers["polkadot"]["polkadot"]
+	waitFor(t, func() bool { return !state.isConnected() })
+	if !state.attemptReconnect() {
+		t.Fatalf("Expected the reader to reconnect")
+	}
+	waitFor(t, func() bool { return slices.Contains(database.saved(), 12) })
+	cancel()
+	if err := <-errChan; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected runLive to stop with the context, got %v", err)
+	}
+
+	saved := database.saved()
+	if got := fmt.Sprint(saved); got != "[10 11 12]" {
+		t.Errorf("Expected blocks [10 11 12] to be saved once in order, got %s", got)
+	}
+}
+
+func TestRunLiveFinalizedOnly(t *testing.T) {
+	var finalized atomic.Int64
+	finalized.Store(11)
+	server := fixtureReader(13, &finalized, -1)
+	defer server.Close()
+
+	readers := map[string]map[string]*ChainState{
+		"polkadot": {"polkadot": {
+			reader:     dix.NewSidecar("polkadot", "polkadot", server.URL),
+			current:    10,
+			head:       11,
+			connected:  true,
+			relayChain: "polkadot",
+			chain:      "polkadot",
+			url:        server.URL,
+		}},
+	}
+	database := &savedBlocks{}
+	config := dix.MgrConfig{DotidxBatch: dix.DotidxBatch{FinalizedOnly: true}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- runLive(ctx, config, database, readers)
+	}()
+
+	// 12 and 13 are not finalized, a few passes leave them alone
+	waitFor(t, func() bool { return slices.Contains(database.saved(), 11) })
+	time.Sleep(2500 * time.Millisecond)
+	if saved := database.saved(); slices.Contains(saved, 12) {
+		t.Errorf("Expected the blocks above the finalized head to wait, got %v", saved)
+	}
+
+	finalized.Store(13)
+	waitFor(t, func() bool { return slices.Contains(database.saved(), 13) })
+	cancel()
+	if err := <-errChan; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected runLive to stop with the context, got %v", err)
+	}
+	if got := fmt.Sprint(database.saved()); got != "[10 11 12 13]" {
+		t.Errorf("Expected blocks [10 11 12 13] to be saved once in order, got %s", got)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the live indexer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
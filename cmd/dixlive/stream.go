@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// streamBuffer is how many blocks a client may lag behind before it is
+// dropped
+const streamBuffer = 64
+
+// blockEvent is what a client receives for each new block, the full block
+// is available from the frontend
+type blockEvent struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	AuthorID   string `json:"authorId"`
+	Finalized  bool   `json:"finalized"`
+}
+
+// addressEvent is what a client receives for each address found in a new
+// block
+type addressEvent struct {
+	Address string `json:"address"`
+	BlockID string `json:"blockId"`
+}
+
+// streamRoutes serves GET /stream/blocks?relay=&chain= as Server-Sent
+// Events, one "block" event per block saved by this process, GET
+// /stream/addresses?relay=&chain=, one "address" event per address of these
+// blocks, and GET /version
+func streamRoutes(bus *dix.EventBus, parachains map[string]map[string]dix.ParaChainConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /version", dix.HandleVersion)
+	mux.HandleFunc("GET /stream/blocks", func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, bus, parachains, dix.TopicNewBlock, "block", func(event dix.Event) any {
+			block := event.Block
+			return blockEvent{
+				Number:     block.ID,
+				Hash:       block.Hash,
+				ParentHash: block.ParentHash,
+				AuthorID:   block.AuthorID,
+				Finalized:  block.Finalized,
+			}
+		})
+	})
+	mux.HandleFunc("GET /stream/addresses", func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, bus, parachains, dix.TopicNewAddress, "address", func(event dix.Event) any {
+			return addressEvent{Address: event.Address, BlockID: event.BlockID}
+		})
+	})
+	return mux
+}
+
+// streamEvents sends the events of topic for the chain of the request as
+// Server-Sent Events named name until the client goes away. A client too
+// slow to keep up gets a "dropped" event and is disconnected.
+func streamEvents(w http.ResponseWriter, r *http.Request, bus *dix.EventBus, parachains map[string]map[string]dix.ParaChainConfig,
+	topic dix.Topic, name string, encode func(dix.Event) any) {
+	relay := r.URL.Query().Get("relay")
+	chain := r.URL.Query().Get("chain")
+	if _, ok := parachains[relay][chain]; !ok {
+		http.Error(w, "Invalid relay or chain", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := bus.Subscribe(topic, relay, chain, streamBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				fmt.Fprint(w, "event: dropped\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			data, err := json.Marshal(encode(event))
+			if err != nil {
+				log.Printf("Error encoding %s event: %v", name, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
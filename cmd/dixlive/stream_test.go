@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func TestStreamBlocks(t *testing.T) {
+	bus := dix.NewEventBus()
+	parachains := map[string]map[string]dix.ParaChainConfig{
+		"polkadot": {"polkadot": {}},
+	}
+	server := httptest.NewServer(streamRoutes(bus, parachains))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream/blocks?relay=polkadot&chain=polkadot", nil)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %s", ct)
+	}
+
+	for bus.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(
+		dix.Event{Topic: dix.TopicNewBlock, RelayChain: "polkadot", Chain: "kusama", Block: dix.BlockData{ID: "1", Hash: "0xother"}},
+		dix.Event{Topic: dix.TopicNewAddress, RelayChain: "polkadot", Chain: "polkadot", Address: "1abc", BlockID: "7"},
+		dix.Event{Topic: dix.TopicNewBlock, RelayChain: "polkadot", Chain: "polkadot", Block: dix.BlockData{ID: "7", Hash: "0x07", ParentHash: "0x06"}},
+	)
+
+	event, data := nextEvent(bufio.NewScanner(resp.Body))
+	if event != "block" {
+		t.Fatalf("Expected a block event, got %q", event)
+	}
+	var received blockEvent
+	if err := json.Unmarshal([]byte(data), &received); err != nil {
+		t.Fatalf("Error decoding %q: %v", data, err)
+	}
+	if received.Number != "7" || received.Hash != "0x07" || received.ParentHash != "0x06" {
+		t.Errorf("Unexpected block %+v", received)
+	}
+}
+
+// nextEvent returns the name and the data of the next Server-Sent Event
+func nextEvent(scanner *bufio.Scanner) (event, data string) {
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "event: "); ok {
+			event = value
+		}
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			return event, value
+		}
+	}
+	return event, ""
+}
+
+func TestStreamAddresses(t *testing.T) {
+	bus := dix.NewEventBus()
+	parachains := map[string]map[string]dix.ParaChainConfig{
+		"polkadot": {"polkadot": {}},
+	}
+	server := httptest.NewServer(streamRoutes(bus, parachains))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream/addresses?relay=polkadot&chain=polkadot", nil)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer resp.Body.Close()
+
+	for bus.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(
+		dix.Event{Topic: dix.TopicNewBlock, RelayChain: "polkadot", Chain: "polkadot", Block: dix.BlockData{ID: "7", Hash: "0x07"}},
+		dix.Event{Topic: dix.TopicNewAddress, RelayChain: "polkadot", Chain: "kusama", Address: "1other", BlockID: "3"},
+		dix.Event{Topic: dix.TopicNewAddress, RelayChain: "polkadot", Chain: "polkadot", Address: "1abc", BlockID: "7"},
+	)
+
+	event, data := nextEvent(bufio.NewScanner(resp.Body))
+	if event != "address" {
+		t.Fatalf("Expected an address event, got %q", event)
+	}
+	var received addressEvent
+	if err := json.Unmarshal([]byte(data), &received); err != nil {
+		t.Fatalf("Error decoding %q: %v", data, err)
+	}
+	if received.Address != "1abc" || received.BlockID != "7" {
+		t.Errorf("Unexpected address %+v", received)
+	}
+}
+
+func TestStreamBlocksUnknownChain(t *testing.T) {
+	handler := streamRoutes(dix.NewEventBus(), map[string]map[string]dix.ParaChainConfig{})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream/blocks?relay=polkadot&chain=polkadot", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
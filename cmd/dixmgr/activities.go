@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 
 	"github.com/coreos/go-systemd/v22/dbus"
+
+	"github.com/pierreaubert/dotidx/dix"
 )
 
 // Activities are the external operations that workflows can call
@@ -21,6 +25,9 @@ type Activities struct {
 	healthHistory   *HealthHistoryStore
 	dynamicConfig   *DynamicConfig
 	database        Database // Database interface for batch and cron operations
+	replica         *sql.DB  // Read replica of the frontend, nil when there is none
+	watchList       *dix.WatchList
+	actionLog       *ActionLog // Actions not executed in watch mode
 }
 
 func NewActivities(executeMode bool, metrics *MetricsCollector, alertManager *AlertManager, enableResourceMonitoring bool, cbManager *CircuitBreakerManager, healthHistory *HealthHistoryStore, dynamicConfig *DynamicConfig, processManager ProcessManager) (*Activities, error) {
@@ -69,9 +76,34 @@ func (a *Activities) Close() {
 	if a.database != nil {
 		a.database.Close()
 	}
+	if a.replica != nil {
+		a.replica.Close()
+	}
 }
 
 // SetDatabase sets the database for batch and cron operations
 func (a *Activities) SetDatabase(db Database) {
 	a.database = db
 }
+
+// SetReplica sets the read replica whose lag is checked
+func (a *Activities) SetReplica(replica *sql.DB) {
+	a.replica = replica
+}
+
+// inMaintenance reports whether the restarts are suspended, see
+// DynamicConfig.MaintenanceMode
+func (a *Activities) inMaintenance() bool {
+	return a.dynamicConfig != nil && a.dynamicConfig.InMaintenance()
+}
+
+// IsMaintenanceModeActivity reports whether the maintenance mode is on, the
+// services are then watched but not restarted
+func (a *Activities) IsMaintenanceModeActivity(ctx context.Context) (bool, error) {
+	return a.inMaintenance(), nil
+}
+
+// SetWatchList alerts on the saved blocks touching a watched address
+func (a *Activities) SetWatchList(wl *dix.WatchList) {
+	a.watchList = wl
+}
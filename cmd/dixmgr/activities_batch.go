@@ -106,6 +106,9 @@ func (a *Activities) ProcessSingleBlockActivity(ctx context.Context,
 		}
 		return fmt.Errorf("failed to save block %d: %w", blockID, err)
 	}
+	if a.watchList != nil {
+		a.watchList.Check(ctx, relayChain, chain, []dix.BlockData{block})
+	}
 
 	if a.metrics != nil {
 		a.metrics.RecordActivityExecution("ProcessSingleBlock", "success")
@@ -156,6 +159,9 @@ func (a *Activities) ProcessBlockBatchActivity(ctx context.Context,
 		}
 		return fmt.Errorf("failed to save block batch: %w", err)
 	}
+	if a.watchList != nil {
+		a.watchList.Check(ctx, relayChain, chain, blocks)
+	}
 
 	if a.metrics != nil {
 		a.metrics.RecordActivityExecution("ProcessBlockBatch", "success")
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/pierreaubert/dotidx/dix"
@@ -112,6 +113,191 @@ func (a *Activities) ExecuteAndStoreNamedQueryActivity(ctx context.Context,
 	return nil
 }
 
+// PartitionCheckResult is the result of CheckCurrentPartitionsActivity
+type PartitionCheckResult struct {
+	Healthy bool
+	// relay:chain whose blocks table has no partition for the current month
+	Missing   []string
+	Timestamp time.Time
+}
+
+// CheckCurrentPartitionsActivity verifies that every indexed chain has a
+// partition for the current month and alerts for the ones which have none:
+// their new blocks cannot be saved and the indexers only log the error
+func (a *Activities) CheckCurrentPartitionsActivity(ctx context.Context) (*PartitionCheckResult, error) {
+	start := time.Now()
+	log.Printf("[Activity] Checking the partitions of the current month")
+
+	if a.database == nil {
+		return nil, fmt.Errorf("database not configured in activities")
+	}
+
+	missing, err := a.database.MissingCurrentPartitions(start)
+	if err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckCurrentPartitions", "error")
+		}
+		return nil, fmt.Errorf("failed to list the partitions: %w", err)
+	}
+
+	result := &PartitionCheckResult{Healthy: len(missing) == 0, Missing: make([]string, 0, len(missing)), Timestamp: start}
+	month := start.UTC().Format("2006-01")
+	for _, info := range missing {
+		service := info.Relaychain + ":" + info.Chain
+		result.Missing = append(result.Missing, service)
+		log.Printf("[Activity] No partition for %s in the blocks table of %s", month, service)
+		if a.alertManager == nil {
+			continue
+		}
+		alert := Alert{
+			Type:     AlertPartitionMissing,
+			Severity: SeverityCritical,
+			Service:  service,
+			Message:  fmt.Sprintf("No partition for %s in the blocks table of %s, new blocks cannot be saved", month, service),
+			Labels: map[string]string{
+				"relay_chain": info.Relaychain,
+				"chain":       info.Chain,
+				"month":       month,
+			},
+		}
+		if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+			log.Printf("[Activity] Failed to alert on the partition of %s: %v", service, err)
+		}
+	}
+
+	if a.metrics != nil {
+		a.metrics.RecordActivityExecution("CheckCurrentPartitions", "success")
+		a.metrics.RecordActivityDuration("CheckCurrentPartitions", time.Since(start))
+	}
+	return result, nil
+}
+
+// SchemaVersionCheckResult is the result of
+// CheckDatabaseSchemaVersionActivity
+type SchemaVersionCheckResult struct {
+	Healthy bool
+	// recorded in dotidx_version, 0 when none is
+	Version int
+	// dix.SQLDatabaseSchemaVersion of this binary
+	Expected  int
+	Timestamp time.Time
+}
+
+// CheckDatabaseSchemaVersionActivity compares the schema version recorded in
+// the database with the one of this binary and alerts when they differ,
+// typically a migration forgotten after a deploy
+func (a *Activities) CheckDatabaseSchemaVersionActivity(ctx context.Context) (*SchemaVersionCheckResult, error) {
+	start := time.Now()
+	log.Printf("[Activity] Checking the database schema version")
+
+	if a.database == nil {
+		return nil, fmt.Errorf("database not configured in activities")
+	}
+
+	version, err := a.database.ReadSchemaVersion()
+	if err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckDatabaseSchemaVersion", "error")
+		}
+		return nil, fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	result := &SchemaVersionCheckResult{
+		Healthy:   version == dix.SQLDatabaseSchemaVersion,
+		Version:   version,
+		Expected:  dix.SQLDatabaseSchemaVersion,
+		Timestamp: start,
+	}
+	alert := Alert{
+		Type:     AlertSchemaMismatch,
+		Severity: SeverityCritical,
+		Service:  "database",
+		Message: fmt.Sprintf("Database schema is at version %d, the binaries expect version %d",
+			version, dix.SQLDatabaseSchemaVersion),
+		Labels: map[string]string{
+			"version":  strconv.Itoa(version),
+			"expected": strconv.Itoa(dix.SQLDatabaseSchemaVersion),
+		},
+	}
+	switch {
+	case result.Healthy && a.alertManager != nil:
+		a.alertManager.ResolveAlert(alert)
+	case !result.Healthy:
+		log.Printf("[Activity] %s", alert.Message)
+		if a.alertManager != nil {
+			if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+				log.Printf("[Activity] Failed to alert on the schema version: %v", err)
+			}
+		}
+	}
+
+	if a.metrics != nil {
+		a.metrics.RecordActivityExecution("CheckDatabaseSchemaVersion", "success")
+		a.metrics.RecordActivityDuration("CheckDatabaseSchemaVersion", time.Since(start))
+	}
+	return result, nil
+}
+
+// ReplicationLagResult is the result of CheckReplicationLagActivity
+type ReplicationLagResult struct {
+	Healthy   bool
+	Lag       time.Duration
+	MaxLag    time.Duration
+	Timestamp time.Time
+}
+
+// CheckReplicationLagActivity measures how far the read replica is behind
+// the primary and alerts above maxLag, the frontend then serves stale data.
+// It does nothing without a replica.
+func (a *Activities) CheckReplicationLagActivity(ctx context.Context, maxLag time.Duration) (*ReplicationLagResult, error) {
+	start := time.Now()
+	if maxLag == 0 {
+		maxLag = dix.DefaultReplicaMaxLag
+	}
+	result := &ReplicationLagResult{Healthy: true, MaxLag: maxLag, Timestamp: start}
+	if a.replica == nil {
+		return result, nil
+	}
+	log.Printf("[Activity] Checking the replication lag")
+
+	lag, err := dix.ReplicationLag(ctx, a.replica)
+	if err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckReplicationLag", "error")
+		}
+		return nil, err
+	}
+	result.Lag = lag
+	result.Healthy = lag <= maxLag
+
+	alert := Alert{
+		Type:     AlertReplicationLag,
+		Severity: SeverityWarning,
+		Service:  "replica",
+		Message:  fmt.Sprintf("Read replica is %s behind the primary, more than %s", lag.Round(time.Second), maxLag),
+		Labels: map[string]string{
+			"lag_seconds": strconv.FormatFloat(lag.Seconds(), 'f', 0, 64),
+		},
+	}
+	switch {
+	case result.Healthy && a.alertManager != nil:
+		a.alertManager.ResolveAlert(alert)
+	case !result.Healthy:
+		log.Printf("[Activity] %s", alert.Message)
+		if a.alertManager != nil {
+			if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+				log.Printf("[Activity] Failed to alert on the replication lag: %v", err)
+			}
+		}
+	}
+
+	if a.metrics != nil {
+		a.metrics.RecordActivityExecution("CheckReplicationLag", "success")
+		a.metrics.RecordActivityDuration("CheckReplicationLag", time.Since(start))
+	}
+	return result, nil
+}
+
 // RegisterDefaultQueriesActivity registers the default queries used by dixcron
 func (a *Activities) RegisterDefaultQueriesActivity(ctx context.Context) error {
 	start := time.Now()
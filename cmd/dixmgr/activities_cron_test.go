@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// partitionsDatabase reports the chains in missing as lacking the partition
+// of the current month
+type partitionsDatabase struct {
+	Database
+	missing []dix.DatabaseInfo
+}
+
+func (d *partitionsDatabase) MissingCurrentPartitions(now time.Time) ([]dix.DatabaseInfo, error) {
+	return d.missing, nil
+}
+
+func TestCheckCurrentPartitionsActivity(t *testing.T) {
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, 5*time.Minute)
+	alertManager.RegisterChannel(channel)
+	database := &partitionsDatabase{}
+	activities := &Activities{database: database, alertManager: alertManager}
+	ctx := context.Background()
+
+	result, err := activities.CheckCurrentPartitionsActivity(ctx)
+	if err != nil {
+		t.Fatalf("CheckCurrentPartitionsActivity: %v", err)
+	}
+	if !result.Healthy || channel.count() != 0 {
+		t.Errorf("Expected a healthy check without alert, got %+v and %d alerts", result, channel.count())
+	}
+
+	database.missing = []dix.DatabaseInfo{{Relaychain: "polkadot", Chain: "assethub"}}
+	result, err = activities.CheckCurrentPartitionsActivity(ctx)
+	if err != nil {
+		t.Fatalf("CheckCurrentPartitionsActivity: %v", err)
+	}
+	if result.Healthy {
+		t.Error("Expected the check to fail without the current partition")
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != "polkadot:assethub" {
+		t.Errorf("Expected polkadot:assethub to miss its partition, got %v", result.Missing)
+	}
+	if channel.count() != 1 {
+		t.Fatalf("Expected 1 alert, got %d", channel.count())
+	}
+	if alert := channel.alerts[0]; alert.Type != AlertPartitionMissing || alert.Severity != SeverityCritical || alert.Labels["chain"] != "assethub" {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+}
+
+// versionDatabase has its schema at version
+type versionDatabase struct {
+	Database
+	version int
+}
+
+func (d *versionDatabase) ReadSchemaVersion() (int, error) {
+	return d.version, nil
+}
+
+func TestCheckDatabaseSchemaVersionActivity(t *testing.T) {
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, 5*time.Minute)
+	alertManager.RegisterChannel(channel)
+	database := &versionDatabase{version: dix.SQLDatabaseSchemaVersion}
+	activities := &Activities{database: database, alertManager: alertManager}
+	ctx := context.Background()
+
+	result, err := activities.CheckDatabaseSchemaVersionActivity(ctx)
+	if err != nil {
+		t.Fatalf("CheckDatabaseSchemaVersionActivity: %v", err)
+	}
+	if !result.Healthy || channel.count() != 0 {
+		t.Errorf("Expected a matching version without alert, got %+v and %d alerts", result, channel.count())
+	}
+
+	// a migration forgotten after a deploy
+	database.version = dix.SQLDatabaseSchemaVersion - 1
+	result, err = activities.CheckDatabaseSchemaVersionActivity(ctx)
+	if err != nil {
+		t.Fatalf("CheckDatabaseSchemaVersionActivity: %v", err)
+	}
+	if result.Healthy || result.Version != dix.SQLDatabaseSchemaVersion-1 || result.Expected != dix.SQLDatabaseSchemaVersion {
+		t.Errorf("Expected a version mismatch, got %+v", result)
+	}
+	if channel.count() != 1 || channel.alerts[0].Type != AlertSchemaMismatch {
+		t.Fatalf("Expected a schema_mismatch alert, got %+v", channel.alerts)
+	}
+
+	// once migrated the alert is resolved
+	database.version = dix.SQLDatabaseSchemaVersion
+	if _, err := activities.CheckDatabaseSchemaVersionActivity(ctx); err != nil {
+		t.Fatalf("CheckDatabaseSchemaVersionActivity: %v", err)
+	}
+	if active := alertManager.GetActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected no active alert after the migration, got %+v", active)
+	}
+}
+
+func TestCheckReplicationLagActivity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, 5*time.Minute)
+	alertManager.RegisterChannel(channel)
+	activities := &Activities{alertManager: alertManager}
+	activities.SetReplica(db)
+	ctx := context.Background()
+
+	expectLag := func(seconds float64) {
+		mock.ExpectQuery("pg_last_wal_receive_lsn\\(\\)").
+			WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery", "lag"}).AddRow(true, seconds))
+	}
+
+	expectLag(5)
+	result, err := activities.CheckReplicationLagActivity(ctx, 30*time.Second)
+	if err != nil {
+		t.Fatalf("CheckReplicationLagActivity: %v", err)
+	}
+	if !result.Healthy || result.Lag != 5*time.Second || channel.count() != 0 {
+		t.Errorf("Expected a healthy replica without alert, got %+v and %d alerts", result, channel.count())
+	}
+
+	expectLag(120.5)
+	result, err = activities.CheckReplicationLagActivity(ctx, 30*time.Second)
+	if err != nil {
+		t.Fatalf("CheckReplicationLagActivity: %v", err)
+	}
+	if result.Healthy || result.Lag != 120500*time.Millisecond {
+		t.Errorf("Expected a lagging replica, got %+v", result)
+	}
+	if channel.count() != 1 || channel.alerts[0].Type != AlertReplicationLag {
+		t.Fatalf("Expected a replication_lag alert, got %+v", channel.alerts)
+	}
+
+	// the default threshold is a minute
+	expectLag(45)
+	if result, err := activities.CheckReplicationLagActivity(ctx, 0); err != nil || !result.Healthy {
+		t.Errorf("Expected 45s to be within the default threshold, got %+v %v", result, err)
+	}
+	if active := alertManager.GetActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected the alert to be resolved, got %+v", active)
+	}
+
+	// the primary instead of a replica
+	mock.ExpectQuery("pg_last_wal_receive_lsn\\(\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_is_in_recovery", "lag"}).AddRow(false, 0))
+	if _, err := activities.CheckReplicationLagActivity(ctx, 0); err == nil {
+		t.Error("Expected an error when the database is not a replica")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -20,26 +20,27 @@ type HTTPHealthCheckConfig struct {
 	Timeout          time.Duration     // Request timeout
 	ResponseContains string            // Optional: check if response contains this string
 	JSONPath         string            // Optional: JSON path to check (e.g., "status.healthy")
+	Attempts         int               // Attempts before reporting unhealthy (0 = 3, 1 = no retry)
+	RetryDelay       time.Duration     // Delay between attempts (0 = 500ms)
 }
 
 // HTTPHealthCheckResult contains the result of an HTTP health check
 type HTTPHealthCheckResult struct {
-	Healthy        bool
-	StatusCode     int
-	ResponseTime   time.Duration
-	ResponseBody   string // Limited to first 1KB
-	Error          string
-	Timestamp      time.Time
+	Healthy      bool
+	StatusCode   int
+	ResponseTime time.Duration // Latency of the last attempt
+	ResponseBody string        // Limited to first 1KB
+	BodyMatched  bool          // Response contains ResponseContains, true when not set
+	Attempts     int           // Attempts made, more than 1 when the first ones failed
+	Error        string
+	Timestamp    time.Time
 }
 
 // CheckHTTPEndpointActivity performs HTTP health check on an endpoint
 // Supports various health check patterns: status code, response content, JSON parsing
+// A failed check is retried quickly a couple of times to avoid false positives
 func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPHealthCheckConfig) (*HTTPHealthCheckResult, error) {
 	start := time.Now()
-	result := &HTTPHealthCheckResult{
-		Timestamp: start,
-		Healthy:   false,
-	}
 
 	// Set defaults
 	if config.Method == "" {
@@ -48,8 +49,11 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 	if config.Timeout == 0 {
 		config.Timeout = 5 * time.Second
 	}
-	if config.ExpectedStatus == 0 {
-		config.ExpectedStatus = 200
+	if config.Attempts <= 0 {
+		config.Attempts = 3
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = 500 * time.Millisecond
 	}
 
 	log.Printf("[Activity] HTTP health check: %s %s", config.Method, config.URL)
@@ -59,11 +63,39 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 		Timeout: config.Timeout,
 	}
 
+	var result *HTTPHealthCheckResult
+	for attempt := 1; attempt <= config.Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return result, nil
+			case <-time.After(config.RetryDelay):
+			}
+			log.Printf("[Activity] Retrying HTTP health check of %s (attempt %d/%d)", config.URL, attempt, config.Attempts)
+		}
+		result = checkHTTPEndpointOnce(ctx, client, config)
+		result.Attempts = attempt
+		result.Timestamp = start
+		if result.Healthy {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// checkHTTPEndpointOnce makes one attempt of CheckHTTPEndpointActivity
+func checkHTTPEndpointOnce(ctx context.Context, client *http.Client, config HTTPHealthCheckConfig) *HTTPHealthCheckResult {
+	start := time.Now()
+	result := &HTTPHealthCheckResult{
+		Healthy: false,
+	}
+
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, config.Method, config.URL, nil)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to create request: %v", err)
-		return result, nil // Return result with error, don't fail activity
+		return result // Return result with error, don't fail activity
 	}
 
 	// Add custom headers
@@ -77,7 +109,7 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 		result.Error = fmt.Sprintf("HTTP request failed: %v", err)
 		result.ResponseTime = time.Since(start)
 		log.Printf("[Activity] HTTP health check failed for %s: %v", config.URL, err)
-		return result, nil
+		return result
 	}
 	defer resp.Body.Close()
 
@@ -88,32 +120,33 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to read response: %v", err)
-		return result, nil
+		return result
 	}
 	result.ResponseBody = string(bodyBytes)
+	result.BodyMatched = strings.Contains(result.ResponseBody, config.ResponseContains)
 
 	// Check status code
 	if config.ExpectedStatus > 0 {
 		if resp.StatusCode != config.ExpectedStatus {
 			result.Error = fmt.Sprintf("unexpected status code: got %d, want %d", resp.StatusCode, config.ExpectedStatus)
 			log.Printf("[Activity] HTTP health check unhealthy: %s returned %d", config.URL, resp.StatusCode)
-			return result, nil
+			return result
 		}
 	} else {
 		// Accept any 2xx status code
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 			result.Error = fmt.Sprintf("non-2xx status code: %d", resp.StatusCode)
 			log.Printf("[Activity] HTTP health check unhealthy: %s returned %d", config.URL, resp.StatusCode)
-			return result, nil
+			return result
 		}
 	}
 
 	// Check response content if specified
 	if config.ResponseContains != "" {
-		if !strings.Contains(result.ResponseBody, config.ResponseContains) {
+		if !result.BodyMatched {
 			result.Error = fmt.Sprintf("response does not contain expected string: %s", config.ResponseContains)
 			log.Printf("[Activity] HTTP health check unhealthy: response missing expected content")
-			return result, nil
+			return result
 		}
 	}
 
@@ -123,12 +156,12 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 		if err != nil {
 			result.Error = fmt.Sprintf("JSON path check failed: %v", err)
 			log.Printf("[Activity] HTTP health check unhealthy: JSON path error: %v", err)
-			return result, nil
+			return result
 		}
 		if !healthy {
 			result.Error = fmt.Sprintf("JSON path %s indicates unhealthy", config.JSONPath)
 			log.Printf("[Activity] HTTP health check unhealthy: JSON path check failed")
-			return result, nil
+			return result
 		}
 	}
 
@@ -137,7 +170,7 @@ func (a *Activities) CheckHTTPEndpointActivity(ctx context.Context, config HTTPH
 	log.Printf("[Activity] HTTP health check passed for %s (status=%d, time=%v)",
 		config.URL, result.StatusCode, result.ResponseTime)
 
-	return result, nil
+	return result
 }
 
 // checkJSONPath checks if a JSON path evaluates to true/healthy
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckHTTPEndpointActivityStatusMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"code":503}`))
+	}))
+	defer server.Close()
+
+	activities := &Activities{}
+	result, err := activities.CheckHTTPEndpointActivity(context.Background(), HTTPHealthCheckConfig{
+		URL:            server.URL + "/blocks/head",
+		ExpectedStatus: http.StatusOK,
+		RetryDelay:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("CheckHTTPEndpointActivity: %v", err)
+	}
+	if result.Healthy || result.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected an unhealthy 503, got %+v", result)
+	}
+	if !strings.Contains(result.Error, "got 503, want 200") {
+		t.Errorf("Expected a status mismatch, got %q", result.Error)
+	}
+	if result.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", result.Attempts)
+	}
+}
+
+func TestCheckHTTPEndpointActivityBodyMatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number":"1234","hash":"0xabcd"}`))
+	}))
+	defer server.Close()
+
+	activities := &Activities{}
+	ctx := context.Background()
+	result, err := activities.CheckHTTPEndpointActivity(ctx, HTTPHealthCheckConfig{
+		URL:              server.URL + "/blocks/head",
+		ResponseContains: `"number"`,
+	})
+	if err != nil {
+		t.Fatalf("CheckHTTPEndpointActivity: %v", err)
+	}
+	if !result.Healthy || !result.BodyMatched || result.StatusCode != http.StatusOK || result.Attempts != 1 {
+		t.Errorf("Expected a healthy match at the first attempt, got %+v", result)
+	}
+	if result.ResponseTime <= 0 {
+		t.Errorf("Expected the latency to be measured, got %v", result.ResponseTime)
+	}
+
+	result, err = activities.CheckHTTPEndpointActivity(ctx, HTTPHealthCheckConfig{
+		URL:              server.URL + "/blocks/head",
+		ResponseContains: `"extrinsics"`,
+		Attempts:         1,
+	})
+	if err != nil {
+		t.Fatalf("CheckHTTPEndpointActivity: %v", err)
+	}
+	if result.Healthy || result.BodyMatched {
+		t.Errorf("Expected the body not to match, got %+v", result)
+	}
+}
+
+func TestCheckHTTPEndpointActivityRetryThenSuccess(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the sidecar is briefly unavailable
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"number":"1234"}`))
+	}))
+	defer server.Close()
+
+	activities := &Activities{}
+	result, err := activities.CheckHTTPEndpointActivity(context.Background(), HTTPHealthCheckConfig{
+		URL:        server.URL + "/blocks/head",
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("CheckHTTPEndpointActivity: %v", err)
+	}
+	if !result.Healthy || result.Attempts != 3 || result.Error != "" {
+		t.Errorf("Expected healthy at the third attempt, got %+v", result)
+	}
+}
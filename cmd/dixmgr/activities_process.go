@@ -11,6 +11,7 @@ import (
 func (a *Activities) StartProcessActivity(ctx context.Context, config ProcessConfig) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would start process: %s", config.Name)
+		a.recordIntendedAction(ctx, "process", config.Name, "start")
 		return nil
 	}
 
@@ -53,6 +54,7 @@ func (a *Activities) StartProcessActivity(ctx context.Context, config ProcessCon
 func (a *Activities) StopProcessActivity(ctx context.Context, name string) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would stop process: %s", name)
+		a.recordIntendedAction(ctx, "process", name, "stop")
 		return nil
 	}
 
@@ -79,6 +81,11 @@ func (a *Activities) StopProcessActivity(ctx context.Context, name string) error
 func (a *Activities) RestartProcessActivity(ctx context.Context, name string) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would restart process: %s", name)
+		a.recordIntendedAction(ctx, "process", name, "restart")
+		return nil
+	}
+	if a.inMaintenance() {
+		log.Printf("[Activity] [MAINTENANCE] Not restarting process: %s", name)
 		return nil
 	}
 
@@ -184,6 +191,7 @@ func (a *Activities) GetProcessOutputActivity(ctx context.Context, name string,
 func (a *Activities) KillProcessActivity(ctx context.Context, name string) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would kill process: %s", name)
+		a.recordIntendedAction(ctx, "process", name, "kill")
 		return nil
 	}
 
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stoppedProcessManager reports every process stopped and counts restarts
+type stoppedProcessManager struct {
+	ProcessManager
+	restarts int
+}
+
+func (m *stoppedProcessManager) GetStatus(ctx context.Context, name string) (*ProcessStatus, error) {
+	return &ProcessStatus{Name: name, State: StateStopped, Healthy: false}, nil
+}
+
+func (m *stoppedProcessManager) Restart(ctx context.Context, name string) error {
+	m.restarts++
+	return nil
+}
+
+func TestMaintenanceModeSuspendsRestarts(t *testing.T) {
+	history, err := NewHealthHistoryStore(filepath.Join(t.TempDir(), "health.db"), true)
+	if err != nil {
+		t.Fatalf("NewHealthHistoryStore: %v", err)
+	}
+	defer history.Close()
+
+	config := NewDynamicConfig()
+	if err := config.Update(map[string]interface{}{"maintenance_mode": true}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	manager := &stoppedProcessManager{}
+	activities := &Activities{
+		executeMode:    true,
+		processManager: manager,
+		healthHistory:  history,
+		dynamicConfig:  config,
+	}
+
+	ctx := context.Background()
+	status, err := activities.CheckProcessActivity(ctx, "dixfe")
+	if err != nil {
+		t.Fatalf("CheckProcessActivity: %v", err)
+	}
+	if status.Healthy {
+		t.Fatal("Expected dixfe to be down")
+	}
+	if err := activities.RestartProcessActivity(ctx, "dixfe"); err != nil {
+		t.Fatalf("RestartProcessActivity: %v", err)
+	}
+	if manager.restarts != 0 {
+		t.Errorf("Expected no restart in maintenance mode, got %d", manager.restarts)
+	}
+
+	// the health check is still recorded
+	events, err := history.GetServiceHistory("dixfe", time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatalf("GetServiceHistory: %v", err)
+	}
+	if len(events) != 1 || events[0].IsHealthy {
+		t.Errorf("Expected one unhealthy event, got %+v", events)
+	}
+
+	if err := config.Update(map[string]interface{}{"maintenance_mode": false}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := activities.RestartProcessActivity(ctx, "dixfe"); err != nil {
+		t.Fatalf("RestartProcessActivity: %v", err)
+	}
+	if manager.restarts != 1 {
+		t.Errorf("Expected a restart after the maintenance, got %d", manager.restarts)
+	}
+}
+
+func TestWatchModeRecordsIntendedActions(t *testing.T) {
+	var out bytes.Buffer
+	manager := &stoppedProcessManager{}
+	activities := &Activities{
+		executeMode:    false,
+		processManager: manager,
+	}
+	activities.SetActionLog(NewActionLog(&out))
+
+	if err := activities.RestartProcessActivity(context.Background(), "dixfe"); err != nil {
+		t.Fatalf("RestartProcessActivity: %v", err)
+	}
+	if manager.restarts != 0 {
+		t.Errorf("Expected watch mode not to restart, got %d restarts", manager.restarts)
+	}
+
+	var action IntendedAction
+	if err := json.Unmarshal(out.Bytes(), &action); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", out.String(), err)
+	}
+	if action.Service != "dixfe" || action.Manager != "process" || action.CurrentState != string(StateStopped) || action.Action != "restart" {
+		t.Errorf("Expected a restart of the stopped dixfe, got %+v", action)
+	}
+	if action.Time.IsZero() {
+		t.Error("Expected the intended action to be timestamped")
+	}
+	if actions := activities.actionLog.Actions(); len(actions) != 1 || actions[0] != action {
+		t.Errorf("Expected the action to be kept, got %+v", actions)
+	}
+}
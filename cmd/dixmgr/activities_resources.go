@@ -7,7 +7,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
 )
 
 // ResourceUsage represents resource usage metrics for a service
@@ -221,3 +224,104 @@ func readProcIO(pid int) (*procIO, error) {
 
 	return io, nil
 }
+
+// Default free space thresholds of CheckDiskSpaceActivity, in percent
+const (
+	defaultDiskWarningPercent  = 10.0
+	defaultDiskCriticalPercent = 5.0
+)
+
+// DiskSpaceConfig configures CheckDiskSpaceActivity
+type DiskSpaceConfig struct {
+	Paths           []string // Directories to check, typically the tablespaces
+	WarningPercent  float64  // Free space below which a warning fires (default: 10)
+	CriticalPercent float64  // Free space below which a critical alert fires (default: 5)
+}
+
+// FromMgrConfigToDiskSpaceConfig checks the tablespace directories under
+// dotidx_root with the thresholds of the monitoring section
+func FromMgrConfigToDiskSpaceConfig(cfg *dix.MgrConfig) DiskSpaceConfig {
+	return DiskSpaceConfig{
+		Paths:           dix.TablespacePaths(cfg.DotidxRoot),
+		WarningPercent:  cfg.Monitoring.DiskWarningPercent,
+		CriticalPercent: cfg.Monitoring.DiskCriticalPercent,
+	}
+}
+
+// DiskSpace is the space left on the filesystem of a directory
+type DiskSpace struct {
+	Path        string
+	TotalBytes  uint64
+	FreeBytes   uint64 // Available to unprivileged users, like PostgreSQL
+	FreePercent float64
+	Error       string
+}
+
+// statDisk returns the total and available bytes of the filesystem holding
+// path, tests replace it
+var statDisk = func(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Blocks) * uint64(st.Bsize), uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// CheckDiskSpaceActivity alerts when a directory runs out of space. Once a
+// tablespace is full every write to its partitions fails, which stalls the
+// indexers of all the chains.
+func (a *Activities) CheckDiskSpaceActivity(ctx context.Context, config DiskSpaceConfig) ([]DiskSpace, error) {
+	if config.WarningPercent == 0 {
+		config.WarningPercent = defaultDiskWarningPercent
+	}
+	if config.CriticalPercent == 0 {
+		config.CriticalPercent = defaultDiskCriticalPercent
+	}
+	log.Printf("[Activity] Checking disk space of %d directories", len(config.Paths))
+
+	spaces := make([]DiskSpace, 0, len(config.Paths))
+	for _, path := range config.Paths {
+		space := DiskSpace{Path: path}
+		total, free, err := statDisk(path)
+		if err != nil {
+			space.Error = err.Error()
+			log.Printf("[Activity] Cannot check the disk space of %s: %v", path, err)
+			spaces = append(spaces, space)
+			continue
+		}
+		space.TotalBytes, space.FreeBytes = total, free
+		if total > 0 {
+			space.FreePercent = 100 * float64(free) / float64(total)
+		}
+		spaces = append(spaces, space)
+
+		if a.alertManager == nil {
+			continue
+		}
+		alert := Alert{
+			Type:    AlertLowDiskSpace,
+			Service: path,
+			Message: fmt.Sprintf("%.1f%% free on %s (%d of %d bytes)", space.FreePercent, path, free, total),
+			Labels: map[string]string{
+				"path":         path,
+				"free_percent": strconv.FormatFloat(space.FreePercent, 'f', 1, 64),
+			},
+		}
+		switch {
+		case space.FreePercent < config.CriticalPercent:
+			alert.Severity = SeverityCritical
+		case space.FreePercent < config.WarningPercent:
+			alert.Severity = SeverityWarning
+		default:
+			for _, severity := range []AlertSeverity{SeverityWarning, SeverityCritical} {
+				alert.Severity = severity
+				a.alertManager.ResolveAlert(alert)
+			}
+			continue
+		}
+		if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+			log.Printf("[Activity] Failed to alert on the disk space of %s: %v", path, err)
+		}
+	}
+	return spaces, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func TestCheckDiskSpaceActivity(t *testing.T) {
+	// fast0 is nearly full, slow0 is fine and missing cannot be read
+	free := map[string]uint64{"/data/fast0": 3, "/data/slow0": 50}
+	saved := statDisk
+	statDisk = func(path string) (uint64, uint64, error) {
+		n, ok := free[path]
+		if !ok {
+			return 0, 0, fmt.Errorf("no such directory")
+		}
+		return 100, n, nil
+	}
+	defer func() { statDisk = saved }()
+
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, 5*time.Minute)
+	alertManager.RegisterChannel(channel)
+	activities := &Activities{alertManager: alertManager}
+	ctx := context.Background()
+
+	config := DiskSpaceConfig{Paths: []string{"/data/fast0", "/data/slow0", "/data/missing"}}
+	spaces, err := activities.CheckDiskSpaceActivity(ctx, config)
+	if err != nil {
+		t.Fatalf("CheckDiskSpaceActivity: %v", err)
+	}
+	if len(spaces) != 3 || spaces[0].FreePercent != 3 || spaces[1].FreePercent != 50 || spaces[2].Error == "" {
+		t.Errorf("Unexpected disk space %+v", spaces)
+	}
+	if channel.count() != 1 {
+		t.Fatalf("Expected 1 alert, got %+v", channel.alerts)
+	}
+	if alert := channel.alerts[0]; alert.Type != AlertLowDiskSpace || alert.Severity != SeverityCritical || alert.Service != "/data/fast0" {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+
+	// a configured threshold above the free space of slow0
+	config.WarningPercent = 60
+	if _, err := activities.CheckDiskSpaceActivity(ctx, config); err != nil {
+		t.Fatalf("CheckDiskSpaceActivity: %v", err)
+	}
+	if channel.count() != 2 || channel.alerts[1].Service != "/data/slow0" || channel.alerts[1].Severity != SeverityWarning {
+		t.Errorf("Expected a warning for /data/slow0, got %+v", channel.alerts)
+	}
+
+	// once space is freed the alerts are resolved
+	free["/data/fast0"], free["/data/slow0"] = 80, 80
+	if _, err := activities.CheckDiskSpaceActivity(ctx, config); err != nil {
+		t.Fatalf("CheckDiskSpaceActivity: %v", err)
+	}
+	if active := alertManager.GetActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected no active alert, got %+v", active)
+	}
+}
+
+func TestFromMgrConfigToDiskSpaceConfig(t *testing.T) {
+	cfg := &dix.MgrConfig{DotidxRoot: "/data"}
+	cfg.Monitoring.DiskWarningPercent = 20
+	config := FromMgrConfigToDiskSpaceConfig(cfg)
+	if len(config.Paths) != 10 || config.Paths[0] != "/data/fast0" || config.Paths[9] != "/data/slow5" {
+		t.Errorf("Expected the 4 fast and 6 slow tablespaces, got %v", config.Paths)
+	}
+	if config.WarningPercent != 20 || config.CriticalPercent != 0 {
+		t.Errorf("Unexpected thresholds %+v", config)
+	}
+}
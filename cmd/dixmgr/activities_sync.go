@@ -8,6 +8,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -116,3 +118,298 @@ func (a *Activities) CheckNodeSyncActivity(ctx context.Context, rpcEndpoint stri
 
 	return isSynced, nil
 }
+
+// NodeSyncSample is the sync state of a node at the time of a check
+type NodeSyncSample struct {
+	Time         time.Time
+	IsSyncing    bool
+	Peers        int
+	CurrentBlock int64 // Best block imported by the node
+	HighestBlock int64 // Best block seen on the network
+}
+
+// NodeSyncProgress compares a sample with the one of the previous check, a
+// node slowly catching up is fine but not one whose best block is stuck
+type NodeSyncProgress struct {
+	Sample          NodeSyncSample
+	Synced          bool
+	BlocksPerSecond float64 // Import rate since the previous sample
+	Stalled         bool    // The best block did not advance since the previous sample
+}
+
+// compareSyncSamples computes the progress of current since previous, nil for
+// the first check
+func compareSyncSamples(previous *NodeSyncSample, current NodeSyncSample) NodeSyncProgress {
+	progress := NodeSyncProgress{
+		Sample: current,
+		Synced: !current.IsSyncing,
+	}
+	if previous == nil {
+		return progress
+	}
+	if elapsed := current.Time.Sub(previous.Time).Seconds(); elapsed > 0 {
+		progress.BlocksPerSecond = float64(current.CurrentBlock-previous.CurrentBlock) / elapsed
+	}
+	// a synced node follows the chain, its best block must advance too
+	progress.Stalled = current.CurrentBlock <= previous.CurrentBlock
+	return progress
+}
+
+// callNodeRPC calls method on the JSON-RPC endpoint of a node and decodes its
+// result into result
+func callNodeRPC(ctx context.Context, url, method string, result interface{}) error {
+	reqJSON, err := json.Marshal(map[string]interface{}{
+		"id":      1,
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  []interface{}{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON-RPC request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqJSON))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, string(body))
+	}
+
+	response := struct {
+		Result interface{} `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{Result: result}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s failed: %s", method, response.Error.Message)
+	}
+	return nil
+}
+
+// CheckNodeSyncProgressActivity samples the sync state and the best block of
+// a node and compares them with previous, the sample of the previous check or
+// nil. It alerts when the best block did not advance between the two checks.
+func (a *Activities) CheckNodeSyncProgressActivity(ctx context.Context, rpcEndpoint string, port int, previous *NodeSyncSample) (*NodeSyncProgress, error) {
+	start := time.Now()
+
+	url := rpcEndpoint
+	if url == "" {
+		url = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	log.Printf("[Activity] Checking node sync progress: %s", url)
+
+	var health struct {
+		IsSyncing bool `json:"isSyncing"`
+		Peers     int  `json:"peers"`
+	}
+	var syncState struct {
+		CurrentBlock int64 `json:"currentBlock"`
+		HighestBlock int64 `json:"highestBlock"`
+	}
+	if err := callNodeRPC(ctx, url, "system_health", &health); err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckNodeSyncProgress", "error")
+			a.metrics.RecordActivityError("CheckNodeSyncProgress", "health_error")
+		}
+		return nil, err
+	}
+	if err := callNodeRPC(ctx, url, "system_syncState", &syncState); err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckNodeSyncProgress", "error")
+			a.metrics.RecordActivityError("CheckNodeSyncProgress", "sync_state_error")
+		}
+		return nil, err
+	}
+
+	progress := compareSyncSamples(previous, NodeSyncSample{
+		Time:         time.Now(),
+		IsSyncing:    health.IsSyncing,
+		Peers:        health.Peers,
+		CurrentBlock: syncState.CurrentBlock,
+		HighestBlock: syncState.HighestBlock,
+	})
+	log.Printf("[Activity] Node %s at block %d of %d, %.2f blocks/s (synced=%v, stalled=%v)",
+		url, syncState.CurrentBlock, syncState.HighestBlock, progress.BlocksPerSecond, progress.Synced, progress.Stalled)
+
+	alert := Alert{
+		Type:     AlertSyncStalled,
+		Severity: SeverityWarning,
+		Service:  url,
+		Message:  fmt.Sprintf("Node %s is stuck at block %d", url, syncState.CurrentBlock),
+		Labels: map[string]string{
+			"current_block": fmt.Sprintf("%d", syncState.CurrentBlock),
+			"highest_block": fmt.Sprintf("%d", syncState.HighestBlock),
+		},
+	}
+	switch {
+	case progress.Stalled:
+		if a.alertManager != nil {
+			if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+				log.Printf("[Activity] Failed to alert on the stalled node: %v", err)
+			}
+		}
+	case previous != nil && a.alertManager != nil:
+		a.alertManager.ResolveAlert(alert)
+	}
+
+	if a.metrics != nil {
+		a.metrics.RecordActivityExecution("CheckNodeSyncProgress", "success")
+		a.metrics.RecordActivityDuration("CheckNodeSyncProgress", time.Since(start))
+		a.metrics.RecordNodeSyncStatus(url, "unknown", progress.Synced, health.Peers)
+	}
+
+	return &progress, nil
+}
+
+// defaultSidecarMaxLag is the number of blocks a sidecar may be away from its
+// node, a few blocks are expected between the two requests
+const defaultSidecarMaxLag = 10
+
+// SidecarHeadConfig names a sidecar and the node it reads from
+type SidecarHeadConfig struct {
+	Service    string // Sidecar service name, used for the alert
+	NodeRPC    string // RPC endpoint of the node (e.g., "http://localhost:9944")
+	SidecarURL string // Sidecar API URL (e.g., "http://localhost:10900")
+	MaxLag     int64  // Blocks the heads may differ by (0 = 10)
+}
+
+// SidecarHeadResult compares the best block of a node with the head of its
+// sidecar
+type SidecarHeadResult struct {
+	NodeHead    int64
+	SidecarHead int64
+	Lag         int64 // Blocks the sidecar is behind its node, negative when ahead
+	Healthy     bool
+}
+
+// fetchSidecarHead returns the number of the block answered by /blocks/head
+func fetchSidecarHead(ctx context.Context, sidecarURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", sidecarURL+"/blocks/head", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var head struct {
+		Number string `json:"number"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&head); err != nil {
+		return 0, fmt.Errorf("failed to decode the sidecar head: %w", err)
+	}
+	number, err := strconv.ParseInt(head.Number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sidecar head number %q: %w", head.Number, err)
+	}
+	return number, nil
+}
+
+// fetchNodeHead returns the number of the best block of a node, from
+// chain_getHeader where it is hex encoded
+func fetchNodeHead(ctx context.Context, nodeRPC string) (int64, error) {
+	var header struct {
+		Number string `json:"number"`
+	}
+	if err := callNodeRPC(ctx, nodeRPC, "chain_getHeader", &header); err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(strings.TrimPrefix(header.Number, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node head number %q: %w", header.Number, err)
+	}
+	return number, nil
+}
+
+// CheckSidecarHeadMatchesNodeActivity compares the best block of a node with
+// the head its sidecar answers. A sidecar can be up but wedged on an old
+// block, it alerts when the two differ by more than MaxLag blocks.
+func (a *Activities) CheckSidecarHeadMatchesNodeActivity(ctx context.Context, config SidecarHeadConfig) (*SidecarHeadResult, error) {
+	start := time.Now()
+	if config.MaxLag <= 0 {
+		config.MaxLag = defaultSidecarMaxLag
+	}
+
+	log.Printf("[Activity] Comparing the head of sidecar %s with its node", config.Service)
+
+	nodeHead, err := fetchNodeHead(ctx, config.NodeRPC)
+	if err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckSidecarHead", "error")
+			a.metrics.RecordActivityError("CheckSidecarHead", "node_error")
+		}
+		return nil, fmt.Errorf("failed to read the head of the node of %s: %w", config.Service, err)
+	}
+	sidecarHead, err := fetchSidecarHead(ctx, config.SidecarURL)
+	if err != nil {
+		if a.metrics != nil {
+			a.metrics.RecordActivityExecution("CheckSidecarHead", "error")
+			a.metrics.RecordActivityError("CheckSidecarHead", "sidecar_error")
+		}
+		return nil, fmt.Errorf("failed to read the head of %s: %w", config.Service, err)
+	}
+
+	result := &SidecarHeadResult{
+		NodeHead:    nodeHead,
+		SidecarHead: sidecarHead,
+		Lag:         nodeHead - sidecarHead,
+	}
+	result.Healthy = result.Lag <= config.MaxLag && -result.Lag <= config.MaxLag
+
+	alert := Alert{
+		Type:     AlertSidecarLagging,
+		Severity: SeverityWarning,
+		Service:  config.Service,
+		Message: fmt.Sprintf("Sidecar %s is at block %d, its node at %d",
+			config.Service, sidecarHead, nodeHead),
+		Labels: map[string]string{
+			"node_head":    strconv.FormatInt(nodeHead, 10),
+			"sidecar_head": strconv.FormatInt(sidecarHead, 10),
+		},
+	}
+	switch {
+	case result.Healthy && a.alertManager != nil:
+		a.alertManager.ResolveAlert(alert)
+	case !result.Healthy:
+		log.Printf("[Activity] %s", alert.Message)
+		if a.alertManager != nil {
+			if err := a.alertManager.FireAlert(ctx, alert); err != nil {
+				log.Printf("[Activity] Failed to alert on the sidecar head: %v", err)
+			}
+		}
+	}
+
+	if a.metrics != nil {
+		a.metrics.RecordActivityExecution("CheckSidecarHead", "success")
+		a.metrics.RecordActivityDuration("CheckSidecarHead", time.Since(start))
+	}
+	return result, nil
+}
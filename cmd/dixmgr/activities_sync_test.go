@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestCheckNodeSyncActivity_Synced(t *testing.T) {
@@ -148,3 +151,120 @@ func TestCheckNodeSyncActivity_PublicEndpoint(t *testing.T) {
 
 	t.Logf("Public endpoint synced status: %v", synced)
 }
+
+// syncingNode answers system_health and system_syncState, at the block
+// pointed to by currentBlock
+func syncingNode(currentBlock *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		switch req.Method {
+		case "system_health":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"isSyncing":true,"peers":20}}`))
+		case "system_syncState":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"startingBlock":0,"currentBlock":%d,"highestBlock":25000000}}`, *currentBlock)
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`))
+		}
+	}))
+}
+
+func TestCheckNodeSyncProgressActivity(t *testing.T) {
+	currentBlock := int64(1000)
+	server := syncingNode(&currentBlock)
+	defer server.Close()
+
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, time.Minute)
+	alertManager.RegisterChannel(channel)
+	activities := &Activities{alertManager: alertManager}
+	ctx := context.Background()
+
+	first, err := activities.CheckNodeSyncProgressActivity(ctx, server.URL, 0, nil)
+	if err != nil {
+		t.Fatalf("CheckNodeSyncProgressActivity: %v", err)
+	}
+	if first.Synced || first.Stalled || first.Sample.CurrentBlock != 1000 || first.Sample.HighestBlock != 25000000 {
+		t.Fatalf("Expected a syncing node at block 1000, got %+v", first)
+	}
+
+	// slowly syncing is fine
+	currentBlock = 1010
+	previous := first.Sample
+	previous.Time = previous.Time.Add(-10 * time.Second)
+	progress, err := activities.CheckNodeSyncProgressActivity(ctx, server.URL, 0, &previous)
+	if err != nil {
+		t.Fatalf("CheckNodeSyncProgressActivity: %v", err)
+	}
+	if progress.Stalled || progress.BlocksPerSecond <= 0 {
+		t.Errorf("Expected the node to make progress, got %+v", progress)
+	}
+	if channel.count() != 0 {
+		t.Errorf("Expected no alert while syncing, got %d", channel.count())
+	}
+
+	// the same block twice is stalled
+	progress, err = activities.CheckNodeSyncProgressActivity(ctx, server.URL, 0, &progress.Sample)
+	if err != nil {
+		t.Fatalf("CheckNodeSyncProgressActivity: %v", err)
+	}
+	if !progress.Stalled {
+		t.Errorf("Expected the node to be stalled, got %+v", progress)
+	}
+	if channel.count() != 1 || channel.alerts[0].Type != AlertSyncStalled {
+		t.Errorf("Expected a sync stalled alert, got %+v", channel.alerts)
+	}
+}
+
+func TestCheckSidecarHeadMatchesNodeActivity(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// block 1000
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"number":"0x3e8","parentHash":"0x00"}}`))
+	}))
+	defer node.Close()
+	sidecarHead := "900"
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blocks/head" {
+			t.Errorf("Expected a request to /blocks/head, got %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"number":"%s","hash":"0xabcd"}`, sidecarHead)
+	}))
+	defer sidecar.Close()
+
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, time.Minute)
+	alertManager.RegisterChannel(channel)
+	activities := &Activities{alertManager: alertManager}
+	config := SidecarHeadConfig{
+		Service:    "sidecar-polkadot-assethub-0",
+		NodeRPC:    node.URL,
+		SidecarURL: sidecar.URL,
+	}
+
+	result, err := activities.CheckSidecarHeadMatchesNodeActivity(context.Background(), config)
+	if err != nil {
+		t.Fatalf("CheckSidecarHeadMatchesNodeActivity: %v", err)
+	}
+	if result.Healthy || result.NodeHead != 1000 || result.SidecarHead != 900 || result.Lag != 100 {
+		t.Errorf("Expected the sidecar 100 blocks behind, got %+v", result)
+	}
+	if channel.count() != 1 || channel.alerts[0].Type != AlertSidecarLagging {
+		t.Fatalf("Expected a sidecar lagging alert, got %+v", channel.alerts)
+	}
+
+	// a couple of blocks apart is expected
+	sidecarHead = "998"
+	result, err = activities.CheckSidecarHeadMatchesNodeActivity(context.Background(), config)
+	if err != nil {
+		t.Fatalf("CheckSidecarHeadMatchesNodeActivity: %v", err)
+	}
+	if !result.Healthy {
+		t.Errorf("Expected the sidecar to follow its node, got %+v", result)
+	}
+	if len(alertManager.GetActiveAlerts()) != 0 {
+		t.Errorf("Expected the alert to be resolved, got %+v", alertManager.GetActiveAlerts())
+	}
+}
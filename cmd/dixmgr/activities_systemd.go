@@ -101,6 +101,7 @@ func (a *Activities) CheckSystemdServiceActivity(ctx context.Context, unitName s
 func (a *Activities) StartSystemdServiceActivity(ctx context.Context, unitName string) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would start systemd service: %s", unitName)
+		a.recordIntendedAction(ctx, "systemd", unitName, "start")
 		return nil
 	}
 
@@ -131,6 +132,7 @@ func (a *Activities) StartSystemdServiceActivity(ctx context.Context, unitName s
 func (a *Activities) StopSystemdServiceActivity(ctx context.Context, unitName string) error {
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would stop systemd service: %s", unitName)
+		a.recordIntendedAction(ctx, "systemd", unitName, "stop")
 		return nil
 	}
 
@@ -163,6 +165,11 @@ func (a *Activities) RestartSystemdServiceActivity(ctx context.Context, unitName
 
 	if !a.executeMode {
 		log.Printf("[Activity] [DRY-RUN] Would restart systemd service: %s", unitName)
+		a.recordIntendedAction(ctx, "systemd", unitName, "restart")
+		return nil
+	}
+	if a.inMaintenance() {
+		log.Printf("[Activity] [MAINTENANCE] Not restarting systemd service: %s", unitName)
 		return nil
 	}
 
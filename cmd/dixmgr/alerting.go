@@ -34,6 +34,12 @@ const (
 	AlertLowPeerCount      AlertType = "low_peer_count"
 	AlertDependencyTimeout AlertType = "dependency_timeout"
 	AlertHealthCheckFailed AlertType = "health_check_failed"
+	AlertAddressWatched    AlertType = "address_watched"
+	AlertPartitionMissing  AlertType = "partition_missing"
+	AlertSchemaMismatch    AlertType = "schema_mismatch"
+	AlertLowDiskSpace      AlertType = "low_disk_space"
+	AlertReplicationLag    AlertType = "replication_lag"
+	AlertSidecarLagging    AlertType = "sidecar_lagging"
 )
 
 // Alert represents an alert event
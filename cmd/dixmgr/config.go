@@ -19,6 +19,9 @@ type NodeWorkflowConfig struct {
 	RPCPort     int    // RPC port for sync checking
 	CheckSync   bool   // Whether to check blockchain sync status before marking ready
 	ReadySignal string // Signal name to emit when ready (optional override)
+
+	// Node of a sidecar, its head is compared with the sidecar once ready
+	SidecarHead *SidecarHeadConfig
 }
 
 // ClusterWorkflowConfig represents configuration for managing redundant services
@@ -65,6 +68,11 @@ type ParaPlan struct {
 	Node               NodeWorkflowConfig // Parachain node configuration
 	SidecarServiceName string             // Base name for sidecar services
 	SidecarCount       int                // Number of sidecar instances
+	// SAS_SUBSTRATE_URL of the sidecars, the node RPC port
+	SidecarSubstrateURL string
+	// HTTP RPC of the node and url of each sidecar, to compare their heads
+	NodeRPC     string
+	SidecarURLs []string
 }
 
 // RelayPlan represents configuration for a relay chain and its parachains
@@ -79,6 +87,11 @@ type InfrastructureWorkflowInput struct {
 	RelayPlans         []RelayPlan // All relay chains and their parachains
 	NginxService       string      // Nginx service name
 	AfterNginxServices []string    // Services to start after nginx (dixlive, dixfe, etc.)
+	// Watch intervals of the sidecars, and of nginx and the app services (0 = 30s)
+	SidecarWatchInterval time.Duration
+	ServiceWatchInterval time.Duration
+	// Configured ready signals a service waits for, by the ready signal of the service
+	Dependencies map[string][]string
 }
 
 // MetricsConfig holds metrics configuration
@@ -121,6 +134,8 @@ type CronWorkflowConfig struct {
 	HourlyCronSchedule string // Cron schedule for hourly queries (e.g., "0 * * * *")
 	DailyCronSchedule  string // Cron schedule for daily queries (e.g., "0 0 * * *")
 	RegisteredQueries  []string // List of registered query names to execute
+	DiskSpace          DiskSpaceConfig // Tablespace directories checked every hour
+	ReplicaMaxLag      time.Duration // Replication lag above which an alert fires (0 = default)
 }
 
 // WatcherConfig represents the complete watcher configuration
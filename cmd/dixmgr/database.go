@@ -15,6 +15,8 @@ type Database interface {
 	GetDatabaseInfo() ([]dix.DatabaseInfo, error)
 	ReadTimeNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) (time.Time, error)
 	ExecuteAndStoreNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) error
+	MissingCurrentPartitions(now time.Time) ([]dix.DatabaseInfo, error)
+	ReadSchemaVersion() (int, error)
 	Close() error
 }
 
@@ -48,6 +50,14 @@ func (d *DixDatabaseAdapter) ExecuteAndStoreNamedQuery(ctx context.Context, rela
 	return d.db.ExecuteAndStoreNamedQuery(ctx, relayChain, chain, queryName, year, month)
 }
 
+func (d *DixDatabaseAdapter) MissingCurrentPartitions(now time.Time) ([]dix.DatabaseInfo, error) {
+	return d.db.MissingCurrentPartitions(now)
+}
+
+func (d *DixDatabaseAdapter) ReadSchemaVersion() (int, error) {
+	return d.db.ReadSchemaVersion()
+}
+
 func (d *DixDatabaseAdapter) Close() error {
 	return d.db.Close()
 }
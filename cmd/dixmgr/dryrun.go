@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxIntendedActions bounds the intended actions kept in memory
+const maxIntendedActions = 1000
+
+// IntendedAction is an action that watch mode did not execute. They are
+// written one JSON object per line so that they can be reviewed, or diffed
+// between two runs, before switching to exec mode.
+type IntendedAction struct {
+	Time         time.Time `json:"time"`
+	Service      string    `json:"service"`
+	Manager      string    `json:"manager"`       // "systemd" or "process"
+	CurrentState string    `json:"current_state"` // State of the service when the action was decided
+	Action       string    `json:"action"`        // "start", "stop", "restart" or "kill"
+}
+
+// ActionLog records the intended actions of watch mode
+type ActionLog struct {
+	mu      sync.Mutex
+	out     io.Writer
+	actions []IntendedAction
+}
+
+// NewActionLog returns a log writing the intended actions to out, which may
+// be nil to only keep them in memory
+func NewActionLog(out io.Writer) *ActionLog {
+	return &ActionLog{out: out}
+}
+
+// Record keeps action and writes it as a JSON line
+func (l *ActionLog) Record(action IntendedAction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.actions = append(l.actions, action)
+	if len(l.actions) > maxIntendedActions {
+		l.actions = l.actions[len(l.actions)-maxIntendedActions:]
+	}
+	if l.out == nil {
+		return nil
+	}
+	data, err := json.Marshal(action)
+	if err != nil {
+		return fmt.Errorf("failed to encode the intended action: %w", err)
+	}
+	_, err = l.out.Write(append(data, '\n'))
+	return err
+}
+
+// Actions returns the latest intended actions, oldest first
+func (l *ActionLog) Actions() []IntendedAction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]IntendedAction(nil), l.actions...)
+}
+
+// SetActionLog sets where watch mode records the actions it does not execute
+func (a *Activities) SetActionLog(actionLog *ActionLog) {
+	a.actionLog = actionLog
+}
+
+// recordIntendedAction records that watch mode did not run action on service
+func (a *Activities) recordIntendedAction(ctx context.Context, manager, service, action string) {
+	if a.actionLog == nil {
+		return
+	}
+	err := a.actionLog.Record(IntendedAction{
+		Time:         time.Now().UTC(),
+		Service:      service,
+		Manager:      manager,
+		CurrentState: a.currentState(ctx, manager, service),
+		Action:       action,
+	})
+	if err != nil {
+		log.Printf("[Activity] Failed to record the intended action: %v", err)
+	}
+}
+
+// currentState returns the state of service as seen by its manager, unknown
+// when it cannot be read
+func (a *Activities) currentState(ctx context.Context, manager, service string) string {
+	switch {
+	case manager == "process" && a.processManager != nil:
+		if status, err := a.processManager.GetStatus(ctx, service); err == nil {
+			return string(status.State)
+		}
+	case manager == "systemd" && a.dbusConn != nil:
+		if prop, err := a.dbusConn.GetUnitPropertyContext(ctx, service, "ActiveState"); err == nil {
+			if state, ok := prop.Value.Value().(string); ok {
+				return state
+			}
+		}
+	}
+	return "unknown"
+}
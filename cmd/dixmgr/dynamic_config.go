@@ -7,10 +7,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
+
+	"github.com/pierreaubert/dotidx/dix"
 )
 
 // DynamicConfig manages runtime configuration updates
@@ -23,6 +26,9 @@ type DynamicConfig struct {
 	ResourceMonitoringEnabled bool
 	HealthHistoryEnabled     bool
 
+	// Maintenance mode: services are still checked and recorded but not restarted
+	MaintenanceMode bool
+
 	// Thresholds (can be updated at runtime)
 	CPUWarningThreshold      float64
 	CPUCriticalThreshold     float64
@@ -58,6 +64,8 @@ func NewDynamicConfig() *DynamicConfig {
 		ResourceMonitoringEnabled: true,
 		HealthHistoryEnabled:      false,
 
+		MaintenanceMode: false,
+
 		CPUWarningThreshold:     80.0,
 		CPUCriticalThreshold:    95.0,
 		MemoryWarningThreshold:  2 * 1024 * 1024 * 1024, // 2GB
@@ -90,6 +98,8 @@ func (c *DynamicConfig) Clone() *DynamicConfig {
 		ResourceMonitoringEnabled: c.ResourceMonitoringEnabled,
 		HealthHistoryEnabled:      c.HealthHistoryEnabled,
 
+		MaintenanceMode: c.MaintenanceMode,
+
 		CPUWarningThreshold:     c.CPUWarningThreshold,
 		CPUCriticalThreshold:    c.CPUCriticalThreshold,
 		MemoryWarningThreshold:  c.MemoryWarningThreshold,
@@ -115,9 +125,7 @@ func (c *DynamicConfig) Clone() *DynamicConfig {
 
 // Update updates the configuration
 func (c *DynamicConfig) Update(updates map[string]interface{}) error {
-	c.mu.Lock()
 	oldConfig := c.Clone()
-	c.mu.Unlock()
 
 	// Apply updates
 	for key, value := range updates {
@@ -154,6 +162,9 @@ func (c *DynamicConfig) set(key string, value interface{}) error {
 	case "health_history_enabled":
 		c.HealthHistoryEnabled = value.(bool)
 
+	case "maintenance_mode":
+		c.MaintenanceMode = value.(bool)
+
 	case "cpu_warning_threshold":
 		c.CPUWarningThreshold = value.(float64)
 	case "cpu_critical_threshold":
@@ -205,6 +216,9 @@ func (c *DynamicConfig) Get(key string) (interface{}, error) {
 	case "health_history_enabled":
 		return c.HealthHistoryEnabled, nil
 
+	case "maintenance_mode":
+		return c.MaintenanceMode, nil
+
 	case "cpu_warning_threshold":
 		return c.CPUWarningThreshold, nil
 	case "cpu_critical_threshold":
@@ -239,6 +253,13 @@ func (c *DynamicConfig) Get(key string) (interface{}, error) {
 	}
 }
 
+// InMaintenance reports whether the maintenance mode is on
+func (c *DynamicConfig) InMaintenance() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.MaintenanceMode
+}
+
 // OnChange registers a callback for configuration changes
 func (c *DynamicConfig) OnChange(callback func(old, new *DynamicConfig)) {
 	c.mu.Lock()
@@ -272,6 +293,8 @@ func (c *DynamicConfig) SaveToFile(path string) error {
 		"resource_monitoring_enabled": c.ResourceMonitoringEnabled,
 		"health_history_enabled":      c.HealthHistoryEnabled,
 
+		"maintenance_mode": c.MaintenanceMode,
+
 		"cpu_warning_threshold":     c.CPUWarningThreshold,
 		"cpu_critical_threshold":    c.CPUCriticalThreshold,
 		"memory_warning_threshold":  c.MemoryWarningThreshold,
@@ -295,7 +318,10 @@ func (c *DynamicConfig) SaveToFile(path string) error {
 		return fmt.Errorf("failed to marshal TOML: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := dix.WriteFileAtomic(path, 0644, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -313,6 +339,8 @@ func (c *DynamicConfig) ToJSON() ([]byte, error) {
 		"resource_monitoring_enabled": c.ResourceMonitoringEnabled,
 		"health_history_enabled":      c.HealthHistoryEnabled,
 
+		"maintenance_mode": c.MaintenanceMode,
+
 		"cpu_warning_threshold":     c.CPUWarningThreshold,
 		"cpu_critical_threshold":    c.CPUCriticalThreshold,
 		"memory_warning_threshold":  c.MemoryWarningThreshold,
@@ -415,9 +443,35 @@ func (s *ConfigHTTPServer) HandleReloadConfig(w http.ResponseWriter, r *http.Req
 	w.Write([]byte(`{"status":"ok","message":"Configuration reloaded"}`))
 }
 
+// HandleMaintenance returns the maintenance mode on GET and sets it on POST
+// with ?enabled=true or ?enabled=false
+func (s *ConfigHTTPServer) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "Invalid or missing 'enabled' query parameter", http.StatusBadRequest)
+			return
+		}
+		if err := s.config.Update(map[string]interface{}{"maintenance_mode": enabled}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update config: %v", err), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Maintenance mode set to %v", enabled)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"maintenance_mode":%v}`, s.config.InMaintenance())
+}
+
 // RegisterHandlers registers HTTP handlers for configuration management
 func (s *ConfigHTTPServer) RegisterHandlers() {
 	http.HandleFunc("/config", s.HandleGetConfig)
 	http.HandleFunc("/config/update", s.HandleUpdateConfig)
 	http.HandleFunc("/config/reload", s.HandleReloadConfig)
+	http.HandleFunc("/maintenance", s.HandleMaintenance)
 }
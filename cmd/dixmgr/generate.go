@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// confDir is the directory of the environment files of the systemd units,
+// see their EnvironmentFile in conf/templates/systemd
+func confDir(config *dix.MgrConfig) string {
+	return filepath.Join(config.TargetDir+"-"+config.Name, "conf")
+}
+
+// generateFiles returns the files dixmgr generates for config, keyed by
+// their path
+func generateFiles(config *dix.MgrConfig) (map[string][]byte, error) {
+	input, err := FromMgrConfigToInfraInput(config, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return sidecarEnvironments(config, input)
+}
+
+// sidecarEnvironments renders the environment file of each sidecar of the
+// plan, the %i-sidecar.conf read by the sidecar@ unit. The sidecars get the
+// SAS_SUBSTRATE_URL of the plan, it must reach the node on its RPC port.
+func sidecarEnvironments(config *dix.MgrConfig, input InfrastructureWorkflowInput) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, relayPlan := range input.RelayPlans {
+		for _, paraPlan := range relayPlan.Parachains {
+			if paraPlan.SidecarCount == 0 {
+				continue
+			}
+			chainConfig := config.Parachains[relayPlan.RelayID][paraPlan.ChainID]
+			if err := dix.ValidateSidecarSubstrateURL(chainConfig, paraPlan.SidecarSubstrateURL); err != nil {
+				return nil, fmt.Errorf("sidecar of %s:%s: %w", relayPlan.RelayID, paraPlan.ChainID, err)
+			}
+			for i := range paraPlan.SidecarCount {
+				var env bytes.Buffer
+				fmt.Fprintf(&env, "SAS_SUBSTRATE_URL=%s\n", paraPlan.SidecarSubstrateURL)
+				fmt.Fprintf(&env, "SAS_EXPRESS_BIND_HOST=%s\n", chainConfig.SidecarIP)
+				fmt.Fprintf(&env, "SAS_EXPRESS_PORT=%d\n", chainConfig.ComputePort(chainConfig.SidecarPort, i))
+				// the instance of sidecar@%s-%s-%d.service, see StartPlan
+				instance := fmt.Sprintf("%s-%s-%d", relayPlan.RelayID, paraPlan.ChainID, i)
+				files[filepath.Join(confDir(config), instance+"-sidecar.conf")] = env.Bytes()
+			}
+		}
+	}
+	return files, nil
+}
+
+// changedFiles returns the files whose content differs from the one on
+// disk, the missing ones included
+func changedFiles(files map[string][]byte) (map[string][]byte, error) {
+	changed := make(map[string][]byte)
+	for path, data := range files {
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err != nil || !bytes.Equal(current, data) {
+			changed[path] = data
+		}
+	}
+	return changed, nil
+}
+
+// runGenerate writes the generated files which changed and returns how
+// many. Nothing is written while the services run, unless force is set.
+func runGenerate(ctx context.Context, pm ProcessManager, config *dix.MgrConfig, force bool) (int, error) {
+	files, err := generateFiles(config)
+	if err != nil {
+		return 0, err
+	}
+	changed, err := changedFiles(files)
+	if err != nil || len(changed) == 0 {
+		return 0, err
+	}
+	if err := guardRunningServices(ctx, pm, config, force); err != nil {
+		return 0, err
+	}
+	return len(changed), writeFiles(changed)
+}
+
+// writeFiles writes the generated files, each one replaced at once
+func writeFiles(files map[string][]byte) error {
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		err := dix.WriteFileAtomic(path, 0o644, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeServices returns the systemd units of the configured services which
+// are running or starting
+func activeServices(ctx context.Context, pm ProcessManager, config *dix.MgrConfig) ([]string, error) {
+	input, err := FromMgrConfigToInfraInput(config, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := input.StartPlan()
+	if err != nil {
+		return nil, err
+	}
+	var active []string
+	for _, service := range plan {
+		unit := service.Node.SystemdUnit
+		status, err := pm.GetStatus(ctx, unit)
+		if err != nil {
+			return nil, fmt.Errorf("cannot tell whether %s is running: %w", unit, err)
+		}
+		if status.State == StateRunning || status.State == StateStarting {
+			active = append(active, unit)
+		}
+	}
+	return active, nil
+}
+
+// guardRunningServices is called before the configuration files are
+// generated: rewriting the files of a running service can break it
+// mid-read. It fails when a service is running, with force it only warns.
+func guardRunningServices(ctx context.Context, pm ProcessManager, config *dix.MgrConfig, force bool) error {
+	active, err := activeServices(ctx, pm, config)
+	switch {
+	case err != nil && force:
+		log.Printf("Warning: %v, overwriting the configuration anyway", err)
+	case err != nil:
+		return fmt.Errorf("%w, use -force to overwrite the configuration anyway", err)
+	case len(active) > 0 && force:
+		log.Printf("Warning: overwriting the configuration of %d running services: %s",
+			len(active), strings.Join(active, ", "))
+	case len(active) > 0:
+		return fmt.Errorf("%d services are running: %s; stop them or use -force",
+			len(active), strings.Join(active, ", "))
+	}
+	return nil
+}
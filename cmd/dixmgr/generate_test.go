@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// unitsProcessManager reports the state of the units it knows, the others
+// are stopped
+type unitsProcessManager struct {
+	ProcessManager
+	states map[string]ProcessState
+	err    error
+}
+
+func (m *unitsProcessManager) GetStatus(ctx context.Context, name string) (*ProcessStatus, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	state, ok := m.states[name]
+	if !ok {
+		state = StateStopped
+	}
+	return &ProcessStatus{Name: name, State: state}, nil
+}
+
+func TestGuardRunningServices(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	ctx := context.Background()
+	config := testInfraConfig()
+
+	stopped := &unitsProcessManager{}
+	if err := guardRunningServices(ctx, stopped, config, false); err != nil {
+		t.Errorf("Expected no error when nothing runs, got %v", err)
+	}
+
+	running := &unitsProcessManager{states: map[string]ProcessState{
+		"chain-node-archive@polkadot-assethub.service": StateRunning,
+		"dixfe.service":    StateStarting,
+		"dixbatch.service": StateFailed,
+	}}
+	active, err := activeServices(ctx, running, config)
+	if err != nil {
+		t.Fatalf("activeServices: %v", err)
+	}
+	if strings.Join(active, ",") != "chain-node-archive@polkadot-assethub.service,dixfe.service" {
+		t.Errorf("Unexpected active services %v", active)
+	}
+	err = guardRunningServices(ctx, running, config, false)
+	if err == nil || !strings.Contains(err.Error(), "2 services are running") ||
+		!strings.Contains(err.Error(), "chain-node-archive@polkadot-assethub.service") {
+		t.Errorf("Expected the running services to be reported, got %v", err)
+	}
+
+	buf.Reset()
+	if err := guardRunningServices(ctx, running, config, true); err != nil {
+		t.Errorf("Expected -force to proceed, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "overwriting the configuration of 2 running services") {
+		t.Errorf("Expected a warning, got %q", buf.String())
+	}
+
+	// a service which cannot be checked may be running
+	unknown := &unitsProcessManager{err: errors.New("no dbus")}
+	if err := guardRunningServices(ctx, unknown, config, false); err == nil || !strings.Contains(err.Error(), "no dbus") {
+		t.Errorf("Expected the status error, got %v", err)
+	}
+	if err := guardRunningServices(ctx, unknown, config, true); err != nil {
+		t.Errorf("Expected -force to proceed, got %v", err)
+	}
+}
+
+// sidecarsConfig is testInfraConfig with two sidecars for assethub,
+// generated in a temporary directory
+func sidecarsConfig(t *testing.T) *dix.MgrConfig {
+	config := testInfraConfig()
+	config.TargetDir = t.TempDir()
+	config.Name = "dotidx"
+	config.Parachains["polkadot"]["assethub"] = dix.ParaChainConfig{
+		NodeIP:       "10.0.0.5",
+		PortRPC:      9945,
+		PortWS:       9955,
+		SidecarIP:    "10.0.0.6",
+		SidecarPort:  10900,
+		SidecarCount: 2,
+	}
+	return config
+}
+
+func TestRunGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	ctx := context.Background()
+	config := sidecarsConfig(t)
+	path := filepath.Join(config.TargetDir+"-dotidx", "conf", "polkadot-assethub-0-sidecar.conf")
+
+	running := &unitsProcessManager{states: map[string]ProcessState{
+		"sidecar@polkadot-assethub-0.service": StateRunning,
+	}}
+	if _, err := runGenerate(ctx, running, config, false); err == nil || !strings.Contains(err.Error(), "sidecar@polkadot-assethub-0.service") {
+		t.Fatalf("Expected the running sidecar to be reported, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing written while the services run, got %v", err)
+	}
+
+	written, err := runGenerate(ctx, running, config, true)
+	if err != nil || written != 2 {
+		t.Fatalf("Expected -force to write 2 files, got %d, %v", written, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected %s to be written: %v", path, err)
+	}
+
+	// nothing changes, the running services are left alone
+	if written, err := runGenerate(ctx, running, config, false); err != nil || written != 0 {
+		t.Errorf("Expected nothing to write, got %d, %v", written, err)
+	}
+}
+
+func TestSidecarEnvironments(t *testing.T) {
+	config := sidecarsConfig(t)
+
+	files, err := generateFiles(config)
+	if err != nil {
+		t.Fatalf("generateFiles: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected one file per sidecar, got %d", len(files))
+	}
+	path := filepath.Join(config.TargetDir+"-dotidx", "conf", "polkadot-assethub-1-sidecar.conf")
+	expected := "SAS_SUBSTRATE_URL=ws://10.0.0.5:9945\nSAS_EXPRESS_BIND_HOST=10.0.0.6\nSAS_EXPRESS_PORT=10902\n"
+	if string(files[path]) != expected {
+		t.Errorf("Expected %q in %s, got %q", expected, path, files[path])
+	}
+
+	if err := writeFiles(files); err != nil {
+		t.Fatalf("writeFiles: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != expected {
+		t.Errorf("Expected %q written in %s, got %q", expected, path, data)
+	}
+
+	// the url of the plan is the one checked
+	input, err := FromMgrConfigToInfraInput(config, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("FromMgrConfigToInfraInput: %v", err)
+	}
+	for i, para := range input.RelayPlans[0].Parachains {
+		if para.ChainID == "assethub" {
+			input.RelayPlans[0].Parachains[i].SidecarSubstrateURL = "ws://10.0.0.5:9955"
+		}
+	}
+	if _, err := sidecarEnvironments(config, input); err == nil || !strings.Contains(err.Error(), "port_ws") {
+		t.Errorf("Expected the ws port to be refused, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pierreaubert/dotidx/dix"
 )
@@ -23,6 +24,12 @@ func ReadySignalSvc(name string) string {
 	return fmt.Sprintf("ready:svc:%s", name)
 }
 
+// ReadySignalService returns the ready signal of a service named as in the
+// watcher dependencies of the configuration, e.g. para:polkadot:assethub
+func ReadySignalService(service string) string {
+	return fmt.Sprintf("ready:%s", service)
+}
+
 // Workflow ID helpers
 func WorkflowIDInfra() string {
 	return "wf.infra"
@@ -52,12 +59,28 @@ func WorkflowIDCron(schedule string) string {
 	return fmt.Sprintf("wf.cron.%s", schedule)
 }
 
+// tierWatchInterval returns the watch interval of a tier of services, the
+// global one in seconds when the tier has none and the default when neither
+// is set
+func tierWatchInterval(tier dix.Duration, global int) time.Duration {
+	if tier > 0 {
+		return time.Duration(tier)
+	}
+	if global > 0 {
+		return time.Duration(global) * time.Second
+	}
+	return defaultWatchInterval
+}
+
 // FromMgrConfigToInfraInput converts MgrConfig to InfrastructureWorkflowInput
 // It validates port conventions and derives service names, RPC ports, and signals
 func FromMgrConfigToInfraInput(cfg *dix.MgrConfig, watchInterval, maxRestarts int, restartBackoff int) (InfrastructureWorkflowInput, error) {
 	input := InfrastructureWorkflowInput{
 		NginxService:       "dix-nginx",
 		AfterNginxServices: []string{"dixlive", "dixfe", "dixbatch", "dixcron"},
+
+		SidecarWatchInterval: tierWatchInterval(cfg.Watcher.WatchIntervals.Sidecar, watchInterval),
+		ServiceWatchInterval: tierWatchInterval(cfg.Watcher.WatchIntervals.Service, watchInterval),
 	}
 
 	// Process each relay chain
@@ -76,6 +99,7 @@ func FromMgrConfigToInfraInput(cfg *dix.MgrConfig, watchInterval, maxRestarts in
 				CheckSync:        true,
 				ReadySignal:      ReadySignalRelay(relayName),
 				ParentWorkflowID: WorkflowIDInfra(),
+				WatchInterval:    tierWatchInterval(cfg.Watcher.WatchIntervals.Relay, watchInterval),
 			}
 		}
 
@@ -87,9 +111,14 @@ func FromMgrConfigToInfraInput(cfg *dix.MgrConfig, watchInterval, maxRestarts in
 			}
 
 			paraPlan := ParaPlan{
-				ChainID:            chainName,
-				SidecarServiceName: fmt.Sprintf("sidecar-%s-%s", relayName, chainName),
-				SidecarCount:       chainConfig.SidecarCount,
+				ChainID:             chainName,
+				SidecarServiceName:  fmt.Sprintf("sidecar-%s-%s", relayName, chainName),
+				SidecarCount:        chainConfig.SidecarCount,
+				SidecarSubstrateURL: dix.SidecarSubstrateURL(chainConfig),
+				NodeRPC:             dix.NodeRPCURL(chainConfig),
+			}
+			for i := 0; i < chainConfig.SidecarCount; i++ {
+				paraPlan.SidecarURLs = append(paraPlan.SidecarURLs, dix.SidecarURL(chainConfig, i))
 			}
 
 			// Parachain node configuration
@@ -101,6 +130,7 @@ func FromMgrConfigToInfraInput(cfg *dix.MgrConfig, watchInterval, maxRestarts in
 				CheckSync:        true,
 				ReadySignal:      ReadySignalPara(relayName, chainName),
 				ParentWorkflowID: WorkflowIDInfra(),
+				WatchInterval:    tierWatchInterval(cfg.Watcher.WatchIntervals.Parachain, watchInterval),
 			}
 
 			relayPlan.Parachains = append(relayPlan.Parachains, paraPlan)
@@ -109,5 +139,18 @@ func FromMgrConfigToInfraInput(cfg *dix.MgrConfig, watchInterval, maxRestarts in
 		input.RelayPlans = append(input.RelayPlans, relayPlan)
 	}
 
+	if len(cfg.Watcher.Dependencies) > 0 {
+		input.Dependencies = make(map[string][]string)
+		for _, dep := range cfg.Watcher.Dependencies {
+			signal := ReadySignalService(dep.Service)
+			for _, dependsOn := range dep.DependsOn {
+				input.Dependencies[signal] = append(input.Dependencies[signal], ReadySignalService(dependsOn))
+			}
+		}
+	}
+	if _, err := input.StartPlan(); err != nil {
+		return input, fmt.Errorf("invalid watcher dependencies: %w", err)
+	}
+
 	return input, nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	_ "github.com/lib/pq"
 	"github.com/pierreaubert/dotidx/dix"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
@@ -25,6 +27,7 @@ func main() {
 	temporalNamespace := flag.String("temporal-namespace", "dotidx", "Temporal namespace")
 	watchMode := flag.Bool("watch", false, "watch mode: monitor services and print what would be done (dry-run)")
 	execMode := flag.Bool("exec", false, "exec mode: monitor services and execute restart actions")
+	actionsOutput := flag.String("actions-output", "-", "watch mode: file the intended actions are appended to as JSON lines, - for stdout")
 
 	// New flags for enhanced features
 	metricsEnabled := flag.Bool("metrics", true, "Enable Prometheus metrics")
@@ -47,12 +50,67 @@ func main() {
 	processPIDDir := flag.String("process-pid-dir", "/var/run/dixmgr", "Directory for PID files (direct mode)")
 	processMaxRestarts := flag.Int("process-max-restarts", 5, "Maximum restart attempts per process")
 
+	// Tuning flags
+	showTuning := flag.Bool("show-tuning", false, "print the postgres and node memory settings computed for this host and exit")
+	memoryGB := flag.Int("memory-gb", 0, "memory of the host in GB used by -show-tuning, detected when not set")
+	generateMode := flag.Bool("generate", false, "write the environment files of the sidecars in <target_dir>-<name>/conf and exit")
+	force := flag.Bool("force", false, "with -generate, overwrite the configuration of running services")
+	planMode := flag.Bool("plan", false, "print the diff -generate would apply, without writing, and exit")
+
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("dixmgr", *showVersion) {
+		return
+	}
 
 	if *configFile == "" {
 		log.Fatal("Configuration file is required (use -conf flag)")
 	}
 
+	if *showTuning {
+		config, err := dix.LoadMgrConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		resolveTuning(config, *memoryGB)
+		printTuning(os.Stdout, *config)
+		return
+	}
+
+	if *generateMode {
+		config, err := dix.LoadMgrConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		processManager, err := NewProcessManager(ProcessManagerConfig{
+			Type:        ProcessManagerType(*processManagerType),
+			LogDir:      *processLogDir,
+			PIDDir:      *processPIDDir,
+			MaxRestarts: *processMaxRestarts,
+		}, nil)
+		if err != nil {
+			log.Fatalf("Failed to create process manager: %v", err)
+		}
+		written, err := runGenerate(context.Background(), processManager, config, *force)
+		processManager.Close()
+		if err != nil {
+			log.Fatalf("Cannot generate the configuration: %v", err)
+		}
+		log.Printf("Wrote %d files in %s", written, confDir(config))
+		return
+	}
+
+	if *planMode {
+		config, err := dix.LoadMgrConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if err := runPlan(os.Stdout, config); err != nil {
+			log.Fatalf("Cannot plan the generation: %v", err)
+		}
+		return
+	}
+
 	// Validate mode flags
 	if *watchMode && *execMode {
 		log.Fatal("Cannot use both -watch and -exec flags. Choose one mode.")
@@ -136,6 +194,15 @@ func main() {
 		log.Printf("Alert manager initialized")
 	}
 
+	// Watched addresses alert through the alert manager, the ones added
+	// with /admin/watchlist of dixfe are read from the database
+	var watchList *dix.WatchList
+	if alertManager != nil {
+		watchList = dix.NewWatchList(config.Monitoring.WatchAddresses, dix.NewSQLDatabase(*config), watchListAlerter(alertManager))
+		watchList.Start(context.Background(), nil, nil)
+		log.Printf("Watching %d addresses", len(watchList.List()))
+	}
+
 	// Initialize circuit breaker manager
 	var circuitBreakerManager *CircuitBreakerManager
 	if *enableCircuitBreaker {
@@ -228,6 +295,29 @@ func main() {
 		log.Fatalf("Failed to create activities: %v", err)
 	}
 	defer activities.Close()
+	if watchList != nil {
+		activities.SetWatchList(watchList)
+	}
+	if *watchMode {
+		out := os.Stdout
+		if *actionsOutput != "-" {
+			out, err = os.OpenFile(*actionsOutput, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Fatalf("Failed to open the intended actions output: %v", err)
+			}
+			defer out.Close()
+		}
+		activities.SetActionLog(NewActionLog(out))
+		log.Printf("Writing the intended actions to %s", *actionsOutput)
+	}
+	if dix.HasDBReplica(*config) {
+		replica, err := sql.Open("postgres", dix.DBReplicaUrl(*config))
+		if err != nil {
+			log.Fatalf("Error opening read replica: %v", err)
+		}
+		activities.SetReplica(replica)
+		log.Printf("Checking the replication lag of %s", dix.DBReplicaUrlSecure(*config))
+	}
 
 	// Create and start worker
 	w := worker.New(temporalClient, actualTaskQueue, worker.Options{})
@@ -245,7 +335,10 @@ func main() {
 	w.RegisterActivity(activities.StartSystemdServiceActivity)
 	w.RegisterActivity(activities.StopSystemdServiceActivity)
 	w.RegisterActivity(activities.RestartSystemdServiceActivity)
+	w.RegisterActivity(activities.IsMaintenanceModeActivity)
 	w.RegisterActivity(activities.CheckNodeSyncActivity)
+	w.RegisterActivity(activities.CheckNodeSyncProgressActivity)
+	w.RegisterActivity(activities.CheckSidecarHeadMatchesNodeActivity)
 	w.RegisterActivity(activities.CheckResourceUsageActivity)
 	w.RegisterActivity(activities.CheckHTTPEndpointActivity)
 	w.RegisterActivity(activities.CheckHTTPEndpointSimpleActivity)
@@ -270,6 +363,10 @@ func main() {
 	w.RegisterActivity(activities.CheckQueryResultExistsActivity)
 	w.RegisterActivity(activities.ExecuteAndStoreNamedQueryActivity)
 	w.RegisterActivity(activities.RegisterDefaultQueriesActivity)
+	w.RegisterActivity(activities.CheckCurrentPartitionsActivity)
+	w.RegisterActivity(activities.CheckDatabaseSchemaVersionActivity)
+	w.RegisterActivity(activities.CheckDiskSpaceActivity)
+	w.RegisterActivity(activities.CheckReplicationLagActivity)
 
 	log.Printf("Registered workflows and activities on task queue: %s", actualTaskQueue)
 
@@ -8,6 +8,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pierreaubert/dotidx/dix"
 )
 
 // MetricsCollector manages Prometheus metrics for dixmgr
@@ -338,6 +340,8 @@ func (mc *MetricsCollector) GetServiceState(service string) (ServiceMetricState,
 
 // StartMetricsServer starts an HTTP server exposing Prometheus metrics
 func (mc *MetricsCollector) StartMetricsServer(addr string) error {
+	prometheus.MustRegister(dix.NewBuildInfoCollector())
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/version", dix.HandleVersion)
 	return http.ListenAndServe(addr, nil)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pierreaubert/dotidx/dix"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// printPlan writes the unified diff between the files on disk and the
+// generated ones, nothing for the unchanged files, and returns how many
+// files would change
+func printPlan(w io.Writer, files map[string][]byte) (int, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	changed := 0
+	for _, path := range paths {
+		from := path
+		current, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			from = "/dev/null"
+		} else if err != nil {
+			return changed, err
+		}
+		if bytes.Equal(current, files[path]) {
+			continue
+		}
+		changed++
+		err = difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+			A:        diffLines(current),
+			B:        diffLines(files[path]),
+			FromFile: from,
+			ToFile:   path,
+			Context:  3,
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// diffLines splits data in lines ending with a newline, difflib.SplitLines
+// would add an empty line after the last one
+func diffLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	last := len(lines) - 1
+	if lines[last] == "" {
+		return lines[:last]
+	}
+	lines[last] += "\n"
+	return lines
+}
+
+// runPlan generates the files as -generate would and prints what it would
+// change, without writing anything
+func runPlan(w io.Writer, config *dix.MgrConfig) error {
+	files, err := generateFiles(config)
+	if err != nil {
+		return err
+	}
+	changed, err := printPlan(w, files)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d of %d files would change in %s\n", changed, len(files), confDir(config))
+	return nil
+}
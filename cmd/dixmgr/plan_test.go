@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func TestPlan(t *testing.T) {
+	config := sidecarsConfig(t)
+	config.Parachains["polkadot"]["people"] = dix.ParaChainConfig{
+		PortRPC:      9946,
+		SidecarIP:    "10.0.0.6",
+		SidecarPort:  11000,
+		SidecarCount: 1,
+	}
+	dir := confDir(config)
+
+	// nothing generated yet, every file is new
+	var out bytes.Buffer
+	if err := runPlan(&out, config); err != nil {
+		t.Fatalf("runPlan: %v", err)
+	}
+	if !strings.Contains(out.String(), "--- /dev/null\n") || !strings.Contains(out.String(), "+SAS_EXPRESS_PORT=10901\n") ||
+		!strings.HasSuffix(out.String(), "3 of 3 files would change in "+dir+"\n") {
+		t.Errorf("Expected three new files, got:\n%s", out.String())
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected -plan to write nothing, got %v", err)
+	}
+
+	files, err := generateFiles(config)
+	if err != nil {
+		t.Fatalf("generateFiles: %v", err)
+	}
+	if err := writeFiles(files); err != nil {
+		t.Fatalf("writeFiles: %v", err)
+	}
+
+	// assethub moves its sidecars, people keeps its own
+	assethub := config.Parachains["polkadot"]["assethub"]
+	assethub.SidecarPort = 10800
+	config.Parachains["polkadot"]["assethub"] = assethub
+	loaded := *config
+	out.Reset()
+	if err := runPlan(&out, config); err != nil {
+		t.Fatalf("runPlan: %v", err)
+	}
+	env := filepath.Join(dir, "polkadot-assethub-0-sidecar.conf")
+	for _, line := range []string{
+		"--- " + env + "\n",
+		"+++ " + env + "\n",
+		"-SAS_EXPRESS_PORT=10901\n",
+		"+SAS_EXPRESS_PORT=10801\n",
+		" SAS_EXPRESS_BIND_HOST=10.0.0.6\n",
+		"2 of 3 files would change",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "polkadot-people-0-sidecar.conf") || strings.Contains(out.String(), "-SAS_SUBSTRATE_URL") {
+		t.Errorf("Expected no diff of the unchanged file nor lines, got:\n%s", out.String())
+	}
+	if data, _ := os.ReadFile(env); !strings.Contains(string(data), "SAS_EXPRESS_PORT=10901\n") {
+		t.Errorf("Expected -plan to leave %s alone, got:\n%s", env, data)
+	}
+	if !reflect.DeepEqual(*config, loaded) {
+		t.Errorf("Expected -plan to leave the configuration alone")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// resolveTuning sets the memory of the host, memoryGB when positive or the
+// detected one otherwise, and the settings computed from it
+func resolveTuning(config *dix.MgrConfig, memoryGB int) {
+	if memoryGB > 0 {
+		config.SystemMemoryGB = memoryGB
+	} else if detected, err := dix.GetSystemMemoryGB(); err == nil {
+		config.SystemMemoryGB = detected
+	} else {
+		log.Printf("Cannot detect the memory of the host, assuming the default: %v", err)
+	}
+	config.CalculateMemorySettings()
+}
+
+// printTuning writes the values the generated postgres and node
+// configurations get
+func printTuning(w io.Writer, config dix.MgrConfig) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	nodes, sidecars := config.ColocatedServices()
+	fmt.Fprintf(tw, "system memory\t%dGB\n", config.SystemMemoryGB)
+	fmt.Fprintf(tw, "colocated\t%d nodes, %d sidecars\n", nodes, sidecars)
+	fmt.Fprintf(tw, "postgres\t%dGB\n", config.PostgresMemoryGB)
+	fmt.Fprintf(tw, "  shared_buffers\t%s\n", config.SharedBuffers)
+	fmt.Fprintf(tw, "  work_mem\t%s\n", config.WorkMemory)
+	fmt.Fprintf(tw, "  maintenance_work_mem\t%s\n", config.MaintenanceWorkMemory)
+	fmt.Fprintf(tw, "  max_wal_size\t%s\n", config.MaxWalSize)
+	fmt.Fprintln(tw, "node\t")
+	fmt.Fprintf(tw, "  db_cache\t%dMB\n", config.DbCache)
+	fmt.Fprintf(tw, "  rpc_max_connections\t%d\n", config.RpcMaxConnections)
+	tw.Flush()
+}
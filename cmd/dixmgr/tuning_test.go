@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func TestPrintTuning(t *testing.T) {
+	var config dix.MgrConfig
+	config.DotidxDB.Memory = "16GB"
+	// the flag wins over the memory of the machine running the test
+	resolveTuning(&config, 64)
+
+	var out bytes.Buffer
+	printTuning(&out, config)
+	for _, line := range []string{
+		"system memory           64GB",
+		"colocated               0 nodes, 0 sidecars",
+		"postgres                64GB",
+		"  shared_buffers        16GB",
+		"  work_mem              64MB",
+		"  maintenance_work_mem  16GB",
+		"  max_wal_size          4GB",
+		"  db_cache              7606MB",
+		"  rpc_max_connections   8000",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+// watchListAlerter fires the alerts of a dix.WatchList through
+// alertManager. The alerts of a chain share its service, the block is a
+// label, and are resolved as soon as they are sent: each block is a
+// separate event.
+func watchListAlerter(alertManager *AlertManager) dix.WatchAlerter {
+	return func(ctx context.Context, watched dix.WatchAlert) error {
+		alert := Alert{
+			Type:     AlertAddressWatched,
+			Severity: SeverityWarning,
+			Service:  fmt.Sprintf("%s:%s", watched.RelayChain, watched.Chain),
+			Message:  watched.String(),
+			Labels: map[string]string{
+				"relay_chain": watched.RelayChain,
+				"chain":       watched.Chain,
+				"block":       watched.BlockID,
+				"addresses":   strings.Join(watched.Addresses, ","),
+			},
+		}
+		err := alertManager.FireAlert(ctx, alert)
+		alertManager.ResolveAlert(alert)
+		return err
+	}
+}
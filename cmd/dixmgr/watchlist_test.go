@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+const watchedAddress = "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+
+// recordingChannel keeps the alerts it is sent
+type recordingChannel struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (c *recordingChannel) Name() string { return "recording" }
+
+func (c *recordingChannel) Send(ctx context.Context, alert Alert) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.alerts = append(c.alerts, alert)
+	return nil
+}
+
+func (c *recordingChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.alerts)
+}
+
+// savingDatabase accepts every save
+type savingDatabase struct {
+	Database
+}
+
+func (d *savingDatabase) Save(items []dix.BlockData, relayChain, chain string) error {
+	return nil
+}
+
+func TestWatchListAlertsOncePerBlock(t *testing.T) {
+	// blocks 1 and 2 touch the watched address, block 3 does not
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/blocks/")
+		signer := watchedAddress
+		if id == "3" {
+			signer = "1zugcag7cJVBtVRnFxv5Qftn7xKAnR6YJ9x4x3XLgGgmNnS"
+		}
+		fmt.Fprintf(w, `{"number":"%s","hash":"0x%s","extrinsics":[{"signature":{"signer":{"id":"%s"}}}]}`, id, id, signer)
+	}))
+	defer sidecar.Close()
+
+	channel := &recordingChannel{}
+	alertManager := NewAlertManager(nil, 5*time.Minute)
+	alertManager.RegisterChannel(channel)
+	activities := &Activities{
+		database:  &savingDatabase{},
+		watchList: dix.NewWatchList([]string{watchedAddress}, nil, watchListAlerter(alertManager)),
+	}
+
+	ctx := context.Background()
+	for _, id := range []int{1, 1, 3} {
+		if err := activities.ProcessSingleBlockActivity(ctx, "polkadot", "assethub", id, sidecar.URL); err != nil {
+			t.Fatalf("ProcessSingleBlockActivity(%d): %v", id, err)
+		}
+	}
+	if n := channel.count(); n != 1 {
+		t.Fatalf("Expected 1 alert after indexing block 1 twice, got %d", n)
+	}
+	alert := channel.alerts[0]
+	if alert.Type != AlertAddressWatched || alert.Service != "polkadot:assethub" ||
+		alert.Labels["block"] != "1" || alert.Labels["addresses"] != watchedAddress {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+	if active := alertManager.GetActiveAlerts(); len(active) != 0 {
+		t.Errorf("Expected the alert to be resolved once sent, got %v", active)
+	}
+
+	if err := activities.ProcessSingleBlockActivity(ctx, "polkadot", "assethub", 2, sidecar.URL); err != nil {
+		t.Fatalf("ProcessSingleBlockActivity(2): %v", err)
+	}
+	if n := channel.count(); n != 2 {
+		t.Errorf("Expected a second alert for block 2, got %d alerts", n)
+	}
+}
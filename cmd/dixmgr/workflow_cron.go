@@ -52,6 +52,12 @@ func CronWorkflow(ctx workflow.Context, config CronWorkflowConfig) error {
 	currentMonth := int(currentTime.Month())
 
 	if isHourly {
+		// the executions started before the health checks go straight to
+		// the queries
+		if workflow.GetVersion(ctx, "hourly-health-checks", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+			checkDatabaseHealth(ctx, config, logger)
+		}
+
 		// Hourly execution: only compute current month's block count
 		err = executeCurrentMonthQueries(ctx, chains, currentYear, currentMonth, logger)
 	} else {
@@ -68,6 +74,35 @@ func CronWorkflow(ctx workflow.Context, config CronWorkflowConfig) error {
 	return nil
 }
 
+// checkDatabaseHealth checks the partitions of the current month, the disk
+// space, the replication lag and the schema version, the failures are
+// logged and alerted by the activities
+func checkDatabaseHealth(ctx workflow.Context, config CronWorkflowConfig, logger log.Logger) {
+	// the blocks of the month are lost when its partition is missing
+	var partitions PartitionCheckResult
+	if err := workflow.ExecuteActivity(ctx, "CheckCurrentPartitionsActivity").Get(ctx, &partitions); err != nil {
+		logger.Error("Failed to check the partitions", "error", err)
+	} else if !partitions.Healthy {
+		logger.Error("No partition for the current month", "chains", partitions.Missing)
+	}
+	var spaces []DiskSpace
+	if err := workflow.ExecuteActivity(ctx, "CheckDiskSpaceActivity", config.DiskSpace).Get(ctx, &spaces); err != nil {
+		logger.Error("Failed to check the disk space", "error", err)
+	}
+	var lag ReplicationLagResult
+	if err := workflow.ExecuteActivity(ctx, "CheckReplicationLagActivity", config.ReplicaMaxLag).Get(ctx, &lag); err != nil {
+		logger.Error("Failed to check the replication lag", "error", err)
+	} else if !lag.Healthy {
+		logger.Error("Read replica is behind", "lag", lag.Lag, "maxLag", lag.MaxLag)
+	}
+	var schema SchemaVersionCheckResult
+	if err := workflow.ExecuteActivity(ctx, "CheckDatabaseSchemaVersionActivity").Get(ctx, &schema); err != nil {
+		logger.Error("Failed to check the schema version", "error", err)
+	} else if !schema.Healthy {
+		logger.Error("Database schema version mismatch", "version", schema.Version, "expected", schema.Expected)
+	}
+}
+
 // executeCurrentMonthQueries executes block count query for current month (hourly)
 func executeCurrentMonthQueries(ctx workflow.Context, chains []ChainInfo,
 	year, month int, logger log.Logger) error {
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// runHourlyCron runs an hourly CronWorkflow on no chain at version of the
+// health checks and returns the environment to inspect the activities
+func runHourlyCron(t *testing.T, version workflow.Version) *testsuite.TestWorkflowEnvironment {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.GetDatabaseInfoActivity)
+	env.RegisterActivity(activities.CheckCurrentPartitionsActivity)
+	env.RegisterActivity(activities.CheckDiskSpaceActivity)
+	env.RegisterActivity(activities.CheckReplicationLagActivity)
+	env.RegisterActivity(activities.CheckDatabaseSchemaVersionActivity)
+
+	env.OnGetVersion("hourly-health-checks", workflow.DefaultVersion, 1).Return(version)
+	env.OnActivity("GetDatabaseInfoActivity", mock.Anything).Return([]ChainInfo{}, nil)
+	env.OnActivity("CheckCurrentPartitionsActivity", mock.Anything).Return(&PartitionCheckResult{Healthy: true}, nil)
+	env.OnActivity("CheckDiskSpaceActivity", mock.Anything, mock.Anything).Return([]DiskSpace{}, nil)
+	env.OnActivity("CheckReplicationLagActivity", mock.Anything, mock.Anything).Return(&ReplicationLagResult{Healthy: true}, nil)
+	env.OnActivity("CheckDatabaseSchemaVersionActivity", mock.Anything).Return(&SchemaVersionCheckResult{Healthy: true}, nil)
+
+	// the test executions have no cron schedule, an empty hourly one
+	// matches it
+	env.ExecuteWorkflow(CronWorkflow, CronWorkflowConfig{})
+	if !env.IsWorkflowCompleted() || env.GetWorkflowError() != nil {
+		t.Fatalf("Expected the workflow to complete, got %v", env.GetWorkflowError())
+	}
+	return env
+}
+
+func TestCronWorkflowHealthChecks(t *testing.T) {
+	env := runHourlyCron(t, 1)
+	for _, activity := range []string{
+		"CheckCurrentPartitionsActivity",
+		"CheckDiskSpaceActivity",
+		"CheckReplicationLagActivity",
+		"CheckDatabaseSchemaVersionActivity",
+	} {
+		env.AssertNumberOfCalls(t, activity, 1)
+	}
+}
+
+func TestCronWorkflowHealthChecksBeforeVersion(t *testing.T) {
+	env := runHourlyCron(t, workflow.DefaultVersion)
+	for _, activity := range []string{
+		"CheckCurrentPartitionsActivity",
+		"CheckDiskSpaceActivity",
+		"CheckReplicationLagActivity",
+		"CheckDatabaseSchemaVersionActivity",
+	} {
+		env.AssertNumberOfCalls(t, activity, 0)
+	}
+}
@@ -16,6 +16,9 @@ func DependentServiceWorkflow(ctx workflow.Context, config DependentServiceConfi
 		"service", config.NodeConfig.Name,
 		"dependencies", len(config.Dependencies))
 
+	// the executions started before went on at the first ready signal
+	waitAll := workflow.GetVersion(ctx, "dependency-wait-all-signals", workflow.DefaultVersion, 1) != workflow.DefaultVersion
+
 	// Wait for all dependencies to be ready
 	for _, dep := range config.Dependencies {
 		logger.Info("Waiting for dependency",
@@ -47,8 +50,12 @@ func DependentServiceWorkflow(ctx workflow.Context, config DependentServiceConfi
 			if ready {
 				logger.Info("Dependency ready",
 					"service", config.NodeConfig.Name,
-					"dependency", dep.WorkflowID)
-				break
+					"dependency", dep.WorkflowID,
+					"signal", signalName)
+				// with RequiredAny the first ready signal is enough
+				if dep.RequiredAny || !waitAll {
+					break
+				}
 			}
 		}
 	}
@@ -2,17 +2,289 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"go.temporal.io/sdk/workflow"
 )
 
+// defaultWatchInterval is how often a service is checked when nothing is
+// configured
+const defaultWatchInterval = 30 * time.Second
+
+// ServiceStart is a service of the infrastructure, started once the services
+// of DependsOn, given by their ready signals, are ready
+type ServiceStart struct {
+	WorkflowID string
+	Node       NodeWorkflowConfig
+	DependsOn  []string
+}
+
+// serviceOf names a service from its ready signal, as in the configuration
+func serviceOf(readySignal string) string {
+	return strings.TrimPrefix(readySignal, "ready:")
+}
+
+// StartPlan lists the services of the infrastructure with their dependencies:
+// relay chains → parachains → sidecars → nginx → app services, plus the
+// configured ones. It fails when a dependency names an unknown service or
+// when the dependencies form a cycle.
+func (input InfrastructureWorkflowInput) StartPlan() ([]ServiceStart, error) {
+	var plan []ServiceStart
+	var allSidecarSignals []string
+
+	sidecarWatchInterval := input.SidecarWatchInterval
+	if sidecarWatchInterval == 0 {
+		sidecarWatchInterval = defaultWatchInterval
+	}
+	serviceWatchInterval := input.ServiceWatchInterval
+	if serviceWatchInterval == 0 {
+		serviceWatchInterval = defaultWatchInterval
+	}
+
+	for _, relayPlan := range input.RelayPlans {
+		// the relay node is missing when the relay chain is not configured
+		var relayDependency []string
+		if relayPlan.Node.ReadySignal != "" {
+			plan = append(plan, ServiceStart{
+				WorkflowID: WorkflowIDNodeRelay(relayPlan.RelayID),
+				Node:       relayPlan.Node,
+			})
+			relayDependency = []string{relayPlan.Node.ReadySignal}
+		}
+
+		for _, paraPlan := range relayPlan.Parachains {
+			plan = append(plan, ServiceStart{
+				WorkflowID: WorkflowIDNodePara(relayPlan.RelayID, paraPlan.ChainID),
+				Node:       paraPlan.Node,
+				DependsOn:  relayDependency,
+			})
+
+			for i := 0; i < paraPlan.SidecarCount; i++ {
+				sidecarConfig := NodeWorkflowConfig{
+					Name:             fmt.Sprintf("Sidecar-%s-%s-%d", relayPlan.RelayID, paraPlan.ChainID, i),
+					SystemdUnit:      fmt.Sprintf("sidecar@%s-%s-%d.service", relayPlan.RelayID, paraPlan.ChainID, i),
+					ServiceName:      fmt.Sprintf("%s-%d", paraPlan.SidecarServiceName, i),
+					CheckSync:        false, // Sidecars don't need sync check
+					ReadySignal:      ReadySignalSidecar(relayPlan.RelayID, paraPlan.ChainID, i),
+					ParentWorkflowID: WorkflowIDInfra(),
+					WatchInterval:    sidecarWatchInterval,
+					MaxRestarts:      5,
+					RestartBackoff:   10 * time.Second,
+				}
+				if paraPlan.NodeRPC != "" && i < len(paraPlan.SidecarURLs) {
+					sidecarConfig.SidecarHead = &SidecarHeadConfig{
+						Service:    sidecarConfig.ServiceName,
+						NodeRPC:    paraPlan.NodeRPC,
+						SidecarURL: paraPlan.SidecarURLs[i],
+					}
+				}
+				plan = append(plan, ServiceStart{
+					WorkflowID: WorkflowIDSidecar(relayPlan.RelayID, paraPlan.ChainID, i),
+					Node:       sidecarConfig,
+					DependsOn:  []string{paraPlan.Node.ReadySignal},
+				})
+				allSidecarSignals = append(allSidecarSignals, sidecarConfig.ReadySignal)
+			}
+		}
+	}
+
+	// nginx depends on all sidecars
+	nginxReadySignal := ReadySignalSvc(input.NginxService)
+	plan = append(plan, ServiceStart{
+		WorkflowID: WorkflowIDSvc(input.NginxService),
+		Node: NodeWorkflowConfig{
+			Name:             "Nginx",
+			SystemdUnit:      "dix-nginx.service",
+			ServiceName:      input.NginxService,
+			CheckSync:        false,
+			ReadySignal:      nginxReadySignal,
+			ParentWorkflowID: WorkflowIDInfra(),
+			WatchInterval:    serviceWatchInterval,
+			MaxRestarts:      5,
+			RestartBackoff:   10 * time.Second,
+		},
+		DependsOn: allSidecarSignals,
+	})
+
+	// application services depend on nginx
+	for _, svcName := range input.AfterNginxServices {
+		plan = append(plan, ServiceStart{
+			WorkflowID: WorkflowIDSvc(svcName),
+			Node: NodeWorkflowConfig{
+				Name:             svcName,
+				SystemdUnit:      fmt.Sprintf("%s.service", svcName),
+				ServiceName:      svcName,
+				CheckSync:        false,
+				ReadySignal:      ReadySignalSvc(svcName),
+				ParentWorkflowID: WorkflowIDInfra(),
+				WatchInterval:    serviceWatchInterval,
+				MaxRestarts:      5,
+				RestartBackoff:   10 * time.Second,
+			},
+			DependsOn: []string{nginxReadySignal},
+		})
+	}
+
+	index := make(map[string]int, len(plan))
+	for i, service := range plan {
+		index[service.Node.ReadySignal] = i
+	}
+
+	// configured dependencies, sorted so that the same error is reported
+	services := make([]string, 0, len(input.Dependencies))
+	for signal := range input.Dependencies {
+		services = append(services, signal)
+	}
+	sort.Strings(services)
+	for _, signal := range services {
+		i, ok := index[signal]
+		if !ok {
+			return nil, fmt.Errorf("unknown service %s", serviceOf(signal))
+		}
+		dependsOn := append([]string(nil), plan[i].DependsOn...)
+		for _, dep := range input.Dependencies[signal] {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("%s depends on unknown service %s", serviceOf(signal), serviceOf(dep))
+			}
+			dependsOn = append(dependsOn, dep)
+		}
+		plan[i].DependsOn = dependsOn
+	}
+
+	// a cycle would leave its services waiting for each other
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(plan))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		path = append(path, serviceOf(plan[i].Node.ReadySignal))
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range plan[i].DependsOn {
+			if err := visit(index[dep], path); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range plan {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
 // InfrastructureWorkflow - Root orchestrator for the entire dotidx infrastructure
-// Orchestrates relay chains → parachains → sidecars → nginx → app services
+// Orchestrates relay chains → parachains → sidecars → nginx → app services,
+// plus the configured dependencies, see StartPlan. Each service waits for its
+// dependencies in a DependentServiceWorkflow and this workflow forwards it the
+// ready signals it receives from the nodes.
 func InfrastructureWorkflow(ctx workflow.Context, input InfrastructureWorkflowInput) error {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("InfrastructureWorkflow started", "relays", len(input.RelayPlans))
 
+	// the executions started before the start plan keep starting the
+	// services one phase at a time
+	if workflow.GetVersion(ctx, "infrastructure-start-plan", workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		return infrastructurePhases(ctx, input)
+	}
+
+	plan, err := input.StartPlan()
+	if err != nil {
+		return fmt.Errorf("invalid infrastructure plan: %w", err)
+	}
+
+	// workflows waiting for each ready signal
+	dependents := make(map[string][]string)
+	for _, service := range plan {
+		logger.Info("Starting service",
+			"service", service.Node.Name,
+			"dependencies", len(service.DependsOn))
+
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: service.WorkflowID,
+		})
+
+		var child workflow.ChildWorkflowFuture
+		if len(service.DependsOn) == 0 {
+			child = workflow.ExecuteChildWorkflow(childCtx, NodeWorkflow, service.Node)
+		} else {
+			dependency := DependentServiceConfig{
+				NodeConfig: service.Node,
+				Dependencies: []DependencyInfo{
+					{
+						WorkflowID:   WorkflowIDInfra(),
+						SignalNames:  service.DependsOn,
+						RequiredAny:  false,
+						TimeoutHours: 24,
+					},
+				},
+			}
+			child = workflow.ExecuteChildWorkflow(childCtx, DependentServiceWorkflow, dependency)
+			for _, signal := range service.DependsOn {
+				dependents[signal] = append(dependents[signal], service.WorkflowID)
+			}
+		}
+
+		// the child must exist before it is signaled
+		if err := child.GetChildWorkflowExecution().Get(ctx, nil); err != nil {
+			return fmt.Errorf("failed to start %s: %w", service.Node.Name, err)
+		}
+	}
+
+	logger.Info("All infrastructure components started and orchestrated")
+
+	// Forward the ready signals and keep running until shutdown
+	selector := workflow.NewSelector(ctx)
+	for _, service := range plan {
+		signal := service.Node.ReadySignal
+		selector.AddReceive(workflow.GetSignalChannel(ctx, signal), func(c workflow.ReceiveChannel, more bool) {
+			var ready bool
+			c.Receive(ctx, &ready)
+			logger.Info("Service ready", "service", service.Node.Name)
+
+			for _, workflowID := range dependents[signal] {
+				err := workflow.SignalExternalWorkflow(ctx, workflowID, "", signal, ready).Get(ctx, nil)
+				if err != nil {
+					logger.Error("Failed to forward ready signal",
+						"signal", signal,
+						"workflow", workflowID,
+						"error", err)
+				}
+			}
+		})
+	}
+
+	shutdown := false
+	selector.AddReceive(workflow.GetSignalChannel(ctx, "Shutdown"), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		shutdown = true
+	})
+	for !shutdown {
+		selector.Select(ctx)
+	}
+	return nil
+}
+
+// infrastructurePhases is InfrastructureWorkflow before the start plan: each
+// phase waits for the ready signals of the previous one, the configured
+// dependencies are ignored
+func infrastructurePhases(ctx workflow.Context, input InfrastructureWorkflowInput) error {
+	logger := workflow.GetLogger(ctx)
+
 	// Track all expected ready signals
 	var allSidecarSignals []string
 
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func testInfraConfig() *dix.MgrConfig {
+	return &dix.MgrConfig{
+		Parachains: map[string]map[string]dix.ParaChainConfig{
+			"polkadot": {
+				"polkadot": {PortRPC: 9944},
+				"assethub": {PortRPC: 9945},
+				"people":   {PortRPC: 9946},
+			},
+		},
+	}
+}
+
+func TestStartPlanDependencies(t *testing.T) {
+	cfg := testInfraConfig()
+	cfg.Watcher.Dependencies = []dix.ServiceDependency{
+		{Service: "para:polkadot:assethub", DependsOn: []string{"para:polkadot:people"}},
+	}
+	input, err := FromMgrConfigToInfraInput(cfg, 30, 5, 10)
+	if err != nil {
+		t.Fatalf("FromMgrConfigToInfraInput: %v", err)
+	}
+	plan, err := input.StartPlan()
+	if err != nil {
+		t.Fatalf("StartPlan: %v", err)
+	}
+	for _, service := range plan {
+		if service.Node.ReadySignal != ReadySignalPara("polkadot", "assethub") {
+			continue
+		}
+		expected := []string{ReadySignalRelay("polkadot"), ReadySignalPara("polkadot", "people")}
+		if strings.Join(service.DependsOn, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected assethub to depend on %v, got %v", expected, service.DependsOn)
+		}
+	}
+
+	// the parachain already depends on its relay chain
+	cfg.Watcher.Dependencies = []dix.ServiceDependency{
+		{Service: "relay:polkadot", DependsOn: []string{"para:polkadot:people"}},
+	}
+	if _, err := FromMgrConfigToInfraInput(cfg, 30, 5, 10); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected a dependency cycle, got %v", err)
+	}
+
+	cfg.Watcher.Dependencies = []dix.ServiceDependency{
+		{Service: "svc:dixfe", DependsOn: []string{"para:kusama:people"}},
+	}
+	if _, err := FromMgrConfigToInfraInput(cfg, 30, 5, 10); err == nil || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("Expected an unknown service, got %v", err)
+	}
+}
+
+// customDependencyInput plans a relay chain with assethub and people, one
+// sidecar each, assethub waiting for people
+func customDependencyInput() InfrastructureWorkflowInput {
+	return InfrastructureWorkflowInput{
+		RelayPlans: []RelayPlan{{
+			RelayID: "polkadot",
+			Node: NodeWorkflowConfig{
+				Name:             "RelayChain-polkadot",
+				ReadySignal:      ReadySignalRelay("polkadot"),
+				ParentWorkflowID: WorkflowIDInfra(),
+			},
+			Parachains: []ParaPlan{
+				{
+					ChainID:      "assethub",
+					SidecarCount: 1,
+					Node: NodeWorkflowConfig{
+						Name:             "Chain-polkadot-assethub",
+						ReadySignal:      ReadySignalPara("polkadot", "assethub"),
+						ParentWorkflowID: WorkflowIDInfra(),
+					},
+				},
+				{
+					ChainID:      "people",
+					SidecarCount: 1,
+					Node: NodeWorkflowConfig{
+						Name:             "Chain-polkadot-people",
+						ReadySignal:      ReadySignalPara("polkadot", "people"),
+						ParentWorkflowID: WorkflowIDInfra(),
+					},
+				},
+			},
+		}},
+		NginxService:       "dix-nginx",
+		AfterNginxServices: []string{"dixfe"},
+		Dependencies: map[string][]string{
+			ReadySignalPara("polkadot", "assethub"): {ReadySignalPara("polkadot", "people")},
+		},
+	}
+}
+
+func TestInfrastructureWorkflowCustomDependency(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(DependentServiceWorkflow)
+	env.SetStartWorkflowOptions(client.StartWorkflowOptions{ID: WorkflowIDInfra()})
+
+	// the nodes are ready as soon as they start
+	var mu sync.Mutex
+	var started []string
+	env.OnWorkflow(NodeWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, config NodeWorkflowConfig) error {
+			mu.Lock()
+			started = append(started, config.Name)
+			mu.Unlock()
+			return workflow.SignalExternalWorkflow(ctx, config.ParentWorkflowID, "", config.ReadySignal, true).Get(ctx, nil)
+		})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("Shutdown", nil)
+	}, time.Hour)
+
+	// assethub comes first in the plan but waits for people
+	input := customDependencyInput()
+
+	env.ExecuteWorkflow(InfrastructureWorkflow, input)
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("InfrastructureWorkflow: %v", err)
+	}
+
+	if len(started) != 7 {
+		t.Fatalf("Expected 7 services started, got %v", started)
+	}
+	position := make(map[string]int)
+	for i, name := range started {
+		position[name] = i
+	}
+	for _, order := range [][2]string{
+		{"RelayChain-polkadot", "Chain-polkadot-people"},
+		{"Chain-polkadot-people", "Chain-polkadot-assethub"},
+		{"Chain-polkadot-assethub", "Sidecar-polkadot-assethub-0"},
+		{"Sidecar-polkadot-assethub-0", "Nginx"},
+		{"Sidecar-polkadot-people-0", "Nginx"},
+		{"Nginx", "dixfe"},
+	} {
+		if position[order[0]] > position[order[1]] {
+			t.Errorf("Expected %s to start before %s, got %v", order[0], order[1], started)
+		}
+	}
+}
+
+func TestFromMgrConfigToInfraInputWatchIntervals(t *testing.T) {
+	cfg := testInfraConfig()
+	cfg.Parachains["polkadot"]["assethub"] = dix.ParaChainConfig{PortRPC: 9945, SidecarCount: 1}
+	cfg.Watcher.WatchIntervals = dix.WatchIntervals{
+		Relay:   dix.Duration(2 * time.Minute),
+		Sidecar: dix.Duration(15 * time.Second),
+	}
+	input, err := FromMgrConfigToInfraInput(cfg, 45, 5, 10)
+	if err != nil {
+		t.Fatalf("FromMgrConfigToInfraInput: %v", err)
+	}
+	if input.SidecarWatchInterval != 15*time.Second || input.ServiceWatchInterval != 45*time.Second {
+		t.Errorf("Expected 15s for the sidecars and 45s for the services, got %v and %v",
+			input.SidecarWatchInterval, input.ServiceWatchInterval)
+	}
+
+	plan, err := input.StartPlan()
+	if err != nil {
+		t.Fatalf("StartPlan: %v", err)
+	}
+	expected := map[string]time.Duration{
+		"RelayChain-polkadot":         2 * time.Minute,
+		"Chain-polkadot-assethub":     45 * time.Second, // the global interval
+		"Chain-polkadot-people":       45 * time.Second,
+		"Sidecar-polkadot-assethub-0": 15 * time.Second,
+		"Nginx":                       45 * time.Second,
+		"dixfe":                       45 * time.Second,
+	}
+	for _, service := range plan {
+		if interval, ok := expected[service.Node.Name]; ok && service.Node.WatchInterval != interval {
+			t.Errorf("Expected %s to be checked every %v, got %v", service.Node.Name, interval, service.Node.WatchInterval)
+		}
+	}
+
+	// nothing configured
+	input, err = FromMgrConfigToInfraInput(testInfraConfig(), 0, 5, 10)
+	if err != nil {
+		t.Fatalf("FromMgrConfigToInfraInput: %v", err)
+	}
+	if input.RelayPlans[0].Node.WatchInterval != defaultWatchInterval || input.SidecarWatchInterval != defaultWatchInterval {
+		t.Errorf("Expected the default watch interval, got %v and %v",
+			input.RelayPlans[0].Node.WatchInterval, input.SidecarWatchInterval)
+	}
+}
+
+func TestStartPlanSidecarHeads(t *testing.T) {
+	input, err := FromMgrConfigToInfraInput(sidecarsConfig(t), 0, 5, 10)
+	if err != nil {
+		t.Fatalf("FromMgrConfigToInfraInput: %v", err)
+	}
+	plan, err := input.StartPlan()
+	if err != nil {
+		t.Fatalf("StartPlan: %v", err)
+	}
+	heads := make(map[string]*SidecarHeadConfig)
+	for _, service := range plan {
+		heads[service.Node.Name] = service.Node.SidecarHead
+	}
+	expected := SidecarHeadConfig{
+		Service:    "sidecar-polkadot-assethub-1",
+		NodeRPC:    "http://10.0.0.5:9945",
+		SidecarURL: "http://10.0.0.6:10902",
+	}
+	if head := heads["Sidecar-polkadot-assethub-1"]; head == nil || *head != expected {
+		t.Errorf("Expected the second sidecar to be compared with %+v, got %+v", expected, head)
+	}
+	if head := heads["Chain-polkadot-assethub"]; head != nil {
+		t.Errorf("Expected no sidecar head check on the node, got %+v", head)
+	}
+}
+
+func TestInfrastructureWorkflowBeforeTheStartPlan(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(DependentServiceWorkflow)
+	env.SetStartWorkflowOptions(client.StartWorkflowOptions{ID: WorkflowIDInfra()})
+	env.OnGetVersion("infrastructure-start-plan", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+
+	var mu sync.Mutex
+	var started []string
+	env.OnWorkflow(NodeWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, config NodeWorkflowConfig) error {
+			mu.Lock()
+			started = append(started, config.Name)
+			mu.Unlock()
+			return workflow.SignalExternalWorkflow(ctx, config.ParentWorkflowID, "", config.ReadySignal, true).Get(ctx, nil)
+		})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("Shutdown", nil)
+	}, time.Hour)
+
+	env.ExecuteWorkflow(InfrastructureWorkflow, customDependencyInput())
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("InfrastructureWorkflow: %v", err)
+	}
+
+	// one phase at a time, the configured dependency is ignored
+	position := make(map[string]int)
+	for i, name := range started {
+		position[name] = i
+	}
+	for _, order := range [][2]string{
+		{"RelayChain-polkadot", "Chain-polkadot-assethub"},
+		{"Chain-polkadot-assethub", "Chain-polkadot-people"},
+		{"Chain-polkadot-people", "Sidecar-polkadot-assethub-0"},
+		{"Sidecar-polkadot-people-0", "Nginx"},
+	} {
+		i, ok := position[order[0]]
+		j, ok2 := position[order[1]]
+		if !ok || !ok2 || i > j {
+			t.Errorf("Expected %s to start before %s, got %v", order[0], order[1], started)
+		}
+	}
+}
@@ -58,6 +58,8 @@ func NodeWorkflow(ctx workflow.Context, config NodeWorkflowConfig) error {
 
 	// Track readiness state
 	readySignalSent := false
+	// Sync state of the previous check, to tell a slow sync from a stalled one
+	var lastSyncSample *NodeSyncSample
 
 	// Main monitoring loop
 	for {
@@ -103,13 +105,38 @@ func NodeWorkflow(ctx workflow.Context, config NodeWorkflowConfig) error {
 					})
 			}
 
-			// Attempt restart if under max restarts
-			if restartCount < config.MaxRestarts {
+			// The operator may be stopping services on purpose, the
+			// executions started before the maintenance mode do not ask
+			var maintenance bool
+			if workflow.GetVersion(ctx, "maintenance-mode", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+				if err := workflow.ExecuteActivity(ctx, "IsMaintenanceModeActivity").Get(ctx, &maintenance); err != nil {
+					logger.Warn("Maintenance mode check failed",
+						"service", config.SystemdUnit,
+						"error", err)
+				}
+			}
+
+			if maintenance {
+				// Leave the service down, the restart is not counted
+				logger.Info("Maintenance mode, not restarting",
+					"service", config.SystemdUnit)
+
+			} else if restartCount < config.MaxRestarts {
+				// Attempt restart if under max restarts
 				restartCount++
 
-				// Apply exponential backoff
+				// Apply exponential backoff, the jitter is drawn in a side
+				// effect to keep the workflow deterministic. The executions
+				// started before keep their linear backoff.
 				if restartCount > 1 {
 					backoffDuration := time.Duration(restartCount) * config.RestartBackoff
+					if workflow.GetVersion(ctx, "restart-backoff-jitter", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+						var random float64
+						_ = workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+							return rand.Float64()
+						}).Get(&random)
+						backoffDuration = calculateBackoffWithJitter(restartCount-2, config.RestartBackoff, maxRestartBackoff, random)
+					}
 					logger.Info("Applying restart backoff",
 						"service", config.SystemdUnit,
 						"backoff", backoffDuration,
@@ -177,20 +204,48 @@ func NodeWorkflow(ctx workflow.Context, config NodeWorkflowConfig) error {
 
 			// Check blockchain sync status if required and not yet signaled ready
 			if config.CheckSync && !readySignalSent {
-				synced, err := checkNodeSync(ctx, config, logger)
+				progress, err := checkNodeSync(ctx, config, lastSyncSample, logger)
 				if err != nil {
 					logger.Warn("Sync check failed", "service", config.Name, "error", err)
-				} else if synced {
+				} else if progress.Synced {
 					logger.Info("Node is synced and ready", "service", config.Name)
 					readySignalSent = emitReadySignal(ctx, config, logger)
+				} else if progress.Stalled {
+					logger.Warn("Node sync is stalled",
+						"service", config.Name,
+						"block", progress.Sample.CurrentBlock)
 				} else {
-					logger.Info("Node is syncing", "service", config.Name)
+					logger.Info("Node is syncing",
+						"service", config.Name,
+						"block", progress.Sample.CurrentBlock,
+						"highestBlock", progress.Sample.HighestBlock,
+						"blocksPerSecond", progress.BlocksPerSecond)
+				}
+				if err == nil {
+					lastSyncSample = &progress.Sample
 				}
 			} else if !config.CheckSync && !readySignalSent {
 				// No sync check required, emit ready signal immediately
 				logger.Info("Service ready (no sync check required)", "service", config.Name)
 				readySignalSent = emitReadySignal(ctx, config, logger)
 			}
+
+			// A sidecar can be up but wedged on an old block, once ready
+			// it is compared with its node. The executions started before
+			// do not compare them.
+			if config.SidecarHead != nil && readySignalSent &&
+				workflow.GetVersion(ctx, "sidecar-head", workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+				var head *SidecarHeadResult
+				err := workflow.ExecuteActivity(ctx, "CheckSidecarHeadMatchesNodeActivity", *config.SidecarHead).Get(ctx, &head)
+				if err != nil {
+					logger.Warn("Sidecar head check failed", "service", config.Name, "error", err)
+				} else if !head.Healthy {
+					logger.Warn("Sidecar lags its node",
+						"service", config.Name,
+						"sidecarHead", head.SidecarHead,
+						"nodeHead", head.NodeHead)
+				}
+			}
 		}
 
 		// Wait before next health check
@@ -202,8 +257,9 @@ func NodeWorkflow(ctx workflow.Context, config NodeWorkflowConfig) error {
 	}
 }
 
-// checkNodeSync checks if a blockchain node has completed syncing
-func checkNodeSync(ctx workflow.Context, config NodeWorkflowConfig, logger log.Logger) (bool, error) {
+// checkNodeSync checks if a blockchain node has completed syncing and, from
+// the sample of the previous check, if it is still making progress
+func checkNodeSync(ctx workflow.Context, config NodeWorkflowConfig, previous *NodeSyncSample, logger log.Logger) (*NodeSyncProgress, error) {
 	// Configure activity options for sync check with retries
 	syncActivityOptions := workflow.ActivityOptions{
 		StartToCloseTimeout: 15 * time.Second,
@@ -216,13 +272,24 @@ func checkNodeSync(ctx workflow.Context, config NodeWorkflowConfig, logger log.L
 	}
 	syncCtx := workflow.WithActivityOptions(ctx, syncActivityOptions)
 
-	var synced bool
-	err := workflow.ExecuteActivity(syncCtx, "CheckNodeSyncActivity", config.RPCEndpoint, config.RPCPort).Get(syncCtx, &synced)
+	// the executions started before the progress check only ask whether
+	// the node is synced
+	if workflow.GetVersion(ctx, "sync-progress", workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		var synced bool
+		err := workflow.ExecuteActivity(syncCtx, "CheckNodeSyncActivity", config.RPCEndpoint, config.RPCPort).Get(syncCtx, &synced)
+		if err != nil {
+			return nil, fmt.Errorf("sync check activity failed: %w", err)
+		}
+		return &NodeSyncProgress{Synced: synced}, nil
+	}
+
+	var progress *NodeSyncProgress
+	err := workflow.ExecuteActivity(syncCtx, "CheckNodeSyncProgressActivity", config.RPCEndpoint, config.RPCPort, previous).Get(syncCtx, &progress)
 	if err != nil {
-		return false, fmt.Errorf("sync check activity failed: %w", err)
+		return nil, fmt.Errorf("sync check activity failed: %w", err)
 	}
 
-	return synced, nil
+	return progress, nil
 }
 
 // emitReadySignal sends the ready signal to the parent workflow
@@ -250,15 +317,23 @@ func emitReadySignal(ctx workflow.Context, config NodeWorkflowConfig, logger log
 	return true
 }
 
-// calculateBackoffWithJitter calculates exponential backoff with jitter
-func calculateBackoffWithJitter(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
-	// Exponential backoff: baseDelay * 2^attempt
-	delay := baseDelay * time.Duration(1<<uint(attempt))
+// maxRestartBackoff bounds the delay between two restarts of a service
+const maxRestartBackoff = 10 * time.Minute
+
+// calculateBackoffWithJitter calculates exponential backoff with jitter,
+// random is in [0, 1)
+func calculateBackoffWithJitter(attempt int, baseDelay, maxDelay time.Duration, random float64) time.Duration {
+	// Exponential backoff: baseDelay * 2^attempt, doubled step by step so
+	// that it cannot overflow
+	delay := baseDelay
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
 	if delay > maxDelay {
 		delay = maxDelay
 	}
 
 	// Add 10-20% jitter
-	jitter := time.Duration(float64(delay) * (0.1 + rand.Float64()*0.1))
+	jitter := time.Duration(float64(delay) * (0.1 + random*0.1))
 	return delay + jitter
 }
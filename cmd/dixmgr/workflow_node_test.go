@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestNodeWorkflowMaintenanceMode(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckSystemdServiceActivity)
+	env.RegisterActivity(activities.IsMaintenanceModeActivity)
+	env.RegisterActivity(activities.RestartSystemdServiceActivity)
+
+	checks, restarts := 0, 0
+	env.OnActivity("CheckSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, unit string) (*SystemdServiceStatus, error) {
+			checks++
+			return &SystemdServiceStatus{IsActive: false, ActiveState: "inactive"}, nil
+		})
+	env.OnActivity("IsMaintenanceModeActivity", mock.Anything).Return(true, nil)
+	env.OnActivity("RestartSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, unit string) error {
+			restarts++
+			return nil
+		})
+	env.RegisterDelayedCallback(env.CancelWorkflow, 10*time.Minute)
+
+	env.ExecuteWorkflow(NodeWorkflow, NodeWorkflowConfig{
+		Name:           "dixfe",
+		SystemdUnit:    "dixfe.service",
+		WatchInterval:  time.Minute,
+		MaxRestarts:    3,
+		RestartBackoff: 10 * time.Second,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if restarts != 0 {
+		t.Errorf("Expected no restart in maintenance mode, got %d", restarts)
+	}
+	// the service is still watched
+	if checks < 10 {
+		t.Errorf("Expected the service to be checked every minute, got %d checks", checks)
+	}
+}
+
+func TestNodeWorkflowBeforeTheMaintenanceMode(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckSystemdServiceActivity)
+	env.RegisterActivity(activities.IsMaintenanceModeActivity)
+	env.RegisterActivity(activities.RestartSystemdServiceActivity)
+	env.OnGetVersion("maintenance-mode", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+
+	restarts := 0
+	env.OnActivity("CheckSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		&SystemdServiceStatus{IsActive: false, ActiveState: "inactive"}, nil)
+	env.OnActivity("IsMaintenanceModeActivity", mock.Anything).Return(
+		func(ctx context.Context) (bool, error) {
+			t.Error("Expected no maintenance mode check in an execution started before it")
+			return true, nil
+		})
+	env.OnActivity("RestartSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, unit string) error {
+			restarts++
+			return nil
+		})
+	env.RegisterDelayedCallback(env.CancelWorkflow, 10*time.Minute)
+
+	env.ExecuteWorkflow(NodeWorkflow, NodeWorkflowConfig{
+		Name:           "dixfe",
+		SystemdUnit:    "dixfe.service",
+		WatchInterval:  time.Minute,
+		MaxRestarts:    3,
+		RestartBackoff: 10 * time.Second,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if restarts != 3 {
+		t.Errorf("Expected the service to be restarted 3 times, got %d", restarts)
+	}
+}
+
+func TestCalculateBackoffWithJitter(t *testing.T) {
+	previous := time.Duration(0)
+	for attempt := 0; attempt < 5; attempt++ {
+		// the largest jitter of an attempt stays below the smallest of the next
+		low := calculateBackoffWithJitter(attempt, 10*time.Second, time.Hour, 0)
+		high := calculateBackoffWithJitter(attempt, 10*time.Second, time.Hour, 0.999)
+		if low <= previous {
+			t.Errorf("Expected attempt %d to wait more than %v, got %v", attempt, previous, low)
+		}
+		if high < low || high > low*12/10 {
+			t.Errorf("Expected a jitter of 10 to 20%% at attempt %d, got %v to %v", attempt, low, high)
+		}
+		previous = high
+	}
+
+	// capped, even past the range of a time.Duration
+	if got := calculateBackoffWithJitter(100, 10*time.Second, time.Minute, 0); got != 66*time.Second {
+		t.Errorf("Expected the backoff to be capped at 66s, got %v", got)
+	}
+}
+
+func TestNodeWorkflowRestartBackoff(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckSystemdServiceActivity)
+	env.RegisterActivity(activities.IsMaintenanceModeActivity)
+	env.RegisterActivity(activities.RestartSystemdServiceActivity)
+
+	var restarts []time.Time
+	env.OnActivity("CheckSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		&SystemdServiceStatus{IsActive: false, ActiveState: "failed"}, nil)
+	env.OnActivity("IsMaintenanceModeActivity", mock.Anything).Return(false, nil)
+	env.OnActivity("RestartSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, unit string) error {
+			restarts = append(restarts, env.Now())
+			return nil
+		})
+	env.RegisterDelayedCallback(env.CancelWorkflow, 2*time.Hour)
+
+	env.ExecuteWorkflow(NodeWorkflow, NodeWorkflowConfig{
+		Name:           "dixfe",
+		SystemdUnit:    "dixfe.service",
+		WatchInterval:  10 * time.Second,
+		MaxRestarts:    5,
+		RestartBackoff: time.Minute,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	// bounded by MaxRestarts
+	if len(restarts) != 5 {
+		t.Fatalf("Expected 5 restarts, got %d", len(restarts))
+	}
+	for i := 2; i < len(restarts); i++ {
+		before, after := restarts[i-1].Sub(restarts[i-2]), restarts[i].Sub(restarts[i-1])
+		if after <= before {
+			t.Errorf("Expected restart %d to wait more than %v, got %v", i+1, before, after)
+		}
+	}
+}
+
+func TestNodeWorkflowBeforeTheJitteredBackoff(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckSystemdServiceActivity)
+	env.RegisterActivity(activities.IsMaintenanceModeActivity)
+	env.RegisterActivity(activities.RestartSystemdServiceActivity)
+	env.OnGetVersion("restart-backoff-jitter", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+
+	var restarts []time.Time
+	env.OnActivity("CheckSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		&SystemdServiceStatus{IsActive: false, ActiveState: "failed"}, nil)
+	env.OnActivity("IsMaintenanceModeActivity", mock.Anything).Return(false, nil)
+	env.OnActivity("RestartSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, unit string) error {
+			restarts = append(restarts, env.Now())
+			return nil
+		})
+	env.RegisterDelayedCallback(env.CancelWorkflow, 2*time.Hour)
+
+	env.ExecuteWorkflow(NodeWorkflow, NodeWorkflowConfig{
+		Name:           "dixfe",
+		SystemdUnit:    "dixfe.service",
+		WatchInterval:  10 * time.Second,
+		MaxRestarts:    4,
+		RestartBackoff: time.Minute,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if len(restarts) != 4 {
+		t.Fatalf("Expected 4 restarts, got %d", len(restarts))
+	}
+	// the watch interval plus the attempt times restart_backoff, no jitter
+	for i := 1; i < len(restarts); i++ {
+		expected := 10*time.Second + time.Duration(i+1)*time.Minute
+		if got := restarts[i].Sub(restarts[i-1]); got != expected {
+			t.Errorf("Expected restart %d to wait %v, got %v", i+1, expected, got)
+		}
+	}
+}
+
+func TestNodeWorkflowSidecarHead(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	activities := &Activities{}
+	env.RegisterActivity(activities.CheckSystemdServiceActivity)
+	env.RegisterActivity(activities.CheckSidecarHeadMatchesNodeActivity)
+
+	head := SidecarHeadConfig{
+		Service:    "sidecar-polkadot-assethub-0",
+		NodeRPC:    "http://10.0.0.5:9945",
+		SidecarURL: "http://10.0.0.6:10901",
+	}
+	checks := 0
+	env.OnActivity("CheckSystemdServiceActivity", mock.Anything, mock.Anything).Return(
+		&SystemdServiceStatus{IsActive: true, ActiveState: "active"}, nil)
+	env.OnActivity("CheckSidecarHeadMatchesNodeActivity", mock.Anything, head).Return(
+		func(ctx context.Context, config SidecarHeadConfig) (*SidecarHeadResult, error) {
+			checks++
+			return &SidecarHeadResult{NodeHead: 100, SidecarHead: 100, Healthy: true}, nil
+		})
+	env.RegisterDelayedCallback(env.CancelWorkflow, 10*time.Minute)
+
+	env.ExecuteWorkflow(NodeWorkflow, NodeWorkflowConfig{
+		Name:          "Sidecar-polkadot-assethub-0",
+		SystemdUnit:   "sidecar@polkadot-assethub-0.service",
+		ServiceName:   head.Service,
+		WatchInterval: time.Minute,
+		SidecarHead:   &head,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Expected the workflow to complete")
+	}
+	if checks < 10 {
+		t.Errorf("Expected the sidecar head to be compared every minute, got %d checks", checks)
+	}
+}
+
+// TestNodeWorkflowReplaysTheSyncCheck replays the history of an execution
+// started before the sync progress check: two watch rounds asking
+// CheckNodeSyncActivity whether the node is synced
+func TestNodeWorkflowReplaysTheSyncCheck(t *testing.T) {
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflow(NodeWorkflow)
+	if err := replayer.ReplayWorkflowHistoryFromJSONFile(nil, "testdata/node_workflow_sync_v0.json"); err != nil {
+		t.Fatalf("Expected the history to replay, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func main() {
+	configFile := flag.String("conf", "", "toml configuration file")
+	chain := flag.String("chain", "", "chain")
+	relayChain := flag.String("relayChain", "polkadot", "relay chain")
+	asJSON := flag.Bool("json", false, "print the partitions as JSON")
+	rebalance := flag.Bool("rebalance", false, "move the old partitions from the fast to the slow tablespaces and the recent ones to the fast tablespaces")
+	yes := flag.Bool("yes", false, "do not ask for confirmation")
+	showVersion := dix.VersionFlag()
+	flag.Parse()
+	if dix.PrintVersion("dixpartitions", *showVersion) {
+		return
+	}
+
+	if *chain == "" {
+		log.Fatal("Chain must be specified")
+	}
+	if *configFile == "" {
+		log.Fatal("Configuration file must be specified")
+	}
+
+	config, err := dix.LoadMgrConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	database := dix.NewSQLDatabase(*config)
+	if err := database.Ping(); err != nil {
+		log.Fatalf("Failed to ping PostgreSQL: %v", err)
+	}
+
+	stats, err := database.GetPartitionStats(*relayChain, *chain)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *rebalance {
+		rebalancePartitions(database, *relayChain, *chain, stats, *yes)
+		return
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+	printStats(os.Stdout, stats)
+}
+
+// rebalancePartitions moves the partitions whose tablespace no longer
+// matches their age
+func rebalancePartitions(database *dix.SQLDatabase, relayChain, chain string, stats []dix.PartitionStat, yes bool) {
+	moves := dix.PartitionsToRebalance(dix.GetBlocksTableName(relayChain, chain), stats, database.FastYears(), time.Now())
+	if len(moves) == 0 {
+		log.Printf("Every partition of %s:%s is on the right tablespace", relayChain, chain)
+		return
+	}
+
+	fmt.Printf("Moving %d partitions of %s:%s, each is locked while it is copied:\n", len(moves), relayChain, chain)
+	for _, move := range moves {
+		fmt.Printf("  %s\n", move)
+	}
+	if !yes && !dix.Confirm("Type 'yes' to move them: ") {
+		log.Println("Aborted")
+		return
+	}
+
+	if err := database.MovePartitions(moves); err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Moved %d partitions of %s:%s", len(moves), relayChain, chain)
+}
+
+// printStats writes one line per partition, then the total of each
+// tablespace
+func printStats(w io.Writer, stats []dix.PartitionStat) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "partition\ttablespace\trows\tsize\t")
+	var tablespaces []string
+	totals := make(map[string]int64)
+	for _, stat := range stats {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t\n", stat.Name, tablespaceName(stat.Tablespace), stat.Rows, formatSize(stat.Bytes))
+		if _, ok := totals[stat.Tablespace]; !ok {
+			tablespaces = append(tablespaces, stat.Tablespace)
+		}
+		totals[stat.Tablespace] += stat.Bytes
+	}
+	fmt.Fprintln(tw, "\t\t\t\t")
+	for _, tablespace := range tablespaces {
+		fmt.Fprintf(tw, "total\t%s\t\t%s\t\n", tablespaceName(tablespace), formatSize(totals[tablespace]))
+	}
+	tw.Flush()
+}
+
+func tablespaceName(tablespace string) string {
+	if tablespace == "" {
+		return "default"
+	}
+	return tablespace
+}
+
+// formatSize returns bytes in the largest unit keeping it at least 1
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func main() {
+	configFile := flag.String("conf", "", "toml configuration file")
+	chain := flag.String("chain", "", "chain")
+	relayChain := flag.String("relayChain", "polkadot", "relay chain")
+	keepMonths := flag.Int("keep-months", 0, "months to keep, current one included, overrides retention_months")
+	yes := flag.Bool("yes", false, "do not ask for confirmation")
+	duplicates := flag.Bool("duplicates", false, "remove the stale copies of the blocks saved more than once instead of old partitions")
+	showVersion := dix.VersionFlag()
+	flag.Parse()
+	if dix.PrintVersion("dixprune", *showVersion) {
+		return
+	}
+
+	if *chain == "" {
+		log.Fatal("Chain must be specified")
+	}
+	if *configFile == "" {
+		log.Fatal("Configuration file must be specified")
+	}
+
+	config, err := dix.LoadMgrConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if *keepMonths == 0 {
+		*keepMonths = config.DotidxDB.RetentionMonths
+	}
+	if *keepMonths <= 0 && !*duplicates {
+		log.Fatal("Retention must be set with -keep-months or retention_months")
+	}
+
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	database := dix.NewSQLDatabase(*config)
+	if err := database.Ping(); err != nil {
+		log.Fatalf("Failed to ping PostgreSQL: %v", err)
+	}
+
+	if *duplicates {
+		pruneDuplicates(database, *relayChain, *chain, *yes)
+		return
+	}
+
+	names, err := database.ListBlocksPartitions(*relayChain, *chain)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	partitions := dix.PartitionsToDrop(dix.GetBlocksTableName(*relayChain, *chain), names, time.Now().UTC(), *keepMonths)
+	if len(partitions) == 0 {
+		log.Printf("Nothing older than %d months for %s:%s", *keepMonths, *relayChain, *chain)
+		return
+	}
+
+	fmt.Printf("Keeping the last %d months of %s:%s, dropping %d partitions:\n", *keepMonths, *relayChain, *chain, len(partitions))
+	for _, partition := range partitions {
+		fmt.Printf("  %s\n", partition.Name)
+	}
+	if !*yes && !dix.Confirm("Type 'yes' to drop them: ") {
+		log.Println("Aborted")
+		return
+	}
+
+	pruned, err := database.DropBlocksPartitions(*relayChain, *chain, partitions)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Dropped %d partitions and %d address rows for %s:%s", len(partitions), pruned, *relayChain, *chain)
+}
+
+// pruneDuplicates removes the copies of the blocks saved more than once
+// which are neither finalized nor linked to by the next block
+func pruneDuplicates(database *dix.SQLDatabase, relayChain, chain string, yes bool) {
+	ctx := context.Background()
+	duplicates, err := database.FindDuplicateBlocks(ctx, relayChain, chain, 0, math.MaxInt32)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if len(duplicates) == 0 {
+		log.Printf("No block saved more than once for %s:%s", relayChain, chain)
+		return
+	}
+
+	fmt.Printf("Found %d blocks saved more than once in %s:%s:\n", len(duplicates), relayChain, chain)
+	for _, d := range duplicates {
+		fmt.Printf("  %s\n", d)
+	}
+	if !yes && !dix.Confirm("Type 'yes' to remove the other copies: ") {
+		log.Println("Aborted")
+		return
+	}
+
+	removed, err := database.RemoveDuplicateBlocks(ctx, relayChain, chain, duplicates)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Removed %d duplicate rows for %s:%s", removed, relayChain, chain)
+}
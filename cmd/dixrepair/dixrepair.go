@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	"github.com/pierreaubert/dotidx/dix"
+)
+
+func main() {
+	configFile := flag.String("conf", "", "toml configuration file")
+	chain := flag.String("chain", "", "chain")
+	relayChain := flag.String("relayChain", "polkadot", "relay chain")
+	startRange := flag.Int("start", 0, "first block to check")
+	endRange := flag.Int("end", math.MaxInt32, "last block to check")
+	refetch := flag.Bool("refetch", false, "fetch the blocks without a timestamp in their extrinsics again from the chain reader")
+	yes := flag.Bool("yes", false, "do not ask for confirmation")
+	showVersion := dix.VersionFlag()
+	flag.Parse()
+	if dix.PrintVersion("dixrepair", *showVersion) {
+		return
+	}
+
+	if *chain == "" {
+		log.Fatal("Chain must be specified")
+	}
+	if *configFile == "" {
+		log.Fatal("Configuration file must be specified")
+	}
+	if *startRange > *endRange {
+		log.Fatalf("Start %d is after end %d", *startRange, *endRange)
+	}
+
+	config, err := dix.LoadMgrConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	database := dix.NewSQLDatabase(*config)
+	if err := database.Ping(); err != nil {
+		log.Fatalf("Failed to ping PostgreSQL: %v", err)
+	}
+
+	var reader dix.ChainReader
+	if *refetch {
+		chainConfig := config.Parachains[*relayChain][*chain]
+		sidecar := dix.NewSidecar(*relayChain, *chain, dix.ChainreaderURL(chainConfig))
+		if err := dix.ConfigureSidecar(sidecar, chainConfig); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := sidecar.Ping(); err != nil {
+			log.Fatalf("Sidecar service test failed: %v", err)
+		}
+		reader = sidecar
+	}
+
+	// a first pass lists the blocks, the second one moves them a window at
+	// a time, neither holds the whole range in memory
+	ctx := context.Background()
+	if !*yes {
+		found, moves := 0, 0
+		unknown, err := database.FindMisdatedBlocks(ctx, *relayChain, *chain, *startRange, *endRange, reader, func(misdated []dix.MisdatedBlock) error {
+			for _, b := range misdated {
+				if b.ChangesPartition() {
+					moves++
+				}
+				fmt.Printf("  %s\n", b)
+			}
+			found += len(misdated)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if unknown > 0 {
+			log.Printf("Skipped %d blocks without a timestamp, try -refetch", unknown)
+		}
+		if found == 0 {
+			log.Printf("No block with a wrong created_at for %s:%s", *relayChain, *chain)
+			return
+		}
+		fmt.Printf("Found %d blocks with a wrong created_at in %s:%s, %d of them change partition\n",
+			found, *relayChain, *chain, moves)
+		if !dix.Confirm("Type 'yes' to repair them: ") {
+			log.Println("Aborted")
+			return
+		}
+	}
+
+	repaired := 0
+	unknown, err := database.FindMisdatedBlocks(ctx, *relayChain, *chain, *startRange, *endRange, reader, func(misdated []dix.MisdatedBlock) error {
+		moved, err := database.MoveMisdatedBlocks(ctx, *relayChain, *chain, misdated)
+		repaired += moved
+		if err == nil {
+			log.Printf("Repaired blocks %d to %d", misdated[0].BlockID, misdated[len(misdated)-1].BlockID)
+		}
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Repaired %d blocks for %s:%s before failing: %v", repaired, *relayChain, *chain, err)
+	}
+	if *yes && unknown > 0 {
+		log.Printf("Skipped %d blocks without a timestamp, try -refetch", unknown)
+	}
+	log.Printf("Repaired %d blocks for %s:%s", repaired, *relayChain, *chain)
+}
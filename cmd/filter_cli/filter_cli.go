@@ -33,7 +33,11 @@ func main() {
 	method := flag.String("method", "", "a Polkadot runtime pallet method")
 	pallet := flag.String("pallet", "", "a Polkadot runtime pallet name")
 
+	showVersion := dix.VersionFlag()
 	flag.Parse()
+	if dix.PrintVersion("filter_cli", *showVersion) {
+		return
+	}
 
 	matcher := &dix.Matcher{
 		Address: *address,
@@ -1,12 +1,16 @@
 package dix
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type BlockData struct {
@@ -27,6 +31,86 @@ type BlockData struct {
 	RcBlockHash    *string         `json:"rcBlockHash,omitempty"`
 }
 
+// Number returns the block number as an integer, ok is false when ID is not
+// a number
+func (b BlockData) Number() (number int64, ok bool) {
+	number, err := strconv.ParseInt(b.ID, 10, 64)
+	return number, err == nil
+}
+
+// MarshalJSON adds blockNumber, the number of the block as an integer, next
+// to number which stays a string for the existing clients
+func (b BlockData) MarshalJSON() ([]byte, error) {
+	type plain BlockData
+	response := struct {
+		plain
+		BlockNumber *int64 `json:"blockNumber,omitempty"`
+	}{plain: plain(b)}
+	if number, ok := b.Number(); ok {
+		response.BlockNumber = &number
+	}
+	return json.Marshal(response)
+}
+
+// UnmarshalJSON reads the block number from number or, as some sidecar
+// versions answer, from id. Both may be a string or an integer.
+func (b *BlockData) UnmarshalJSON(data []byte) error {
+	type plain BlockData
+	var response struct {
+		plain
+		Number json.RawMessage `json:"number"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+	*b = BlockData(response.plain)
+	raw := response.Number
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = response.ID
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	// a string is kept as is, ValidateBlock rejects it if it is no number
+	if err := json.Unmarshal(raw, &b.ID); err == nil {
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err != nil {
+		return fmt.Errorf("invalid block number %s: %w", raw, err)
+	}
+	b.ID = number.String()
+	return nil
+}
+
+// GenesisBlockID is the first block of every chain, it has no extrinsics and
+// so no timestamp
+const GenesisBlockID = 0
+
+// IsGenesis reports whether block is the genesis block
+func IsGenesis(block BlockData) bool {
+	return block.ID == strconv.Itoa(GenesisBlockID)
+}
+
+// SortBlocksByID sorts blocks by ascending block number, the blocks with a
+// non numeric ID come last in string order, blocks at the same height keep
+// their order
+func SortBlocksByID(blocks []BlockData) {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		a, okA := blocks[i].Number()
+		b, okB := blocks[j].Number()
+		switch {
+		case okA && okB:
+			return a < b
+		case okA != okB:
+			return okA
+		default:
+			return blocks[i].ID < blocks[j].ID
+		}
+	})
+}
+
 func IsValidAddress(address string) bool {
 	// Polkadot addresses are 47 or 48 characters long and start with a number or letter
 	if len(address) < 45 || len(address) > 50 {
@@ -44,66 +128,255 @@ func IsValidAddress(address string) bool {
 	return false
 }
 
+// ErrNoTimestamp is returned by ExtractTimestamp when the extrinsics carry
+// no usable timestamp.set call
+var ErrNoTimestamp = errors.New("no timestamp in extrinsics")
+
 func ExtractTimestamp(extrinsics []byte) (ts string, err error) {
 	const defaultTimestamp = "0001-01-01 00:00:00.0000"
-	re := regexp.MustCompile("\"now\"[ ]*[:][ ]*\"[0-9]+\"")
-	texts := re.FindAllString(string(extrinsics), 1)
-	if len(texts) == 0 {
-		return defaultTimestamp, fmt.Errorf("cannot find \"now\" in extrinsics: %w", err)
-	}
-	stexts := strings.Split(texts[0], "\"")
-	if len(stexts) != 5 {
-		return defaultTimestamp, fmt.Errorf("cannot find timestamp in extrinsics: len is %d", len(stexts))
-	}
-	millis, err := strconv.ParseInt(stexts[3], 10, 64)
+	millis, err := extractTimestampMillis(extrinsics)
 	if err != nil {
-		return defaultTimestamp, fmt.Errorf("cannot convert timestamp to milliseconds: %w", err)
+		return defaultTimestamp, err
 	}
-	ts = time.UnixMilli(millis).Format("2006-01-02 15:04:05.0000")
+	ts = FormatCreatedAt(time.UnixMilli(millis))
 	return
 }
 
-// extractAddressesFromExtrinsics extracts Polkadot addresses from extrinsics JSON
+// the method of a sidecar timestamp.set extrinsic, the fallback reads the
+// first "now" after it. Sidecar named it "timestamp.set" in the first spec
+// versions.
+var (
+	timestampSetRegexp = regexp.MustCompile(`"pallet"\s*:\s*"timestamp"\s*,\s*"method"\s*:\s*"set"|"method"\s*:\s*"timestamp\.set"`)
+	nowRegexp          = regexp.MustCompile(`"now"\s*:\s*"?([0-9]+)"?`)
+)
+
+// extractTimestampMillis reads the argument of timestamp.set, as decoded by
+// sidecar (args.now) or by the RPC reader (params[0].value). The extrinsics
+// are decoded one at a time up to that call, usually the first or second
+// one, and only the fields telling it apart are kept. Extrinsics which are
+// not a JSON array fall back to the "now" following a timestamp.set method.
+func extractTimestampMillis(extrinsics []byte) (int64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(extrinsics))
+	if token, err := decoder.Token(); err == nil && token == json.Delim('[') {
+		for decoder.More() {
+			var call timestampCall
+			if err := decoder.Decode(&call); err != nil {
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &typeErr) {
+					// the extrinsic was read, it is not timestamp.set
+					continue
+				}
+				break
+			}
+			if now, ok := call.now(); ok {
+				return timestampToMillis(now)
+			}
+		}
+	}
+	loc := timestampSetRegexp.FindIndex(extrinsics)
+	if loc == nil {
+		return 0, fmt.Errorf("%w: cannot find timestamp.set", ErrNoTimestamp)
+	}
+	call := extrinsics[loc[1]:]
+	if next := timestampSetRegexp.FindIndex(call); next != nil {
+		call = call[:next[0]]
+	}
+	match := nowRegexp.FindSubmatch(call)
+	if match == nil {
+		return 0, fmt.Errorf("%w: cannot find \"now\" in timestamp.set", ErrNoTimestamp)
+	}
+	return timestampToMillis(string(match[1]))
+}
+
+// timestampCall is the part of an extrinsic telling whether it is
+// timestamp.set, the decoder skips the other fields
+type timestampCall struct {
+	// sidecar, {"pallet":"timestamp","method":"set"} or "timestamp.set"
+	Method json.RawMessage `json:"method"`
+	Args   struct {
+		Now json.RawMessage `json:"now"`
+	} `json:"args"`
+	// RPC reader, which keeps the decoder fields
+	CallModule         string  `json:"call_module"`
+	CallModuleFunction *string `json:"call_module_function"`
+	CallFunction       *string `json:"call_function"`
+	CallName           *string `json:"call_name"`
+	Params             []struct {
+		Name  string          `json:"name"`
+		Value json.RawMessage `json:"value"`
+	} `json:"params"`
+}
+
+// now returns the argument of timestamp.set, a string or a float64
+func (c timestampCall) now() (any, bool) {
+	if len(c.Method) > 0 && c.Method[0] == '{' {
+		var method struct {
+			Pallet string `json:"pallet"`
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(c.Method, &method) != nil ||
+			!strings.EqualFold(method.Pallet, "timestamp") || method.Method != "set" {
+			return nil, false
+		}
+		return rawTimestamp(c.Args.Now)
+	}
+	if len(c.Method) > 0 && c.Method[0] == '"' {
+		var method string
+		if json.Unmarshal(c.Method, &method) != nil || !strings.EqualFold(method, "timestamp.set") {
+			return nil, false
+		}
+		return rawTimestamp(c.Args.Now)
+	}
+	if !strings.EqualFold(c.CallModule, "timestamp") {
+		return nil, false
+	}
+	// the call name is optional
+	for _, function := range []*string{c.CallModuleFunction, c.CallFunction, c.CallName} {
+		if function != nil && *function != "set" {
+			return nil, false
+		}
+	}
+	for _, param := range c.Params {
+		if param.Name == "now" || param.Name == "" {
+			return rawTimestamp(param.Value)
+		}
+	}
+	return nil, false
+}
+
+func rawTimestamp(raw json.RawMessage) (any, bool) {
+	var value any
+	if len(raw) == 0 || json.Unmarshal(raw, &value) != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// timestampToMillis accepts a number or a decimal string in milliseconds, or
+// in seconds for values too small to be milliseconds
+func timestampToMillis(value any) (int64, error) {
+	var millis int64
+	switch v := value.(type) {
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: cannot convert %q to milliseconds: %w", ErrNoTimestamp, v, err)
+		}
+		millis = parsed
+	case float64:
+		millis = int64(v)
+	default:
+		return 0, fmt.Errorf("%w: unexpected type %T", ErrNoTimestamp, value)
+	}
+	if millis <= 0 {
+		return 0, fmt.Errorf("%w: invalid value %d", ErrNoTimestamp, millis)
+	}
+	if millis < secondsThreshold {
+		millis *= 1000
+	}
+	return millis, nil
+}
+
+// ExtractAddresses returns the addresses indexed in address2blocks for a
+// block with these extrinsics
+func ExtractAddresses(extrinsics json.RawMessage) ([]string, error) {
+	return extractAddressesFromExtrinsics(extrinsics)
+}
+
+// extractAddressesFromExtrinsics extracts Polkadot addresses from extrinsics
+// JSON: the strings of arrays and the string values of the keys containing
+// "id", in any case, at any depth. The JSON is scanned in place instead of
+// being decoded into maps, only the addresses found are allocated.
+// Unlike a decoding, which keeps the last one, every value of a key repeated
+// in an object is looked at.
 func extractAddressesFromExtrinsics(extrinsics json.RawMessage) ([]string, error) {
 	if len(extrinsics) == 0 {
 		return nil, nil
 	}
-
-	var data interface{}
-	if err := json.Unmarshal(extrinsics, &data); err != nil {
+	if !json.Valid(extrinsics) {
+		// decoding tells what is wrong
+		var data any
+		err := json.Unmarshal(extrinsics, &data)
 		return nil, fmt.Errorf("error parsing extrinsics JSON: %w", err)
 	}
 
 	// Set to store unique addresses
 	addressMap := make(map[string]struct{})
-	var findAddresses func(data interface{})
-
-	findAddresses = func(data interface{}) {
-		switch v := data.(type) {
-		case map[string]interface{}:
-			// Check for fields that might contain an address
-			for key, value := range v {
-				if strings.Contains(strings.ToLower(key), "id") {
-					if id, ok := value.(string); ok && IsValidAddress(id) {
-						addressMap[id] = struct{}{}
-					}
+	addAddress := func(raw []byte, plain bool) {
+		// a plain string is its own value, an address has 45 to 50 bytes
+		if plain && (len(raw) < 45 || len(raw) > 50) {
+			return
+		}
+		address := jsonString(raw, plain)
+		if IsValidAddress(address) {
+			addressMap[address] = struct{}{}
+		}
+	}
+
+	// the containers enclosing the current position
+	type container struct {
+		array bool
+		// objects alternate keys and values
+		expectKey bool
+		idKey     bool
+	}
+	stack := make([]container, 0, 16)
+	valueDone := func() {
+		if n := len(stack); n > 0 && !stack[n-1].array {
+			stack[n-1].expectKey = true
+		}
+	}
+
+	for i := 0; i < len(extrinsics); i++ {
+		switch extrinsics[i] {
+		case ' ', '\t', '\n', '\r', ',', ':':
+		case '{':
+			stack = append(stack, container{expectKey: true})
+		case '[':
+			stack = append(stack, container{array: true})
+		case '}', ']':
+			stack = stack[:len(stack)-1]
+			valueDone()
+		case '"':
+			// the JSON is valid, the string ends at the first unescaped quote
+			plain := true
+			j := i + 1
+			for ; extrinsics[j] != '"'; j++ {
+				switch {
+				case extrinsics[j] == '\\':
+					plain = false
+					j++
+				case extrinsics[j] >= utf8.RuneSelf:
+					plain = false
 				}
-				findAddresses(value)
 			}
-
-		case []interface{}:
-			for _, item := range v {
-				if str, ok := item.(string); ok && IsValidAddress(str) {
-					addressMap[str] = struct{}{}
-				} else {
-					findAddresses(item)
+			raw := extrinsics[i : j+1]
+			i = j
+			if len(stack) == 0 {
+				continue
+			}
+			top := &stack[len(stack)-1]
+			switch {
+			case top.array:
+				addAddress(raw, plain)
+			case top.expectKey:
+				top.idKey = keyHasID(raw, plain)
+				top.expectKey = false
+			default:
+				if top.idKey {
+					addAddress(raw, plain)
 				}
+				top.expectKey = true
+			}
+		default:
+			// a number, true, false or null
+			for i+1 < len(extrinsics) && !strings.ContainsRune(" \t\n\r,]}", rune(extrinsics[i+1])) {
+				i++
 			}
+			valueDone()
 		}
 	}
 
-	findAddresses(data)
-
 	addresses := make([]string, 0, len(addressMap))
 	for addr := range addressMap {
 		addresses = append(addresses, addr)
@@ -111,3 +384,29 @@ func extractAddressesFromExtrinsics(extrinsics json.RawMessage) ([]string, error
 
 	return addresses, nil
 }
+
+// jsonString returns the value of the JSON string raw, quotes included. A
+// plain string has no escape and is ASCII, it is used as is.
+func jsonString(raw []byte, plain bool) string {
+	if plain {
+		return string(raw[1 : len(raw)-1])
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return ""
+	}
+	return value
+}
+
+// keyHasID reports whether the JSON string raw contains "id" in any case
+func keyHasID(raw []byte, plain bool) bool {
+	if !plain {
+		return strings.Contains(strings.ToLower(jsonString(raw, plain)), "id")
+	}
+	for k := 1; k+1 < len(raw)-1; k++ {
+		if raw[k]|0x20 == 'i' && raw[k+1]|0x20 == 'd' {
+			return true
+		}
+	}
+	return false
+}
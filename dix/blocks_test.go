@@ -3,10 +3,15 @@ package dix
 //goland:noinspection Annotator,Annotator,Annotator,Annotator,Annotator,Annotator,Annotator,Annotator
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
@@ -88,6 +93,84 @@ func TestExtractAddressesFromExtrinsics(t *testing.T) {
 	}
 }
 
+// decodedAddresses is how extractAddressesFromExtrinsics used to find the
+// addresses, by decoding the extrinsics into maps and walking them
+func decodedAddresses(extrinsics json.RawMessage) ([]string, error) {
+	var data any
+	if err := json.Unmarshal(extrinsics, &data); err != nil {
+		return nil, fmt.Errorf("error parsing extrinsics JSON: %w", err)
+	}
+	found := make(map[string]struct{})
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, value := range v {
+				if s, ok := value.(string); ok && strings.Contains(strings.ToLower(key), "id") && IsValidAddress(s) {
+					found[s] = struct{}{}
+				}
+				walk(value)
+			}
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok && IsValidAddress(s) {
+					found[s] = struct{}{}
+				} else {
+					walk(item)
+				}
+			}
+		}
+	}
+	walk(data)
+	addresses := make([]string, 0, len(found))
+	for address := range found {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+func TestExtractAddressesMatchesDecoding(t *testing.T) {
+	const (
+		alice = "5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"
+		bob   = "5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty"
+	)
+	tests := map[string]string{
+		"upper case key":       `[{"signer": {"ID": "` + alice + `"}, "paraId": "` + bob + `"}]`,
+		"escaped key":          `[{"\u0069d": "` + alice + `", "i\"d": "` + bob + `"}]`,
+		"escaped address":      `[{"id": "5Grwva\u0045F5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY"}]`,
+		"non id key":           `[{"dest": "` + alice + `", "who": ["` + bob + `"]}]`,
+		"id key object":        `[{"id": {"dest": "` + alice + `"}, "ids": [{"x": "` + bob + `"}]}]`,
+		"key after object":     `[{"args": {"a": [1, 2.5e3, true, null]}, "accountId": "` + alice + `"}]`,
+		"nested arrays":        `[[["` + alice + `", ["` + bob + `"]]], -1, false]`,
+		"address as key":       `[{"` + alice + `": "id"}]`,
+		"top level string":     `"` + alice + `"`,
+		"top level object":     `{"id":"` + alice + `","data":{"callId":"` + bob + `"}}`,
+		"unicode":              `[{"nameId": "é` + alice + `", "id": "` + bob + `"}]`,
+		"whitespace":           "[ {\n\t\"id\" :\r\n \"" + alice + "\" } ]",
+		"invalid json":         `[{"id": "` + alice + `"`,
+		"trailing data":        `[] []`,
+		"benchmark extrinsics": string(benchmarkBlocks(1, 20, 64)[0].Extrinsics),
+	}
+	for name, extrinsics := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, wantErr := decodedAddresses(json.RawMessage(extrinsics))
+			got, err := extractAddressesFromExtrinsics(json.RawMessage(extrinsics))
+			if wantErr != nil {
+				if err == nil || err.Error() != wantErr.Error() {
+					t.Fatalf("Expected error %v, got %v", wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			sort.Strings(got)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
 func TestExtractAddressesFromRealData(t *testing.T) {
 	// Get all JSON files in the tests/data/blocks directory
 	blockDir := "../tests/data/blocks"
@@ -218,3 +301,143 @@ func TestIsValidAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractTimestampMissing(t *testing.T) {
+	_, err := ExtractTimestamp([]byte(`[{"method": {"pallet": "balances", "method": "transfer"}}]`))
+	if !errors.Is(err, ErrNoTimestamp) {
+		t.Errorf("Expected ErrNoTimestamp, got %v", err)
+	}
+}
+
+func TestBlockTimestampsFallback(t *testing.T) {
+	withTimestamp := func(millis int64) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`[{"method": {"pallet": "timestamp", "method": "set"}, "args": {"now": "%d"}}]`, millis))
+	}
+	without := json.RawMessage(`[{"method": {"pallet": "balances", "method": "transfer"}}]`)
+	first := time.UnixMilli(1700000000000)
+	header := time.UnixMilli(1700000012000)
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.Local)
+	layout := "2006-01-02 15:04:05.0000"
+
+	items := []BlockData{
+		{ID: "1", Extrinsics: withTimestamp(first.UnixMilli())},
+		{ID: "2", Extrinsics: without},
+		{ID: "3", Extrinsics: without, Timestamp: header},
+	}
+	timestamps, fallbacks := blockTimestamps(items, now)
+	if fallbacks != 2 {
+		t.Errorf("Expected 2 fallbacks, got %d", fallbacks)
+	}
+	want := []string{first.Format(layout), first.Format(layout), header.Format(layout)}
+	for i := range want {
+		if timestamps[i] != want[i] {
+			t.Errorf("Block %s: expected %s, got %s", items[i].ID, want[i], timestamps[i])
+		}
+		if strings.HasPrefix(timestamps[i], "2000-01-01") {
+			t.Errorf("Block %s got a fabricated timestamp %s", items[i].ID, timestamps[i])
+		}
+	}
+
+	// nothing to borrow from, the block is saved now
+	timestamps, _ = blockTimestamps([]BlockData{{ID: "4", Extrinsics: without}}, now)
+	if timestamps[0] != now.Format(layout) {
+		t.Errorf("Expected %s, got %s", now.Format(layout), timestamps[0])
+	}
+}
+
+func TestBlockTimestampsGenesis(t *testing.T) {
+	genesis := BlockData{ID: "0", Extrinsics: json.RawMessage(`[]`)}
+	first := time.UnixMilli(1700000000000)
+	next := BlockData{ID: "1", Extrinsics: json.RawMessage(fmt.Sprintf(
+		`[{"method": {"pallet": "timestamp", "method": "set"}, "args": {"now": "%d"}}]`, first.UnixMilli()))}
+
+	if !IsGenesis(genesis) || IsGenesis(next) {
+		t.Fatalf("Only block 0 is the genesis block")
+	}
+	timestamps, fallbacks := blockTimestamps([]BlockData{genesis, next}, time.Now())
+	if fallbacks != 0 {
+		t.Errorf("The genesis block is not a timestamp failure, got %d fallbacks", fallbacks)
+	}
+	if timestamps[0] != timestamps[1] {
+		t.Errorf("Expected genesis at the time of block 1 %s, got %s", timestamps[1], timestamps[0])
+	}
+}
+
+func TestBlockDataNumberJSON(t *testing.T) {
+	data, err := json.Marshal(BlockData{ID: "12345", Hash: "0x1"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if fields["number"] != "12345" {
+		t.Errorf("Expected number to stay the string 12345, got %v", fields["number"])
+	}
+	if fields["blockNumber"] != float64(12345) {
+		t.Errorf("Expected blockNumber 12345, got %v", fields["blockNumber"])
+	}
+
+	var block BlockData
+	if err := json.Unmarshal(data, &block); err != nil || block.ID != "12345" || block.Hash != "0x1" {
+		t.Errorf("Expected the block to decode back, got %+v %v", block, err)
+	}
+
+	data, err = json.Marshal(BlockData{ID: "head"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(data), "blockNumber") {
+		t.Errorf("Expected no blockNumber for a non numeric ID, got %s", data)
+	}
+
+	blocks := []BlockData{{ID: "100"}, {ID: "9"}, {ID: "10"}}
+	SortBlocksByID(blocks)
+	if blocks[0].ID != "9" || blocks[1].ID != "10" || blocks[2].ID != "100" {
+		t.Errorf("Expected a numeric order, got %v %v %v", blocks[0].ID, blocks[1].ID, blocks[2].ID)
+	}
+
+	// the non numeric IDs go after the numbers whatever the input order
+	blocks = []BlockData{{ID: "head"}, {ID: "100"}, {ID: "0x1"}, {ID: "9"}, {ID: ""}, {ID: "10"}}
+	SortBlocksByID(blocks)
+	var ids []string
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	if want := []string{"9", "10", "100", "", "0x1", "head"}; !slices.Equal(ids, want) {
+		t.Errorf("Expected %q, got %q", want, ids)
+	}
+}
+
+func TestBlockDataUnmarshalNumberOrID(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"number", `{"number": "42", "hash": "0x2a"}`, "42"},
+		{"id", `{"id": "42", "hash": "0x2a"}`, "42"},
+		{"integer id", `{"id": 42, "hash": "0x2a"}`, "42"},
+		{"integer number", `{"number": 42, "hash": "0x2a"}`, "42"},
+		{"number wins over id", `{"number": "42", "id": "7", "hash": "0x2a"}`, "42"},
+		{"null number", `{"number": null, "id": "42", "hash": "0x2a"}`, "42"},
+		{"neither", `{"hash": "0x2a"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var block BlockData
+			if err := json.Unmarshal([]byte(tt.data), &block); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if block.ID != tt.want || block.Hash != "0x2a" {
+				t.Errorf("Expected block %q with hash 0x2a, got %q %q", tt.want, block.ID, block.Hash)
+			}
+		})
+	}
+
+	var block BlockData
+	if err := json.Unmarshal([]byte(`{"id": {"value": 42}}`), &block); err == nil {
+		t.Errorf("Expected an object id to be rejected, got %q", block.ID)
+	}
+}
@@ -0,0 +1,87 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultBlockTime is the block time of the relay chains and of most
+// parachains with asynchronous backing
+const DefaultBlockTime = 6 * time.Second
+
+// blocks sampled by EstimateBlockTime, spaced by blockTimeSampleSpacing
+const (
+	blockTimeSamples       = 5
+	blockTimeSampleSpacing = 100
+)
+
+// AverageBlockTime returns the average time between blocks given the
+// timestamps of a few of them, indexed by block id
+func AverageBlockTime(timestamps map[int]time.Time) (time.Duration, error) {
+	if len(timestamps) < 2 {
+		return 0, fmt.Errorf("need at least 2 blocks, got %d", len(timestamps))
+	}
+	first, last := -1, -1
+	for id := range timestamps {
+		if first == -1 || id < first {
+			first = id
+		}
+		if id > last {
+			last = id
+		}
+	}
+	elapsed := timestamps[last].Sub(timestamps[first])
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("timestamps do not increase between blocks %d and %d", first, last)
+	}
+	return elapsed / time.Duration(last-first), nil
+}
+
+// EstimateBlockTime samples recent blocks below head to measure the average
+// block time of the chain. It returns fallback when the blocks cannot be
+// fetched or carry no timestamp.
+func EstimateBlockTime(ctx context.Context, reader ChainReader, head int, fallback time.Duration) time.Duration {
+	timestamps := make(map[int]time.Time, blockTimeSamples)
+	for i := 0; i < blockTimeSamples; i++ {
+		id := head - i*blockTimeSampleSpacing
+		if id < 1 {
+			break
+		}
+		block, err := reader.FetchBlock(ctx, id)
+		if err != nil {
+			log.Printf("Cannot fetch block %d to estimate block time: %v", id, err)
+			continue
+		}
+		ts, err := ExtractTimestamp(block.Extrinsics)
+		if err != nil {
+			continue
+		}
+		at, err := time.ParseInLocation(createdAtLayout, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		timestamps[id] = at
+	}
+	blockTime, err := AverageBlockTime(timestamps)
+	if err != nil {
+		log.Printf("Cannot estimate block time, using %s: %v", fallback, err)
+		return fallback
+	}
+	return blockTime
+}
+
+// SinceDaysRange returns the block range covering the last days of a chain
+// whose head is at head, assuming a constant blockTime
+func SinceDaysRange(head int, blockTime time.Duration, days int) (start, end int, err error) {
+	if days <= 0 {
+		return 0, 0, fmt.Errorf("since-days must be positive, got %d", days)
+	}
+	if blockTime <= 0 {
+		return 0, 0, fmt.Errorf("block time must be positive, got %s", blockTime)
+	}
+	blocksPerDay := int(24 * time.Hour / blockTime)
+	start = max(head-blocksPerDay*days, 1)
+	return start, head, nil
+}
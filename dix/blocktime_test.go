@@ -0,0 +1,49 @@
+package dix
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinceDaysRange(t *testing.T) {
+	start, end, err := SinceDaysRange(1_000_000, 6*time.Second, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1_000_000-14_400*10, start)
+	assert.Equal(t, 1_000_000, end)
+
+	start, end, err = SinceDaysRange(1_000_000, 12*time.Second, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1_000_000-7_200, start)
+	assert.Equal(t, 1_000_000, end)
+
+	// a young chain starts at its first block
+	start, _, err = SinceDaysRange(1000, 6*time.Second, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, start)
+
+	_, _, err = SinceDaysRange(1000, 6*time.Second, 0)
+	assert.Error(t, err)
+	_, _, err = SinceDaysRange(1000, 0, 1)
+	assert.Error(t, err)
+}
+
+func TestAverageBlockTime(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestamps := map[int]time.Time{
+		1000: start.Add(600 * time.Second),
+		900:  start,
+		950:  start.Add(290 * time.Second),
+		800:  start.Add(-612 * time.Second),
+	}
+	blockTime, err := AverageBlockTime(timestamps)
+	assert.NoError(t, err)
+	assert.Equal(t, 6060*time.Millisecond, blockTime)
+
+	_, err = AverageBlockTime(map[int]time.Time{1: start})
+	assert.Error(t, err, "one block is not enough")
+
+	_, err = AverageBlockTime(map[int]time.Time{1: start, 2: start})
+	assert.Error(t, err, "a chain without timestamps cannot be measured")
+}
@@ -0,0 +1,126 @@
+package dix
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a size bounded LRU cache whose entries expire after a TTL. A nil
+// Cache stores nothing, so callers can leave caching disabled without
+// checking.
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[K]*list.Element
+	// most recently used first
+	order *list.List
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// NewCache returns a cache of at most size entries kept for ttl, or nil
+// when size or ttl is not positive
+func NewCache[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &Cache[K, V]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[K]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the value of key unless it is missing or expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := element.Value.(*cacheEntry[K, V])
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Put stores value for key, evicting the least recently used entry when
+// the cache is full
+func (c *Cache[K, V]) Put(key K, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry[K, V])
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry[K, V]{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// DeleteFunc removes the entries whose key matches and returns how many
+// were removed
+func (c *Cache[K, V]) DeleteFunc(match func(K) bool) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, element := range c.entries {
+		if match(key) {
+			c.remove(element)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SetClock replaces time.Now to compute the expiry of the entries
+func (c *Cache[K, V]) SetClock(now func() time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Len returns the number of entries, expired ones included
+func (c *Cache[K, V]) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry[K, V]).key)
+}
@@ -0,0 +1,61 @@
+package dix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cache := NewCache[string, int](2, time.Minute)
+	cache.SetClock(func() time.Time { return now })
+
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("Expected a miss on an empty cache")
+	}
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	if v, ok := cache.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected a hit with 1, got %d %v", v, ok)
+	}
+	// b is the least recently used
+	cache.Put("c", 3)
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("Expected a to be expired")
+	}
+	cache.Put("c", 4)
+	if v, ok := cache.Get("c"); !ok || v != 4 {
+		t.Errorf("Expected c to be refreshed with 4, got %d %v", v, ok)
+	}
+
+	cache.Put("d", 5)
+	if removed := cache.DeleteFunc(func(key string) bool { return key == "c" }); removed != 1 {
+		t.Errorf("Expected 1 entry removed, got %d", removed)
+	}
+	if _, ok := cache.Get("c"); ok {
+		t.Errorf("Expected c to be removed")
+	}
+	if _, ok := cache.Get("d"); !ok {
+		t.Errorf("Expected d to be kept")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	cache := NewCache[string, int](0, time.Minute)
+	if cache != nil {
+		t.Fatalf("Expected a disabled cache to be nil")
+	}
+	cache.Put("a", 1)
+	cache.SetClock(time.Now)
+	if _, ok := cache.Get("a"); ok || cache.Len() != 0 || cache.DeleteFunc(func(string) bool { return true }) != 0 {
+		t.Errorf("Expected a nil cache to store nothing")
+	}
+}
@@ -2,46 +2,298 @@ package dix
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"time"
 	// gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ChainReader interface {
 	GetChainHeadID() (int, error)
+	// GetFinalizedHeadID returns the highest finalized block, blocks up to
+	// it cannot be reorged
+	GetFinalizedHeadID() (int, error)
 	FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error)
 	FetchBlock(ctx context.Context, id int) (BlockData, error)
+	GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error)
 	Ping() error
 	GetStats() *MetricsStats
 }
 
+// IndexableHeadID returns the block the indexers go up to: the finalized
+// head when finalizedOnly is set, the head of the chain otherwise
+func IndexableHeadID(reader ChainReader, finalizedOnly bool) (int, error) {
+	if finalizedOnly {
+		return reader.GetFinalizedHeadID()
+	}
+	return reader.GetChainHeadID()
+}
+
 // Sidecar implements the ChainReader interface using Substrate API Sidecar
 // Supports both regular blocks and elastic scaling enabled parachains
 // Note: Elastic scaling support (v20.9.0+) allows multiple blocks per block height
 // The database schema uses (hash, created_at) as primary key to handle this
 type Sidecar struct {
-	relay   string
-	chain   string
-	url     string
-	metrics *Metrics
+	relay            string
+	chain            string
+	url              string
+	metrics          *Metrics
+	maxResponseBytes int64
+	// sent with every request, see ChainreaderHeaders
+	headers http.Header
+	// nil uses http.DefaultClient, see SetClientCertificate
+	client *http.Client
+	// how FetchBlock asks for a single block, see SetBlockURLStyle
+	blockURLStyle BlockURLStyle
 }
 
+// BlockURLStyle is how a single block is requested from the sidecar
+type BlockURLStyle string
+
+const (
+	// BlockURLPath requests /blocks/{id}, the default
+	BlockURLPath BlockURLStyle = "path"
+	// BlockURLQuery requests /blocks?id={id}
+	BlockURLQuery BlockURLStyle = "query"
+)
+
+// DefaultMaxResponseBytes bounds a sidecar answer, a range of large blocks
+// stays well below it
+const DefaultMaxResponseBytes = 256 << 20
+
 func NewSidecar(relay, chain, url string) *Sidecar {
 	return &Sidecar{
-		relay:   relay,
-		chain:   chain,
-		url:     url,
-		metrics: NewMetrics("Sidecar"),
+		relay:            relay,
+		chain:            chain,
+		url:              url,
+		metrics:          NewMetrics("Sidecar"),
+		maxResponseBytes: DefaultMaxResponseBytes,
+		blockURLStyle:    BlockURLPath,
+	}
+}
+
+// SetBlockURLStyle changes how FetchBlock requests a block, "" restores
+// the default
+func (s *Sidecar) SetBlockURLStyle(style BlockURLStyle) error {
+	switch style {
+	case "":
+		style = BlockURLPath
+	case BlockURLPath, BlockURLQuery:
+	default:
+		return fmt.Errorf("invalid chain reader block url %q: expected %q or %q", style, BlockURLPath, BlockURLQuery)
+	}
+	s.blockURLStyle = style
+	return nil
+}
+
+// blockURL returns the url of block id in the configured style
+func (s *Sidecar) blockURL(id int) string {
+	if s.blockURLStyle == BlockURLQuery {
+		return fmt.Sprintf("%s/blocks?id=%d", s.url, id)
+	}
+	return fmt.Sprintf("%s/blocks/%d", s.url, id)
+}
+
+// SetMaxResponseBytes changes the largest answer accepted from the sidecar,
+// 0 or less restores the default
+func (s *Sidecar) SetMaxResponseBytes(n int64) {
+	if n <= 0 {
+		n = DefaultMaxResponseBytes
+	}
+	s.maxResponseBytes = n
+}
+
+// ChainreaderHeaders returns the headers sent to the chain reader of chain
+func ChainreaderHeaders(chain ParaChainConfig) http.Header {
+	headers := make(http.Header)
+	for name, value := range chain.ChainreaderHeaders {
+		headers.Set(name, value)
+	}
+	if chain.ChainreaderUserAgent != "" {
+		headers.Set("User-Agent", chain.ChainreaderUserAgent)
+	}
+	if chain.ChainreaderToken != "" {
+		headers.Set("Authorization", "Bearer "+chain.ChainreaderToken)
+	}
+	return headers
+}
+
+// RedactHeaders returns a copy of headers safe to log, credentials are
+// masked
+func RedactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"} {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "******")
+		}
+	}
+	return redacted
+}
+
+// SetHeaders sends headers with every request to the sidecar, for proxies
+// requiring authentication or a known User-Agent
+func (s *Sidecar) SetHeaders(headers http.Header) {
+	s.headers = headers.Clone()
+	if len(headers) > 0 {
+		log.Printf("Sidecar %s:%s requests carry %v", s.relay, s.chain, RedactHeaders(headers))
+	}
+}
+
+func (s *Sidecar) do(req *http.Request) (*http.Response, error) {
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// SetClientCertificate authenticates to the sidecar with the certificate of
+// certFile and keyFile. The sidecar certificate must be signed by caFile,
+// or by a system authority when caFile is empty.
+func (s *Sidecar) SetClientCertificate(certFile, keyFile, caFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("invalid chain reader client certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("cannot read chain reader CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	s.client = &http.Client{Transport: transport}
+	return nil
+}
+
+// ConfigureSidecar applies the block url style, the headers and the client
+// certificate of chain to reader, it fails when the style is unknown or the
+// certificate files cannot be loaded
+func ConfigureSidecar(reader *Sidecar, chain ParaChainConfig) error {
+	if err := reader.SetBlockURLStyle(BlockURLStyle(chain.ChainreaderBlockURL)); err != nil {
+		return err
+	}
+	reader.SetHeaders(ChainreaderHeaders(chain))
+	if chain.ChainreaderCert == "" && chain.ChainreaderKey == "" {
+		return nil
+	}
+	return reader.SetClientCertificate(chain.ChainreaderCert, chain.ChainreaderKey, chain.ChainreaderCA)
+}
+
+// ChainreaderURL returns the base url of the chain reader of chain, https
+// when it authenticates with a client certificate
+func ChainreaderURL(chain ParaChainConfig) string {
+	scheme := "http"
+	if chain.ChainreaderCert != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, chain.ChainreaderIP, chain.ChainreaderPort)
+}
+
+// readBody reads a response body, failing instead of buffering more than
+// maxResponseBytes
+func (s *Sidecar) readBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, s.maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxResponseBytes {
+		return nil, fmt.Errorf("sidecar response exceeds %d bytes", s.maxResponseBytes)
 	}
+	return data, nil
 }
 
-// fetchHeadBlock fetches the current head block from the sidecar API
+// limitedReader fails once more than limit bytes are read, as readBody does
+// for a response it buffers
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n, fmt.Errorf("sidecar response exceeds %d bytes", l.limit)
+	}
+	return n, err
+}
+
+// decodeBlockRange decodes the array of blocks of a range response from r
+// one block at a time, so that only the decoded blocks and the one being
+// read are held in memory. expected is the size of the range.
+func decodeBlockRange(r io.Reader, expected int) ([]BlockData, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		// null, as an empty array
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected an array of blocks, got %v", token)
+	}
+
+	blocks := make([]BlockData, 0, expected)
+	for decoder.More() {
+		var block BlockData
+		if err := decoder.Decode(&block); err != nil {
+			return nil, fmt.Errorf("block %d of the range: %w", len(blocks), err)
+		}
+		blocks = append(blocks, block)
+	}
+	// the closing bracket
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	switch _, err := decoder.Token(); err {
+	case io.EOF:
+	case nil:
+		return nil, fmt.Errorf("unexpected data after the array of blocks")
+	default:
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// GetChainHeadID fetches the current head block from the sidecar API
 func (s *Sidecar) GetChainHeadID() (int, error) {
+	return s.headID("/blocks/head")
+}
 
+// GetFinalizedHeadID asks the sidecar for the header of the finalized head
+func (s *Sidecar) GetFinalizedHeadID() (int, error) {
+	return s.headID("/blocks/head/header?finalized=true")
+}
+
+// headID returns the number of the block or header answered at path
+func (s *Sidecar) headID(path string) (int, error) {
 	start := time.Now()
 	defer func(start time.Time) {
 		go func(start time.Time, err error) {
@@ -50,10 +302,14 @@ func (s *Sidecar) GetChainHeadID() (int, error) {
 	}(start)
 
 	// Construct the URL for the head block
-	url := fmt.Sprintf("%s/blocks/head", s.url)
+	url := s.url + path
 
 	// Make the request
-	resp, err := http.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return -1, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := s.do(req)
 	if err != nil {
 		return -1, fmt.Errorf("error fetching head block: %w", err)
 	}
@@ -65,7 +321,7 @@ func (s *Sidecar) GetChainHeadID() (int, error) {
 	}
 
 	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := s.readBody(resp.Body)
 	if err != nil {
 		return -1, fmt.Errorf("error reading response body for block range: %w", err)
 	}
@@ -123,7 +379,7 @@ func (s *Sidecar) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockD
 			return nil, fmt.Errorf("error creating request: %w", err)
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := s.do(req)
 		if err != nil {
 			return nil, fmt.Errorf("error fetching block range: %w", err)
 		}
@@ -134,15 +390,22 @@ func (s *Sidecar) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockD
 			return nil, fmt.Errorf("sidecar API returned status code %d", resp.StatusCode)
 		}
 
-		// Read the response body
-		body, err := io.ReadAll(resp.Body)
+		// Parse the response as it is read, one block at a time
+		_, decodeSpan := startSpan(ctx, "decode")
+		body := &limitedReader{r: resp.Body, limit: s.maxResponseBytes}
+		blocks, err = decodeBlockRange(body, len(blockIDs))
+		decodeSpan.SetAttributes(attribute.Int("blocks", len(blocks)))
+		recordError(decodeSpan, err)
+		decodeSpan.End()
 		if err != nil {
-			return nil, fmt.Errorf("error reading response body for block range: %w", err)
+			return nil, fmt.Errorf("error parsing block range response: %w", err)
 		}
 
-		// Parse the response
-		if err := json.Unmarshal(body, &blocks); err != nil {
-			return nil, fmt.Errorf("error parsing block range response: %w", err)
+		// the sidecar may answer with a subset of the range, fetch the
+		// missing blocks one by one rather than indexing a partial batch
+		blocks, err = s.fetchMissingBlocks(ctx, blockIDs, blocks)
+		if err != nil {
+			return nil, err
 		}
 	} else {
 		// Fetch blocks individually for non-sequential IDs
@@ -159,6 +422,28 @@ func (s *Sidecar) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockD
 	return blocks, nil
 }
 
+// fetchMissingBlocks fetches the blocks of blockIDs which are not in blocks
+func (s *Sidecar) fetchMissingBlocks(ctx context.Context, blockIDs []int, blocks []BlockData) ([]BlockData, error) {
+	returned := make(map[int]bool, len(blocks))
+	for _, block := range blocks {
+		if id, err := strconv.Atoi(block.ID); err == nil {
+			returned[id] = true
+		}
+	}
+	for _, id := range blockIDs {
+		if returned[id] {
+			continue
+		}
+		log.Printf("Block %d missing from range response, fetching it alone", id)
+		block, err := s.FetchBlock(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching missing block %d: %w", id, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
 // fetchBlock makes a call to the sidecar API to fetch a single block
 // Note: With elastic scaling, multiple blocks may exist at the same height
 // This function returns the canonical block. For multi-block queries, use useRcBlock parameter
@@ -171,7 +456,7 @@ func (s *Sidecar) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 	}(start)
 
 	// Construct the URL for the block
-	url := fmt.Sprintf("%s/blocks/%d", s.url, id)
+	url := s.blockURL(id)
 
 	// Make the request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -179,7 +464,7 @@ func (s *Sidecar) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 		return BlockData{}, fmt.Errorf("error creating request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return BlockData{}, fmt.Errorf("error fetching block %d: %w", id, err)
 	}
@@ -191,7 +476,7 @@ func (s *Sidecar) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 	}
 
 	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := s.readBody(resp.Body)
 	if err != nil {
 		return BlockData{}, fmt.Errorf("error reading response body for block %d: %w", id, err)
 	}
@@ -205,6 +490,75 @@ func (s *Sidecar) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 	return block, nil
 }
 
+// sidecarRuntimeSpec is the answer of /runtime/spec, numbers are strings
+type sidecarRuntimeSpec struct {
+	SpecName           string `json:"specName"`
+	SpecVersion        string `json:"specVersion"`
+	ImplVersion        string `json:"implVersion"`
+	AuthoringVersion   string `json:"authoringVersion"`
+	TransactionVersion string `json:"transactionVersion"`
+	StateVersion       string `json:"stateVersion"`
+}
+
+func (spec sidecarRuntimeSpec) toRuntimeVersion() (RuntimeVersion, error) {
+	specVersion, err := strconv.Atoi(spec.SpecVersion)
+	if err != nil {
+		return RuntimeVersion{}, fmt.Errorf("invalid specVersion %q: %w", spec.SpecVersion, err)
+	}
+	// the other versions are informative, default to 0 when absent
+	implVersion, _ := strconv.Atoi(spec.ImplVersion)
+	authoringVersion, _ := strconv.Atoi(spec.AuthoringVersion)
+	transactionVersion, _ := strconv.Atoi(spec.TransactionVersion)
+	stateVersion, _ := strconv.Atoi(spec.StateVersion)
+	return RuntimeVersion{
+		SpecName:           spec.SpecName,
+		SpecVersion:        specVersion,
+		ImplVersion:        implVersion,
+		AuthoringVersion:   authoringVersion,
+		TransactionVersion: transactionVersion,
+		StateVersion:       stateVersion,
+	}, nil
+}
+
+// GetRuntimeVersion returns the runtime that was live at blockID
+func (s *Sidecar) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	start := time.Now()
+	defer func(start time.Time) {
+		go func(start time.Time, err error) {
+			s.metrics.RecordLatency(start, 1, err)
+		}(start, nil)
+	}(start)
+
+	url := fmt.Sprintf("%s/runtime/spec?at=%d", s.url, blockID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return RuntimeVersion{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return RuntimeVersion{}, fmt.Errorf("error fetching runtime spec at %d: %w", blockID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return RuntimeVersion{}, fmt.Errorf("sidecar API returned status code %d for runtime spec at %d", resp.StatusCode, blockID)
+	}
+
+	body, err := s.readBody(resp.Body)
+	if err != nil {
+		return RuntimeVersion{}, fmt.Errorf("error reading runtime spec at %d: %w", blockID, err)
+	}
+
+	var spec sidecarRuntimeSpec
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return RuntimeVersion{}, fmt.Errorf("error parsing runtime spec at %d: %w", blockID, err)
+	}
+
+	return spec.toRuntimeVersion()
+}
+
 // testSidecarService tests if the sidecar service is available
 func (s *Sidecar) Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -215,7 +569,7 @@ func (s *Sidecar) Ping() error {
 		return fmt.Errorf("error creating request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return fmt.Errorf("error connecting to sidecar service: %w", err)
 	}
@@ -241,20 +595,71 @@ func NewChainReader(relay, chain, wsUrl, httpUrl string) ChainReader {
 // NewChainReaderFromConfig creates a ChainReader from ParaChainConfig
 // It automatically constructs the WebSocket and HTTP URLs from config
 func NewChainReaderFromConfig(relay, chain string, config ParaChainConfig) ChainReader {
-	// Determine the node IP
-	nodeIP := config.NodeIP
-	if nodeIP == "" {
-		nodeIP = config.RelayIP
-	}
-	if nodeIP == "" {
-		nodeIP = "127.0.0.1"
-	}
-
 	// Construct WebSocket URL for SubstrateRPC
-	wsUrl := fmt.Sprintf("ws://%s:%d", nodeIP, config.PortWS)
+	wsUrl := fmt.Sprintf("ws://%s:%d", nodeIP(config), config.PortWS)
 
 	// Construct HTTP URL for Sidecar fallback
 	httpUrl := fmt.Sprintf("http://%s:%d", config.ChainreaderIP, config.ChainreaderPort)
 
 	return NewChainReader(relay, chain, wsUrl, httpUrl)
 }
+
+// nodeIP returns the address of the archive node of a chain
+func nodeIP(config ParaChainConfig) string {
+	if config.NodeIP != "" {
+		return config.NodeIP
+	}
+	if config.RelayIP != "" {
+		return config.RelayIP
+	}
+	return "127.0.0.1"
+}
+
+// NodeRPCURL returns the HTTP JSON-RPC url of the archive node of a chain
+func NodeRPCURL(config ParaChainConfig) string {
+	return fmt.Sprintf("http://%s:%d", nodeIP(config), config.PortRPC)
+}
+
+// SidecarURL returns the url of the i-th sidecar of a chain
+func SidecarURL(config ParaChainConfig, i int) string {
+	ip := config.SidecarIP
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s:%d", ip, config.ComputePort(config.SidecarPort, i))
+}
+
+// SidecarSubstrateURL returns the SAS_SUBSTRATE_URL of the sidecars of a
+// chain, they talk to the node on its RPC port
+func SidecarSubstrateURL(config ParaChainConfig) string {
+	return fmt.Sprintf("ws://%s:%d", nodeIP(config), config.PortRPC)
+}
+
+// ValidateSidecarSubstrateURL checks that substrateURL reaches the node of
+// the chain on its RPC port. Using port_ws instead is a common mistake.
+func ValidateSidecarSubstrateURL(config ParaChainConfig, substrateURL string) error {
+	u, err := url.Parse(substrateURL)
+	if err != nil {
+		return fmt.Errorf("invalid substrate url %q: %w", substrateURL, err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("substrate url %q must use ws or wss", substrateURL)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("substrate url %q has no host", substrateURL)
+	}
+	if config.PortRPC <= 0 {
+		return fmt.Errorf("port_rpc is not set")
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return fmt.Errorf("substrate url %q has no port", substrateURL)
+	}
+	if port != config.PortRPC {
+		if port == config.PortWS {
+			return fmt.Errorf("substrate url %q uses port_ws %d instead of port_rpc %d", substrateURL, port, config.PortRPC)
+		}
+		return fmt.Errorf("substrate url %q does not match port_rpc %d", substrateURL, config.PortRPC)
+	}
+	return nil
+}
@@ -51,6 +51,23 @@ func (f *FallbackChainReader) GetChainHeadID() (int, error) {
 	return headID, nil
 }
 
+// GetFinalizedHeadID implements ChainReader interface with fallback
+func (f *FallbackChainReader) GetFinalizedHeadID() (int, error) {
+	headID, err := f.primary.GetFinalizedHeadID()
+	if err == nil {
+		return headID, nil
+	}
+
+	log.Printf("Primary reader failed for %s:%s GetFinalizedHeadID: %v, falling back to secondary", f.relay, f.chain, err)
+
+	headID, err = f.secondary.GetFinalizedHeadID()
+	if err != nil {
+		return -1, fmt.Errorf("both primary and secondary readers failed: %w", err)
+	}
+
+	return headID, nil
+}
+
 // FetchBlock implements ChainReader interface with fallback
 func (f *FallbackChainReader) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 	// Try primary reader first
@@ -89,6 +106,23 @@ func (f *FallbackChainReader) FetchBlockRange(ctx context.Context, blockIDs []in
 	return blocks, nil
 }
 
+// GetRuntimeVersion implements ChainReader interface with fallback
+func (f *FallbackChainReader) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	runtime, err := f.primary.GetRuntimeVersion(ctx, blockID)
+	if err == nil {
+		return runtime, nil
+	}
+
+	log.Printf("Primary reader failed for %s:%s GetRuntimeVersion(%d): %v, falling back to secondary", f.relay, f.chain, blockID, err)
+
+	runtime, err = f.secondary.GetRuntimeVersion(ctx, blockID)
+	if err != nil {
+		return RuntimeVersion{}, fmt.Errorf("both primary and secondary readers failed for runtime at %d: %w", blockID, err)
+	}
+
+	return runtime, nil
+}
+
 // Ping implements ChainReader interface with fallback
 func (f *FallbackChainReader) Ping() error {
 	// Try primary reader first
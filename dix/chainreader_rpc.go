@@ -3,33 +3,62 @@ package dix
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
+	"net"
 	"strconv"
+	"sync"
 	"time"
 
+	gorillaws "github.com/gorilla/websocket"
 	substrate "github.com/itering/substrate-api-rpc"
 	"github.com/itering/substrate-api-rpc/metadata"
 	"github.com/itering/substrate-api-rpc/model"
+	"github.com/itering/substrate-api-rpc/pkg/recws"
 	rpc "github.com/itering/substrate-api-rpc/rpc"
 	"github.com/itering/substrate-api-rpc/storageKey"
 	rpcutil "github.com/itering/substrate-api-rpc/util"
 	"github.com/itering/substrate-api-rpc/websocket"
+	"golang.org/x/sync/singleflight"
 )
 
 // SubstrateRPCReader implements ChainReader using the Go substrate-rpc-api library
 // This provides a native Go alternative to the HTTP-based Sidecar service
 type SubstrateRPCReader struct {
-	relay       string
-	chain       string
-	wsUrl       string
+	relay   string
+	chain   string
+	wsUrl   string
+	metrics *Metrics
+	// runtime and metadata loaded by initialize, shared by concurrent calls
+	stateMu     sync.Mutex
 	metadatas   map[int]*metadata.Instant
 	runtimes    map[string]RuntimeVersion
-	metrics     *Metrics
 	initialized bool
+	// reconnect re-dials the node and reloads runtime and metadata, calls
+	// failing on a lost connection are retried maxReconnects times. The calls
+	// losing the connection together share a single reconnection.
+	reconnect      func(blockID int) error
+	reconnects     singleflight.Group
+	maxReconnects  int
+	reconnectDelay time.Duration
+	// connections to wsUrl, owned by this reader so that readers of
+	// different chains do not share the library's global endpoint
+	poolMu           sync.Mutex
+	pool             *rpcPool
+	handshakeTimeout time.Duration
 }
 
+const (
+	defaultRPCMaxReconnects  = 5
+	defaultRPCReconnectDelay = 500 * time.Millisecond
+	maxRPCReconnectDelay     = 30 * time.Second
+	rpcPoolMaxConns          = 25
+	rpcHandshakeTimeout      = 5 * time.Second
+)
+
 // RuntimeVersion represents the runtime version information
 type RuntimeVersion struct {
 	SpecName           string  `json:"specName"`
@@ -67,26 +96,207 @@ type EncodedBlock struct {
 
 // NewSubstrateRPCReader creates a new SubstrateRPCReader instance
 func NewSubstrateRPCReader(relay, chain, wsUrl string) *SubstrateRPCReader {
-	return &SubstrateRPCReader{
-		relay:       relay,
-		chain:       chain,
-		wsUrl:       wsUrl,
-		metadatas:   make(map[int]*metadata.Instant),
-		runtimes:    make(map[string]RuntimeVersion),
-		metrics:     NewMetrics("SubstrateRPC"),
-		initialized: false,
+	r := &SubstrateRPCReader{
+		relay:          relay,
+		chain:          chain,
+		wsUrl:          wsUrl,
+		metadatas:      make(map[int]*metadata.Instant),
+		runtimes:       make(map[string]RuntimeVersion),
+		metrics:        NewMetrics("SubstrateRPC"),
+		maxReconnects:  defaultRPCMaxReconnects,
+		reconnectDelay: defaultRPCReconnectDelay,
+
+		handshakeTimeout: rpcHandshakeTimeout,
+	}
+	r.reconnect = r.redial
+	return r
+}
+
+// rpcPool is a connection pool and the number of calls running on it. A
+// pool retired by closePool is closed when its last call returns.
+type rpcPool struct {
+	websocket.Pool
+	calls   int
+	retired bool
+}
+
+// acquirePool returns the connection pool of the reader, creating it on
+// first use. The pool stays open until the caller releases it.
+func (r *SubstrateRPCReader) acquirePool() (*rpcPool, error) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+	if r.pool != nil {
+		r.pool.calls++
+		return r.pool, nil
+	}
+	factory := func() (*recws.RecConn, error) {
+		conn := &recws.RecConn{
+			KeepAliveTimeout: 10 * time.Second,
+			WriteTimeout:     30 * time.Second,
+			ReadTimeout:      30 * time.Second,
+			NonVerbose:       true,
+			HandshakeTimeout: r.handshakeTimeout,
+		}
+		conn.Dial(r.wsUrl, nil)
+		return conn, nil
+	}
+	pool, err := websocket.NewChannelPool(0, rpcPoolMaxConns, factory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool for %s: %w", r.wsUrl, err)
+	}
+	r.pool = &rpcPool{Pool: pool, calls: 1}
+	return r.pool, nil
+}
+
+// releasePool ends a call on pool, closing it if it was retired meanwhile
+func (r *SubstrateRPCReader) releasePool(pool *rpcPool) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+	pool.calls--
+	if pool.retired && pool.calls == 0 {
+		pool.Close()
+	}
+}
+
+// closePool swaps out the connections of the reader, the next call dials
+// again. The calls running on the previous pool finish on it.
+func (r *SubstrateRPCReader) closePool() {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+	if r.pool == nil {
+		return
+	}
+	r.pool.retired = true
+	if r.pool.calls == 0 {
+		r.pool.Close()
+	}
+	r.pool = nil
+}
+
+// errConnectionLost marks the calls whose request could not be written
+var errConnectionLost = errors.New("websocket connection lost")
+
+// trackedConn keeps the error of a failed write, websocket.SendWsRequest
+// only reports its text
+type trackedConn struct {
+	websocket.WsConn
+	writeErr error
+}
+
+func (c *trackedConn) WriteMessage(messageType int, data []byte) error {
+	err := c.WsConn.WriteMessage(messageType, data)
+	if err != nil {
+		c.writeErr = err
+	}
+	return err
+}
+
+// withConn runs send on a pooled connection. A connection which failed is
+// dropped instead of going back to the pool.
+func (r *SubstrateRPCReader) withConn(send func(conn websocket.WsConn) error) error {
+	pool, err := r.acquirePool()
+	if err != nil {
+		return err
+	}
+	defer r.releasePool(pool)
+	conn, err := pool.Get()
+	if err != nil {
+		return fmt.Errorf("websocket connection to %s: %w", r.wsUrl, err)
+	}
+	tracked := &trackedConn{WsConn: conn.Conn}
+	err = send(tracked)
+	if err != nil && tracked.writeErr != nil {
+		err = fmt.Errorf("%w to %s: %w", errConnectionLost, r.wsUrl, tracked.writeErr)
+	}
+	if isConnectionError(err) {
+		conn.MarkUnusable()
+	}
+	conn.Close()
+	return err
+}
+
+// sendWsRequest sends request on one of the reader's connections
+func (r *SubstrateRPCReader) sendWsRequest(v interface{}, request []byte) error {
+	return r.withConn(func(conn websocket.WsConn) error {
+		return websocket.SendWsRequest(conn, v, request)
+	})
+}
+
+// getBlockHash returns the hash of blockID, -1 for the head
+func (r *SubstrateRPCReader) getBlockHash(blockID int) (hash string, err error) {
+	err = r.withConn(func(conn websocket.WsConn) (err error) {
+		hash, err = rpc.GetChainGetBlockHash(conn, blockID)
+		return err
+	})
+	return hash, err
+}
+
+// redial drops the pooled connections and initializes the reader again,
+// the runtime may have been upgraded while the node was away
+func (r *SubstrateRPCReader) redial(blockID int) error {
+	r.closePool()
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	r.initialized = false
+	return r.load(blockID)
+}
+
+// isConnectionError tells a lost websocket apart from an RPC error
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var closeErr *gorillaws.CloseError
+	return errors.Is(err, errConnectionLost) ||
+		errors.Is(err, recws.ErrNotConnected) ||
+		errors.Is(err, websocket.ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) ||
+		errors.As(err, &closeErr)
+}
+
+// withReconnect runs call and, while it fails on a lost connection, re-dials
+// with an exponential backoff before trying again
+func (r *SubstrateRPCReader) withReconnect(ctx context.Context, blockID int, call func() error) error {
+	err := call()
+	delay := r.reconnectDelay
+	for attempt := 1; attempt <= r.maxReconnects && isConnectionError(err); attempt++ {
+		log.Printf("Connection to %s lost (%v), reconnecting in %s (attempt %d/%d)",
+			r.wsUrl, err, delay, attempt, r.maxReconnects)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRPCReconnectDelay)
+		_, reconnectErr, _ := r.reconnects.Do("reconnect", func() (any, error) {
+			return nil, r.reconnect(blockID)
+		})
+		if reconnectErr != nil {
+			err = fmt.Errorf("%w, reconnecting to %s: %w", errConnectionLost, r.wsUrl, reconnectErr)
+			continue
+		}
+		err = call()
 	}
+	return err
 }
 
-// initialize connects to the WebSocket and fetches initial runtime and metadata
+// initialize connects to the WebSocket and fetches initial runtime and
+// metadata, once: concurrent calls wait for the first one
 func (r *SubstrateRPCReader) initialize(blockID int) error {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
 	if r.initialized {
 		return nil
 	}
+	return r.load(blockID)
+}
 
-	websocket.SetEndpoint(r.wsUrl)
-
-	blockHash, err := rpc.GetChainGetBlockHash(nil, blockID)
+// load fetches the runtime and metadata at blockID, stateMu must be held
+func (r *SubstrateRPCReader) load(blockID int) error {
+	blockHash, err := r.getBlockHash(blockID)
 	if err != nil {
 		return fmt.Errorf("failed to get block %d hash: %w", blockID, err)
 	}
@@ -113,7 +323,7 @@ func (r *SubstrateRPCReader) initialize(blockID int) error {
 func (r *SubstrateRPCReader) getRuntime(blockID int, blockHash string) (RuntimeVersion, error) {
 	var rpcRuntimeResult model.JsonRpcResult
 	runtimeRequest := rpc.ChainGetRuntimeVersion(blockID, blockHash)
-	err := websocket.SendWsRequest(nil, &rpcRuntimeResult, runtimeRequest)
+	err := r.sendWsRequest(&rpcRuntimeResult, runtimeRequest)
 	if err != nil {
 		return RuntimeVersion{}, fmt.Errorf("failed to send runtime version request: %w", err)
 	}
@@ -145,7 +355,11 @@ func (r *SubstrateRPCReader) getRuntime(blockID int, blockHash string) (RuntimeV
 
 // getMetadata fetches the metadata for a specific spec version
 func (r *SubstrateRPCReader) getMetadata(specVersion int, blockHash string) (*metadata.Instant, error) {
-	rawMetadata, err := rpc.GetMetadataByHash(nil, blockHash)
+	var rawMetadata string
+	err := r.withConn(func(conn websocket.WsConn) (err error) {
+		rawMetadata, err = rpc.GetMetadataByHash(conn, blockHash)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metadata by hash %s: %w", blockHash, err)
 	}
@@ -170,21 +384,27 @@ func (r *SubstrateRPCReader) GetChainHeadID() (int, error) {
 		}(start, nil)
 	}(start)
 
-	// Ensure initialized
-	if !r.initialized {
-		if err := r.initialize(1); err != nil {
-			return -1, fmt.Errorf("failed to initialize: %w", err)
-		}
+	var head int
+	err := r.withReconnect(context.Background(), 1, func() (err error) {
+		head, err = r.getChainHeadID()
+		return err
+	})
+	return head, err
+}
+
+func (r *SubstrateRPCReader) getChainHeadID() (int, error) {
+	if err := r.initialize(1); err != nil {
+		return -1, fmt.Errorf("failed to initialize: %w", err)
 	}
 
-	blockHash, err := rpc.GetChainGetBlockHash(nil, -1) // -1 gets the latest block
+	blockHash, err := r.getBlockHash(-1) // -1 gets the latest block
 	if err != nil {
 		return -1, fmt.Errorf("failed to get head block hash: %w", err)
 	}
 
 	var rpcBlockResult model.JsonRpcResult
 	blockRequest := rpc.ChainGetBlock(rand.Intn(10000), blockHash)
-	err = websocket.SendWsRequest(nil, &rpcBlockResult, blockRequest)
+	err = r.sendWsRequest(&rpcBlockResult, blockRequest)
 	if err != nil {
 		return -1, fmt.Errorf("failed to get head block: %w", err)
 	}
@@ -221,6 +441,65 @@ func (r *SubstrateRPCReader) GetChainHeadID() (int, error) {
 	return int(blockNum), nil
 }
 
+// GetFinalizedHeadID implements ChainReader interface
+func (r *SubstrateRPCReader) GetFinalizedHeadID() (int, error) {
+	start := time.Now()
+	defer func(start time.Time) {
+		go func(start time.Time, err error) {
+			r.metrics.RecordLatency(start, 1, err)
+		}(start, nil)
+	}(start)
+
+	var head int
+	err := r.withReconnect(context.Background(), 1, func() (err error) {
+		head, err = r.getFinalizedHeadID()
+		return err
+	})
+	return head, err
+}
+
+func (r *SubstrateRPCReader) getFinalizedHeadID() (int, error) {
+	if err := r.initialize(1); err != nil {
+		return -1, fmt.Errorf("failed to initialize: %w", err)
+	}
+
+	var hashResult model.JsonRpcResult
+	request, _ := json.Marshal(rpc.Param{Id: rand.Intn(10000), Method: "chain_getFinalizedHead", Params: []string{}, JsonRpc: "2.0"})
+	if err := r.sendWsRequest(&hashResult, request); err != nil {
+		return -1, fmt.Errorf("failed to get finalized head: %w", err)
+	}
+	if err := hashResult.CheckErr(); err != nil {
+		return -1, fmt.Errorf("RPC error fetching finalized head: %w", err)
+	}
+	hash, ok := hashResult.Result.(string)
+	if !ok {
+		return -1, fmt.Errorf("unexpected result type for finalized head")
+	}
+
+	var headerResult model.JsonRpcResult
+	request, _ = json.Marshal(rpc.Param{Id: rand.Intn(10000), Method: "chain_getHeader", Params: []string{hash}, JsonRpc: "2.0"})
+	if err := r.sendWsRequest(&headerResult, request); err != nil {
+		return -1, fmt.Errorf("failed to get finalized header: %w", err)
+	}
+	if err := headerResult.CheckErr(); err != nil {
+		return -1, fmt.Errorf("RPC error fetching finalized header: %w", err)
+	}
+	if _, ok := headerResult.Result.(map[string]interface{}); !ok {
+		return -1, fmt.Errorf("unexpected result type for finalized header")
+	}
+	var header struct {
+		Number string `json:"number"`
+	}
+	if err := headerResult.ToAnyThing(&header); err != nil {
+		return -1, fmt.Errorf("failed to read finalized header: %w", err)
+	}
+	blockNum, err := strconv.ParseInt(header.Number, 0, 64)
+	if err != nil {
+		return -1, fmt.Errorf("failed to parse block number: %w", err)
+	}
+	return int(blockNum), nil
+}
+
 // FetchBlock implements ChainReader interface
 func (r *SubstrateRPCReader) FetchBlock(ctx context.Context, id int) (BlockData, error) {
 	start := time.Now()
@@ -230,15 +509,21 @@ func (r *SubstrateRPCReader) FetchBlock(ctx context.Context, id int) (BlockData,
 		}(start, nil)
 	}(start)
 
-	// Ensure initialized
-	if !r.initialized {
-		if err := r.initialize(id); err != nil {
-			return BlockData{}, fmt.Errorf("failed to initialize: %w", err)
-		}
+	var block BlockData
+	err := r.withReconnect(ctx, id, func() (err error) {
+		block, err = r.fetchBlock(id)
+		return err
+	})
+	return block, err
+}
+
+func (r *SubstrateRPCReader) fetchBlock(id int) (BlockData, error) {
+	if err := r.initialize(id); err != nil {
+		return BlockData{}, fmt.Errorf("failed to initialize: %w", err)
 	}
 
 	// Get block hash
-	hash, err := rpc.GetChainGetBlockHash(nil, id)
+	hash, err := r.getBlockHash(id)
 	if err != nil {
 		return BlockData{}, fmt.Errorf("failed to get block %d hash: %w", id, err)
 	}
@@ -255,16 +540,10 @@ func (r *SubstrateRPCReader) FetchBlock(ctx context.Context, id int) (BlockData,
 		return BlockData{}, fmt.Errorf("error fetching events for block %d: %w", id, err)
 	}
 
-	// Get runtime info
-	runtimeInfo, ok := r.runtimes["relay-chain"]
-	if !ok {
-		return BlockData{}, fmt.Errorf("runtime info not found for block %d", id)
-	}
-
-	// Get metadata
-	meta, ok := r.metadatas[runtimeInfo.SpecVersion]
-	if !ok {
-		return BlockData{}, fmt.Errorf("metadata for spec version %d not found", runtimeInfo.SpecVersion)
+	// Get runtime info and metadata
+	runtimeInfo, meta, err := r.currentMetadata(id)
+	if err != nil {
+		return BlockData{}, err
 	}
 
 	// Decode extrinsics
@@ -286,6 +565,21 @@ func (r *SubstrateRPCReader) FetchBlock(ctx context.Context, id int) (BlockData,
 	return block, nil
 }
 
+// currentMetadata returns the runtime loaded by initialize and its metadata
+func (r *SubstrateRPCReader) currentMetadata(id int) (RuntimeVersion, *metadata.Instant, error) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	runtimeInfo, ok := r.runtimes["relay-chain"]
+	if !ok {
+		return RuntimeVersion{}, nil, fmt.Errorf("runtime info not found for block %d", id)
+	}
+	meta, ok := r.metadatas[runtimeInfo.SpecVersion]
+	if !ok {
+		return RuntimeVersion{}, nil, fmt.Errorf("metadata for spec version %d not found", runtimeInfo.SpecVersion)
+	}
+	return runtimeInfo, meta, nil
+}
+
 // FetchBlockRange implements ChainReader interface
 func (r *SubstrateRPCReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error) {
 	if len(blockIDs) == 0 {
@@ -316,6 +610,30 @@ func (r *SubstrateRPCReader) FetchBlockRange(ctx context.Context, blockIDs []int
 	return blocks, nil
 }
 
+// GetRuntimeVersion implements ChainReader interface
+func (r *SubstrateRPCReader) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	start := time.Now()
+	defer func(start time.Time) {
+		go func(start time.Time, err error) {
+			r.metrics.RecordLatency(start, 1, err)
+		}(start, nil)
+	}(start)
+
+	var runtime RuntimeVersion
+	err := r.withReconnect(ctx, blockID, func() (err error) {
+		if err := r.initialize(blockID); err != nil {
+			return fmt.Errorf("failed to initialize: %w", err)
+		}
+		hash, err := r.getBlockHash(blockID)
+		if err != nil {
+			return fmt.Errorf("failed to get block %d hash: %w", blockID, err)
+		}
+		runtime, err = r.getRuntime(blockID, hash)
+		return err
+	})
+	return runtime, err
+}
+
 // Ping implements ChainReader interface
 func (r *SubstrateRPCReader) Ping() error {
 	// Try to get chain head to verify connection
@@ -332,7 +650,7 @@ func (r *SubstrateRPCReader) GetStats() *MetricsStats {
 func (r *SubstrateRPCReader) fetchBlockDetails(blockHash string, blockNum int) (EncodedBlock, error) {
 	blockRequest := rpc.ChainGetBlock(rand.Intn(10000), blockHash)
 	var rpcBlockResult model.JsonRpcResult
-	err := websocket.SendWsRequest(nil, &rpcBlockResult, blockRequest)
+	err := r.sendWsRequest(&rpcBlockResult, blockRequest)
 	if err != nil {
 		return EncodedBlock{}, fmt.Errorf("failed to send block request: %w", err)
 	}
@@ -374,7 +692,7 @@ func (r *SubstrateRPCReader) fetchEvents(blockHash string, blockNum int) (string
 		rpcutil.AddHex(eventsKeyBytes.EncodeKey),
 		blockHash)
 
-	err := websocket.SendWsRequest(nil, &rpcEventResult, storageRequest)
+	err := r.sendWsRequest(&rpcEventResult, storageRequest)
 	if err != nil {
 		return "", fmt.Errorf("failed to send event storage request: %w", err)
 	}
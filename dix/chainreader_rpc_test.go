@@ -0,0 +1,303 @@
+package dix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/itering/substrate-api-rpc/model"
+	"github.com/itering/substrate-api-rpc/pkg/recws"
+	"github.com/itering/substrate-api-rpc/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRPCReader(reconnect func(blockID int) error) *SubstrateRPCReader {
+	r := NewSubstrateRPCReader("polkadot", "polkadot", "ws://127.0.0.1:1")
+	r.reconnect = reconnect
+	r.reconnectDelay = time.Millisecond
+	return r
+}
+
+func TestRPCReaderReconnectsAfterDisconnect(t *testing.T) {
+	reconnects := 0
+	r := newTestRPCReader(func(blockID int) error {
+		assert.Equal(t, 42, blockID, "the reader is re-initialized at the requested block")
+		reconnects++
+		return nil
+	})
+
+	calls := 0
+	err := r.withReconnect(context.Background(), 42, func() error {
+		calls++
+		if calls == 1 {
+			// the node went away between two calls
+			return fmt.Errorf("failed to get block 42 hash: %w", recws.ErrNotConnected)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 1, reconnects)
+}
+
+func TestRPCReaderKeepsRetryingWhileNodeIsDown(t *testing.T) {
+	reconnects := 0
+	r := newTestRPCReader(func(blockID int) error {
+		reconnects++
+		if reconnects < 3 {
+			return errors.New("websocket: bad handshake")
+		}
+		return nil
+	})
+
+	calls := 0
+	err := r.withReconnect(context.Background(), 1, func() error {
+		calls++
+		if calls == 1 {
+			return recws.ErrNotConnected
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reconnects)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRPCReaderGivesUp(t *testing.T) {
+	reconnects := 0
+	r := newTestRPCReader(func(blockID int) error {
+		reconnects++
+		return nil
+	})
+	err := r.withReconnect(context.Background(), 1, func() error {
+		return recws.ErrNotConnected
+	})
+	assert.ErrorIs(t, err, recws.ErrNotConnected)
+	assert.Equal(t, defaultRPCMaxReconnects, reconnects)
+}
+
+func TestRPCReaderDoesNotRetryRPCErrors(t *testing.T) {
+	r := newTestRPCReader(func(blockID int) error {
+		t.Error("an RPC error must not trigger a reconnection")
+		return nil
+	})
+	err := r.withReconnect(context.Background(), 1, func() error {
+		return errors.New("RPC error fetching block: unknown block")
+	})
+	assert.Error(t, err)
+}
+
+// newRPCEchoServer answers every JSON-RPC call with result
+func newRPCEchoServer(t *testing.T, result string) *httptest.Server {
+	upgrader := gorillaws.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		for {
+			var request struct {
+				ID int `json:"id"`
+			}
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			if err := conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": request.ID, "result": result}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRPCReadersUseTheirOwnEndpoint(t *testing.T) {
+	polkadot := newRPCEchoServer(t, "0xpolkadot")
+	kusama := newRPCEchoServer(t, "0xkusama")
+
+	readers := map[string]*SubstrateRPCReader{
+		"0xpolkadot": NewSubstrateRPCReader("polkadot", "polkadot", "ws"+strings.TrimPrefix(polkadot.URL, "http")),
+		"0xkusama":   NewSubstrateRPCReader("kusama", "kusama", "ws"+strings.TrimPrefix(kusama.URL, "http")),
+	}
+
+	var wg sync.WaitGroup
+	for expected, reader := range readers {
+		reader.handshakeTimeout = 100 * time.Millisecond
+		defer reader.closePool()
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(expected string, reader *SubstrateRPCReader) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					hash, err := reader.getBlockHash(j)
+					if err != nil {
+						t.Errorf("%s: %v", expected, err)
+						return
+					}
+					if hash != expected {
+						t.Errorf("reader of %s got %s", expected, hash)
+					}
+				}
+			}(expected, reader)
+		}
+	}
+	wg.Wait()
+}
+
+func TestIsConnectionError(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("failed to get block 1 hash: %w", recws.ErrNotConnected),
+		fmt.Errorf("%w to ws://node: %w", errConnectionLost, gorillaws.ErrCloseSent),
+		&gorillaws.CloseError{Code: gorillaws.CloseAbnormalClosure},
+		websocket.ErrClosed,
+		io.ErrUnexpectedEOF,
+	} {
+		assert.True(t, isConnectionError(err), "%v", err)
+	}
+	for _, err := range []error{
+		nil,
+		errors.New("RPC error fetching block: unknown block"),
+		// an RPC error whose text names the websocket is not a lost connection
+		errors.New("RPC error: websocket subscription limit reached"),
+	} {
+		assert.False(t, isConnectionError(err), "%v", err)
+	}
+}
+
+// brokenConn fails every write as a connection whose close was sent
+type brokenConn struct {
+	websocket.WsConn
+}
+
+func (brokenConn) WriteMessage(int, []byte) error { return gorillaws.ErrCloseSent }
+
+func TestTrackedConnKeepsTheWriteError(t *testing.T) {
+	conn := &trackedConn{WsConn: brokenConn{}}
+	err := websocket.SendWsRequest(conn, &model.JsonRpcResult{}, []byte(`{}`))
+	assert.Error(t, err)
+	assert.ErrorIs(t, conn.writeErr, gorillaws.ErrCloseSent)
+}
+
+func TestRPCReaderDetectsDroppedConnections(t *testing.T) {
+	upgrader := gorillaws.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	r := NewSubstrateRPCReader("polkadot", "polkadot", "ws"+strings.TrimPrefix(server.URL, "http"))
+	r.handshakeTimeout = 100 * time.Millisecond
+	defer r.closePool()
+	_, err := r.getBlockHash(1)
+	assert.True(t, isConnectionError(err), "%v", err)
+}
+
+func TestRPCReaderSharesConcurrentReconnects(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	r := newTestRPCReader(func(blockID int) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			calls := 0
+			err := r.withReconnect(context.Background(), 1, func() error {
+				calls++
+				if calls == 1 {
+					return recws.ErrNotConnected
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, maxRunning, "one reconnection at a time")
+}
+
+func TestRPCReaderClosesRetiredPoolAfterItsCalls(t *testing.T) {
+	server := newRPCEchoServer(t, "0xpolkadot")
+	r := NewSubstrateRPCReader("polkadot", "polkadot", "ws"+strings.TrimPrefix(server.URL, "http"))
+	r.handshakeTimeout = 100 * time.Millisecond
+	pool, err := r.acquirePool()
+	assert.NoError(t, err)
+
+	// a redial retires the pool while a call still runs on it
+	r.closePool()
+	conn, err := pool.Get()
+	assert.NoError(t, err, "the running call keeps its pool")
+	conn.MarkUnusable()
+	conn.Close()
+
+	next, err := r.acquirePool()
+	assert.NoError(t, err)
+	assert.NotSame(t, pool, next, "the next call gets a new pool")
+	r.releasePool(next)
+
+	r.releasePool(pool)
+	_, err = pool.Get()
+	assert.ErrorIs(t, err, websocket.ErrClosed, "the last call closes the retired pool")
+	r.closePool()
+}
+
+func TestRPCReaderCallsSurvivePoolSwaps(t *testing.T) {
+	server := newRPCEchoServer(t, "0xpolkadot")
+	r := NewSubstrateRPCReader("polkadot", "polkadot", "ws"+strings.TrimPrefix(server.URL, "http"))
+	r.handshakeTimeout = 100 * time.Millisecond
+	defer r.closePool()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				r.closePool()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	defer close(done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := r.getBlockHash(j); err != nil {
+					t.Errorf("call %d: %v", j, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
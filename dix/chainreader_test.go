@@ -2,10 +2,23 @@ package dix
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,6 +73,28 @@ func TestFetchHeadBlock(t *testing.T) {
 	}
 }
 
+func TestSidecarFinalizedHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blocks/head/header" || r.URL.Query().Get("finalized") != "true" {
+			t.Errorf("Expected request to /blocks/head/header?finalized=true, got %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"parentHash":"0x01","number":"12340","stateRoot":"0x02","extrinsicsRoot":"0x03","digest":{"logs":[]}}`)
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("relay", "chain", server.URL)
+	finalized, err := IndexableHeadID(reader, true)
+	if err != nil {
+		t.Fatalf("GetFinalizedHeadID returned an error: %v", err)
+	}
+	if finalized != 12340 {
+		t.Errorf("Expected finalized head 12340, got %d", finalized)
+	}
+}
+
 func TestCallSidecar(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +153,11 @@ func TestCallSidecar(t *testing.T) {
 func TestFetchBlockRange(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// blocks missing from the range response are fetched one by one
+		if id, ok := strings.CutPrefix(r.URL.Path, "/blocks/"); ok {
+			fmt.Fprintf(w, `{"number": "%s", "hash": "0xsingle%s"}`, id, id)
+			return
+		}
 		// Check if the request URL matches the expected pattern for block range
 		if r.URL.Path != "/blocks" {
 			t.Errorf("Expected request to '/blocks', got '%s'", r.URL.Path)
@@ -201,8 +241,8 @@ func TestFetchBlockRange(t *testing.T) {
 	}
 
 	// Check that we got the expected number of blocks
-	if len(blocks) != 3 {
-		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	if len(blocks) != 6 {
+		t.Fatalf("Expected 6 blocks, got %d", len(blocks))
 	}
 
 	// Check the first block
@@ -228,4 +268,399 @@ func TestFetchBlockRange(t *testing.T) {
 	if blocks[2].Hash != "0x1234567890abcdef3" {
 		t.Errorf("Expected third block Hash=0x1234567890abcdef3, got %s", blocks[2].Hash)
 	}
+
+	// The blocks the range did not return
+	if blocks[5].ID != "105" || blocks[5].Hash != "0xsingle105" {
+		t.Errorf("Expected block 105 to be fetched alone, got %s %s", blocks[5].ID, blocks[5].Hash)
+	}
+}
+
+func TestFetchBlockRangeRefetchesMissingBlocks(t *testing.T) {
+	var singles []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := strings.CutPrefix(r.URL.Path, "/blocks/"); ok {
+			singles = append(singles, id)
+			fmt.Fprintf(w, `{"number": "%s", "hash": "0x%s"}`, id, id)
+			return
+		}
+		// 101 is missing from the range
+		fmt.Fprintln(w, `[{"number": "100", "hash": "0x100"}, {"number": "102", "hash": "0x102"}]`)
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("relay", "chain", server.URL)
+	blocks, err := reader.FetchBlockRange(context.Background(), []int{100, 101, 102})
+	if err != nil {
+		t.Fatalf("FetchBlockRange returned an error: %v", err)
+	}
+	if len(singles) != 1 || singles[0] != "101" {
+		t.Errorf("Expected only block 101 to be fetched alone, got %v", singles)
+	}
+	ids := make(map[string]bool)
+	for _, block := range blocks {
+		ids[block.ID] = true
+	}
+	if len(blocks) != 3 || !ids["100"] || !ids["101"] || !ids["102"] {
+		t.Errorf("Expected blocks 100, 101 and 102, got %v", ids)
+	}
+}
+
+func TestFetchBlockRangeMissingBlockError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blocks" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, `[{"number": "100", "hash": "0x100"}]`)
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("relay", "chain", server.URL)
+	if _, err := reader.FetchBlockRange(context.Background(), []int{100, 101}); err == nil {
+		t.Error("Expected an error rather than a partial batch")
+	}
+}
+
+// rangeResponse returns the range response of the blocks first to last, each
+// padded with padding bytes of logs, malformed replacing block bad when set
+func rangeResponse(first, last, padding int, bad string) []io.Reader {
+	parts := []io.Reader{strings.NewReader("[")}
+	logs := strings.Repeat("x", padding)
+	for id := first; id <= last; id++ {
+		sep := ","
+		if id == last {
+			sep = "]"
+		}
+		block := fmt.Sprintf(`{"number": "%d", "hash": "0x%x", "logs": ["%s"]}`, id, id, logs)
+		if bad != "" && id == first+3 {
+			block = bad
+		}
+		parts = append(parts, strings.NewReader(block+sep))
+	}
+	return parts
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestFetchBlockRangeLargeRange(t *testing.T) {
+	const first, last = 1000, 5999
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("range") != fmt.Sprintf("%d-%d", first, last) {
+			t.Errorf("Expected a range query, got %s", r.URL.String())
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		io.Copy(w, io.MultiReader(rangeResponse(first, last, 1024, "")...))
+	}))
+	defer server.Close()
+
+	blockIDs := make([]int, 0, last-first+1)
+	for id := first; id <= last; id++ {
+		blockIDs = append(blockIDs, id)
+	}
+	reader := NewSidecar("relay", "chain", server.URL)
+	blocks, err := reader.FetchBlockRange(context.Background(), blockIDs)
+	if err != nil {
+		t.Fatalf("FetchBlockRange returned an error: %v", err)
+	}
+	if len(blocks) != len(blockIDs) {
+		t.Fatalf("Expected %d blocks, got %d", len(blockIDs), len(blocks))
+	}
+	for i, block := range blocks {
+		id := blockIDs[i]
+		if block.ID != fmt.Sprint(id) || block.Hash != fmt.Sprintf("0x%x", id) || len(block.Logs) != 1024+4 {
+			t.Fatalf("Unexpected block %d: %s %s with %d bytes of logs", id, block.ID, block.Hash, len(block.Logs))
+		}
+	}
+
+	// the size guard still applies to a streamed response
+	reader.SetMaxResponseBytes(1 << 20)
+	if _, err := reader.FetchBlockRange(context.Background(), blockIDs); err == nil || !strings.Contains(err.Error(), "exceeds 1048576 bytes") {
+		t.Errorf("Expected the response size guard to trigger, got %v", err)
+	}
+}
+
+func TestDecodeBlockRangeStreams(t *testing.T) {
+	// about 5 MB of blocks, the fourth one is malformed
+	body := &countingReader{r: io.MultiReader(rangeResponse(100, 5099, 1024, `{"number": "103", "hash": 42}`)...)}
+	_, err := decodeBlockRange(body, 5000)
+	if err == nil || !strings.Contains(err.Error(), "block 3 of the range") {
+		t.Fatalf("Expected block 3 to be reported malformed, got %v", err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected the decoding error to be kept, got %T", errors.Unwrap(err))
+	}
+	// blocks are decoded as they are read, the error is found early
+	if body.n > 64<<10 {
+		t.Errorf("Expected the decoding to stop after the malformed block, read %d bytes", body.n)
+	}
+
+	for name, data := range map[string]string{
+		"truncated":     `[{"number": "100"}, {"number": "10`,
+		"not an array":  `{"number": "100"}`,
+		"trailing data": `[{"number": "100"}] [{"number": "101"}]`,
+		"empty":         ``,
+	} {
+		if blocks, err := decodeBlockRange(strings.NewReader(data), 2); err == nil {
+			t.Errorf("%s: expected an error, got %d blocks", name, len(blocks))
+		}
+	}
+
+	blocks, err := decodeBlockRange(strings.NewReader("null\n"), 2)
+	if err != nil || len(blocks) != 0 {
+		t.Errorf("Expected null to decode as no blocks, got %v, %v", blocks, err)
+	}
+}
+
+func TestSidecarGetRuntimeVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/runtime/spec" || r.URL.Query().Get("at") != "42" {
+			t.Errorf("Expected request to /runtime/spec?at=42, got %s", r.URL.String())
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{
+			"at": {"height": "42", "hash": "0x42"},
+			"authoringVersion": "0",
+			"transactionVersion": "26",
+			"implVersion": "0",
+			"specName": "polkadot",
+			"specVersion": "1003000",
+			"stateVersion": "1"
+		}`)
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("polkadot", "polkadot", server.URL)
+	runtime, err := reader.GetRuntimeVersion(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("GetRuntimeVersion returned an error: %v", err)
+	}
+	if runtime.SpecName != "polkadot" || runtime.SpecVersion != 1003000 || runtime.TransactionVersion != 26 {
+		t.Errorf("Unexpected runtime version: %+v", runtime)
+	}
+}
+
+func TestSidecarMaxResponseBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a block padded well past the limit
+		fmt.Fprintf(w, `{"number": "100", "logs": "%s"}`, strings.Repeat("x", 4096))
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("relay", "chain", server.URL)
+	reader.SetMaxResponseBytes(1024)
+	_, err := reader.FetchBlock(context.Background(), 100)
+	if err == nil || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Fatalf("Expected the response size guard to trigger, got %v", err)
+	}
+
+	reader.SetMaxResponseBytes(0)
+	if _, err := reader.FetchBlock(context.Background(), 100); err != nil {
+		t.Errorf("Default limit should accept the response, got %v", err)
+	}
+}
+
+func TestValidateSidecarSubstrateURL(t *testing.T) {
+	config := ParaChainConfig{NodeIP: "10.0.0.5", PortWS: 9945, PortRPC: 9946}
+
+	if got := SidecarSubstrateURL(config); got != "ws://10.0.0.5:9946" {
+		t.Errorf("Expected ws://10.0.0.5:9946, got %s", got)
+	}
+	if err := ValidateSidecarSubstrateURL(config, SidecarSubstrateURL(config)); err != nil {
+		t.Errorf("Expected the generated url to be valid, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		config ParaChainConfig
+		want   string
+	}{
+		{"ws port", "ws://10.0.0.5:9945", config, "port_ws"},
+		{"other port", "ws://10.0.0.5:9000", config, "does not match port_rpc"},
+		{"http scheme", "http://10.0.0.5:9946", config, "ws or wss"},
+		{"no port", "ws://10.0.0.5", config, "no port"},
+		{"no rpc port", "ws://10.0.0.5:9946", ParaChainConfig{PortWS: 9945}, "port_rpc is not set"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateSidecarSubstrateURL(tc.config, tc.url)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSidecarSendsHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BlockData{ID: "42"})
+	}))
+	defer server.Close()
+
+	headers := ChainreaderHeaders(ParaChainConfig{
+		ChainreaderUserAgent: "dotidx-test/1.0",
+		ChainreaderToken:     "s3cret",
+		ChainreaderHeaders:   map[string]string{"X-Rate-Class": "indexer"},
+	})
+	reader := NewSidecar("polkadot", "polkadot", server.URL)
+	reader.SetHeaders(headers)
+	if _, err := reader.GetChainHeadID(); err != nil {
+		t.Fatalf("GetChainHeadID: %v", err)
+	}
+
+	expected := map[string]string{
+		"User-Agent":    "dotidx-test/1.0",
+		"Authorization": "Bearer s3cret",
+		"X-Rate-Class":  "indexer",
+	}
+	for name, value := range expected {
+		if got := received.Get(name); got != value {
+			t.Errorf("Header %s: expected %q, got %q", name, value, got)
+		}
+	}
+
+	redacted := RedactHeaders(headers)
+	if got := redacted.Get("Authorization"); strings.Contains(got, "s3cret") {
+		t.Errorf("Authorization is not redacted: %q", got)
+	}
+	if headers.Get("Authorization") != "Bearer s3cret" {
+		t.Errorf("RedactHeaders changed its argument")
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key
+// as PEM files and returns their paths with the certificate itself
+func writeClientCertificate(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dotidx-indexer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error encoding key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestSidecarClientCertificate(t *testing.T) {
+	certFile, keyFile, clientCert := writeClientCertificate(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "dotidx-indexer" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(BlockData{ID: "7"})
+	}))
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a certificate the handshake fails
+	if _, err := NewSidecar("polkadot", "polkadot", server.URL).GetChainHeadID(); err == nil {
+		t.Errorf("Expected the server to require a client certificate")
+	}
+
+	reader := NewSidecar("polkadot", "polkadot", server.URL)
+	err := ConfigureSidecar(reader, ParaChainConfig{ChainreaderCert: certFile, ChainreaderKey: keyFile, ChainreaderCA: caFile})
+	if err != nil {
+		t.Fatalf("ConfigureSidecar: %v", err)
+	}
+	head, err := reader.GetChainHeadID()
+	if err != nil {
+		t.Fatalf("GetChainHeadID: %v", err)
+	}
+	if head != 7 {
+		t.Errorf("Expected head 7, got %d", head)
+	}
+
+	if err := reader.SetClientCertificate(filepath.Join(t.TempDir(), "missing.crt"), keyFile, ""); err == nil {
+		t.Errorf("Expected a missing certificate to be rejected")
+	}
+}
+
+func TestFetchBlockURLStyle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/blocks/7":
+			fmt.Fprintln(w, `{"number": "7", "hash": "0x07"}`)
+		case r.URL.Path == "/blocks" && r.URL.Query().Get("id") == "7":
+			// this sidecar names the block number id
+			fmt.Fprintln(w, `{"id": "7", "hash": "0x07"}`)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("relay", "chain", server.URL)
+	for _, style := range []BlockURLStyle{"", BlockURLPath, BlockURLQuery} {
+		if err := reader.SetBlockURLStyle(style); err != nil {
+			t.Fatalf("SetBlockURLStyle(%q): %v", style, err)
+		}
+		block, err := reader.FetchBlock(context.Background(), 7)
+		if err != nil {
+			t.Fatalf("FetchBlock with style %q: %v", style, err)
+		}
+		if block.ID != "7" || block.Hash != "0x07" {
+			t.Errorf("Expected block 7 with style %q, got %+v", style, block)
+		}
+	}
+
+	if err := ConfigureSidecar(reader, ParaChainConfig{ChainreaderBlockURL: "fragment"}); err == nil {
+		t.Error("Expected an unknown block url style to be rejected")
+	}
 }
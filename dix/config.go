@@ -2,11 +2,9 @@ package dix
 
 import (
 	"flag"
-	"fmt"
 	"net"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -18,6 +16,7 @@ type Config struct {
 	BatchSize      int
 	MaxWorkers     int
 	FlushTimeout   time.Duration
+	FlushBytes     int64
 	Relaychain     string
 	Chain          string
 	Live           bool
@@ -39,17 +38,38 @@ func checkPortFollowConvention(chainreaderUrl string, expectedPort int) bool {
 	return iport == expectedPort
 }
 
+// conventionalSidecarPort returns the port of the sidecar of a polkadot
+// chain, 0 for the chains without one
+func conventionalSidecarPort(chain string) int {
+	switch chain {
+	case "polkadot":
+		return 10800
+	case "assethub":
+		return 10900
+	case "people":
+		return 11000
+	case "collectives":
+		return 11100
+	case "mythos":
+		return 11200
+	case "frequency":
+		return 11300
+	}
+	return 0
+}
+
 func ParseFlags() (Config, error) {
 
 	chainReaderURL := flag.String("chainreader", "", "Chain reader URL: sidecar or go")
 	databaseURL := flag.String("database", "", "Database URL")
 
-	startRange := flag.Int("start", 1, "Start of the integer range")
+	startRange := flag.Int("start", GenesisBlockID, "Start of the integer range, the genesis block by default")
 	endRange := flag.Int("end", -1, "End of the integer range. If not set head of the chain block id will be used")
 
 	batchSize := flag.Int("batch", 10, "Number of items to collect before writing to database")
 	maxWorkers := flag.Int("workers", 5, "Maximum number of concurrent workers")
 	flushTimeout := flag.Duration("flush", 30*time.Second, "Maximum time to wait before flushing data to database")
+	flushBytes := flag.Int64("flush-bytes", DefaultFlushBytes, "Maximum estimated size of the blocks written to database at once")
 
 	relaychain := flag.String("relaychain", "Polkadot", "Relaychain name")
 	chain := flag.String("chain", "", "Chain name")
@@ -61,34 +81,7 @@ func ParseFlags() (Config, error) {
 	frontendStatic := flag.String("frontend-static", "static", "path to the static html/css/js files of the frontend")
 	flag.Parse()
 
-	// add some checks here to minimise risk of writing to the wrong database
-	if *chainReaderURL != "" {
-		if strings.ToLower(*relaychain) == "polkadot" {
-			expectedPort := 0
-			switch strings.ToLower(*chain) {
-			case "polkadot":
-				expectedPort = 10800
-			case "assethub":
-				expectedPort = 10900
-			case "people":
-				expectedPort = 11000
-			case "collectives":
-				expectedPort = 11100
-			case "mythos":
-				expectedPort = 11200
-			case "frequency":
-				expectedPort = 11300
-			}
-			if !checkPortFollowConvention(*chainReaderURL, expectedPort) {
-				return Config{}, fmt.Errorf("%s:%s sidecar port should be %d got %s",
-					strings.ToLower(*relaychain),
-					strings.ToLower(*chain),
-					10800, *chainReaderURL)
-			}
-		}
-	}
-
-	return Config{
+	config := Config{
 		StartRange:     *startRange,
 		EndRange:       *endRange,
 		ChainReaderURL: *chainReaderURL,
@@ -96,11 +89,16 @@ func ParseFlags() (Config, error) {
 		BatchSize:      *batchSize,
 		MaxWorkers:     *maxWorkers,
 		FlushTimeout:   *flushTimeout,
+		FlushBytes:     *flushBytes,
 		Relaychain:     *relaychain,
 		Chain:          *chain,
 		Live:           *live,
 		FrontendIP:     *frontendIP,
 		FrontendPort:   *frontendPort,
 		FrontendStatic: *frontendStatic,
-	}, nil
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
 }
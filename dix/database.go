@@ -4,17 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"log"
 	"maps"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
+	"github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type DatabaseInfo struct {
@@ -36,6 +42,14 @@ type Database interface {
 	ReadTimeNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) (time.Time, error)
 	ExecuteNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) (SqlResult, error)
 	ExecuteAndStoreNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) error
+	RollupYear(ctx context.Context, relayChain, chain, queryName string, year int) (int, error)
+	MissingCurrentPartitions(now time.Time) ([]DatabaseInfo, error)
+	ReadSchemaVersion() (int, error)
+	SaveRuntimeSpec(relayChain, chain string, blockID int, runtime RuntimeVersion) error
+	GetRuntimeSpecAt(relayChain, chain string, blockID int) (RuntimeVersion, int, error)
+	SaveRuntimeUpgrade(relayChain, chain string, upgrade RuntimeUpgrade, timestamp string) error
+	GetRuntimeUpgrades(relayChain, chain string) ([]RuntimeUpgrade, error)
+	QuarantineParentHashMismatches(blocks []BlockData, mismatches []ParentHashMismatch, relayChain, chain string) error
 }
 
 // DBPoolConfig contains the configuration for the database connection pool
@@ -46,13 +60,24 @@ type DBPoolConfig struct {
 	ConnMaxIdleTime time.Duration // Maximum idle time of a connection
 }
 
-const schemaName = "chain"
 const fastTablespaceRoot = "fast"
 const fastTablespaceNumber = 4
 const slowTablespaceRoot = "slow"
 const slowTablespaceNumber = 6
-const SQLDatabaseSchemaVersion = 2
-const monthlyQueryResultsTable = "chain.dotidx_monthly_query_results"
+const SQLDatabaseSchemaVersion = 3
+
+// TablespacePaths returns the directories of the fast and slow tablespaces
+// created under root by pg.sql.tmpl
+func TablespacePaths(root string) []string {
+	paths := make([]string, 0, fastTablespaceNumber+slowTablespaceNumber)
+	for i := range fastTablespaceNumber {
+		paths = append(paths, filepath.Join(root, fmt.Sprintf("%s%d", fastTablespaceRoot, i)))
+	}
+	for i := range slowTablespaceNumber {
+		paths = append(paths, filepath.Join(root, fmt.Sprintf("%s%d", slowTablespaceRoot, i)))
+	}
+	return paths
+}
 
 // DBDialect represents the type of database
 type DBDialect string
@@ -67,6 +92,28 @@ type SQLDatabase struct {
 	dialect DBDialect
 	metrics *Metrics
 	poolCfg DBPoolConfig
+	// number of hash partitions of the address2blocks tables
+	addressPartitions int
+	// years of blocks partitions kept on the fast tablespaces
+	fastYears int
+	// log the statements which failed, see LogSQL
+	debugSQL bool
+	// blocks saved with a best-effort timestamp, see blockTimestamps
+	timestampFallbacks atomic.Int64
+	// saved blocks which were new and which were rewritten
+	blocksInserted atomic.Int64
+	blocksUpdated  atomic.Int64
+	// blocks saved without addresses, see isMissingPartition
+	blocksWithoutAddresses atomic.Int64
+	// blocks moved to failed_blocks, see quarantineInvalidBlocks
+	blocksQuarantined atomic.Int64
+	// relay:chain saved without their addresses, see SetSkipAddresses
+	skipAddresses map[string]bool
+	// highest block committed per relay:chain
+	maxSavedMu sync.Mutex
+	maxSaved   map[string]int
+	// committed blocks and addresses are published there when set
+	bus *EventBus
 }
 
 type NamedQuery struct {
@@ -76,10 +123,16 @@ type NamedQuery struct {
 }
 
 type NamedQueryParameters struct {
+	// Schema is set to the schema of the dotidx tables when rendering
+	Schema     string
 	Relaychain string
 	Chain      string
 	Year       int
 	Month      int
+	// StartDate and EndDate are set for range queries only, EndDate is
+	// excluded, templates use {{.StartDate.Format "2006-01-02"}}
+	StartDate time.Time
+	EndDate   time.Time
 }
 
 type SqlResult []map[string]interface{}
@@ -89,22 +142,86 @@ var (
 	registryMutex = &sync.RWMutex{}
 )
 
+// sampleQueryParameters fill every template field when checking a query
+func sampleQueryParameters(relayChain, chain string) NamedQueryParameters {
+	return NamedQueryParameters{
+		Relaychain: relayChain,
+		Chain:      chain,
+		Year:       2024,
+		Month:      1,
+		StartDate:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func renderNamedQuery(tmpl *template.Template, parameters NamedQueryParameters) (string, error) {
+	parameters.Schema = schemaName
+	var sqlBuilder strings.Builder
+	if err := tmpl.Execute(&sqlBuilder, parameters); err != nil {
+		return "", err
+	}
+	return sqlBuilder.String(), nil
+}
+
+// parseNamedQuery parses the template and renders it once so that a
+// reference to an unknown parameter fails here rather than when it runs
+func parseNamedQuery(name, sqlTemplate string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(sqlTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderNamedQuery(tmpl, sampleQueryParameters("polkadot", "polkadot")); err != nil {
+		return nil, fmt.Errorf("error rendering query '%s': %w", name, err)
+	}
+	return tmpl, nil
+}
+
 func RegisterQuery(name, sqlTemplate, description string) error {
+	tmpl, err := parseNamedQuery(name, sqlTemplate)
+	if err != nil {
+		return err
+	}
+	if err := registerNamedQuery(name, tmpl, description); err != nil {
+		return err
+	}
+	log.Printf("Registered query: %s - %s", name, description)
+	return nil
+}
+
+// RegisterCheckedQuery registers a query after the database accepted its
+// SQL, rendered for relayChain and chain, in an EXPLAIN
+func (s *SQLDatabase) RegisterCheckedQuery(ctx context.Context, relayChain, chain, name, sqlTemplate, description string) error {
+	tmpl, err := parseNamedQuery(name, sqlTemplate)
+	if err != nil {
+		return err
+	}
+	sqlString, err := renderNamedQuery(tmpl, sampleQueryParameters(relayChain, chain))
+	if err != nil {
+		return fmt.Errorf("error rendering query '%s': %w", name, err)
+	}
+	rows, err := s.db.QueryContext(ctx, "EXPLAIN "+sqlString)
+	if err != nil {
+		return fmt.Errorf("invalid SQL in query '%s': %w", name, err)
+	}
+	rows.Close()
+	if err := registerNamedQuery(name, tmpl, description); err != nil {
+		return err
+	}
+	log.Printf("Registered query: %s - %s", name, description)
+	return nil
+}
+
+func registerNamedQuery(name string, tmpl *template.Template, description string) error {
 	registryMutex.Lock()
 	defer registryMutex.Unlock()
 	if _, exists := queryRegistry[name]; exists {
 		return fmt.Errorf("query with name '%s' already registered", name)
 	}
-	tmpl, err := template.New(name).Parse(sqlTemplate)
-	if err != nil {
-		return err
-	}
 	queryRegistry[name] = NamedQuery{
 		Name:        name,
 		SQLTemplate: tmpl,
 		Description: description,
 	}
-	log.Printf("Registered query: %s - %s", name, description)
 	return nil
 }
 
@@ -119,24 +236,39 @@ func (s *SQLDatabase) getTableName(tableName string) string {
 
 func GetBlocksTableName(relayChain, chain string) string {
 	chainName := sanitizeChainName(relayChain, chain)
-	return fmt.Sprintf("%s.blocks_%s_%s", schemaName, strings.ToLower(relayChain), chainName)
+	return fmt.Sprintf("%s.blocks_%s_%s", schemaName, sanitizeRelayChainName(relayChain), chainName)
 }
 
 func GetBlocksPrimaryKeyName(relayChain, chain string) string {
 	chainName := sanitizeChainName(relayChain, chain)
-	return fmt.Sprintf("blocks_%s_%s", strings.ToLower(relayChain), chainName)
+	return fmt.Sprintf("blocks_%s_%s", sanitizeRelayChainName(relayChain), chainName)
 }
 
 func GetAddressTableName(relayChain, chain string) string {
 	chainName := sanitizeChainName(relayChain, chain)
-	return fmt.Sprintf("%s.address2blocks_%s_%s", schemaName, strings.ToLower(relayChain), chainName)
+	return fmt.Sprintf("%s.address2blocks_%s_%s", schemaName, sanitizeRelayChainName(relayChain), chainName)
 }
 
 func GetStatsPerMonthTableName(relayChain, chain string) string {
 	chainName := sanitizeChainName(relayChain, chain)
-	return fmt.Sprintf("%s.stats_per_month_%s_%s", schemaName, strings.ToLower(relayChain), chainName)
+	return fmt.Sprintf("%s.stats_per_month_%s_%s", schemaName, sanitizeRelayChainName(relayChain), chainName)
+}
+
+// sanitizeRelayChainName returns the relay chain part of the table names,
+// in lower case and reduced to [a-z0-9]
+func sanitizeRelayChainName(relayChain string) string {
+	var result strings.Builder
+	for _, char := range strings.ToLower(relayChain) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') {
+			result.WriteRune(char)
+		}
+	}
+	return result.String()
 }
 
+// sanitizeChainName returns the chain part of the table names: chain in
+// lower case, reduced to [a-z0-9] and without the relay chain name, so
+// kusama/kusama-assethub gives assethub. The relay chain keeps its name.
 func sanitizeChainName(initialRelaychainName, initialChainName string) string {
 	chainName := strings.ToLower(initialChainName)
 	relaychainName := strings.ToLower(initialRelaychainName)
@@ -155,6 +287,29 @@ func sanitizeChainName(initialRelaychainName, initialChainName string) string {
 	return chainName
 }
 
+// CheckTableNameCollisions errors when two configured chains would share
+// their tables once their names are sanitized
+func CheckTableNameCollisions(parachains map[string]map[string]ParaChainConfig) error {
+	relays := slices.Sorted(maps.Keys(parachains))
+	owners := make(map[string]string)
+	collisions := make([]string, 0)
+	for _, relay := range relays {
+		for _, chain := range slices.Sorted(maps.Keys(parachains[relay])) {
+			table := GetBlocksTableName(relay, chain)
+			owner := fmt.Sprintf("%s:%s", relay, chain)
+			if other, ok := owners[table]; ok {
+				collisions = append(collisions, fmt.Sprintf("%s and %s both map to %s", other, owner, table))
+				continue
+			}
+			owners[table] = owner
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("table name collision: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
 func DefaultDBPoolConfig() DBPoolConfig {
 	return DBPoolConfig{
 		MaxOpenConns:    25,
@@ -164,6 +319,37 @@ func DefaultDBPoolConfig() DBPoolConfig {
 	}
 }
 
+// DBPoolConfigFromMgrConfig returns the default pool with the overrides of
+// the [dotidx_db] section
+func DBPoolConfigFromMgrConfig(config MgrConfig) DBPoolConfig {
+	poolCfg := DefaultDBPoolConfig()
+	if config.DotidxDB.MaxOpenConns > 0 {
+		poolCfg.MaxOpenConns = config.DotidxDB.MaxOpenConns
+		poolCfg.MaxIdleConns = min(poolCfg.MaxIdleConns, poolCfg.MaxOpenConns)
+	}
+	return poolCfg
+}
+
+// EffectiveWorkers returns the number of workers the indexer should run.
+// Every worker writes to the database, running more workers than pooled
+// connections only makes them wait on each other, so workers are capped to
+// the pool size and capped reports it. With no workers configured the pool
+// size is used. SQLite serialises writes anyway and is left alone.
+func EffectiveWorkers(config MgrConfig) (workers int, capped bool) {
+	workers = config.DotidxBatch.MaxWorkers
+	if strings.EqualFold(config.DotidxDB.Type, "sqlite") {
+		return workers, false
+	}
+	maxOpenConns := DBPoolConfigFromMgrConfig(config).MaxOpenConns
+	if workers <= 0 {
+		return maxOpenConns, false
+	}
+	if workers > maxOpenConns {
+		return maxOpenConns, true
+	}
+	return workers, false
+}
+
 func NewSQLDatabaseWithDB(db *sql.DB) *SQLDatabase {
 	return NewSQLDatabaseWithPoolAndDialect(
 		db,
@@ -192,7 +378,54 @@ func NewSQLDatabase(config MgrConfig) *SQLDatabase {
 	if err != nil {
 		log.Fatalf("Error opening database: %v", err)
 	}
-	return NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), dialect)
+	s := NewSQLDatabaseWithPoolAndDialect(db, DBPoolConfigFromMgrConfig(config), dialect)
+	s.SetAddressPartitions(config.DotidxDB.AddressPartitions)
+	s.SetFastYears(config.DotidxDB.FastYears)
+	s.SetDebugSQL(config.DotidxDB.DebugSQL)
+	for relay, chains := range config.Parachains {
+		for chain, chainConfig := range chains {
+			s.SetSkipAddresses(relay, chain, chainConfig.SkipAddresses)
+		}
+	}
+	return s
+}
+
+// SetSkipAddresses makes Save write the blocks of relayChain:chain without
+// extracting their addresses, for chains indexed for their blocks only. It
+// must be called before the first Save.
+func (s *SQLDatabase) SetSkipAddresses(relayChain, chain string, skip bool) {
+	if s.skipAddresses == nil {
+		s.skipAddresses = make(map[string]bool)
+	}
+	s.skipAddresses[relayChain+":"+chain] = skip
+}
+
+// SetAddressPartitions sets the number of hash partitions of the
+// address2blocks tables created from now on, 0 or less restores one
+// partition per fast tablespace. It does not repartition existing tables:
+// those keep the modulus of their partitions, see addressPartitionModulus.
+func (s *SQLDatabase) SetAddressPartitions(n int) {
+	if n <= 0 {
+		n = fastTablespaceNumber
+	}
+	if n%fastTablespaceNumber != 0 {
+		log.Printf("warning: address_partitions %d does not spread evenly over the %d fast tablespaces",
+			n, fastTablespaceNumber)
+	}
+	s.addressPartitions = n
+}
+
+// SetFastYears sets how many years of blocks partitions, the current one
+// included, go to the fast tablespaces, 0 or less restores the current year
+// only. The partitions already created move with dixpartitions -rebalance.
+func (s *SQLDatabase) SetFastYears(n int) {
+	s.fastYears = max(n, 1)
+}
+
+// FastYears returns the years of blocks partitions kept on the fast
+// tablespaces
+func (s *SQLDatabase) FastYears() int {
+	return s.fastYears
 }
 
 // NewSQLDatabaseWithPool creates a new Database instance with custom connection pool settings
@@ -221,10 +454,12 @@ func NewSQLDatabaseWithPoolAndDialect(db *sql.DB, poolCfg DBPoolConfig, dialect
 	}
 
 	s := &SQLDatabase{
-		db:      db,
-		dialect: dialect,
-		metrics: NewMetrics(metricsName),
-		poolCfg: poolCfg,
+		db:                db,
+		dialect:           dialect,
+		metrics:           NewMetrics(metricsName),
+		poolCfg:           poolCfg,
+		addressPartitions: fastTablespaceNumber,
+		fastYears:         1,
 	}
 
 	return s
@@ -234,6 +469,8 @@ func (s *SQLDatabase) Close() error {
 	return s.db.Close()
 }
 
+// DoUpgrade brings the shared tables to SQLDatabaseSchemaVersion and records
+// it in dotidx_version
 func (s *SQLDatabase) DoUpgrade() error {
 	// create dotidx version table to track migrations
 	var createVersionTableSQL string
@@ -262,9 +499,42 @@ CREATE TABLE IF NOT EXISTS dotidx_version (
 		return fmt.Errorf("error creating monthly query results table: %w", err)
 	}
 
+	if err := s.CreateTableRangeQueryResults(); err != nil {
+		return fmt.Errorf("error creating range query results table: %w", err)
+	}
+
+	if err := s.CreateTableFailedBlocks(); err != nil {
+		return fmt.Errorf("error creating failed blocks table: %w", err)
+	}
+
+	if err := s.CreateTableWatchedAddresses(); err != nil {
+		return fmt.Errorf("error creating watched addresses table: %w", err)
+	}
+
+	nowFunc := "NOW()"
+	if s.dialect == DialectSQLite {
+		nowFunc = "datetime('now')"
+	}
+	recordVersionSQL := s.prepareQuery(fmt.Sprintf(
+		"INSERT INTO dotidx_version (version_id, timestamp) VALUES ($1, %s) ON CONFLICT (version_id) DO NOTHING;",
+		nowFunc))
+	if _, err := s.db.Exec(recordVersionSQL, SQLDatabaseSchemaVersion); err != nil {
+		return fmt.Errorf("error recording schema version %d: %w", SQLDatabaseSchemaVersion, err)
+	}
+
 	return nil
 }
 
+// ReadSchemaVersion returns the highest version recorded in dotidx_version,
+// 0 when none is
+func (s *SQLDatabase) ReadSchemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRow("SELECT MAX(version_id) FROM dotidx_version;").Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading dotidx_version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
 func (s *SQLDatabase) CreateTableBlocks(relayChain, chain string) error {
 	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
 	blocksPK := GetBlocksPrimaryKeyName(relayChain, chain)
@@ -332,61 +602,49 @@ func (s *SQLDatabase) CreateTableBlocksPartitions(relayChain, chain, firstTimest
 	blocksTable := GetBlocksTableName(relayChain, chain)
 
 	// kusame stated oct 2019
-	firstYear, firstMonth := 2019, 9
+	firstYear, firstMonth := 2019, time.October
 	if relayChain == "polkadot" {
-		firstYear, firstMonth = 2020, 04
+		firstYear, firstMonth = 2020, time.May
 	}
 	if firstTimestamp != "" {
-		firstTime, err := time.Parse("2020-01-01 00:00:00", firstTimestamp)
+		// the fractional seconds of createdAtLayout are accepted as well
+		firstTime, err := time.Parse(time.DateTime, firstTimestamp)
 		if err == nil {
-			_, firstMonthAsMonth, _ := firstTime.Date()
-			firstMonth = int(firstMonthAsMonth) - 1
+			firstYear, firstMonth, _ = firstTime.Date()
 		}
 	}
 
-	// Spread by month across the partition
-	slow := 0
-	fast := 0
-	slowOrFast := ""
-	for yearIdx := range 6 {
-		year := firstYear + yearIdx
-		if year >= time.Now().Year() {
-			slowOrFast = fmt.Sprintf("%s%d", fastTablespaceRoot, fast)
-			fast = min(fast+1, fastTablespaceNumber-1)
-		} else {
-			slowOrFast = fmt.Sprintf("%s%d", slowTablespaceRoot, slow)
-			slow = min(slow+1, slowTablespaceNumber-1)
-		}
-		for month := range 12 {
+	// Spread by month across the partition, up to the end of next year so
+	// that calling it again extends the table
+	now := time.Now()
+	lastYear := max(firstYear+5, now.Year()+1)
+	for year := firstYear; year <= lastYear; year++ {
+		tablespace := blocksPartitionTablespace(firstYear, year, s.fastYears, now)
+		for month := time.January; month <= time.December; month++ {
 			// skip tables if no data
-			if year < firstYear || (year == firstYear && month < firstMonth) {
+			if year == firstYear && month < firstMonth {
 				continue
 			}
-			from_date := fmt.Sprintf("%04d-%02d-01 00:00:00.0000", year, month+1)
-			to_date := fmt.Sprintf("%04d-%02d-01 00:00:00.0000", year, month+2)
-			if month == 11 {
-				to_date = fmt.Sprintf("%04d-%02d-01 00:00:00.0000", year+1, 1)
-			}
+			partition := BlocksPartitionOf(blocksTable, time.Date(year, month, 1, 0, 0, 0, 0, time.UTC))
+			from, to := partition.Bounds()
 			parts := fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %[1]s_%04[2]d_%02[3]d PARTITION OF %[1]s
-  FOR VALUES FROM (timestamp '%[5]s') TO (timestamp '%[6]s')
-  TABLESPACE dotidx_%[7]s;
-ALTER TABLE IF EXISTS %[1]s_%04[2]d_%02[3]d OWNER to dotidx;
-REVOKE ALL ON TABLE %[1]s_%04[2]d_%02[3]d FROM PUBLIC;
-GRANT SELECT ON TABLE %[1]s_%04[2]d_%02[3]d TO PUBLIC;
-GRANT ALL ON TABLE %[1]s_%04[2]d_%02[3]d TO dotidx;
+CREATE TABLE IF NOT EXISTS %[1]s PARTITION OF %[2]s
+  FOR VALUES FROM (timestamp '%[3]s') TO (timestamp '%[4]s')
+  TABLESPACE %[5]s;
+ALTER TABLE IF EXISTS %[1]s OWNER to dotidx;
+REVOKE ALL ON TABLE %[1]s FROM PUBLIC;
+GRANT SELECT ON TABLE %[1]s TO PUBLIC;
+GRANT ALL ON TABLE %[1]s TO dotidx;
 	`,
-				blocksTable, // 1
-				year,        // 2
-				month+1,     // 3
-				month+2,     // 4
-				from_date,   // 5
-				to_date,     // 6
-				slowOrFast,  // 7
+				partition.Name,               // 1
+				blocksTable,                  // 2
+				from.Format(createdAtLayout), // 3
+				to.Format(createdAtLayout),   // 4
+				tablespace,                   // 5
 			)
 			_, err := s.db.Exec(parts)
 			if err != nil {
-				log.Printf("sql %s", parts)
+				s.LogSQL(parts)
 				return fmt.Errorf("error creating blocks partition table: %w", err)
 			}
 		}
@@ -423,7 +681,7 @@ GRANT ALL ON TABLE %[1]s TO dotidx;
 
 	_, err := s.db.Exec(template)
 	if err != nil {
-		log.Printf("sql %s", template)
+		s.LogSQL(template)
 		return fmt.Errorf("error creating address2blocks table: %w", err)
 	}
 
@@ -438,24 +696,37 @@ func (s *SQLDatabase) CreateTableAddress2BlocksPartitions(relayChain, chain stri
 
 	address2blocksTable := GetAddressTableName(relayChain, chain)
 
-	// spread across fast disks to improve access time
-	for fast := range fastTablespaceNumber {
+	modulus, err := s.addressPartitionModulus(address2blocksTable)
+	if err != nil {
+		return err
+	}
+	if modulus == 0 {
+		modulus = s.addressPartitions
+	} else if modulus != s.addressPartitions {
+		log.Printf("warning: %s is partitioned with modulus %d, keeping it instead of address_partitions %d",
+			address2blocksTable, modulus, s.addressPartitions)
+	}
+
+	// spread across fast disks to improve access time, partitions cycle
+	// through the tablespaces when there are more partitions than disks
+	for remainder := range modulus {
 		parts := fmt.Sprintf(`
 CREATE TABLE IF NOT EXISTS %[1]s_%1[2]d PARTITION OF %[1]s
   FOR VALUES WITH (modulus %[3]d, remainder %[2]d)
-  TABLESPACE dotidx_fast%[2]d;
+  TABLESPACE dotidx_fast%[4]d;
 ALTER TABLE IF EXISTS %[1]s_%1[2]d OWNER to dotidx;
 REVOKE ALL ON TABLE %[1]s_%1[2]d FROM PUBLIC;
 GRANT SELECT ON TABLE %[1]s_%1[2]d TO PUBLIC;
 GRANT ALL ON TABLE %[1]s_%1[2]d TO dotidx;
 	`,
-			address2blocksTable,  // 1
-			fast,                 // 2
-			fastTablespaceNumber, // 3
+			address2blocksTable,            // 1
+			remainder,                      // 2
+			modulus,                        // 3
+			remainder%fastTablespaceNumber, // 4
 		)
 		_, err := s.db.Exec(parts)
 		if err != nil {
-			log.Printf("sql %s", parts)
+			s.LogSQL(parts)
 			return fmt.Errorf("error creating partitions for address2blocks: %w", err)
 		}
 	}
@@ -463,6 +734,21 @@ GRANT ALL ON TABLE %[1]s_%1[2]d TO dotidx;
 	return nil
 }
 
+// addressPartitionModulus returns the modulus of the hash partitions of the
+// address2blocks table, 0 when the table has none yet
+func (s *SQLDatabase) addressPartitionModulus(table string) (int, error) {
+	query := `
+SELECT COALESCE(MAX(substring(pg_get_expr(c.relpartbound, c.oid) FROM 'modulus (\d+)')::int), 0)
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = to_regclass($1)`
+	var modulus int
+	if err := s.db.QueryRow(query, table).Scan(&modulus); err != nil {
+		return 0, fmt.Errorf("error reading the partitions of %s: %w", table, err)
+	}
+	return modulus, nil
+}
+
 func (s *SQLDatabase) CreateDotidxTable(relayChain, chain string) error {
 	dotidxTable := s.getTableName(fmt.Sprintf("%s.dotidx", schemaName))
 
@@ -486,7 +772,7 @@ func (s *SQLDatabase) CreateDotidxTable(relayChain, chain string) error {
 	}
 
 	if _, err := s.db.Exec(createQuery); err != nil {
-		log.Printf("sql %s", createQuery)
+		s.LogSQL(createQuery)
 		return fmt.Errorf("%w", err)
 	}
 
@@ -496,12 +782,12 @@ VALUES ('%s', '%s')
 ON CONFLICT (relay_chain, chain) DO NOTHING;
 `,
 		dotidxTable,
-		strings.ToLower(relayChain),
+		sanitizeRelayChainName(relayChain),
 		sanitizeChainName(relayChain, chain),
 	)
 
 	if _, err := s.db.Exec(inserts); err != nil {
-		log.Printf("sql %s", inserts)
+		s.LogSQL(inserts)
 		return fmt.Errorf("error failed to create insert in dotidx: %w", err)
 	}
 
@@ -510,6 +796,10 @@ ON CONFLICT (relay_chain, chain) DO NOTHING;
 
 func (s *SQLDatabase) CreateTable(relayChain, chain, firstTimestamp, lastTimestamp string) error {
 
+	if err := s.createSchema(); err != nil {
+		return err
+	}
+
 	if err := s.CreateDotidxTable(relayChain, chain); err != nil {
 		return fmt.Errorf("error creating dotidx table: %w", err)
 	}
@@ -530,8 +820,17 @@ func (s *SQLDatabase) CreateTable(relayChain, chain, firstTimestamp, lastTimesta
 		return fmt.Errorf("error creating table address2blocks partitions: %w", err)
 	}
 
-	if err := s.CreateTableMonthlyQueryResults(); err != nil {
-		return fmt.Errorf("error creating monthly table for statistics: %w", err)
+	// the tables for statistics and the schema version
+	if err := s.DoUpgrade(); err != nil {
+		return err
+	}
+
+	if err := s.CreateTableRuntimeSpecs(relayChain, chain); err != nil {
+		return fmt.Errorf("error creating table runtime specs: %w", err)
+	}
+
+	if err := s.CreateTableRuntimeUpgrades(); err != nil {
+		return fmt.Errorf("error creating table runtime upgrades: %w", err)
 	}
 
 	return nil
@@ -566,7 +865,70 @@ func (s *SQLDatabase) CreateIndex(relayChain, chain string) error {
 	return nil
 }
 
+// TimestampFallbacks returns how many blocks were saved without a timestamp
+// extrinsic
+func (s *SQLDatabase) TimestampFallbacks() int64 {
+	return s.timestampFallbacks.Load()
+}
+
+// blockTimestamps returns the timestamp of each block from its timestamp.set
+// extrinsic. Blocks without one use, in order, the timestamp set by the chain
+// reader, the timestamp of the closest block of the batch which has one, or
+// now, all formatted by FormatCreatedAt. It also returns how many blocks
+// needed a fallback, the genesis block never has a timestamp and is not
+// counted.
+func blockTimestamps(items []BlockData, now time.Time) ([]string, int) {
+	timestamps := make([]string, len(items))
+	extracted := make([]bool, len(items))
+	fallbacks := 0
+	for i, item := range items {
+		ts, err := ExtractTimestamp(item.Extrinsics)
+		if err == nil {
+			timestamps[i], extracted[i] = ts, true
+			continue
+		}
+		if !IsGenesis(item) {
+			fallbacks++
+		}
+		if !item.Timestamp.IsZero() {
+			timestamps[i] = FormatCreatedAt(item.Timestamp)
+		}
+	}
+	for i := range items {
+		if timestamps[i] != "" {
+			continue
+		}
+		timestamps[i] = FormatCreatedAt(now)
+		for distance := 1; distance < len(items); distance++ {
+			if j := i - distance; j >= 0 && extracted[j] {
+				timestamps[i] = timestamps[j]
+				break
+			}
+			if j := i + distance; j < len(items) && extracted[j] {
+				timestamps[i] = timestamps[j]
+				break
+			}
+		}
+	}
+	return timestamps, fallbacks
+}
+
 func (s *SQLDatabase) Save(items []BlockData, relayChain, chain string) error {
+	return s.SaveContext(context.Background(), items, relayChain, chain)
+}
+
+// SaveContext is Save recording an extract-addresses span under the span of
+// ctx
+func (s *SQLDatabase) SaveContext(ctx context.Context, items []BlockData, relayChain, chain string) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	// a malformed sidecar response would be stored with empty fields
+	items, err := s.quarantineInvalidBlocks(items, relayChain, chain)
+	if err != nil {
+		return err
+	}
 	if len(items) == 0 {
 		return nil
 	}
@@ -586,6 +948,16 @@ func (s *SQLDatabase) Save(items []BlockData, relayChain, chain string) error {
 	// log.Printf("Blocks table: %s", blocksTable)
 	// log.Printf("Address2blocks table: %s", address2blocksTable)
 
+	// PostgreSQL tells inserted rows from updated ones with xmax, SQLite
+	// needs to look the block up first
+	upsertReturning := " RETURNING (xmax = 0)"
+	existsQuery := ""
+	if s.dialect == DialectSQLite {
+		upsertReturning = ""
+		existsQuery = s.prepareQuery(fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE hash = $1 AND created_at = $2", blocksTable))
+	}
+
 	// Create insert query templates without using prepared statements
 	blocksInsertQuery := s.prepareQuery(fmt.Sprintf(
 		"INSERT INTO %s ("+
@@ -602,17 +974,88 @@ func (s *SQLDatabase) Save(items []BlockData, relayChain, chain string) error {
 			"on_initialize = EXCLUDED.on_initialize, "+
 			"on_finalize = EXCLUDED.on_finalize, "+
 			"logs = EXCLUDED.logs, "+
-			"extrinsics = EXCLUDED.extrinsics",
-		blocksTable))
+			"extrinsics = EXCLUDED.extrinsics"+
+			"%s",
+		blocksTable, upsertReturning))
 
 	addressInsertQuery := s.prepareQuery(fmt.Sprintf(
 		"INSERT INTO %s (address, block_id) VALUES ($1, $2) "+
 			"ON CONFLICT (address, block_id) DO NOTHING",
 		address2blocksTable))
 
+	// extracting addresses is CPU bound, it is done before the
+	// transaction starts
+	var blockAddresses [][]string
+	if !s.skipAddresses[relayChain+":"+chain] {
+		_, extractSpan := startSpan(ctx, "extract-addresses", attribute.Int("blocks", len(items)))
+		blockAddresses = make([][]string, len(items))
+		addressCount := 0
+		for i, item := range items {
+			addresses, err := extractAddressesFromExtrinsics(item.Extrinsics)
+			if err != nil {
+				log.Printf("warning: error extracting addresses from extrinsics: %v", err)
+				continue
+			}
+			blockAddresses[i] = addresses
+			addressCount += len(addresses)
+		}
+		extractSpan.SetAttributes(attribute.Int("addresses", addressCount))
+		extractSpan.End()
+	}
+
+	timestamps, fallbacks := blockTimestamps(items, time.Now())
+	if fallbacks > 0 {
+		s.timestampFallbacks.Add(int64(fallbacks))
+		log.Printf("warning: %d blocks of %s:%s without a timestamp extrinsic, using a best-effort time", fallbacks, relayChain, chain)
+	}
+
+	queries := saveQueries{exists: existsQuery, blocks: blocksInsertQuery, address: addressInsertQuery}
+	inserted, updated, events, err := s.saveTx(queries, items, timestamps, blockAddresses, relayChain, chain)
+	if isMissingPartition(err, relayChain, chain) {
+		// a dropped partition would stall indexing, it is recreated once and
+		// the blocks are saved without their addresses if that is not enough
+		log.Printf("warning: address2blocks partition of %s:%s is missing, recreating it: %v", relayChain, chain, err)
+		if perr := s.CreateTableAddress2BlocksPartitions(relayChain, chain); perr != nil {
+			log.Printf("Error recreating address2blocks partitions of %s:%s: %v", relayChain, chain, perr)
+		}
+		inserted, updated, events, err = s.saveTx(queries, items, timestamps, blockAddresses, relayChain, chain)
+		if isMissingPartition(err, relayChain, chain) {
+			s.blocksWithoutAddresses.Add(int64(len(items)))
+			log.Printf("warning: saving blocks %s-%s of %s:%s without their addresses: %v",
+				items[0].ID, items[len(items)-1].ID, relayChain, chain, err)
+			inserted, updated, events, err = s.saveTx(queries, items, timestamps, nil, relayChain, chain)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.blocksInserted.Add(inserted)
+	s.blocksUpdated.Add(updated)
+	s.recordMaxSaved(items, relayChain, chain)
+	if updated > 0 {
+		log.Printf("Rewrote %d existing blocks of %s:%s (%d new)", updated, relayChain, chain, inserted)
+	}
+	if s.bus != nil {
+		s.bus.Publish(events...)
+	}
+
+	return nil
+}
+
+type saveQueries struct {
+	exists  string
+	blocks  string
+	address string
+}
+
+// saveTx writes items and, when blockAddresses is not nil, their addresses
+// in one transaction. It returns the new and rewritten block counts and the
+// events to publish once committed.
+func (s *SQLDatabase) saveTx(queries saveQueries, items []BlockData, timestamps []string, blockAddresses [][]string, relayChain, chain string) (int64, int64, []Event, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("error beginning transaction: %w", err)
+		return 0, 0, nil, fmt.Errorf("error beginning transaction: %w", err)
 	}
 	defer func() {
 		if err != nil {
@@ -623,20 +1066,13 @@ func (s *SQLDatabase) Save(items []BlockData, relayChain, chain string) error {
 		}
 	}()
 
-	for _, item := range items {
-		ts, err := ExtractTimestamp(item.Extrinsics)
-		if err != nil {
-			id, _ := strconv.ParseInt(item.ID, 10, 32)
-			milli := id % 1000
-			sec := (id / 1000) % 60
-			min := (id / 60000) % 60
-			hour := (id / 3600000) % 60
-			ts = fmt.Sprintf("2000-01-01 %02d:%02d:%02d.%04d", hour, min, sec, milli)
-		}
+	var inserted, updated int64
+	var events []Event
+	for i, item := range items {
+		ts := timestamps[i]
 
 		// log.Printf("Debug: %s %s %s", item.ID, ts, item.Hash)
-		_, err = tx.Exec(
-			blocksInsertQuery,
+		args := []any{
 			item.ID,
 			ts,
 			item.Hash,
@@ -649,30 +1085,108 @@ func (s *SQLDatabase) Save(items []BlockData, relayChain, chain string) error {
 			item.OnFinalize,
 			item.Logs,
 			item.Extrinsics,
-		)
+		}
+		isNew := false
+		if queries.exists != "" {
+			var count int
+			if err = tx.QueryRow(queries.exists, item.Hash, ts).Scan(&count); err != nil {
+				return 0, 0, nil, fmt.Errorf("error looking up block %s: %w", item.ID, err)
+			}
+			isNew = count == 0
+			_, err = tx.Exec(queries.blocks, args...)
+		} else {
+			err = tx.QueryRow(queries.blocks, args...).Scan(&isNew)
+		}
 		if err != nil {
-			return fmt.Errorf("error inserting into blocks table: %w", err)
+			return 0, 0, nil, fmt.Errorf("error inserting into blocks table: %w", err)
+		}
+		if isNew {
+			inserted++
+		} else {
+			updated++
 		}
 
-		addresses, err := extractAddressesFromExtrinsics(item.Extrinsics)
-		if err != nil {
-			log.Printf("warning: error extracting addresses from extrinsics: %v", err)
-			continue
+		if s.bus != nil {
+			events = append(events, Event{Topic: TopicNewBlock, RelayChain: relayChain, Chain: chain, Block: item})
 		}
 
-		for _, address := range addresses {
-			_, err = tx.Exec(addressInsertQuery, address, item.ID)
+		if blockAddresses == nil {
+			continue
+		}
+		for _, address := range blockAddresses[i] {
+			_, err = tx.Exec(queries.address, address, item.ID)
 			if err != nil {
-				return fmt.Errorf("error inserting into address2blocks table: %w", err)
+				return 0, 0, nil, fmt.Errorf("error inserting into address2blocks table: %w", err)
+			}
+			if s.bus != nil {
+				events = append(events, Event{Topic: TopicNewAddress, RelayChain: relayChain, Chain: chain, Address: address, BlockID: item.ID})
 			}
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+		return 0, 0, nil, fmt.Errorf("error committing transaction: %w", err)
 	}
+	return inserted, updated, events, nil
+}
 
-	return nil
+// isMissingPartition reports whether err is PostgreSQL failing to route a
+// row to a partition of the address2blocks table of relayChain:chain
+func isMissingPartition(err error, relayChain, chain string) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23514" {
+		return false
+	}
+	table := strings.TrimPrefix(GetAddressTableName(relayChain, chain), schemaName+".")
+	return strings.HasPrefix(pqErr.Message, fmt.Sprintf("no partition of relation %q ", table))
+}
+
+// BlocksWithoutAddresses returns how many blocks were saved without their
+// addresses because an address2blocks partition was missing
+func (s *SQLDatabase) BlocksWithoutAddresses() int64 {
+	return s.blocksWithoutAddresses.Load()
+}
+
+// SetEventBus publishes every committed block and its addresses to bus, it
+// must be called before the first Save
+func (s *SQLDatabase) SetEventBus(bus *EventBus) {
+	s.bus = bus
+}
+
+func (s *SQLDatabase) recordMaxSaved(items []BlockData, relayChain, chain string) {
+	highest := -1
+	for _, item := range items {
+		if id, err := strconv.Atoi(item.ID); err == nil && id > highest {
+			highest = id
+		}
+	}
+	if highest < 0 {
+		return
+	}
+	key := relayChain + ":" + chain
+	s.maxSavedMu.Lock()
+	defer s.maxSavedMu.Unlock()
+	if s.maxSaved == nil {
+		s.maxSaved = make(map[string]int)
+	}
+	if current, ok := s.maxSaved[key]; !ok || highest > current {
+		s.maxSaved[key] = highest
+	}
+}
+
+// MaxSavedBlock returns the highest block of relayChain:chain saved by this
+// process, ok is false before the first save
+func (s *SQLDatabase) MaxSavedBlock(relayChain, chain string) (block int, ok bool) {
+	s.maxSavedMu.Lock()
+	defer s.maxSavedMu.Unlock()
+	block, ok = s.maxSaved[relayChain+":"+chain]
+	return block, ok
+}
+
+// UpsertCounts returns how many saved blocks were new and how many already
+// existed and were rewritten. A high rewrite ratio means overlapping runs.
+func (s *SQLDatabase) UpsertCounts() (inserted, updated int64) {
+	return s.blocksInserted.Load(), s.blocksUpdated.Load()
 }
 
 func (s *SQLDatabase) GetExistingBlocks(relayChain, chain string, startRange, endRange int) (map[int]bool, error) {
@@ -734,6 +1248,29 @@ func (s *SQLDatabase) GetDatabaseInfo() ([]DatabaseInfo, error) {
 }
 
 func (s *SQLDatabase) ExecuteNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) (SqlResult, error) {
+	return s.executeNamedQuery(ctx, queryName, NamedQueryParameters{
+		Relaychain: relayChain,
+		Chain:      chain,
+		Year:       year,
+		Month:      month,
+	})
+}
+
+// ExecuteNamedQueryRange runs a query written against StartDate and EndDate
+// over [start, end)
+func (s *SQLDatabase) ExecuteNamedQueryRange(ctx context.Context, relayChain, chain, queryName string, start, end time.Time) (SqlResult, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("invalid range for query '%s': %s is not before %s", queryName, start, end)
+	}
+	return s.executeNamedQuery(ctx, queryName, NamedQueryParameters{
+		Relaychain: relayChain,
+		Chain:      chain,
+		StartDate:  start,
+		EndDate:    end,
+	})
+}
+
+func (s *SQLDatabase) executeNamedQuery(ctx context.Context, queryName string, parameters NamedQueryParameters) (SqlResult, error) {
 	registryMutex.RLock()
 	namedQuery, exists := queryRegistry[queryName]
 	registryMutex.RUnlock()
@@ -742,22 +1279,15 @@ func (s *SQLDatabase) ExecuteNamedQuery(ctx context.Context, relayChain, chain,
 		return nil, fmt.Errorf("query with name '%s' not found in registry", queryName)
 	}
 
-	parameters := NamedQueryParameters{
-		Relaychain: relayChain,
-		Chain:      chain,
-		Year:       year,
-		Month:      month,
-	}
-
-	var sqlBuilder strings.Builder
-	if err := namedQuery.SQLTemplate.Execute(&sqlBuilder, parameters); err != nil {
+	sqlString, err := renderNamedQuery(namedQuery.SQLTemplate, parameters)
+	if err != nil {
 		return nil, fmt.Errorf("error executing template for query '%s': %w", queryName, err)
 	}
-	sqlString := sqlBuilder.String()
 
 	rows, err := s.db.QueryContext(ctx, sqlString)
 	if err != nil {
-		log.Printf("Error executing SQL query '%s'. SQL: %s, Error: %v", queryName, sqlString, err)
+		log.Printf("Error executing SQL query '%s': %v", queryName, err)
+		s.LogSQL(sqlString)
 		return nil, fmt.Errorf("error executing SQL query '%s': %w", queryName, err)
 	}
 	defer rows.Close()
@@ -827,7 +1357,7 @@ VALUES
 ON CONFLICT
   (relay_chain, chain, query_name, year, month)
 DO UPDATE SET results = EXCLUDED.results, last_updated = %s;`,
-		monthlyQueryResultsTable,
+		MonthlyQueryResultsTableName(),
 		nowFunc,
 		nowFunc,
 	))
@@ -839,11 +1369,90 @@ DO UPDATE SET results = EXCLUDED.results, last_updated = %s;`,
 
 	_, err = s.db.ExecContext(ctx, query, relayChain, chain, queryName, year, month, jsonData)
 	if err != nil {
-		return fmt.Errorf("error storing query results for '%s' into %s: %w", queryName, monthlyQueryResultsTable, err)
+		return fmt.Errorf("error storing query results for '%s' into %s: %w", queryName, MonthlyQueryResultsTableName(), err)
+	}
+	return nil
+}
+
+func (s *SQLDatabase) ExecuteAndStoreNamedQueryRange(ctx context.Context, relayChain, chain, queryName string, start, end time.Time) error {
+	results, err := s.ExecuteNamedQueryRange(ctx, relayChain, chain, queryName, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to execute named query '%s': %w", queryName, err)
 	}
+
+	if err := s.StoreRangeQueryResult(ctx, relayChain, chain, queryName, start, end, results); err != nil {
+		return fmt.Errorf("failed to store results of query '%s': %w", queryName, err)
+	}
+
 	return nil
 }
 
+// StoreRangeQueryResult keeps the result of a range query, keyed by its
+// bounds so that each range has its own row
+func (s *SQLDatabase) StoreRangeQueryResult(ctx context.Context, relayChain, chain, queryName string, start, end time.Time, result SqlResult) error {
+	nowFunc := "NOW()"
+	if s.dialect == DialectSQLite {
+		nowFunc = "datetime('now')"
+	}
+
+	query := s.prepareQuery(fmt.Sprintf(`
+INSERT INTO
+  %s (relay_chain, chain, query_name, start_date, end_date, results, last_updated)
+VALUES
+  ($1, $2, $3, $4, $5, $6, %s)
+ON CONFLICT
+  (relay_chain, chain, query_name, start_date, end_date)
+DO UPDATE SET results = EXCLUDED.results, last_updated = %s;`,
+		s.getTableName(RangeQueryResultsTableName()),
+		nowFunc,
+		nowFunc,
+	))
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error marshaling query results for '%s': %w", queryName, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, query, relayChain, chain, queryName, start.UTC(), end.UTC(), jsonData)
+	if err != nil {
+		return fmt.Errorf("error storing query results for '%s' into %s: %w", queryName, RangeQueryResultsTableName(), err)
+	}
+	return nil
+}
+
+// ReadRangeQueryResult returns the stored result of a range query, nil if
+// that range was never computed
+func (s *SQLDatabase) ReadRangeQueryResult(ctx context.Context, relayChain, chain, queryName string, start, end time.Time) (SqlResult, error) {
+	query := s.prepareQuery(fmt.Sprintf(`
+SELECT
+  results
+FROM
+  %s
+WHERE
+  relay_chain = $1
+  AND chain = $2
+  AND query_name = $3
+  AND start_date = $4
+  AND end_date = $5;`,
+		s.getTableName(RangeQueryResultsTableName()),
+	))
+
+	var jsonData []byte
+	err := s.db.QueryRowContext(ctx, query, relayChain, chain, queryName, start.UTC(), end.UTC()).Scan(&jsonData)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading query results for '%s' from %s: %w", queryName, RangeQueryResultsTableName(), err)
+	}
+
+	var result SqlResult
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		return nil, fmt.Errorf("error decoding query results for '%s': %w", queryName, err)
+	}
+	return result, nil
+}
+
 func (s *SQLDatabase) ReadTimeNamedQuery(ctx context.Context, relayChain, chain, queryName string, year, month int) (t time.Time, err error) {
 	query := fmt.Sprintf(`
 SELECT
@@ -859,7 +1468,7 @@ WHERE
 ORDER BY last_updated DESC
 LIMIT 1
 `,
-		monthlyQueryResultsTable,
+		MonthlyQueryResultsTableName(),
 		relayChain,
 		chain,
 		queryName,
@@ -870,7 +1479,7 @@ LIMIT 1
 	rows, err := s.db.Query(query)
 	if err != nil {
 		// log.Printf("exec with q=%s", query)
-		return time.Time{}, fmt.Errorf("error reading query results for '%s' into %s: %w", queryName, monthlyQueryResultsTable, err)
+		return time.Time{}, fmt.Errorf("error reading query results for '%s' into %s: %w", queryName, MonthlyQueryResultsTableName(), err)
 	}
 	defer rows.Close()
 
@@ -886,7 +1495,7 @@ LIMIT 1
 }
 
 func (s *SQLDatabase) CreateTableMonthlyQueryResults() error {
-	tableName := s.getTableName(monthlyQueryResultsTable)
+	tableName := s.getTableName(MonthlyQueryResultsTableName())
 
 	var query string
 	if s.dialect == DialectSQLite {
@@ -923,10 +1532,58 @@ CREATE TABLE IF NOT EXISTS %s (
 	return nil
 }
 
+func (s *SQLDatabase) CreateTableRangeQueryResults() error {
+	tableName := s.getTableName(RangeQueryResultsTableName())
+
+	var query string
+	if s.dialect == DialectSQLite {
+		query = fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    relay_chain TEXT NOT NULL,
+    chain TEXT NOT NULL,
+    query_name TEXT NOT NULL,
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP NOT NULL,
+    results TEXT,
+    last_updated TEXT DEFAULT (datetime('now')),
+    PRIMARY KEY (relay_chain, chain, query_name, start_date, end_date)
+);`, tableName)
+	} else {
+		query = fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    relay_chain TEXT NOT NULL,
+    chain TEXT NOT NULL,
+    query_name TEXT NOT NULL,
+    start_date TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    results JSONB,
+    last_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (relay_chain, chain, query_name, start_date, end_date)
+);`, tableName)
+	}
+
+	_, err := s.db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("error creating %s table: %w", tableName, err)
+	}
+	log.Printf("Ensured table %s exists", tableName)
+	return nil
+}
+
+// pqSanitizeIdentifier quotes identifier for PostgreSQL
 func pqSanitizeIdentifier(identifier string) string {
 	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
 }
 
+// pqSanitizeTableName quotes each part of a schema qualified table name
+func pqSanitizeTableName(tableName string) string {
+	schema, table, qualified := strings.Cut(tableName, ".")
+	if !qualified {
+		return pqSanitizeIdentifier(tableName)
+	}
+	return pqSanitizeIdentifier(schema) + "." + pqSanitizeIdentifier(table)
+}
+
 func rowsToJSON(rows *sql.Rows) ([]byte, error) {
 	columns, err := rows.Columns()
 	if err != nil {
@@ -1006,9 +1663,9 @@ func (s *SQLDatabase) convertSQLFunctions(query string) string {
 	query = strings.ReplaceAll(query, "EXTRACT(DAY FROM created_at)", "CAST(strftime('%d', created_at) AS INTEGER)")
 
 	// Convert schema.table to schema_table for SQLite
-	query = strings.ReplaceAll(query, "chain.blocks_", "chain_blocks_")
-	query = strings.ReplaceAll(query, "chain.address2blocks_", "chain_address2blocks_")
-	query = strings.ReplaceAll(query, "chain.dotidx", "chain_dotidx")
+	query = strings.ReplaceAll(query, schemaName+".blocks_", schemaName+"_blocks_")
+	query = strings.ReplaceAll(query, schemaName+".address2blocks_", schemaName+"_address2blocks_")
+	query = strings.ReplaceAll(query, schemaName+".dotidx", schemaName+"_dotidx")
 
 	return query
 }
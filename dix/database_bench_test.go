@@ -0,0 +1,166 @@
+package dix
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchmarkBlocks returns count consecutive blocks with a timestamp.set and
+// extrinsics signed by addresses distinct accounts, each carrying padding
+// bytes of call data
+func benchmarkBlocks(count, addresses, padding int) []BlockData {
+	data := strings.Repeat("ab", padding/2)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocks := make([]BlockData, count)
+	for i := range blocks {
+		extrinsics := []map[string]any{{
+			"method": map[string]string{"pallet": "timestamp", "method": "set"},
+			"args":   map[string]string{"now": fmt.Sprint(start.Add(time.Duration(i) * 6 * time.Second).UnixMilli())},
+		}}
+		for j := range addresses {
+			extrinsics = append(extrinsics, map[string]any{
+				"method":    map[string]string{"pallet": "balances", "method": "transferKeepAlive"},
+				"signature": map[string]any{"signer": map[string]string{"id": fmt.Sprintf("1%047d", j)}},
+				"args":      map[string]string{"dest": "0x" + data},
+			})
+		}
+		raw, err := json.Marshal(extrinsics)
+		if err != nil {
+			panic(err)
+		}
+		blocks[i] = BlockData{
+			ID:             fmt.Sprint(1000 + i),
+			Hash:           fmt.Sprintf("0x%064x", 1000+i),
+			ParentHash:     fmt.Sprintf("0x%064x", 999+i),
+			StateRoot:      fmt.Sprintf("0x%064x", i),
+			ExtrinsicsRoot: fmt.Sprintf("0x%064x", i),
+			Finalized:      true,
+			OnInitialize:   json.RawMessage(`{"events":[]}`),
+			OnFinalize:     json.RawMessage(`{"events":[]}`),
+			Logs:           json.RawMessage(`[]`),
+			Extrinsics:     raw,
+		}
+	}
+	return blocks
+}
+
+// discardDriver is a database/sql driver accepting every statement: queries
+// answer one row with true, as the upsert of a new block does
+type discardDriver struct{}
+
+type discardConn struct{}
+
+type discardStmt struct{}
+
+type discardRows struct{ done bool }
+
+func (discardDriver) Open(name string) (driver.Conn, error) { return discardConn{}, nil }
+
+func (discardConn) Prepare(query string) (driver.Stmt, error) { return discardStmt{}, nil }
+func (discardConn) Close() error                              { return nil }
+func (discardConn) Begin() (driver.Tx, error)                 { return discardConn{}, nil }
+func (discardConn) Commit() error                             { return nil }
+func (discardConn) Rollback() error                           { return nil }
+
+func (discardStmt) Close() error  { return nil }
+func (discardStmt) NumInput() int { return -1 }
+
+func (discardStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (discardStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &discardRows{}, nil
+}
+
+func (*discardRows) Columns() []string { return []string{"inserted"} }
+func (*discardRows) Close() error      { return nil }
+func (r *discardRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = true
+	return nil
+}
+
+func init() {
+	sql.Register("dotidx-discard", discardDriver{})
+}
+
+// BenchmarkSaveBatch measures Save on batches of blocks of various address
+// counts and extrinsics sizes. The database discards every statement, so it
+// measures the work of dotidx: validation, address extraction, timestamps
+// and the statements sent. Run it with
+//
+//	go test ./dix -run '^$' -bench BenchmarkSaveBatch -benchmem
+func BenchmarkSaveBatch(b *testing.B) {
+	const batch = 100
+	for _, tc := range []struct {
+		addresses int
+		padding   int
+	}{
+		{0, 0},
+		{10, 64},
+		{10, 4096},
+		{100, 64},
+		{100, 4096},
+	} {
+		b.Run(fmt.Sprintf("addresses=%d/padding=%d", tc.addresses, tc.padding), func(b *testing.B) {
+			blocks := benchmarkBlocks(batch, tc.addresses, tc.padding)
+			size := 0
+			for _, block := range blocks {
+				size += len(block.Extrinsics)
+			}
+
+			db, err := sql.Open("dotidx-discard", "")
+			if err != nil {
+				b.Fatalf("Error opening database: %v", err)
+			}
+			defer db.Close()
+			database := NewSQLDatabaseWithDB(db)
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if err := database.Save(blocks, "polkadot", "bench"); err != nil {
+					b.Fatalf("Save: %v", err)
+				}
+			}
+			b.ReportMetric(float64(b.N*batch)/b.Elapsed().Seconds(), "blocks/s")
+		})
+	}
+}
+
+// BenchmarkExtractAddresses measures the address extraction of a large block
+// with 100 signers and 4 KiB of call data per extrinsic
+func BenchmarkExtractAddresses(b *testing.B) {
+	extrinsics := benchmarkBlocks(1, 100, 4096)[0].Extrinsics
+	b.SetBytes(int64(len(extrinsics)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := extractAddressesFromExtrinsics(extrinsics); err != nil {
+			b.Fatalf("extractAddressesFromExtrinsics: %v", err)
+		}
+	}
+}
+
+// BenchmarkExtractTimestamp measures reading the timestamp of the same large
+// block, the extrinsics after timestamp.set are not decoded
+func BenchmarkExtractTimestamp(b *testing.B) {
+	extrinsics := benchmarkBlocks(1, 100, 4096)[0].Extrinsics
+	b.SetBytes(int64(len(extrinsics)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := extractTimestampMillis(extrinsics); err != nil {
+			b.Fatalf("extractTimestampMillis: %v", err)
+		}
+	}
+}
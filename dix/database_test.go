@@ -1,13 +1,19 @@
 package dix
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,13 +61,13 @@ func TestSaveToDatabase(t *testing.T) {
 	mock.ExpectBegin()
 
 	// For first item: first blocks table insert with correct column names
-	mock.ExpectExec("^INSERT INTO chain\\.blocks_polkadot_chain \\(block_id, created_at, hash, parent_hash, state_root, extrinsics_root, author_id, finalized, on_initialize, on_finalize, logs, extrinsics\\) VALUES \\(.*\\) ON CONFLICT.*$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain \\(block_id, created_at, hash, parent_hash, state_root, extrinsics_root, author_id, finalized, on_initialize, on_finalize, logs, extrinsics\\) VALUES \\(.*\\) ON CONFLICT.* RETURNING \\(xmax = 0\\)$").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
 
 	// Then address2blocks table
 	mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain \\(address, block_id\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(address, block_id\\) DO NOTHING$").WithArgs("5GrwvaEF5zXb26Fz9rcQpDWS57CtERHpNehXCPcNoHGKutQY", "1").WillReturnResult(sqlmock.NewResult(0, 1))
 
 	// For second item: first blocks table with correct column names
-	mock.ExpectExec("^INSERT INTO chain\\.blocks_polkadot_chain \\(block_id, created_at, hash, parent_hash, state_root, extrinsics_root, author_id, finalized, on_initialize, on_finalize, logs, extrinsics\\) VALUES \\(.*\\) ON CONFLICT.*$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain \\(block_id, created_at, hash, parent_hash, state_root, extrinsics_root, author_id, finalized, on_initialize, on_finalize, logs, extrinsics\\) VALUES \\(.*\\) ON CONFLICT.* RETURNING \\(xmax = 0\\)$").WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
 
 	// Then address2blocks table
 	mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain \\(address, block_id\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(address, block_id\\) DO NOTHING$").WithArgs("5FHneW46xGXgs5mUiveU4sbTyGBzmstUspZC92UhjJM694ty", "2").WillReturnResult(sqlmock.NewResult(0, 1))
@@ -204,3 +210,714 @@ func TestDatabaseClose(t *testing.T) {
 // 		t.Errorf("Unfulfilled expectations: %v", err)
 // 	}
 // }
+
+func TestEffectiveWorkers(t *testing.T) {
+	tests := []struct {
+		name         string
+		dbType       string
+		maxWorkers   int
+		maxOpenConns int
+		workers      int
+		capped       bool
+	}{
+		{"fits in the default pool", "postgres", 8, 0, 8, false},
+		{"capped to the default pool", "postgres", 50, 0, 25, true},
+		{"capped to a configured pool", "postgres", 50, 40, 40, true},
+		{"derived from the pool", "postgres", 0, 10, 10, false},
+		{"sqlite is not capped", "sqlite", 50, 0, 50, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := MgrConfig{
+				DotidxDB:    DotidxDB{Type: tt.dbType, MaxOpenConns: tt.maxOpenConns},
+				DotidxBatch: DotidxBatch{MaxWorkers: tt.maxWorkers},
+			}
+			workers, capped := EffectiveWorkers(config)
+			assert.Equal(t, tt.workers, workers)
+			assert.Equal(t, tt.capped, capped)
+		})
+	}
+}
+
+func TestDBPoolConfigFromMgrConfig(t *testing.T) {
+	assert.Equal(t, DefaultDBPoolConfig(), DBPoolConfigFromMgrConfig(MgrConfig{}))
+
+	poolCfg := DBPoolConfigFromMgrConfig(MgrConfig{DotidxDB: DotidxDB{MaxOpenConns: 3}})
+	assert.Equal(t, 3, poolCfg.MaxOpenConns)
+	assert.Equal(t, 3, poolCfg.MaxIdleConns, "idle connections cannot exceed open ones")
+}
+
+func TestCreateTableAddress2BlocksPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	database := NewSQLDatabaseWithDB(db)
+	database.SetAddressPartitions(16)
+
+	table := GetAddressTableName("polkadot", "polkadot")
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(substring\\(pg_get_expr").WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"modulus"}).AddRow(0))
+	for remainder := range 16 {
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s_%d PARTITION OF %s\n  FOR VALUES WITH (modulus 16, remainder %d)\n  TABLESPACE dotidx_fast%d;",
+			table, remainder, table, remainder, remainder%fastTablespaceNumber,
+		))).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	assert.NoError(t, database.CreateTableAddress2BlocksPartitions("polkadot", "polkadot"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTableAddress2BlocksPartitionsKeepsExistingModulus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	database := NewSQLDatabaseWithDB(db)
+	database.SetAddressPartitions(16)
+
+	// the table was created with the default 4 partitions
+	table := GetAddressTableName("polkadot", "polkadot")
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(substring\\(pg_get_expr").WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"modulus"}).AddRow(4))
+	for remainder := range 4 {
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s_%d PARTITION OF %s\n  FOR VALUES WITH (modulus 4, remainder %d)",
+			table, remainder, table, remainder,
+		))).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	assert.NoError(t, database.CreateTableAddress2BlocksPartitions("polkadot", "polkadot"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddressPartitionsDefault(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	database := NewSQLDatabaseWithDB(db)
+	assert.Equal(t, fastTablespaceNumber, database.addressPartitions)
+	database.SetAddressPartitions(0)
+	assert.Equal(t, fastTablespaceNumber, database.addressPartitions)
+}
+
+func TestSanitizeChainName(t *testing.T) {
+	for _, tc := range []struct {
+		relay, chain string
+		want         string
+		blocksTable  string
+	}{
+		{"polkadot", "polkadot", "polkadot", "chain.blocks_polkadot_polkadot"},
+		{"polkadot", "assethub", "assethub", "chain.blocks_polkadot_assethub"},
+		{"Polkadot", "AssetHub", "assethub", "chain.blocks_polkadot_assethub"},
+		{"kusama", "kusama", "kusama", "chain.blocks_kusama_kusama"},
+		{"kusama", "kusama-assethub", "assethub", "chain.blocks_kusama_assethub"},
+		{"polkadot", "polkadot-bridge-hub", "bridgehub", "chain.blocks_polkadot_bridgehub"},
+		{"westend", "asset_hub_westend", "assethub", "chain.blocks_westend_assethub"},
+	} {
+		if got := sanitizeChainName(tc.relay, tc.chain); got != tc.want {
+			t.Errorf("sanitizeChainName(%q, %q) = %q, want %q", tc.relay, tc.chain, got, tc.want)
+		}
+		if got := GetBlocksTableName(tc.relay, tc.chain); got != tc.blocksTable {
+			t.Errorf("GetBlocksTableName(%q, %q) = %q, want %q", tc.relay, tc.chain, got, tc.blocksTable)
+		}
+	}
+}
+
+func TestCheckTableNameCollisions(t *testing.T) {
+	parachains := map[string]map[string]ParaChainConfig{
+		"polkadot": {"polkadot": {}, "assethub": {}, "people": {}},
+		"kusama":   {"kusama": {}, "assethub": {}},
+	}
+	if err := CheckTableNameCollisions(parachains); err != nil {
+		t.Errorf("Expected no collision, got %v", err)
+	}
+
+	parachains["polkadot"]["asset-hub"] = ParaChainConfig{}
+	err := CheckTableNameCollisions(parachains)
+	if err == nil {
+		t.Fatal("Expected a collision between assethub and asset-hub")
+	}
+	want := "polkadot:asset-hub and polkadot:assethub both map to chain.blocks_polkadot_assethub"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected %q in %v", want, err)
+	}
+}
+
+func TestSaveWithoutTimestampExtrinsic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	header := time.UnixMilli(1700000012000)
+	blocks := []BlockData{{
+		ID:             "7",
+		Timestamp:      header,
+		Hash:           "0x07",
+		ParentHash:     "0x06",
+		StateRoot:      "0x70",
+		ExtrinsicsRoot: "0x71",
+		Extrinsics:     json.RawMessage(`[]`),
+	}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WithArgs("7", header.Format("2006-01-02 15:04:05.0000"), "0x07",
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	database := NewSQLDatabaseWithDB(db)
+	if err := database.Save(blocks, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := database.TimestampFallbacks(); got != 1 {
+		t.Errorf("Expected 1 timestamp fallback, got %d", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSaveCountsInsertsAndUpdates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	block := BlockData{
+		ID:             "1",
+		Hash:           "0x01",
+		ParentHash:     "0x00",
+		StateRoot:      "0x10",
+		ExtrinsicsRoot: "0x11",
+		Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"}}]`),
+	}
+	// the second save finds the row, xmax is then the updating transaction
+	for _, inserted := range []bool{true, false} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain .* RETURNING \\(xmax = 0\\)$").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(inserted))
+		mock.ExpectCommit()
+	}
+
+	if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if inserted, updated := database.UpsertCounts(); inserted != 1 || updated != 0 {
+		t.Errorf("After a new block expected 1 insert and 0 update, got %d and %d", inserted, updated)
+	}
+	if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if inserted, updated := database.UpsertCounts(); inserted != 1 || updated != 1 {
+		t.Errorf("After an existing block expected 1 insert and 1 update, got %d and %d", inserted, updated)
+	}
+	if block, ok := database.MaxSavedBlock("polkadot", "chain"); !ok || block != 1 {
+		t.Errorf("Expected block 1 as the highest saved, got %d %v", block, ok)
+	}
+	if _, ok := database.MaxSavedBlock("polkadot", "other"); ok {
+		t.Errorf("Expected no saved block for another chain")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNamedQueryRange(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableRangeQueryResults(); err != nil {
+		t.Fatalf("CreateTableRangeQueryResults: %v", err)
+	}
+
+	if _, err := db.Exec(`CREATE TABLE samples (relay TEXT, created_at TEXT)`); err != nil {
+		t.Fatalf("Error creating samples: %v", err)
+	}
+	for _, day := range []string{"2024-01-15", "2024-02-10", "2024-03-31", "2024-04-01"} {
+		if _, err := db.Exec(`INSERT INTO samples VALUES ('polkadot', ?)`, day); err != nil {
+			t.Fatalf("Error inserting sample: %v", err)
+		}
+	}
+
+	if err := RegisterQuery("test_samples_in_range", `
+SELECT COUNT(*) AS total FROM samples
+WHERE relay = '{{.Relaychain}}'
+AND created_at >= '{{.StartDate.Format "2006-01-02"}}'
+AND created_at < '{{.EndDate.Format "2006-01-02"}}';`, "samples in a range"); err != nil {
+		t.Fatalf("RegisterQuery: %v", err)
+	}
+	if err := RegisterQuery("test_samples_in_month", `
+SELECT COUNT(*) AS total FROM samples
+WHERE created_at LIKE '{{.Year}}-{{printf "%02d" .Month}}-%';`, "samples in a month"); err != nil {
+		t.Fatalf("RegisterQuery: %v", err)
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	result, err := database.ExecuteNamedQueryRange(ctx, "polkadot", "polkadot", "test_samples_in_range", start, end)
+	if err != nil {
+		t.Fatalf("ExecuteNamedQueryRange: %v", err)
+	}
+	if len(result) != 1 || result[0]["total"] != int64(3) {
+		t.Errorf("Expected 3 samples in range, got %v", result)
+	}
+
+	if _, err := database.ExecuteNamedQueryRange(ctx, "polkadot", "polkadot", "test_samples_in_range", end, start); err == nil {
+		t.Error("Expected an error for a range ending before it starts")
+	}
+
+	if err := database.ExecuteAndStoreNamedQueryRange(ctx, "polkadot", "polkadot", "test_samples_in_range", start, end); err != nil {
+		t.Fatalf("ExecuteAndStoreNamedQueryRange: %v", err)
+	}
+	stored, err := database.ReadRangeQueryResult(ctx, "polkadot", "polkadot", "test_samples_in_range", start, end)
+	if err != nil {
+		t.Fatalf("ReadRangeQueryResult: %v", err)
+	}
+	// stored results come back from JSON
+	if len(stored) != 1 || stored[0]["total"] != float64(3) {
+		t.Errorf("Expected the stored result to be 3 samples, got %v", stored)
+	}
+
+	// storing the same range again replaces the result
+	if _, err := db.Exec(`INSERT INTO samples VALUES ('polkadot', '2024-03-01')`); err != nil {
+		t.Fatalf("Error inserting sample: %v", err)
+	}
+	if err := database.ExecuteAndStoreNamedQueryRange(ctx, "polkadot", "polkadot", "test_samples_in_range", start, end); err != nil {
+		t.Fatalf("ExecuteAndStoreNamedQueryRange: %v", err)
+	}
+	stored, err = database.ReadRangeQueryResult(ctx, "polkadot", "polkadot", "test_samples_in_range", start, end)
+	if err != nil {
+		t.Fatalf("ReadRangeQueryResult: %v", err)
+	}
+	if len(stored) != 1 || stored[0]["total"] != float64(4) {
+		t.Errorf("Expected the stored result to be 4 samples, got %v", stored)
+	}
+
+	missing, err := database.ReadRangeQueryResult(ctx, "polkadot", "polkadot", "test_samples_in_range", start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("ReadRangeQueryResult: %v", err)
+	}
+	if missing != nil {
+		t.Errorf("Expected no result for a range never computed, got %v", missing)
+	}
+
+	// month queries keep working
+	monthly, err := database.ExecuteNamedQuery(ctx, "polkadot", "polkadot", "test_samples_in_month", 2024, 3)
+	if err != nil {
+		t.Fatalf("ExecuteNamedQuery: %v", err)
+	}
+	if len(monthly) != 1 || monthly[0]["total"] != int64(2) {
+		t.Errorf("Expected 2 samples in March, got %v", monthly)
+	}
+}
+
+func TestRegisterQueryValidation(t *testing.T) {
+	if err := RegisterQuery("test_unknown_parameter", `SELECT {{.Week}};`, "unknown parameter"); err == nil {
+		t.Error("Expected an error for a template using an unknown parameter")
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if _, err := db.Exec(`CREATE TABLE blocks_polkadot_assethub (block_id INTEGER, created_at TEXT)`); err != nil {
+		t.Fatalf("Error creating blocks: %v", err)
+	}
+
+	ctx := context.Background()
+	valid := `
+SELECT COUNT(*) AS total FROM blocks_{{.Relaychain}}_{{.Chain}}
+WHERE created_at >= '{{.StartDate.Format "2006-01-02"}}';`
+	if err := database.RegisterCheckedQuery(ctx, "polkadot", "assethub", "test_checked_valid", valid, "valid"); err != nil {
+		t.Errorf("Expected a valid query to register, got %v", err)
+	}
+
+	invalid := `SELEC COUNT(*) FROM blocks_{{.Relaychain}}_{{.Chain}};`
+	if err := database.RegisterCheckedQuery(ctx, "polkadot", "assethub", "test_checked_invalid", invalid, "typo"); err == nil {
+		t.Error("Expected an error for invalid SQL")
+	}
+	unknownTable := `SELECT COUNT(*) FROM blocks_{{.Relaychain}}_unknown;`
+	if err := database.RegisterCheckedQuery(ctx, "polkadot", "assethub", "test_checked_table", unknownTable, "table"); err == nil {
+		t.Error("Expected an error for an unknown table")
+	}
+
+	registryMutex.RLock()
+	_, validRegistered := queryRegistry["test_checked_valid"]
+	_, invalidRegistered := queryRegistry["test_checked_invalid"]
+	registryMutex.RUnlock()
+	if !validRegistered {
+		t.Error("Expected the valid query to be registered")
+	}
+	if invalidRegistered {
+		t.Error("Expected the invalid query not to be registered")
+	}
+}
+
+func TestSaveRecreatesMissingAddressPartition(t *testing.T) {
+	address := "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+	block := BlockData{
+		ID:             "1",
+		Hash:           "0x01",
+		ParentHash:     "0x00",
+		StateRoot:      "0x10",
+		ExtrinsicsRoot: "0x11",
+		Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"},"signature":{"signer":{"id":"` + address + `"}}}]`),
+	}
+	missing := &pq.Error{Code: "23514", Message: `no partition of relation "address2blocks_polkadot_chain" found for row`}
+
+	expectMissing := func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain ").WillReturnError(missing)
+		mock.ExpectRollback()
+	}
+
+	t.Run("recreated", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock database: %v", err)
+		}
+		defer db.Close()
+		database := NewSQLDatabaseWithDB(db)
+		database.SetAddressPartitions(1)
+
+		expectMissing(mock)
+		mock.ExpectQuery("SELECT COALESCE\\(MAX\\(substring\\(pg_get_expr").
+			WillReturnRows(sqlmock.NewRows([]string{"modulus"}).AddRow(1))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS chain\\.address2blocks_polkadot_chain_0 PARTITION OF").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain ").
+			WithArgs(address, "1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if got := database.BlocksWithoutAddresses(); got != 0 {
+			t.Errorf("Expected no block saved without addresses, got %d", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock database: %v", err)
+		}
+		defer db.Close()
+		database := NewSQLDatabaseWithDB(db)
+		database.SetAddressPartitions(1)
+
+		expectMissing(mock)
+		mock.ExpectQuery("SELECT COALESCE\\(MAX\\(substring\\(pg_get_expr").
+			WillReturnRows(sqlmock.NewRows([]string{"modulus"}).AddRow(1))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS chain\\.address2blocks_polkadot_chain_0 PARTITION OF").
+			WillReturnError(fmt.Errorf("permission denied"))
+		expectMissing(mock)
+		// the block is committed without its address
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectCommit()
+
+		if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if got := database.BlocksWithoutAddresses(); got != 1 {
+			t.Errorf("Expected 1 block saved without addresses, got %d", got)
+		}
+		if inserted, _ := database.UpsertCounts(); inserted != 1 {
+			t.Errorf("Expected 1 inserted block, got %d", inserted)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestIsMissingPartition(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{&pq.Error{Code: "23514", Message: `no partition of relation "address2blocks_polkadot_chain" found for row`}, true},
+		{fmt.Errorf("saving: %w", &pq.Error{Code: "23514", Message: `no partition of relation "address2blocks_polkadot_chain" found for row`}), true},
+		// the blocks table or the addresses of another chain are not recreated
+		{&pq.Error{Code: "23514", Message: `no partition of relation "blocks_polkadot_chain" found for row`}, false},
+		{&pq.Error{Code: "23514", Message: `no partition of relation "address2blocks_polkadot_chain2" found for row`}, false},
+		{&pq.Error{Code: "23514", Message: `new row for relation "address2blocks_polkadot_chain" violates check constraint`}, false},
+		{errors.New(`no partition of relation "address2blocks_polkadot_chain" found for row`), false},
+		{nil, false},
+	} {
+		if got := isMissingPartition(tc.err, "polkadot", "chain"); got != tc.expected {
+			t.Errorf("isMissingPartition(%v) = %v, expected %v", tc.err, got, tc.expected)
+		}
+	}
+}
+
+func TestSaveGenesisBlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WithArgs("0", sqlmock.AnyArg(), "0x00", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	genesis := BlockData{
+		ID:             "0",
+		Hash:           "0x00",
+		ParentHash:     "0x0000000000000000000000000000000000000000000000000000000000000000",
+		StateRoot:      "0x01",
+		ExtrinsicsRoot: "0x02",
+		Extrinsics:     json.RawMessage(`[]`),
+	}
+	if err := database.Save([]BlockData{genesis}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := database.TimestampFallbacks(); got != 0 {
+		t.Errorf("Expected no timestamp fallback for the genesis block, got %d", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDoUpgradeRecordsSchemaVersion(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+
+	// upgrading twice keeps a single row
+	for range 2 {
+		if err := database.DoUpgrade(); err != nil {
+			t.Fatalf("DoUpgrade: %v", err)
+		}
+	}
+	version, err := database.ReadSchemaVersion()
+	if err != nil {
+		t.Fatalf("ReadSchemaVersion: %v", err)
+	}
+	if version != SQLDatabaseSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SQLDatabaseSchemaVersion, version)
+	}
+
+	if _, err := db.Exec("DELETE FROM dotidx_version"); err != nil {
+		t.Fatalf("Error emptying dotidx_version: %v", err)
+	}
+	if version, err := database.ReadSchemaVersion(); err != nil || version != 0 {
+		t.Errorf("Expected version 0 without a recorded version, got %d %v", version, err)
+	}
+}
+
+func TestSaveQuarantinesInvalidBlocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	extrinsics := json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"}}]`)
+	// the sidecar response had no hash
+	missingHash := BlockData{ID: "1", ParentHash: "0x00", StateRoot: "0x10", ExtrinsicsRoot: "0x11", Extrinsics: extrinsics}
+	valid := BlockData{ID: "2", Hash: "0x02", ParentHash: "0x01", StateRoot: "0x20", ExtrinsicsRoot: "0x21", Extrinsics: extrinsics}
+
+	mock.ExpectExec("^\\s*INSERT INTO chain\\.failed_blocks ").
+		WithArgs("polkadot", "chain", "1", "", "block 1 has no hash", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WithArgs("2", sqlmock.AnyArg(), "0x02", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	if err := database.Save([]BlockData{missingHash, valid}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := database.QuarantinedBlocks(); got != 1 {
+		t.Errorf("Expected 1 quarantined block, got %d", got)
+	}
+	if inserted, _ := database.UpsertCounts(); inserted != 1 {
+		t.Errorf("Expected only the valid block to be stored, got %d", inserted)
+	}
+
+	// a batch without a valid block does not open a transaction
+	mock.ExpectExec("^\\s*INSERT INTO chain\\.failed_blocks ").
+		WithArgs("polkadot", "chain", "1", "", "block 1 has no hash", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := database.Save([]BlockData{missingHash}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCreateTableFailedBlocks(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+
+	if err := database.DoUpgrade(); err != nil {
+		t.Fatalf("DoUpgrade: %v", err)
+	}
+	block := BlockData{ID: "1", ParentHash: "0x00"}
+	// quarantining the same block twice keeps the latest reason
+	for _, reason := range []string{"first", "block 1 has no hash"} {
+		if err := database.saveFailedBlock(block, "polkadot", "chain", reason); err != nil {
+			t.Fatalf("saveFailedBlock: %v", err)
+		}
+	}
+	var count int
+	var reason string
+	row := db.QueryRow("SELECT COUNT(*), MAX(reason) FROM " + database.getTableName(FailedBlocksTableName()))
+	if err := row.Scan(&count, &reason); err != nil {
+		t.Fatalf("Error reading failed_blocks: %v", err)
+	}
+	if count != 1 || reason != "block 1 has no hash" {
+		t.Errorf("Expected one failed block with the latest reason, got %d %q", count, reason)
+	}
+}
+
+func TestBlocksPartitionBoundaries(t *testing.T) {
+	var statements []string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(
+		func(expected, actual string) error {
+			statements = append(statements, actual)
+			return nil
+		})))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+
+	// November of this year up to December five years later
+	year := time.Now().Year()
+	for range 2 + 5*12 {
+		mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	database := NewSQLDatabaseWithDB(db)
+	first := fmt.Sprintf("%d-11-20 10:00:00.0000", year)
+	if err := database.CreateTableBlocksPartitions("polkadot", "chain", first, ""); err != nil {
+		t.Fatalf("CreateTableBlocksPartitions: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+
+	type partitionRange struct{ name, from, to string }
+	partitionRegexp := regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\S+) PARTITION OF \S+\s+FOR VALUES FROM \(timestamp '([^']+)'\) TO \(timestamp '([^']+)'\)`)
+	var created []partitionRange
+	for _, statement := range statements {
+		if m := partitionRegexp.FindStringSubmatch(statement); m != nil {
+			created = append(created, partitionRange{m[1], m[2], m[3]})
+		}
+	}
+	if len(created) != len(statements) {
+		t.Fatalf("Expected a partition per statement, got %d of %d", len(created), len(statements))
+	}
+
+	// a block on each side of every month boundary of two years, December
+	// to January included, lands in the partition of its month
+	table := GetBlocksTableName("polkadot", "chain")
+	for month := range 24 {
+		boundary := time.Date(year, time.December+time.Month(month), 1, 0, 0, 0, 0, time.Local)
+		for _, at := range []time.Time{boundary.Add(-time.Millisecond), boundary} {
+			block := BlockData{
+				ID:         "1",
+				Extrinsics: json.RawMessage(fmt.Sprintf(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"%d"}}]`, at.UnixMilli())),
+			}
+			timestamps, _ := blockTimestamps([]BlockData{block}, time.Now())
+			createdAt := timestamps[0]
+
+			// PostgreSQL routes the row to the range holding created_at
+			var got []string
+			for _, partition := range created {
+				if partition.from <= createdAt && createdAt < partition.to {
+					got = append(got, partition.name)
+				}
+			}
+			want := fmt.Sprintf("%s_%04d_%02d", table, at.Year(), int(at.Month()))
+			if len(got) != 1 || got[0] != want {
+				t.Errorf("Expected a block created at %s in %s, got %v", createdAt, want, got)
+			}
+		}
+	}
+}
+
+func TestSaveSkipAddresses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+	database.SetSkipAddresses("polkadot", "chain", true)
+
+	address := "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+	block := BlockData{
+		ID:             "1",
+		Hash:           "0x01",
+		ParentHash:     "0x00",
+		StateRoot:      "0x10",
+		ExtrinsicsRoot: "0x11",
+		Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"},"signature":{"signer":{"id":"` + address + `"}}}]`),
+	}
+	// the block only, the unexpected address insert would fail the save
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectCommit()
+
+	if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := database.BlocksWithoutAddresses(); got != 0 {
+		t.Errorf("Expected skipped addresses not to count as missing, got %d", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// BlockCopy is one hash saved for a block_id
+type BlockCopy struct {
+	Hash      string
+	Finalized bool
+	// a block saved at the next height has Hash as its parent hash
+	Linked bool
+	// rows saved with Hash, more than one when the timestamp differed
+	Rows int
+}
+
+// DuplicateBlock is a block_id saved more than once. The primary key is
+// (hash, created_at) so a block replaced by a reorg after it was indexed
+// stays next to the canonical one, and GetExistingBlocks cannot tell them
+// apart.
+type DuplicateBlock struct {
+	BlockID int
+	Copies  []BlockCopy
+	// hash of the canonical copy, empty when it cannot be decided
+	Keep string
+}
+
+func (d DuplicateBlock) String() string {
+	if d.Keep == "" {
+		return fmt.Sprintf("block %d has %d copies, undecided", d.BlockID, len(d.Copies))
+	}
+	return fmt.Sprintf("block %d has %d copies, keeping %s", d.BlockID, len(d.Copies), d.Keep)
+}
+
+// canonicalCopy returns the finalized copy, or among the copies left the one
+// the next block links to. It returns "" when several copies are equally
+// good, which is also the case of the blocks sharing a height with elastic
+// scaling.
+func canonicalCopy(copies []BlockCopy) string {
+	rank := func(c BlockCopy) int {
+		r := 0
+		if c.Finalized {
+			r += 2
+		}
+		if c.Linked {
+			r++
+		}
+		return r
+	}
+	keep, best, tie := "", -1, false
+	for _, c := range copies {
+		switch r := rank(c); {
+		case r > best:
+			keep, best, tie = c.Hash, r, false
+		case r == best:
+			tie = true
+		}
+	}
+	if tie {
+		return ""
+	}
+	return keep
+}
+
+// FindDuplicateBlocks returns the block_ids between startRange and endRange
+// saved more than once in the blocks table of relayChain:chain, with the
+// copy to keep
+func (s *SQLDatabase) FindDuplicateBlocks(ctx context.Context, relayChain, chain string, startRange, endRange int) ([]DuplicateBlock, error) {
+	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
+	query := s.prepareQuery(fmt.Sprintf(`
+SELECT d.block_id, d.hash, d.finalized,
+       EXISTS (SELECT 1 FROM %[1]s c WHERE c.block_id = d.block_id + 1 AND c.parent_hash = d.hash)
+FROM %[1]s d
+WHERE d.block_id IN (
+  SELECT block_id FROM %[1]s
+  WHERE block_id BETWEEN $1 AND $2
+  GROUP BY block_id HAVING COUNT(*) > 1
+)
+ORDER BY d.block_id, d.hash;`, blocksTable))
+
+	rows, err := s.db.QueryContext(ctx, query, startRange, endRange)
+	if err != nil {
+		return nil, fmt.Errorf("error querying duplicate blocks of %s: %w", blocksTable, err)
+	}
+	defer rows.Close()
+
+	duplicates := make([]DuplicateBlock, 0)
+	for rows.Next() {
+		var blockID int
+		var c BlockCopy
+		if err := rows.Scan(&blockID, &c.Hash, &c.Finalized, &c.Linked); err != nil {
+			return nil, fmt.Errorf("error scanning duplicate block: %w", err)
+		}
+		c.Rows = 1
+		if n := len(duplicates); n == 0 || duplicates[n-1].BlockID != blockID {
+			duplicates = append(duplicates, DuplicateBlock{BlockID: blockID})
+		}
+		d := &duplicates[len(duplicates)-1]
+		if n := len(d.Copies); n > 0 && d.Copies[n-1].Hash == c.Hash {
+			last := &d.Copies[n-1]
+			last.Rows++
+			last.Finalized = last.Finalized || c.Finalized
+			last.Linked = last.Linked || c.Linked
+			continue
+		}
+		d.Copies = append(d.Copies, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over duplicate blocks: %w", err)
+	}
+
+	for i := range duplicates {
+		duplicates[i].Keep = canonicalCopy(duplicates[i].Copies)
+	}
+	return duplicates, nil
+}
+
+// RemoveDuplicateBlocks deletes, in one transaction, the copies other than
+// Keep and the extra rows of Keep but the latest one. Undecided duplicates
+// are left as they are. The address2blocks rows do not say which copy they
+// come from and are kept. It returns the number of rows deleted.
+func (s *SQLDatabase) RemoveDuplicateBlocks(ctx context.Context, relayChain, chain string, duplicates []DuplicateBlock) (int64, error) {
+	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
+	removeCopy := s.prepareQuery(fmt.Sprintf(
+		"DELETE FROM %s WHERE block_id = $1 AND hash = $2;", blocksTable))
+	removeOlderRows := s.prepareQuery(fmt.Sprintf(
+		"DELETE FROM %[1]s WHERE block_id = $1 AND hash = $2 AND created_at < "+
+			"(SELECT MAX(created_at) FROM %[1]s WHERE block_id = $3 AND hash = $4);", blocksTable))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var removed int64
+	for _, d := range duplicates {
+		if d.Keep == "" {
+			log.Printf("Skipping %s", d)
+			continue
+		}
+		for _, c := range d.Copies {
+			query, args := removeCopy, []any{d.BlockID, c.Hash}
+			if c.Hash == d.Keep {
+				if c.Rows < 2 {
+					continue
+				}
+				query, args = removeOlderRows, []any{d.BlockID, c.Hash, d.BlockID, c.Hash}
+			}
+			result, err := tx.ExecContext(ctx, query, args...)
+			if err != nil {
+				return 0, fmt.Errorf("error removing block %d %s: %w", d.BlockID, c.Hash, err)
+			}
+			n, _ := result.RowsAffected()
+			removed += n
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing the removal of duplicate blocks: %w", err)
+	}
+	return removed, nil
+}
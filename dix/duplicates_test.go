@@ -0,0 +1,127 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestCanonicalCopy(t *testing.T) {
+	tests := []struct {
+		name   string
+		copies []BlockCopy
+		keep   string
+	}{
+		{"finalized wins", []BlockCopy{{Hash: "0xa", Linked: true}, {Hash: "0xb", Finalized: true}}, "0xb"},
+		{"linked wins", []BlockCopy{{Hash: "0xa"}, {Hash: "0xb", Linked: true}}, "0xb"},
+		{"finalized and linked", []BlockCopy{{Hash: "0xa", Finalized: true}, {Hash: "0xb", Finalized: true, Linked: true}}, "0xb"},
+		{"undecided", []BlockCopy{{Hash: "0xa"}, {Hash: "0xb"}}, ""},
+		{"both finalized", []BlockCopy{{Hash: "0xa", Finalized: true}, {Hash: "0xb", Finalized: true}}, ""},
+		{"same hash twice", []BlockCopy{{Hash: "0xa", Rows: 2}}, "0xa"},
+	}
+	for _, tc := range tests {
+		if got := canonicalCopy(tc.copies); got != tc.keep {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.keep, got)
+		}
+	}
+}
+
+func TestRemoveDuplicateBlocks(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableBlocks("polkadot", "polkadot"); err != nil {
+		t.Fatalf("CreateTableBlocks: %v", err)
+	}
+	blocksTable := database.getTableName(GetBlocksTableName("polkadot", "polkadot"))
+
+	for _, row := range []struct {
+		id        int
+		createdAt string
+		hash      string
+		parent    string
+		finalized bool
+	}{
+		{10, "2026-10-16 12:00:00", "0x10", "0x09", true},
+		// 11 was reorged after it was indexed, 12 links to 0x11b
+		{11, "2026-10-16 12:00:05", "0x11a", "0x10", false},
+		{11, "2026-10-16 12:00:06", "0x11b", "0x10", true},
+		{12, "2026-10-16 12:00:12", "0x12", "0x11b", false},
+		// 13 was saved twice with different timestamps
+		{13, "2026-10-16 12:00:18", "0x13", "0x12", false},
+		{13, "2026-10-16 12:00:19", "0x13", "0x12", false},
+		// 14 has two copies nothing tells apart
+		{14, "2026-10-16 12:00:24", "0x14a", "0x13", false},
+		{14, "2026-10-16 12:00:25", "0x14b", "0x13", false},
+	} {
+		if _, err := db.Exec(`INSERT INTO `+blocksTable+` (block_id, created_at, hash, parent_hash, state_root,
+			extrinsics_root, author_id, finalized) VALUES (?, ?, ?, ?, '', '', '', ?)`,
+			row.id, row.createdAt, row.hash, row.parent, row.finalized); err != nil {
+			t.Fatalf("Error inserting block %d: %v", row.id, err)
+		}
+	}
+
+	ctx := context.Background()
+	duplicates, err := database.FindDuplicateBlocks(ctx, "polkadot", "polkadot", 0, 100)
+	if err != nil {
+		t.Fatalf("FindDuplicateBlocks: %v", err)
+	}
+	keep := make(map[int]string)
+	for _, d := range duplicates {
+		keep[d.BlockID] = d.Keep
+	}
+	if len(duplicates) != 3 || keep[11] != "0x11b" || keep[13] != "0x13" || keep[14] != "" {
+		t.Fatalf("Unexpected duplicates %v", duplicates)
+	}
+
+	removed, err := database.RemoveDuplicateBlocks(ctx, "polkadot", "polkadot", duplicates)
+	if err != nil {
+		t.Fatalf("RemoveDuplicateBlocks: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 rows removed, got %d", removed)
+	}
+
+	rows, err := db.Query(`SELECT block_id, hash, created_at FROM ` + blocksTable + ` ORDER BY block_id, hash`)
+	if err != nil {
+		t.Fatalf("Error reading blocks: %v", err)
+	}
+	defer rows.Close()
+	var left []string
+	for rows.Next() {
+		var id int
+		var hash, createdAt string
+		if err := rows.Scan(&id, &hash, &createdAt); err != nil {
+			t.Fatalf("Error scanning block: %v", err)
+		}
+		left = append(left, hash+"@"+createdAt)
+	}
+	expected := []string{
+		"0x10@2026-10-16 12:00:00",
+		"0x11b@2026-10-16 12:00:06",
+		"0x12@2026-10-16 12:00:12",
+		"0x13@2026-10-16 12:00:19",
+		"0x14a@2026-10-16 12:00:24",
+		"0x14b@2026-10-16 12:00:25",
+	}
+	if len(left) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, left)
+	}
+	for i := range expected {
+		if left[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, left)
+			break
+		}
+	}
+
+	duplicates, err = database.FindDuplicateBlocks(ctx, "polkadot", "polkadot", 0, 100)
+	if err != nil {
+		t.Fatalf("FindDuplicateBlocks: %v", err)
+	}
+	if len(duplicates) != 1 || duplicates[0].BlockID != 14 {
+		t.Errorf("Expected only the undecided block 14 left, got %v", duplicates)
+	}
+}
@@ -0,0 +1,96 @@
+package dix
+
+import "sync"
+
+// Topic is the kind of an Event
+type Topic string
+
+const (
+	// TopicNewBlock carries each committed block
+	TopicNewBlock Topic = "new_block"
+	// TopicNewAddress carries each address found in a committed block
+	TopicNewAddress Topic = "new_address"
+)
+
+// Event is published on the EventBus once the database committed it
+type Event struct {
+	Topic      Topic
+	RelayChain string
+	Chain      string
+	// Block is set for TopicNewBlock
+	Block BlockData
+	// Address and BlockID are set for TopicNewAddress
+	Address string
+	BlockID string
+}
+
+// EventBus hands what this process saves to in-process subscribers.
+// Publishing never blocks: a subscriber whose buffer is full is dropped and
+// its channel closed.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	topic      Topic
+	relayChain string
+	chain      string
+	ch         chan Event
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns the events of topic for relayChain:chain from now on and
+// a function to stop receiving them. The channel is closed when the
+// subscriber is dropped or cancelled.
+func (b *EventBus) Subscribe(topic Topic, relayChain, chain string, buffer int) (<-chan Event, func()) {
+	sub := &subscriber{
+		topic:      topic,
+		relayChain: relayChain,
+		chain:      chain,
+		ch:         make(chan Event, max(buffer, 1)),
+	}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub.ch, func() { b.drop(sub) }
+}
+
+// Publish sends events to their subscribers
+func (b *EventBus) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, event := range events {
+		for sub := range b.subscribers {
+			if sub.topic != event.Topic || sub.relayChain != event.RelayChain || sub.chain != event.Chain {
+				continue
+			}
+			select {
+			case sub.ch <- event:
+			default:
+				// too slow, it will have to catch up from the database
+				delete(b.subscribers, sub)
+				close(sub.ch)
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of live subscribers
+func (b *EventBus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func (b *EventBus) drop(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,149 @@
+package dix
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEventBusPublishSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	blocks, cancelBlocks := bus.Subscribe(TopicNewBlock, "polkadot", "polkadot", 4)
+	defer cancelBlocks()
+	addresses, cancelAddresses := bus.Subscribe(TopicNewAddress, "polkadot", "polkadot", 4)
+	defer cancelAddresses()
+
+	bus.Publish(
+		Event{Topic: TopicNewBlock, RelayChain: "polkadot", Chain: "polkadot", Block: BlockData{ID: "1"}},
+		Event{Topic: TopicNewBlock, RelayChain: "kusama", Chain: "kusama", Block: BlockData{ID: "2"}},
+		Event{Topic: TopicNewAddress, RelayChain: "polkadot", Chain: "polkadot", Address: "1abc", BlockID: "1"},
+	)
+
+	if event := <-blocks; event.Block.ID != "1" {
+		t.Errorf("Expected block 1, got %+v", event)
+	}
+	if event := <-addresses; event.Address != "1abc" || event.BlockID != "1" {
+		t.Errorf("Expected address 1abc in block 1, got %+v", event)
+	}
+	select {
+	case event := <-blocks:
+		t.Errorf("Expected no other block, got %+v", event)
+	default:
+	}
+}
+
+func TestEventBusCancel(t *testing.T) {
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(TopicNewBlock, "polkadot", "polkadot", 1)
+	cancel()
+	// cancelling twice is harmless
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("Expected the channel to be closed")
+	}
+	if n := bus.Subscribers(); n != 0 {
+		t.Errorf("Expected no subscriber, got %d", n)
+	}
+	bus.Publish(Event{Topic: TopicNewBlock, RelayChain: "polkadot", Chain: "polkadot"})
+}
+
+func TestEventBusDropsSlowSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	slow, cancelSlow := bus.Subscribe(TopicNewBlock, "polkadot", "polkadot", 2)
+	defer cancelSlow()
+	fast, cancelFast := bus.Subscribe(TopicNewBlock, "polkadot", "polkadot", 10)
+	defer cancelFast()
+
+	done := make(chan struct{})
+	go func() {
+		for _, id := range []string{"1", "2", "3", "4"} {
+			bus.Publish(Event{Topic: TopicNewBlock, RelayChain: "polkadot", Chain: "polkadot", Block: BlockData{ID: id}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("Expected the slow subscriber to get 2 events before being dropped, got %d", received)
+	}
+	if n := bus.Subscribers(); n != 1 {
+		t.Errorf("Expected 1 subscriber left, got %d", n)
+	}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if event := <-fast; event.Block.ID != id {
+			t.Errorf("Expected block %s, got %s", id, event.Block.ID)
+		}
+	}
+}
+
+func TestSavePublishesAfterCommit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+	bus := NewEventBus()
+	database.SetEventBus(bus)
+	blocks, cancelBlocks := bus.Subscribe(TopicNewBlock, "polkadot", "chain", 4)
+	defer cancelBlocks()
+	addresses, cancelAddresses := bus.Subscribe(TopicNewAddress, "polkadot", "chain", 4)
+	defer cancelAddresses()
+
+	address := "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+	block := BlockData{
+		ID:             "1",
+		Hash:           "0x01",
+		ParentHash:     "0x00",
+		StateRoot:      "0x10",
+		ExtrinsicsRoot: "0x11",
+		Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"},"signature":{"signer":{"id":"` + address + `"}}}]`),
+	}
+
+	// a failed commit publishes nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain ").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(sqlmock.ErrCancelled)
+	if err := database.Save([]BlockData{block}, "polkadot", "chain"); err == nil {
+		t.Fatal("Expected the commit to fail")
+	}
+	select {
+	case event := <-blocks:
+		t.Fatalf("Expected nothing published after a failed commit, got %+v", event)
+	default:
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain ").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := database.Save([]BlockData{block}, "polkadot", "chain"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if event := <-blocks; event.Block.Hash != "0x01" {
+		t.Errorf("Expected block 0x01, got %+v", event)
+	}
+	if event := <-addresses; event.Address != address || event.BlockID != "1" {
+		t.Errorf("Expected %s in block 1, got %+v", address, event)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
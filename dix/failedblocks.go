@@ -0,0 +1,117 @@
+package dix
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// FailedBlocksTableName returns the table of the blocks of all the chains
+// which failed ValidateBlock
+func FailedBlocksTableName() string {
+	return schemaName + ".failed_blocks"
+}
+
+// CreateTableFailedBlocks creates the table where invalid blocks are
+// quarantined with the reason they were rejected
+func (s *SQLDatabase) CreateTableFailedBlocks() error {
+	tableName := s.getTableName(FailedBlocksTableName())
+
+	var query string
+	if s.dialect == DialectSQLite {
+		query = fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    relay_chain TEXT NOT NULL,
+    chain       TEXT NOT NULL,
+    block_id    TEXT NOT NULL,
+    hash        TEXT NOT NULL,
+    reason      TEXT NOT NULL,
+    block       TEXT,
+    failed_at   TEXT DEFAULT (datetime('now')),
+    PRIMARY KEY (relay_chain, chain, block_id, hash)
+);`, tableName)
+	} else {
+		query = fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    relay_chain TEXT NOT NULL,
+    chain       TEXT NOT NULL,
+    block_id    TEXT NOT NULL,
+    hash        TEXT NOT NULL,
+    reason      TEXT NOT NULL,
+    block       JSONB,
+    failed_at   TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (relay_chain, chain, block_id, hash)
+);`, tableName)
+	}
+
+	if _, err := s.db.Exec(query); err != nil {
+		s.LogSQL(query)
+		return fmt.Errorf("error creating %s table: %w", tableName, err)
+	}
+	return nil
+}
+
+// quarantineInvalidBlocks moves the blocks failing ValidateBlock to the
+// failed_blocks table and returns the others, in order
+func (s *SQLDatabase) quarantineInvalidBlocks(items []BlockData, relayChain, chain string) ([]BlockData, error) {
+	valid := items[:0:0]
+	for _, item := range items {
+		err := ValidateBlock(item)
+		if err == nil {
+			valid = append(valid, item)
+			continue
+		}
+		log.Printf("warning: quarantining block %q of %s:%s: %v", item.ID, relayChain, chain, err)
+		if qerr := s.saveFailedBlock(item, relayChain, chain, err.Error()); qerr != nil {
+			return nil, qerr
+		}
+		s.blocksQuarantined.Add(1)
+	}
+	return valid, nil
+}
+
+// QuarantineParentHashMismatches records the blocks of mismatches, found in
+// blocks, in the failed_blocks table and counts them in the metrics
+func (s *SQLDatabase) QuarantineParentHashMismatches(blocks []BlockData, mismatches []ParentHashMismatch, relayChain, chain string) error {
+	s.metrics.RecordParentHashMismatches(len(mismatches))
+	for _, mismatch := range mismatches {
+		for _, block := range blocks {
+			if block.ID != strconv.Itoa(mismatch.BlockID) || block.ParentHash != mismatch.ParentHash {
+				continue
+			}
+			if err := s.saveFailedBlock(block, relayChain, chain, "parent hash mismatch: "+mismatch.String()); err != nil {
+				return err
+			}
+			s.blocksQuarantined.Add(1)
+		}
+	}
+	return nil
+}
+
+// saveFailedBlock records block and why it was rejected, a block rejected
+// again keeps the latest reason
+func (s *SQLDatabase) saveFailedBlock(block BlockData, relayChain, chain, reason string) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("error encoding failed block %q: %w", block.ID, err)
+	}
+	query := s.prepareQuery(fmt.Sprintf(`
+INSERT INTO %s (relay_chain, chain, block_id, hash, reason, block)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (relay_chain, chain, block_id, hash) DO UPDATE SET
+reason = EXCLUDED.reason,
+block = EXCLUDED.block;`,
+		s.getTableName(FailedBlocksTableName()),
+	))
+	if _, err := s.db.Exec(query, relayChain, chain, block.ID, block.Hash, reason, string(data)); err != nil {
+		return fmt.Errorf("error quarantining block %q: %w", block.ID, err)
+	}
+	return nil
+}
+
+// QuarantinedBlocks returns how many blocks failed ValidateBlock or
+// VerifyParentHashes and were moved to the failed_blocks table
+func (s *SQLDatabase) QuarantinedBlocks() int64 {
+	return s.blocksQuarantined.Load()
+}
@@ -0,0 +1,68 @@
+package dix
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "postgresql.conf")
+	if err := os.WriteFile(path, []byte("shared_buffers = 16GB\n"), 0o644); err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+
+	// the generation fails half way through
+	err := WriteFileAtomic(path, 0o600, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "shared_buf"); err != nil {
+			return err
+		}
+		return errors.New("template: no such field")
+	})
+	if err == nil || !strings.Contains(err.Error(), "no such field") {
+		t.Fatalf("Expected the template error, got %v", err)
+	}
+	assertFile(t, path, "shared_buffers = 16GB\n", 0o644)
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %d files", len(entries))
+	}
+
+	err = WriteFileAtomic(path, 0o600, func(w io.Writer) error {
+		_, err := io.WriteString(w, "shared_buffers = 9GB\n")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	assertFile(t, path, "shared_buffers = 9GB\n", 0o600)
+
+	// a missing directory fails before anything is written
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "pg_hba.conf"), 0o600, func(w io.Writer) error {
+		t.Error("Expected no write")
+		return nil
+	}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func assertFile(t *testing.T, path, content string, perm os.FileMode) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", path, err)
+	}
+	if string(data) != content {
+		t.Errorf("Expected %q in %s, got %q", content, path, data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", path, err)
+	}
+	if info.Mode().Perm() != perm {
+		t.Errorf("Expected %s to be %v, got %v", path, perm, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,90 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+)
+
+// BlockRange is an inclusive range of block ids fetched with one request
+type BlockRange struct {
+	First int
+	Last  int
+}
+
+// Len returns the number of blocks of the range
+func (r BlockRange) Len() int {
+	return r.Last - r.First + 1
+}
+
+// IDs returns the block ids of the range in order
+func (r BlockRange) IDs() []int {
+	ids := make([]int, 0, r.Len())
+	for id := r.First; id <= r.Last; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (r BlockRange) String() string {
+	return fmt.Sprintf("[%d, %d]", r.First, r.Last)
+}
+
+// MissingBlocks returns, in order, the ids between startRange and endRange
+// included which have no row in the blocks table of relayChain:chain. The
+// database computes them with one anti join against the series of ids, the
+// blocks already saved are never sent back.
+func (s *SQLDatabase) MissingBlocks(ctx context.Context, relayChain, chain string, startRange, endRange int) ([]int, error) {
+	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
+	query := fmt.Sprintf(`
+SELECT ids.id FROM generate_series($1::integer, $2::integer) AS ids(id)
+WHERE NOT EXISTS (SELECT 1 FROM %s b WHERE b.block_id = ids.id)
+ORDER BY ids.id;`, blocksTable)
+	if s.dialect == DialectSQLite {
+		// generate_series is an extension of SQLite
+		query = fmt.Sprintf(`
+WITH RECURSIVE ids(id) AS (SELECT $1 UNION ALL SELECT id + 1 FROM ids WHERE id < $2)
+SELECT ids.id FROM ids
+WHERE NOT EXISTS (SELECT 1 FROM %s b WHERE b.block_id = ids.id)
+ORDER BY ids.id;`, blocksTable)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.prepareQuery(query), startRange, endRange)
+	if err != nil {
+		return nil, fmt.Errorf("error looking for missing blocks of %s: %w", blocksTable, err)
+	}
+	defer rows.Close()
+
+	missing := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning block ID: %w", err)
+		}
+		missing = append(missing, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error looking for missing blocks of %s: %w", blocksTable, err)
+	}
+	return missing, nil
+}
+
+// CoalesceBlockRanges groups the sorted ids into ranges, each at most
+// maxSize long so that it fits in one range request, 0 or less leaves them
+// unbounded. Two ids with at most maxGap blocks between them share a range:
+// those blocks are already saved and are fetched again, a few redundant
+// blocks cost less than one more request.
+func CoalesceBlockRanges(ids []int, maxSize, maxGap int) []BlockRange {
+	maxGap = max(maxGap, 0)
+	ranges := make([]BlockRange, 0)
+	for _, id := range ids {
+		if n := len(ranges); n > 0 {
+			last := &ranges[n-1]
+			if id-last.Last-1 <= maxGap && (maxSize <= 0 || id-last.First < maxSize) {
+				last.Last = id
+				continue
+			}
+		}
+		ranges = append(ranges, BlockRange{First: id, Last: id})
+	}
+	return ranges
+}
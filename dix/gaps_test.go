@@ -0,0 +1,135 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCoalesceBlockRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		ids      []int
+		maxSize  int
+		expected []BlockRange
+	}{
+		{"nothing missing", nil, 10, []BlockRange{}},
+		{"one block", []int{7}, 10, []BlockRange{{7, 7}}},
+		{"gaps", []int{1, 2, 3, 7, 9, 10}, 10, []BlockRange{{1, 3}, {7, 7}, {9, 10}}},
+		{"split at the batch size", []int{1, 2, 3, 4, 5, 6, 7, 20, 21}, 3, []BlockRange{{1, 3}, {4, 6}, {7, 7}, {20, 21}}},
+		{"unbounded", []int{1, 2, 3, 4, 5, 8}, 0, []BlockRange{{1, 5}, {8, 8}}},
+	}
+	for _, tc := range tests {
+		got := CoalesceBlockRanges(tc.ids, tc.maxSize, 0)
+		if !slices.Equal(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+		fetched := 0
+		for _, r := range got {
+			if tc.maxSize > 0 && r.Len() > tc.maxSize {
+				t.Errorf("%s: range %s is longer than %d", tc.name, r, tc.maxSize)
+			}
+			fetched += len(r.IDs())
+		}
+		if fetched != len(tc.ids) {
+			t.Errorf("%s: expected %d blocks to fetch, got %d", tc.name, len(tc.ids), fetched)
+		}
+	}
+}
+
+func TestCoalesceBlockRangesGapTolerance(t *testing.T) {
+	// sparse ids, as left by a few failed batches
+	ids := []int{100, 102, 103, 107, 108, 120, 121, 122, 130, 500}
+	tests := []struct {
+		maxSize, maxGap int
+		expected        []BlockRange
+	}{
+		{10, 0, []BlockRange{{100, 100}, {102, 103}, {107, 108}, {120, 122}, {130, 130}, {500, 500}}},
+		// 101 is fetched again, 104 to 106 are too many
+		{10, 1, []BlockRange{{100, 103}, {107, 108}, {120, 122}, {130, 130}, {500, 500}}},
+		{10, 3, []BlockRange{{100, 108}, {120, 122}, {130, 130}, {500, 500}}},
+		// 130 would make the range 11 blocks long
+		{10, 10, []BlockRange{{100, 108}, {120, 122}, {130, 130}, {500, 500}}},
+		{20, 10, []BlockRange{{100, 108}, {120, 130}, {500, 500}}},
+		{0, 20, []BlockRange{{100, 130}, {500, 500}}},
+		{0, -1, []BlockRange{{100, 100}, {102, 103}, {107, 108}, {120, 122}, {130, 130}, {500, 500}}},
+	}
+	for _, tc := range tests {
+		got := CoalesceBlockRanges(ids, tc.maxSize, tc.maxGap)
+		if !slices.Equal(got, tc.expected) {
+			t.Errorf("size %d gap %d: expected %v, got %v", tc.maxSize, tc.maxGap, tc.expected, got)
+		}
+		missing := 0
+		for _, r := range got {
+			for _, id := range r.IDs() {
+				if slices.Contains(ids, id) {
+					missing++
+				}
+			}
+		}
+		if missing != len(ids) {
+			t.Errorf("size %d gap %d: expected the %d missing ids to be fetched, got %d", tc.maxSize, tc.maxGap, len(ids), missing)
+		}
+	}
+}
+
+func TestMissingBlocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM generate_series($1::integer, $2::integer) AS ids(id)
+WHERE NOT EXISTS (SELECT 1 FROM chain.blocks_polkadot_polkadot b WHERE b.block_id = ids.id)`)).
+		WithArgs(100, 200).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101).AddRow(150))
+
+	missing, err := database.MissingBlocks(context.Background(), "polkadot", "polkadot", 100, 200)
+	if err != nil {
+		t.Fatalf("MissingBlocks: %v", err)
+	}
+	if !slices.Equal(missing, []int{101, 150}) {
+		t.Errorf("Expected [101 150], got %v", missing)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMissingBlocksSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableBlocks("polkadot", "polkadot"); err != nil {
+		t.Fatalf("CreateTableBlocks: %v", err)
+	}
+	blocksTable := database.getTableName(GetBlocksTableName("polkadot", "polkadot"))
+	for _, id := range []int{10, 11, 13, 16} {
+		if _, err := db.Exec(`INSERT INTO `+blocksTable+` (block_id, created_at, hash, parent_hash, state_root,
+			extrinsics_root, author_id, finalized, extrinsics) VALUES (?, '2026-01-15 08:30:00', '', '', '', '', '', true, '[]')`,
+			id); err != nil {
+			t.Fatalf("Error inserting block %d: %v", id, err)
+		}
+	}
+
+	missing, err := database.MissingBlocks(context.Background(), "polkadot", "polkadot", 9, 17)
+	if err != nil {
+		t.Fatalf("MissingBlocks: %v", err)
+	}
+	if !slices.Equal(missing, []int{9, 12, 14, 15, 17}) {
+		t.Errorf("Expected [9 12 14 15 17], got %v", missing)
+	}
+	ranges := CoalesceBlockRanges(missing, 100, 0)
+	if !slices.Equal(ranges, []BlockRange{{9, 9}, {12, 12}, {14, 15}, {17, 17}}) {
+		t.Errorf("Unexpected ranges %v", ranges)
+	}
+}
@@ -0,0 +1,80 @@
+package dix
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// InFlightBatches bounds the batches held in memory at once, from the moment
+// they are fetched until they are saved, across all the chains indexed by one
+// process. A nil limit does not bound anything.
+type InFlightBatches struct {
+	slots chan struct{}
+}
+
+// NewInFlightBatches returns a limit of n batches, nil when n is 0
+func NewInFlightBatches(n int) *InFlightBatches {
+	if n <= 0 {
+		return nil
+	}
+	return &InFlightBatches{slots: make(chan struct{}, n)}
+}
+
+// batchSlot is the slot of one batch, it is freed once the worker and the
+// queued saves of the batch are all done with it
+type batchSlot struct {
+	limit *InFlightBatches
+	refs  atomic.Int64
+}
+
+func (s *batchSlot) retain() {
+	s.refs.Add(1)
+}
+
+func (s *batchSlot) release() {
+	if s.refs.Add(-1) == 0 {
+		<-s.limit.slots
+	}
+}
+
+type batchSlotKey struct{}
+
+// Acquire waits for a free slot, it fails when ctx is done first. The
+// returned context carries the slot to the saves of the batch: a SaveQueue
+// keeps it until the blocks it queued are saved. done must be called once
+// the batch is processed.
+func (l *InFlightBatches) Acquire(ctx context.Context) (context.Context, func(), error) {
+	if l == nil {
+		return ctx, func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx, nil, ctx.Err()
+	}
+	slot := &batchSlot{limit: l}
+	slot.retain()
+	return context.WithValue(ctx, batchSlotKey{}, slot), slot.release, nil
+}
+
+// batchSlotFrom returns the slot carried by ctx, nil if there is none
+func batchSlotFrom(ctx context.Context) *batchSlot {
+	slot, _ := ctx.Value(batchSlotKey{}).(*batchSlot)
+	return slot
+}
+
+// InFlight returns how many batches hold a slot
+func (l *InFlightBatches) InFlight() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+// Size returns how many batches may be held at once, 0 when unbounded
+func (l *InFlightBatches) Size() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
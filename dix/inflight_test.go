@@ -0,0 +1,130 @@
+package dix
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// heldBlocks counts the blocks fetched by largeReader and not yet saved
+type heldBlocks struct {
+	held, peak atomic.Int64
+}
+
+func (h *heldBlocks) add(n int) {
+	held := h.held.Add(int64(n))
+	for p := h.peak.Load(); held > p && !h.peak.CompareAndSwap(p, held); p = h.peak.Load() {
+	}
+}
+
+type tallyReader struct {
+	largeReader
+	blocks *heldBlocks
+}
+
+func (r *tallyReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error) {
+	r.blocks.add(len(blockIDs))
+	return r.largeReader.FetchBlockRange(ctx, blockIDs)
+}
+
+// sluggishDatabase takes a while to save
+type sluggishDatabase struct {
+	Database
+	blocks *heldBlocks
+}
+
+func (d *sluggishDatabase) Save(items []BlockData, relayChain, chain string) error {
+	time.Sleep(time.Millisecond)
+	d.blocks.add(-len(items))
+	return nil
+}
+
+func TestInFlightBatchesUnderLoad(t *testing.T) {
+	const (
+		limit     = 3
+		workers   = 8
+		batches   = 40
+		batchSize = 5
+	)
+	blocks := &heldBlocks{}
+	reader := &tallyReader{blocks: blocks}
+	// the queue alone would let workers+10+1 batches pile up
+	q := NewSaveQueue(&sluggishDatabase{blocks: blocks}, 10, 1)
+	inflight := NewInFlightBatches(limit)
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ids := range work {
+				ctx, done, err := inflight.Acquire(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n := inflight.InFlight(); n > limit {
+					t.Errorf("Expected at most %d batches in flight, got %d", limit, n)
+				}
+				// two blocks per save, the slot waits for the three saves
+				ProcessBlockBatch(ctx, ids, "polkadot", "polkadot", q, reader, 2100)
+				done()
+			}
+		}()
+	}
+	for i := range batches {
+		ids := make([]int, batchSize)
+		for j := range ids {
+			ids[j] = i*batchSize + j
+		}
+		work <- ids
+	}
+	close(work)
+	wg.Wait()
+	q.Drain()
+
+	if peak := blocks.peak.Load(); peak > limit*batchSize {
+		t.Errorf("Expected at most %d blocks held, got %d", limit*batchSize, peak)
+	}
+	if held := blocks.held.Load(); held != 0 {
+		t.Errorf("Expected every block to be saved, %d are not", held)
+	}
+	if n := inflight.InFlight(); n != 0 {
+		t.Errorf("Expected every slot to be freed, %d are held", n)
+	}
+}
+
+func TestInFlightBatchesCanceled(t *testing.T) {
+	inflight := NewInFlightBatches(1)
+	_, done, err := inflight.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := inflight.Acquire(ctx); err == nil {
+		t.Error("Expected Acquire to fail while the only slot is held")
+	}
+	done()
+	if inflight.InFlight() != 0 {
+		t.Errorf("Expected the slot to be freed, got %d in flight", inflight.InFlight())
+	}
+}
+
+func TestNilInFlightBatches(t *testing.T) {
+	inflight := NewInFlightBatches(0)
+	if inflight != nil {
+		t.Fatalf("Expected no limit, got %d", inflight.Size())
+	}
+	ctx, done, err := inflight.Acquire(context.Background())
+	if err != nil || ctx == nil {
+		t.Fatalf("Acquire on no limit: %v", err)
+	}
+	done()
+	if inflight.InFlight() != 0 || inflight.Size() != 0 {
+		t.Error("Expected no limit to report nothing")
+	}
+}
@@ -0,0 +1,139 @@
+package dix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// WorkerBudget bounds the workers running at once across all the chains
+// indexed by one process. A nil budget does not limit anything.
+type WorkerBudget struct {
+	slots chan struct{}
+	// slot of a single chain, see split
+	reserved chan struct{}
+	// slots taken from slots, the reserved one is released last
+	mu     sync.Mutex
+	shared int
+}
+
+func NewWorkerBudget(n int) *WorkerBudget {
+	return &WorkerBudget{slots: make(chan struct{}, max(n, 1))}
+}
+
+// GlobalWorkerBudget returns the budget shared by the chains of config:
+// global_workers, or the size of the database pool when it is not set
+func GlobalWorkerBudget(config MgrConfig) *WorkerBudget {
+	n := config.DotidxBatch.GlobalWorkers
+	if n <= 0 {
+		n = DBPoolConfigFromMgrConfig(config).MaxOpenConns
+	}
+	return NewWorkerBudget(n)
+}
+
+// split returns the budgets of chains sharing b. Each chain gets a slot of
+// its own and the rest of b is shared: busy chains cannot starve a quiet
+// one. With fewer slots than chains, nothing is reserved.
+func (b *WorkerBudget) split(chains int) []*WorkerBudget {
+	budgets := make([]*WorkerBudget, chains)
+	if b == nil {
+		return budgets
+	}
+	reserve := 0
+	if cap(b.slots) >= chains {
+		reserve = 1
+	}
+	shared := make(chan struct{}, cap(b.slots)-reserve*chains)
+	for i := range budgets {
+		budgets[i] = &WorkerBudget{slots: shared}
+		if reserve > 0 {
+			budgets[i].reserved = make(chan struct{}, reserve)
+		}
+	}
+	return budgets
+}
+
+// Acquire waits for a free slot, it fails when ctx is done first
+func (b *WorkerBudget) Acquire(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	// the shared slots are left to the other chains when possible
+	select {
+	case b.reserved <- struct{}{}:
+		return nil
+	default:
+	}
+	select {
+	case b.reserved <- struct{}{}:
+		return nil
+	case b.slots <- struct{}{}:
+		b.mu.Lock()
+		b.shared++
+		b.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (b *WorkerBudget) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shared > 0 {
+		b.shared--
+		<-b.slots
+		return
+	}
+	<-b.reserved
+}
+
+// Size returns how many workers may run at once
+func (b *WorkerBudget) Size() int {
+	if b == nil {
+		return 0
+	}
+	return cap(b.slots) + cap(b.reserved)
+}
+
+// ChainIndexer indexes one chain until its range is done or ctx is
+// canceled, its workers run within budget
+type ChainIndexer func(ctx context.Context, relayChain, chain string, budget *WorkerBudget) error
+
+// LaunchChains runs index for every configured chain at once and waits for
+// all of them, the chains share budget. A failing chain does not stop the
+// others, the errors are joined.
+func LaunchChains(ctx context.Context, parachains map[string]map[string]ParaChainConfig, budget *WorkerBudget, index ChainIndexer) error {
+	chains := 0
+	for _, relay := range parachains {
+		chains += len(relay)
+	}
+	budgets := budget.split(chains)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for _, relayChain := range slices.Sorted(maps.Keys(parachains)) {
+		for _, chain := range slices.Sorted(maps.Keys(parachains[relayChain])) {
+			chainBudget := budgets[0]
+			budgets = budgets[1:]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := index(ctx, relayChain, chain, chainBudget); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s:%s: %w", relayChain, chain, err))
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
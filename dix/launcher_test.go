@@ -0,0 +1,99 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLaunchChainsSharesBudget(t *testing.T) {
+	parachains := map[string]map[string]ParaChainConfig{
+		"polkadot": {"assethub": {}, "people": {}, "quiet": {}},
+	}
+	tasks := map[string]int{"assethub": 40, "people": 40, "quiet": 4}
+	budget := NewWorkerBudget(8)
+	// the busy chains hold their slots until the quiet one is done
+	quietDone := make(chan struct{})
+
+	var running, peak atomic.Int64
+	var mu sync.Mutex
+	finished := make(map[string]time.Time)
+	err := LaunchChains(context.Background(), parachains, budget, func(ctx context.Context, relayChain, chain string, budget *WorkerBudget) error {
+		if chain == "quiet" {
+			// the busy chains take every slot they can first
+			for deadline := time.Now().Add(time.Second); running.Load() < 7 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			defer close(quietDone)
+		}
+		var wg sync.WaitGroup
+		// every chain runs more workers than the budget allows
+		for range tasks[chain] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := budget.Acquire(ctx); err != nil {
+					t.Errorf("%s: %v", chain, err)
+					return
+				}
+				defer budget.Release()
+				n := running.Add(1)
+				for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+				}
+				if chain == "quiet" {
+					time.Sleep(2 * time.Millisecond)
+				} else {
+					<-quietDone
+				}
+				running.Add(-1)
+			}()
+		}
+		wg.Wait()
+		mu.Lock()
+		finished[chain] = time.Now()
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("LaunchChains: %v", err)
+	}
+	if got := peak.Load(); got > int64(budget.Size()) {
+		t.Errorf("Expected at most %d workers at once, got %d", budget.Size(), got)
+	}
+	if len(finished) != 3 {
+		t.Fatalf("Expected every chain to finish, got %v", finished)
+	}
+	if !finished["quiet"].Before(finished["assethub"]) || !finished["quiet"].Before(finished["people"]) {
+		t.Errorf("The quiet chain waited for the busy ones to finish")
+	}
+}
+
+func TestLaunchChainsJoinsErrors(t *testing.T) {
+	parachains := map[string]map[string]ParaChainConfig{
+		"polkadot": {"polkadot": {}, "assethub": {}},
+	}
+	err := LaunchChains(context.Background(), parachains, nil, func(ctx context.Context, relayChain, chain string, budget *WorkerBudget) error {
+		if chain == "assethub" {
+			return fmt.Errorf("sidecar down")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "polkadot:assethub: sidecar down") {
+		t.Errorf("Expected the assethub error, got %v", err)
+	}
+}
+
+func TestNilWorkerBudget(t *testing.T) {
+	var budget *WorkerBudget
+	if err := budget.Acquire(context.Background()); err != nil {
+		t.Errorf("A nil budget should not limit, got %v", err)
+	}
+	budget.Release()
+}
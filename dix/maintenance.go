@@ -0,0 +1,88 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultWritableGrace is how long a monthly partition keeps receiving
+// blocks after its month ended, late blocks and backfills included
+const DefaultWritableGrace = 7 * 24 * time.Hour
+
+// WritablePartitions returns the monthly partitions of blocksTable which can
+// still be written: the ones whose month has started and ended less than
+// grace ago. Older ones are sealed.
+func WritablePartitions(blocksTable string, names []string, now time.Time, grace time.Duration) []string {
+	writable := make([]string, 0)
+	for _, name := range names {
+		partition, ok := ParseBlocksPartition(blocksTable, name)
+		if !ok {
+			continue
+		}
+		start := time.Date(partition.Year, time.Month(partition.Month), 1, 0, 0, 0, 0, time.UTC)
+		end := start.AddDate(0, 1, 0)
+		if start.After(now) || !now.Before(end.Add(grace)) {
+			continue
+		}
+		writable = append(writable, name)
+	}
+	return writable
+}
+
+// HasCurrentPartition reports whether one of the monthly partitions of
+// blocksTable receives the blocks produced at now
+func HasCurrentPartition(blocksTable string, names []string, now time.Time) bool {
+	return len(WritablePartitions(blocksTable, names, now.UTC(), 0)) > 0
+}
+
+// MissingCurrentPartitions returns the indexed chains whose blocks table has
+// no partition for the month of now. Their new blocks cannot be saved, which
+// the indexers only report in their logs.
+func (s *SQLDatabase) MissingCurrentPartitions(now time.Time) ([]DatabaseInfo, error) {
+	if s.dialect == DialectSQLite {
+		return nil, nil
+	}
+	infos, err := s.GetDatabaseInfo()
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]DatabaseInfo, 0)
+	for _, info := range infos {
+		partitions, err := s.ListBlocksPartitions(info.Relaychain, info.Chain)
+		if err != nil {
+			return nil, err
+		}
+		if !HasCurrentPartition(GetBlocksTableName(info.Relaychain, info.Chain), partitions, now) {
+			missing = append(missing, info)
+		}
+	}
+	return missing, nil
+}
+
+// MaintainPartitions runs ANALYZE, or VACUUM (ANALYZE) when vacuum is set, on
+// the writable partitions of the blocks table of relayChain:chain. It returns
+// the partitions it went through.
+func (s *SQLDatabase) MaintainPartitions(ctx context.Context, relayChain, chain string, vacuum bool, now time.Time) ([]string, error) {
+	if s.dialect == DialectSQLite {
+		return nil, nil
+	}
+	names, err := s.ListBlocksPartitions(relayChain, chain)
+	if err != nil {
+		return nil, err
+	}
+	command := "ANALYZE"
+	if vacuum {
+		command = "VACUUM (ANALYZE)"
+	}
+	partitions := WritablePartitions(GetBlocksTableName(relayChain, chain), names, now, DefaultWritableGrace)
+	for i, partition := range partitions {
+		start := time.Now()
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("%s %s;", command, pqSanitizeTableName(partition))); err != nil {
+			return partitions[:i], fmt.Errorf("error running %s on %s: %w", command, partition, err)
+		}
+		log.Printf("%s %s in %s", command, partition, time.Since(start).Round(time.Millisecond))
+	}
+	return partitions, nil
+}
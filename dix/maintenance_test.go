@@ -0,0 +1,111 @@
+package dix
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWritablePartitions(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	names := []string{
+		table + "_2025_01",
+		table + "_2025_02",
+		table + "_2025_03",
+		table + "_2025_04",
+		table + "_default",
+	}
+
+	for _, tc := range []struct {
+		name string
+		now  time.Time
+		want []string
+	}{
+		{"early in the month", time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), []string{"_2025_02", "_2025_03"}},
+		{"after the grace period", time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC), []string{"_2025_03"}},
+		{"all sealed", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := WritablePartitions(table, names, tc.now, DefaultWritableGrace)
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != table+tc.want[i] {
+					t.Errorf("Expected %s%s, got %s", table, tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaintainPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectQuery("FROM pg_inherits").
+		WithArgs("chain", "blocks_polkadot_polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("blocks_polkadot_polkadot_2025_01").
+			AddRow("blocks_polkadot_polkadot_2025_02").
+			AddRow("blocks_polkadot_polkadot_2025_03").
+			AddRow("blocks_polkadot_polkadot_2025_04"))
+	mock.ExpectExec(regexp.QuoteMeta(`VACUUM (ANALYZE) "chain"."blocks_polkadot_polkadot_2025_03";`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	now := time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC)
+	partitions, err := database.MaintainPartitions(context.Background(), "polkadot", "polkadot", true, now)
+	if err != nil {
+		t.Fatalf("MaintainPartitions: %v", err)
+	}
+	if len(partitions) != 1 || partitions[0] != "chain.blocks_polkadot_polkadot_2025_03" {
+		t.Errorf("Expected only the March partition, got %v", partitions)
+	}
+	// sealed partitions got no statement
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestMissingCurrentPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectQuery("(?i)from chain\\.dotidx").
+		WillReturnRows(sqlmock.NewRows([]string{"relaychain", "chain"}).
+			AddRow("polkadot", "polkadot").
+			AddRow("polkadot", "assethub"))
+	mock.ExpectQuery("FROM pg_inherits").
+		WithArgs("chain", "blocks_polkadot_polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("blocks_polkadot_polkadot_2025_02").
+			AddRow("blocks_polkadot_polkadot_2025_03"))
+	// the partitions stop at the previous month
+	mock.ExpectQuery("FROM pg_inherits").
+		WithArgs("chain", "blocks_polkadot_assethub").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("blocks_polkadot_assethub_2025_01").
+			AddRow("blocks_polkadot_assethub_2025_02"))
+
+	missing, err := database.MissingCurrentPartitions(time.Date(2025, 3, 1, 0, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("MissingCurrentPartitions: %v", err)
+	}
+	if len(missing) != 1 || missing[0].Chain != "assethub" {
+		t.Errorf("Expected the partition of assethub to be missing, got %v", missing)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -110,10 +111,13 @@ func (m *Bucket) PrintStats(printHeader bool) {
 // Metrics tracks performance metrics for API calls
 type Metrics struct {
 	Buckets []*Bucket
+	// blocks failing VerifyParentHashes
+	parentHashMismatches atomic.Int64
 }
 
 type MetricsStats struct {
-	BucketsStats [4]BucketStats
+	BucketsStats         [4]BucketStats
+	ParentHashMismatches int64
 }
 
 // NewMetrics creates a new Metrics instance
@@ -135,6 +139,11 @@ func (m *Metrics) RecordLatency(start time.Time, count int, err error) {
 	}
 }
 
+// RecordParentHashMismatches counts blocks failing VerifyParentHashes
+func (m *Metrics) RecordParentHashMismatches(count int) {
+	m.parentHashMismatches.Add(int64(count))
+}
+
 func NewMetricsStats() *MetricsStats {
 	return &MetricsStats{
 		BucketsStats: [4]BucketStats{
@@ -152,6 +161,7 @@ func (m *Metrics) GetStats() (s *MetricsStats) {
 	for i := range m.Buckets {
 		s.BucketsStats[i] = m.Buckets[i].GetStats()
 	}
+	s.ParentHashMismatches = m.parentHashMismatches.Load()
 	return
 }
 
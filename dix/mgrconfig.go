@@ -19,6 +19,9 @@ type MgrConfig struct {
 	SystemMemoryGB        int                                   // Runtime: detected system memory in GB
 	MaintenanceWorkMemory string                                // Runtime: calculated maintenance_work_mem
 	MaxWalSize            string                                // Runtime: calculated max_wal_size
+	SharedBuffers         string                                // Runtime: calculated shared_buffers
+	WorkMemory            string                                // Runtime: calculated work_mem
+	PostgresMemoryGB      int                                   // Runtime: memory left to postgres by the colocated services
 	DbCache               int                                   // Runtime: calculated db_cache
 	RpcMaxConnections     int                                   // Runtime: calculated rpc_max_connections
 	DotidxRoot            string                                `toml:"dotidx_root"`
@@ -31,11 +34,13 @@ type MgrConfig struct {
 	DotidxBatch           DotidxBatch                           `toml:"dotidx_batch"`
 	DotidxDB              DotidxDB                              `toml:"dotidx_db"`
 	DotidxFE              DotidxFE                              `toml:"dotidx_fe"`
+	DotidxCron            DotidxCron                            `toml:"dotidx_cron"`
 	Parachains            map[string]map[string]ParaChainConfig `toml:"parachains"`
 	Filesystem            FilesystemConfig                      `toml:"filesystem"`
 	Monitoring            MonitoringConfig                      `toml:"monitoring"`
 	Watcher               OrchestratorConfig                    `toml:"watcher"`
 	Temporal              TemporalConfig                        `toml:"temporal"`
+	Webhooks              []WebhookConfig                       `toml:"webhooks"`
 }
 
 type DotidxDB struct {
@@ -45,27 +50,159 @@ type DotidxDB struct {
 	IP            string   `toml:"ip"`
 	User          string   `toml:"user"`
 	Port          int      `toml:"port"`
-	Password      string   `toml:"password"`
+	Password      string   `toml:"password" json:"-"`
 	Memory        string   `toml:"memory"`
 	Data          string   `toml:"data"`
 	Run           string   `toml:"run"`
 	WhitelistedIP []string `toml:"whitelisted_ip"`
+	// schema of the dotidx tables, "chain" when empty; one schema per
+	// instance lets several of them share a database
+	Schema string `toml:"schema"`
+	// optional read-only replica used by the frontend
+	ReplicaIP   string `toml:"replica_ip"`
+	ReplicaPort int    `toml:"replica_port"`
+	// dixmgr alerts when the replica lags more than this behind the
+	// primary, DefaultReplicaMaxLag when not set
+	ReplicaMaxLag Duration `toml:"replica_max_lag"`
+	// size of the connection pool of the indexers, 0 keeps the default
+	MaxOpenConns int `toml:"max_open_conns"`
+	// hash partitions of the address tables, spread over the fast
+	// tablespaces; 0 means one per tablespace
+	AddressPartitions int `toml:"address_partitions"`
+	// years of blocks, the current one included, kept on the fast
+	// tablespaces; 0 means the current year only
+	FastYears int `toml:"fast_years"`
+	// read the password from a file or an environment variable rather than
+	// keeping it in the configuration
+	PasswordFile string `toml:"password_file"`
+	PasswordEnv  string `toml:"password_env"`
+	// months of blocks kept by dixprune, the current one included; 0
+	// keeps everything
+	RetentionMonths int `toml:"retention_months"`
+	// dixcron runs ANALYZE on the writable block partitions at this
+	// interval, and VACUUM as well when MaintenanceVacuum is set; 0 disables it
+	MaintenanceInterval Duration `toml:"maintenance_interval"`
+	MaintenanceVacuum   bool     `toml:"maintenance_vacuum"`
+	// debug: log the statements which failed, redacted and truncated
+	DebugSQL bool `toml:"debug_sql"`
+}
+
+// String hides the password when the configuration is printed
+func (db DotidxDB) String() string {
+	type plain DotidxDB
+	redacted := plain(db)
+	if redacted.Password != "" {
+		redacted.Password = "******"
+	}
+	return fmt.Sprintf("%+v", redacted)
+}
+
+// GoString hides the password from %#v
+func (db DotidxDB) GoString() string {
+	return db.String()
+}
+
+// loadDBPassword replaces the password with the content of password_file or
+// of the variable password_env
+func loadDBPassword(db *DotidxDB, lookup func(string) (string, bool)) error {
+	switch {
+	case db.PasswordFile != "" && db.PasswordEnv != "":
+		return fmt.Errorf("password_file and password_env are exclusive")
+	case db.PasswordFile != "":
+		data, err := os.ReadFile(db.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("cannot read password_file: %w", err)
+		}
+		db.Password = strings.TrimSpace(string(data))
+	case db.PasswordEnv != "":
+		password, ok := lookup(db.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("password_env %s is not set", db.PasswordEnv)
+		}
+		db.Password = password
+	}
+	return nil
 }
 
 type Duration time.Duration
 
 type DotidxBatch struct {
+	// first block to index, GenesisBlockID when not set
 	StartRange   int      `toml:"start_range"`
 	EndRange     int      `toml:"end_range"`
 	BatchSize    int      `toml:"batch_size"`
 	MaxWorkers   int      `toml:"max_workers"`
 	FlushTimeout Duration `toml:"flush_timeout"`
+	// how often the indexer logs its progress, defaults to 1 minute
+	ProgressInterval Duration `toml:"progress_interval"`
+	// "text" (default) or "json" for one JSON object per stats line
+	StatsFormat string `toml:"stats_format"`
+	// largest sidecar answer accepted, 0 uses DefaultMaxResponseBytes
+	MaxResponseBytes int64 `toml:"max_response_bytes"`
+	// estimated size of the blocks saved in one transaction, 0 uses
+	// DefaultFlushBytes
+	FlushBytes int64 `toml:"flush_bytes"`
+	// batches waiting to be saved before the fetchers block, 0 saves from
+	// the fetching workers
+	SaveQueue int `toml:"save_queue"`
+	// dixgapfill joins two missing blocks with at most this many saved
+	// blocks between them in one request, fetching those again; 0 fetches
+	// only the missing blocks
+	GapTolerance int `toml:"gap_tolerance"`
+	// batches fetched and not yet saved across all the chains indexed by
+	// one process, a hard ceiling on their memory, 0 does not bound them
+	MaxInFlightBatches int `toml:"max_inflight_batches"`
+	// OTLP/HTTP collector receiving the indexing spans, for example
+	// http://localhost:4318, tracing is off when empty
+	TracingEndpoint string `toml:"tracing_endpoint"`
+	// workers running at once across all the chains indexed by one
+	// process, 0 uses the database pool size
+	GlobalWorkers int `toml:"global_workers"`
+	// dixbatch and dixlive stop at the finalized head, blocks above it
+	// wait for finalization and a reorg never reaches the database
+	FinalizedOnly bool `toml:"finalized_only"`
 }
 
 type DotidxFE struct {
-	IP         string `toml:"ip"`
-	Port       int    `toml:"port"`
-	StaticPath string `toml:"static_path"`
+	IP           string   `toml:"ip"`
+	Port         int      `toml:"port"`
+	StaticPath   string   `toml:"static_path"`
+	QueryTimeout Duration `toml:"query_timeout"`
+	// bearer token of the /admin endpoints, they are disabled when empty
+	AdminToken string `toml:"admin_token"`
+	// private listener for the admin and metrics endpoints, they are not
+	// served when AdminPort is 0
+	AdminIP   string `toml:"admin_ip"`
+	AdminPort int    `toml:"admin_port"`
+	// debug: the plan of the queries slower than this is logged, disabled
+	// when 0
+	ExplainSlowQueries Duration `toml:"explain_slow_queries"`
+	// pages of blocks per address kept in memory, disabled when 0, for
+	// AddressCacheTTL (30s by default)
+	AddressCacheSize int      `toml:"address_cache_size"`
+	AddressCacheTTL  Duration `toml:"address_cache_ttl"`
+	// answer with the JSON field names of the versions before they were
+	// made camelCase
+	LegacyJSONNames bool `toml:"legacy_json_names"`
+}
+
+// DotidxCron holds the cron schedules of the dixcron jobs, see
+// ParseSchedule; an empty schedule uses the default of the job and "off"
+// disables it
+type DotidxCron struct {
+	// blocks indexed in the current month, default hourly
+	Stats string `toml:"stats"`
+	// monthly named queries not computed yet, default daily
+	Queries string `toml:"queries"`
+	// monthly partitions of the blocks tables up to next year, default daily
+	Partitions string `toml:"partitions"`
+	// ANALYZE of the writable partitions, VACUUM too with maintenance_vacuum;
+	// off by default unless maintenance_interval is set
+	Analyze string `toml:"analyze"`
+	// runs BackupCommand with DOTIDX_BACKUP set to dotidx_backup, off by
+	// default
+	Backup        string `toml:"backup"`
+	BackupCommand string `toml:"backup_command"`
 }
 
 type ParaChainConfig struct {
@@ -84,6 +221,23 @@ type ParaChainConfig struct {
 	RelayIP               string `toml:"relay_ip"`
 	NodeIP                string `toml:"node_ip"`
 	BootNodes             string `toml:"bootnodes"`
+	// expected block time, used when it cannot be measured on chain
+	BlockTime Duration `toml:"block_time"`
+	// sent to the chain reader, the token as an Authorization bearer
+	ChainreaderUserAgent string            `toml:"chainreader_user_agent"`
+	ChainreaderToken     string            `toml:"chainreader_token" json:"-"`
+	ChainreaderHeaders   map[string]string `toml:"chainreader_headers"`
+	// client certificate for a chain reader behind mutual TLS, the CA
+	// verifies the chain reader certificate
+	ChainreaderCert string `toml:"chainreader_cert"`
+	ChainreaderKey  string `toml:"chainreader_key"`
+	ChainreaderCA   string `toml:"chainreader_ca"`
+	// how a single block is requested: "path" for /blocks/{id}, the
+	// default, or "query" for /blocks?id={id}
+	ChainreaderBlockURL string `toml:"chainreader_block_url"`
+	// the chain is indexed for its blocks only, no address is extracted
+	// nor written to address2blocks
+	SkipAddresses bool `toml:"skip_addresses"`
 }
 
 func (ParaChainConfig) ComputePort(i, j int) int {
@@ -100,6 +254,17 @@ type MonitoringConfig struct {
 	PrometheusPort int    `toml:"prometheus_port"`
 	GrafanaIP      string `toml:"grafana_ip"`
 	GrafanaPort    int    `toml:"grafana_port"`
+	// dixbatch, dixlive and dixmgr alert when a block they index touches
+	// one of these addresses or of the ones added with dixfe's
+	// /admin/watchlist, as long as this or watch_webhook is set
+	WatchAddresses []string `toml:"watch_addresses"`
+	// dixbatch and dixlive post their watch alerts there, a Slack incoming
+	// webhook or any URL taking JSON, and log them when it is not set
+	WatchWebhook string `toml:"watch_webhook"`
+	// dixmgr alerts when the free space of a tablespace directory falls
+	// below these percentages, 10 and 5 when not set
+	DiskWarningPercent  float64 `toml:"disk_warning_percent"`
+	DiskCriticalPercent float64 `toml:"disk_critical_percent"`
 }
 
 type OrchestratorConfig struct {
@@ -107,6 +272,29 @@ type OrchestratorConfig struct {
 	MaxRestarts      int           `toml:"max_restarts"`
 	RestartBackoff   time.Duration `toml:"restart_backoff"`
 	OperationTimeout time.Duration `toml:"operation_timeout"`
+	// watch_interval of a tier of services, when it differs
+	WatchIntervals WatchIntervals `toml:"watch_intervals"`
+	// start dependencies on top of relay -> parachain -> sidecars -> nginx
+	// -> services, they must not form a cycle
+	Dependencies []ServiceDependency `toml:"dependencies"`
+}
+
+// WatchIntervals sets how often each tier of services is checked, 0 keeps
+// the watch_interval of the watcher
+type WatchIntervals struct {
+	Relay     Duration `toml:"relay"`
+	Parachain Duration `toml:"parachain"`
+	Sidecar   Duration `toml:"sidecar"`
+	// nginx and the dotidx services
+	Service Duration `toml:"service"`
+}
+
+// ServiceDependency makes Service wait for the services of DependsOn to be
+// ready before it starts. Services are named relay:<relay>,
+// para:<relay>:<chain>, sidecar:<relay>:<chain>:<index> and svc:<name>.
+type ServiceDependency struct {
+	Service   string   `toml:"service"`
+	DependsOn []string `toml:"depends_on"`
 }
 
 type TemporalConfig struct {
@@ -115,6 +303,8 @@ type TemporalConfig struct {
 	TaskQueue string `toml:"taskqueue"` // Task queue name (e.g., "dotidx-watcher")
 }
 
+// LoadMgrConfig reads the TOML file then applies the DOTIDX_* environment
+// variables on top of it, see ApplyEnv
 func LoadMgrConfig(file string) (*MgrConfig, error) {
 	data, err := os.ReadFile(file)
 	if err != nil {
@@ -126,6 +316,10 @@ func LoadMgrConfig(file string) (*MgrConfig, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if err := loadDBPassword(&config.DotidxDB, os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid database password: %w", err)
+	}
+
 	// On Linux, try to read database password from systemd credentials
 	if runtime.GOOS == "linux" {
 		if dbPassword, err := readSystemdCredential("db_password"); err == nil && dbPassword != "" {
@@ -133,6 +327,19 @@ func LoadMgrConfig(file string) (*MgrConfig, error) {
 		}
 	}
 
+	if err := ApplyEnv(&config, os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	// every problem at once rather than one per attempt
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	// the table names are computed from the schema everywhere
+	if err := SetSchemaName(config.DotidxDB.Schema); err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+
 	return &config, nil
 }
 
@@ -170,25 +377,52 @@ func (d *Duration) UnmarshalText(b []byte) error {
 	return nil
 }
 
-func DBUrl(config MgrConfig) string {
+func dbUrl(config MgrConfig, password, ip string, port int) string {
 	return fmt.Sprintf(`%s://%s:%s@%s:%d/%s?sslmode=disable`,
 		config.DotidxDB.Type,
 		config.DotidxDB.User,
-		config.DotidxDB.Password,
-		config.DotidxDB.IP,
-		config.DotidxDB.Port,
+		password,
+		ip,
+		port,
 		config.DotidxDB.Name,
 	)
 }
 
+func DBUrl(config MgrConfig) string {
+	return dbUrl(config, config.DotidxDB.Password, config.DotidxDB.IP, config.DotidxDB.Port)
+}
+
 func DBUrlSecure(config MgrConfig) string {
-	return fmt.Sprintf(`%s://%s:******@%s:%d/%s?sslmode=disable`,
-		config.DotidxDB.Type,
-		config.DotidxDB.User,
-		config.DotidxDB.IP,
-		config.DotidxDB.Port,
-		config.DotidxDB.Name,
-	)
+	return dbUrl(config, "******", config.DotidxDB.IP, config.DotidxDB.Port)
+}
+
+// HasDBReplica reports whether a read replica is configured
+func HasDBReplica(config MgrConfig) bool {
+	return config.DotidxDB.ReplicaIP != ""
+}
+
+// DBReplicaUrl returns the url of the read replica, it shares user, password
+// and database name with the primary. It falls back to the primary when no
+// replica is configured.
+func DBReplicaUrl(config MgrConfig) string {
+	if !HasDBReplica(config) {
+		return DBUrl(config)
+	}
+	return dbUrl(config, config.DotidxDB.Password, config.DotidxDB.ReplicaIP, replicaPort(config))
+}
+
+func DBReplicaUrlSecure(config MgrConfig) string {
+	if !HasDBReplica(config) {
+		return DBUrlSecure(config)
+	}
+	return dbUrl(config, "******", config.DotidxDB.ReplicaIP, replicaPort(config))
+}
+
+func replicaPort(config MgrConfig) int {
+	if config.DotidxDB.ReplicaPort == 0 {
+		return config.DotidxDB.Port
+	}
+	return config.DotidxDB.ReplicaPort
 }
 
 // GetSystemMemoryGB detects the system's total memory in GB
@@ -233,14 +467,41 @@ func GetSystemMemoryGB() (int, error) {
 	return memGB, nil
 }
 
-// CalculateMemorySettings calculates PostgreSQL and Node memory settings based on system memory
+// memory kept for the services running next to postgres: a node needs its
+// db cache and some more, a sidecar about 1GB
+const (
+	nodeOverheadGB  = 2
+	sidecarMemoryGB = 1
+)
+
+// CalculateMemorySettings calculates PostgreSQL and Node memory settings based on system memory.
+// The nodes and sidecars on the database host get their memory first,
+// postgres is tuned for what is left.
 func (c *MgrConfig) CalculateMemorySettings() {
 	if c.SystemMemoryGB <= 0 {
 		c.SystemMemoryGB = 16 // default fallback
 	}
+	c.calculateNodeSettings()
+
+	nodes, sidecars := c.ColocatedServices()
+	reservedGB := nodes*(c.DbCache/1024+nodeOverheadGB) + sidecars*sidecarMemoryGB
+	// postgres keeps at least a quarter of the host
+	c.PostgresMemoryGB = max(c.SystemMemoryGB-reservedGB, c.SystemMemoryGB/4, 1)
+	pgMemoryGB := c.PostgresMemoryGB
+
+	// shared_buffers: a quarter of the postgres memory, the configured
+	// memory is an upper bound
+	sharedMB := max(pgMemoryGB*1024/4, 128)
+	if configured, ok := parseMemoryMB(c.DotidxDB.Memory); ok && configured < sharedMB {
+		sharedMB = configured
+	}
+	c.SharedBuffers = formatMemoryMB(sharedMB)
+
+	// work_mem: 4MB per GB, 64MB from 16GB on
+	c.WorkMemory = formatMemoryMB(min(max(pgMemoryGB*4, 16), 64))
 
-	// Calculate maintenance_work_mem: (systemMemory / 16) * 4GB, capped at 64GB
-	maintenanceGB := (c.SystemMemoryGB * 4) / 16
+	// Calculate maintenance_work_mem: (postgresMemory / 16) * 4GB, capped at 64GB
+	maintenanceGB := (pgMemoryGB * 4) / 16
 	if maintenanceGB > 64 {
 		maintenanceGB = 64
 	}
@@ -249,8 +510,8 @@ func (c *MgrConfig) CalculateMemorySettings() {
 	}
 	c.MaintenanceWorkMemory = fmt.Sprintf("%dGB", maintenanceGB)
 
-	// Calculate max_wal_size: (systemMemory / 16) * 1GB, capped at 4GB
-	walGB := c.SystemMemoryGB / 16
+	// Calculate max_wal_size: (postgresMemory / 16) * 1GB, capped at 4GB
+	walGB := pgMemoryGB / 16
 	if walGB > 4 {
 		walGB = 4
 	}
@@ -258,7 +519,10 @@ func (c *MgrConfig) CalculateMemorySettings() {
 		walGB = 1
 	}
 	c.MaxWalSize = fmt.Sprintf("%dGB", walGB)
+}
 
+// calculateNodeSettings sets the db cache and rpc connections of the nodes
+func (c *MgrConfig) calculateNodeSettings() {
 	// Reference values for Node: 16GB RAM -> 1GB db-cache, 2k rpc-max-connections
 	// Scales linearly with caps.
 	const baseMemory = 16
@@ -286,3 +550,59 @@ func (c *MgrConfig) CalculateMemorySettings() {
 		c.RpcMaxConnections = int(rpcMaxConnections)
 	}
 }
+
+// ColocatedServices counts the nodes and the sidecars running on the
+// database host
+func (c *MgrConfig) ColocatedServices() (nodes, sidecars int) {
+	for _, chains := range c.Parachains {
+		for _, chain := range chains {
+			if sameHost(nodeIP(chain), c.DotidxDB.IP) {
+				nodes++
+			}
+			if sameHost(chain.SidecarIP, c.DotidxDB.IP) {
+				sidecars += chain.SidecarCount
+			}
+		}
+	}
+	return nodes, sidecars
+}
+
+// sameHost reports whether the addresses a and b are the same machine, an
+// empty address is the local one
+func sameHost(a, b string) bool {
+	local := func(ip string) bool {
+		switch ip {
+		case "", "localhost", "127.0.0.1", "::1":
+			return true
+		}
+		return false
+	}
+	return a == b || (local(a) && local(b))
+}
+
+// parseMemoryMB parses a postgres memory size such as 512MB or 16GB
+func parseMemoryMB(size string) (int, bool) {
+	units := []struct {
+		suffix string
+		mb     float64
+	}{{"TB", 1024 * 1024}, {"GB", 1024}, {"MB", 1}, {"kB", 1.0 / 1024}}
+	size = strings.TrimSpace(size)
+	for _, unit := range units {
+		if value, ok := strings.CutSuffix(size, unit.suffix); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n <= 0 {
+				return 0, false
+			}
+			return max(int(float64(n)*unit.mb), 1), true
+		}
+	}
+	return 0, false
+}
+
+// formatMemoryMB writes mb in GB when it is a whole number of GB
+func formatMemoryMB(mb int) string {
+	if mb%1024 == 0 {
+		return fmt.Sprintf("%dGB", mb/1024)
+	}
+	return fmt.Sprintf("%dMB", mb)
+}
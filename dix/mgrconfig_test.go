@@ -0,0 +1,200 @@
+package dix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, db string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "conf.toml")
+	content := "[dotidx_db]\ntype = \"postgres\"\nip = \"127.0.0.1\"\nport = 5432\nuser = \"dotidx\"\n" + db
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	return file
+}
+
+func TestLoadDBPassword(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("Error writing secret: %v", err)
+	}
+	t.Setenv("TEST_DOTIDX_PASSWORD", "from-env")
+
+	for _, tc := range []struct {
+		name    string
+		db      string
+		want    string
+		wantErr bool
+	}{
+		{"toml", `password = "from-toml"`, "from-toml", false},
+		{"file", fmt.Sprintf("password_file = %q", secret), "from-file", false},
+		{"env", `password_env = "TEST_DOTIDX_PASSWORD"`, "from-env", false},
+		{"file over toml", fmt.Sprintf("password = \"from-toml\"\npassword_file = %q", secret), "from-file", false},
+		{"missing file", `password_file = "/nonexistent/db_password"`, "", true},
+		{"missing env", `password_env = "TEST_DOTIDX_UNSET"`, "", true},
+		{"both", fmt.Sprintf("password_file = %q\npassword_env = \"TEST_DOTIDX_PASSWORD\"", secret), "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := LoadMgrConfig(writeTestConfig(t, tc.db))
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got password %q", config.DotidxDB.Password)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMgrConfig: %v", err)
+			}
+			if config.DotidxDB.Password != tc.want {
+				t.Errorf("Expected password %q, got %q", tc.want, config.DotidxDB.Password)
+			}
+		})
+	}
+}
+
+func TestDBPasswordNotPrinted(t *testing.T) {
+	t.Setenv("TEST_DOTIDX_PASSWORD", "s3cr3t-value")
+	config, err := LoadMgrConfig(writeTestConfig(t, `password_env = "TEST_DOTIDX_PASSWORD"`))
+	if err != nil {
+		t.Fatalf("LoadMgrConfig: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	log.Printf("config %v", *config)
+	log.Printf("config %+v", config)
+	log.Printf("db %#v", config.DotidxDB)
+	log.Printf("url %s", DBUrlSecure(*config))
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	logs.Write(data)
+
+	if strings.Contains(logs.String(), "s3cr3t-value") {
+		t.Errorf("Password leaked in output:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "TEST_DOTIDX_PASSWORD") {
+		t.Errorf("Expected the rest of the configuration to be printed:\n%s", logs.String())
+	}
+}
+
+func TestLoadMgrConfigSchema(t *testing.T) {
+	defer SetSchemaName("")
+
+	if _, err := LoadMgrConfig(writeTestConfig(t, `schema = "dotidx2"`)); err != nil {
+		t.Fatalf("LoadMgrConfig: %v", err)
+	}
+	if got := GetBlocksTableName("polkadot", "polkadot"); got != "dotidx2.blocks_polkadot_polkadot" {
+		t.Errorf("Expected the configured schema, got %s", got)
+	}
+
+	if _, err := LoadMgrConfig(writeTestConfig(t, `schema = "chain; DROP TABLE x"`)); err == nil {
+		t.Errorf("Expected an unsafe schema to be rejected")
+	}
+}
+
+func TestLoadMgrConfigRejectsUnsafeChainNames(t *testing.T) {
+	file := writeTestConfig(t, "\n[parachains.polkadot.\"asset-hub; DROP TABLE x\"]\nchainreader_port = 10800\n")
+	if _, err := LoadMgrConfig(file); err == nil {
+		t.Errorf("Expected an unsafe chain name to be rejected")
+	}
+
+	file = writeTestConfig(t, "\n[parachains.polkadot.assethub]\nchainreader_port = 10800\n")
+	if _, err := LoadMgrConfig(file); err != nil {
+		t.Errorf("LoadMgrConfig: %v", err)
+	}
+}
+
+func TestCalculateMemorySettings(t *testing.T) {
+	tests := []struct {
+		memoryGB          int
+		maintenance, wal  string
+		dbCache, rpcConns int
+	}{
+		{0, "4GB", "1GB", 1024, 2000},
+		{8, "2GB", "1GB", 1024, 2000},
+		{16, "4GB", "1GB", 1024, 2000},
+		{64, "16GB", "4GB", 7606, 8000},
+		{128, "32GB", "4GB", 16384, 16000},
+		{512, "64GB", "4GB", 16384, 16000},
+	}
+	for _, tc := range tests {
+		config := MgrConfig{SystemMemoryGB: tc.memoryGB}
+		config.CalculateMemorySettings()
+		if config.MaintenanceWorkMemory != tc.maintenance || config.MaxWalSize != tc.wal ||
+			config.DbCache != tc.dbCache || config.RpcMaxConnections != tc.rpcConns {
+			t.Errorf("%dGB: expected %s %s %d %d, got %s %s %d %d", tc.memoryGB,
+				tc.maintenance, tc.wal, tc.dbCache, tc.rpcConns,
+				config.MaintenanceWorkMemory, config.MaxWalSize, config.DbCache, config.RpcMaxConnections)
+		}
+	}
+}
+
+func TestCalculateMemorySettingsColocated(t *testing.T) {
+	chains := map[string]map[string]ParaChainConfig{
+		"polkadot": {
+			"polkadot": {RelayIP: "192.168.1.36", SidecarIP: "192.168.1.36", SidecarCount: 5},
+			"assethub": {NodeIP: "192.168.1.36", SidecarIP: "192.168.1.36", SidecarCount: 5},
+			"people":   {NodeIP: "192.168.1.40", SidecarIP: "192.168.1.40", SidecarCount: 2},
+		},
+	}
+	dedicated := MgrConfig{SystemMemoryGB: 64, Parachains: chains}
+	dedicated.DotidxDB.IP = "192.168.1.50"
+	dedicated.CalculateMemorySettings()
+	colocated := MgrConfig{SystemMemoryGB: 64, Parachains: chains}
+	colocated.DotidxDB.IP = "192.168.1.36"
+	colocated.CalculateMemorySettings()
+
+	if nodes, sidecars := dedicated.ColocatedServices(); nodes != 0 || sidecars != 0 {
+		t.Errorf("Dedicated host: expected no colocated service, got %d nodes %d sidecars", nodes, sidecars)
+	}
+	if nodes, sidecars := colocated.ColocatedServices(); nodes != 2 || sidecars != 10 {
+		t.Errorf("Colocated host: expected 2 nodes 10 sidecars, got %d nodes %d sidecars", nodes, sidecars)
+	}
+
+	// the nodes and sidecars do not change postgres on a dedicated host
+	got := []string{dedicated.SharedBuffers, dedicated.WorkMemory, dedicated.MaintenanceWorkMemory, dedicated.MaxWalSize}
+	if !slices.Equal(got, []string{"16GB", "64MB", "16GB", "4GB"}) {
+		t.Errorf("Dedicated host: unexpected settings %v", got)
+	}
+	// 2 nodes with a 7GB cache and 10 sidecars leave 64-2*(7+2)-10 = 36GB
+	if colocated.PostgresMemoryGB != 36 {
+		t.Errorf("Colocated host: expected 36GB for postgres, got %dGB", colocated.PostgresMemoryGB)
+	}
+	got = []string{colocated.SharedBuffers, colocated.WorkMemory, colocated.MaintenanceWorkMemory, colocated.MaxWalSize}
+	if !slices.Equal(got, []string{"9GB", "64MB", "9GB", "2GB"}) {
+		t.Errorf("Colocated host: unexpected settings %v", got)
+	}
+	// the nodes are tuned the same
+	if colocated.DbCache != dedicated.DbCache || colocated.RpcMaxConnections != dedicated.RpcMaxConnections {
+		t.Errorf("Expected the same node settings, got %d %d and %d %d",
+			dedicated.DbCache, dedicated.RpcMaxConnections, colocated.DbCache, colocated.RpcMaxConnections)
+	}
+
+	// a small crowded host keeps a quarter of its memory for postgres
+	small := MgrConfig{SystemMemoryGB: 8, Parachains: chains}
+	small.DotidxDB.IP = "192.168.1.36"
+	small.CalculateMemorySettings()
+	got = []string{small.SharedBuffers, small.WorkMemory, small.MaintenanceWorkMemory, small.MaxWalSize}
+	if small.PostgresMemoryGB != 2 || !slices.Equal(got, []string{"512MB", "16MB", "1GB", "1GB"}) {
+		t.Errorf("Small host: unexpected settings %dGB %v", small.PostgresMemoryGB, got)
+	}
+
+	// the configured memory bounds shared_buffers
+	dedicated.DotidxDB.Memory = "4GB"
+	dedicated.CalculateMemorySettings()
+	if dedicated.SharedBuffers != "4GB" {
+		t.Errorf("Expected the configured 4GB shared_buffers, got %s", dedicated.SharedBuffers)
+	}
+}
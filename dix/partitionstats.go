@@ -0,0 +1,65 @@
+package dix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PartitionStat is the size of one partition of the blocks or address table
+// of a chain, as known by the catalog
+type PartitionStat struct {
+	// parent table and partition, qualified with their schema
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	// empty for the default tablespace of the database
+	Tablespace string `json:"tablespace"`
+	// estimated from the planner statistics, 0 before the first ANALYZE
+	Rows int64 `json:"rows"`
+	// on disk, indexes and TOAST included
+	Bytes int64 `json:"bytes"`
+}
+
+// GetPartitionStats returns the partitions of the blocks table of
+// relayChain:chain, the monthly ones, then of its address table, each by
+// name. SQLite has no partitions.
+func (s *SQLDatabase) GetPartitionStats(relayChain, chain string) ([]PartitionStat, error) {
+	if s.dialect == DialectSQLite {
+		return nil, nil
+	}
+	prefix := schemaName + "."
+	blocksTable := GetBlocksTableName(relayChain, chain)
+	addressTable := GetAddressTableName(relayChain, chain)
+	query := `
+SELECT parent.relname, child.relname, COALESCE(ts.spcname, ''),
+       GREATEST(child.reltuples, 0)::bigint, pg_total_relation_size(child.oid)
+FROM pg_inherits
+JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+JOIN pg_namespace ns ON ns.oid = parent.relnamespace
+LEFT JOIN pg_tablespace ts ON ts.oid = child.reltablespace
+WHERE ns.nspname = $1 AND parent.relname IN ($2, $3)
+ORDER BY parent.relname = $2 DESC, child.relname;`
+
+	rows, err := s.db.Query(query, schemaName,
+		strings.TrimPrefix(blocksTable, prefix),
+		strings.TrimPrefix(addressTable, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the partitions of %s:%s: %w", relayChain, chain, err)
+	}
+	defer rows.Close()
+
+	stats := make([]PartitionStat, 0)
+	for rows.Next() {
+		var stat PartitionStat
+		if err := rows.Scan(&stat.Table, &stat.Name, &stat.Tablespace, &stat.Rows, &stat.Bytes); err != nil {
+			return nil, fmt.Errorf("error scanning partition of %s:%s: %w", relayChain, chain, err)
+		}
+		stat.Table = prefix + stat.Table
+		stat.Name = prefix + stat.Name
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the partitions of %s:%s: %w", relayChain, chain, err)
+	}
+	return stats, nil
+}
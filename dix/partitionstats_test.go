@@ -0,0 +1,46 @@
+package dix
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetPartitionStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectQuery("FROM pg_inherits(.|\\n)*pg_tablespace").
+		WithArgs("chain", "blocks_polkadot_polkadot", "address2blocks_polkadot_polkadot").
+		WillReturnRows(sqlmock.NewRows([]string{"parent", "child", "tablespace", "rows", "bytes"}).
+			AddRow("blocks_polkadot_polkadot", "blocks_polkadot_polkadot_2024_12", "slow0", 446400, 3<<30).
+			AddRow("blocks_polkadot_polkadot", "blocks_polkadot_polkadot_2025_01", "fast0", 0, 8192).
+			AddRow("address2blocks_polkadot_polkadot", "address2blocks_polkadot_polkadot_0", "", 1200000, 1<<30))
+
+	stats, err := database.GetPartitionStats("polkadot", "polkadot")
+	if err != nil {
+		t.Fatalf("GetPartitionStats: %v", err)
+	}
+	expected := []PartitionStat{
+		{Table: "chain.blocks_polkadot_polkadot", Name: "chain.blocks_polkadot_polkadot_2024_12", Tablespace: "slow0", Rows: 446400, Bytes: 3 << 30},
+		{Table: "chain.blocks_polkadot_polkadot", Name: "chain.blocks_polkadot_polkadot_2025_01", Tablespace: "fast0", Rows: 0, Bytes: 8192},
+		{Table: "chain.address2blocks_polkadot_polkadot", Name: "chain.address2blocks_polkadot_polkadot_0", Tablespace: "", Rows: 1200000, Bytes: 1 << 30},
+	}
+	if !slices.Equal(stats, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	mock.ExpectQuery("FROM pg_inherits").WillReturnError(sql.ErrConnDone)
+	if _, err := database.GetPartitionStats("polkadot", "polkadot"); err == nil {
+		t.Error("Expected the catalog error to be returned")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
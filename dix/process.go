@@ -2,7 +2,10 @@ package dix
 
 import (
 	"context"
+	"fmt"
 	"log"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ProcessSingleBlock fetches and processes a single block using fetchBlock
@@ -27,39 +30,167 @@ func ProcessSingleBlock(
 	}
 }
 
-// ProcessBlockBatch fetches and processes a batch of blocks using fetchBlockRange
+// ProcessBlockBatch fetches and processes a batch of blocks using
+// fetchBlockRange. The range is saved in chunks of at most flushBytes, as
+// estimated by EstimateBlockSize, 0 means DefaultFlushBytes. It returns the
+// ids of the blocks it could not fetch or save, the ones handed to a
+// SaveQueue count as saved.
 func ProcessBlockBatch(
 	ctx context.Context,
 	blockIDs []int,
 	relayChain, chain string,
 	db Database,
 	reader ChainReader,
-) {
+	flushBytes int64,
+) (unsaved []int) {
 	if len(blockIDs) == 0 {
-		return
+		return nil
 	}
 
+	ctx, span := startSpan(ctx, "process-batch",
+		attribute.String("relay_chain", relayChain),
+		attribute.String("chain", chain),
+		attribute.Int("blocks", len(blockIDs)))
+	defer span.End()
+
 	// Create the array of block IDs from the range
 	ids := make([]int, 0, blockIDs[len(blockIDs)-1]-blockIDs[0]+1)
 	for i := blockIDs[0]; i <= blockIDs[len(blockIDs)-1]; i++ {
 		ids = append(ids, i)
 	}
 
-	blockRange, err := reader.FetchBlockRange(ctx, ids)
+	blockRange, err := fetchBlockRange(ctx, reader, ids)
 	if err != nil {
+		recordError(span, err)
 		log.Printf("Error fetching blocks %d-%d: %v", blockIDs[0], blockIDs[len(blockIDs)-1], err)
-		return
+		return ids
 	}
 
 	if len(blockRange) == 0 {
 		log.Printf("No blocks returned for range %d-%d", blockIDs[0], blockIDs[len(blockIDs)-1])
-		return
+		return ids
+	}
+
+	// a reader answering with the wrong block for an id breaks the chain,
+	// the range is fetched again once. If it is still broken the blocks at
+	// fault go to failed_blocks and the range is left for the next pass
+	// rather than saved.
+	mismatches := VerifyParentHashes(blockRange)
+	if len(mismatches) > 0 {
+		log.Printf("Parent hash mismatch on %s:%s: %s, fetching blocks %d-%d again",
+			relayChain, chain, mismatches[0], blockIDs[0], blockIDs[len(blockIDs)-1])
+		blockRange, err = fetchBlockRange(ctx, reader, ids)
+		if err != nil {
+			recordError(span, err)
+			log.Printf("Error fetching blocks %d-%d: %v", blockIDs[0], blockIDs[len(blockIDs)-1], err)
+			return ids
+		}
+		mismatches = VerifyParentHashes(blockRange)
+	}
+	if len(mismatches) > 0 {
+		for _, mismatch := range mismatches {
+			log.Printf("Parent hash mismatch on %s:%s: %s", relayChain, chain, mismatch)
+		}
+		recordError(span, fmt.Errorf("%d parent hash mismatches", len(mismatches)))
+		if err := db.QuarantineParentHashMismatches(blockRange, mismatches, relayChain, chain); err != nil {
+			log.Printf("Error recording the parent hash mismatches of blocks %d-%d: %v",
+				blockIDs[0], blockIDs[len(blockIDs)-1], err)
+		}
+		return ids
+	}
+
+	// Save blocks to database, a few very large blocks are enough to
+	// require more than one transaction
+	saved := 0
+	for _, chunk := range SplitBlocksBySize(blockRange, flushBytes) {
+		if err := saveChunk(ctx, db, chunk, relayChain, chain); err != nil {
+			recordError(span, err)
+			log.Printf("Error saving blocks %s-%s: %v", chunk[0].ID, chunk[len(chunk)-1].ID, err)
+			// the next chunks are not saved either
+			for _, block := range blockRange[saved:] {
+				if id, ok := block.Number(); ok {
+					unsaved = append(unsaved, int(id))
+				}
+			}
+			return unsaved
+		}
+		saved += len(chunk)
 	}
 
-	// Save blocks to database
-	err = db.Save(blockRange, relayChain, chain)
+	// a failure here must not stop indexing, the range is already saved
+	if err := TrackRuntimeUpgrades(ctx, blockRange, relayChain, chain, db, reader); err != nil {
+		log.Printf("Error tracking runtime for blocks %d-%d: %v", blockIDs[0], blockIDs[len(blockIDs)-1], err)
+	}
+	return nil
+}
+
+// fetchBlockRange fetches ids under a fetch-range span, sorted by id since
+// readers do not guarantee any order and saved batches are ascending
+func fetchBlockRange(ctx context.Context, reader ChainReader, ids []int) ([]BlockData, error) {
+	ctx, span := startSpan(ctx, "fetch-range")
+	defer span.End()
+	blockRange, err := reader.FetchBlockRange(ctx, ids)
+	span.SetAttributes(attribute.Int("blocks", len(blockRange)))
+	recordError(span, err)
 	if err != nil {
-		log.Printf("Error saving blocks %d-%d: %v", blockIDs[0], blockIDs[len(blockIDs)-1], err)
-		return
+		return nil, err
+	}
+	SortBlocksByID(blockRange)
+	return blockRange, nil
+}
+
+// contextSaver is a Database whose Save records spans
+type contextSaver interface {
+	SaveContext(ctx context.Context, items []BlockData, relayChain, chain string) error
+}
+
+// saveChunk saves blocks under a save-batch span
+func saveChunk(ctx context.Context, db Database, blocks []BlockData, relayChain, chain string) error {
+	ctx, span := startSpan(ctx, "save-batch", attribute.Int("blocks", len(blocks)))
+	defer span.End()
+
+	var err error
+	if saver, ok := db.(contextSaver); ok {
+		err = saver.SaveContext(ctx, blocks, relayChain, chain)
+	} else {
+		err = db.Save(blocks, relayChain, chain)
+	}
+	recordError(span, err)
+	return err
+}
+
+// DefaultFlushBytes bounds the estimated size of the blocks saved in one
+// transaction
+const DefaultFlushBytes = 64 << 20
+
+// EstimateBlockSize returns the approximate JSON size of a block, its
+// extrinsics and events dominate
+func EstimateBlockSize(block BlockData) int64 {
+	size := len(block.ID) + len(block.Hash) + len(block.ParentHash) + len(block.StateRoot) +
+		len(block.ExtrinsicsRoot) + len(block.AuthorID) +
+		len(block.OnInitialize) + len(block.OnFinalize) + len(block.Logs) + len(block.Extrinsics)
+	return int64(size)
+}
+
+// SplitBlocksBySize cuts blocks into consecutive chunks whose estimated size
+// stays under maxBytes; a block larger than maxBytes gets its own chunk
+func SplitBlocksBySize(blocks []BlockData, maxBytes int64) [][]BlockData {
+	if maxBytes <= 0 {
+		maxBytes = DefaultFlushBytes
+	}
+	chunks := make([][]BlockData, 0, 1)
+	start := 0
+	var size int64
+	for i, block := range blocks {
+		blockSize := EstimateBlockSize(block)
+		if i > start && size+blockSize > maxBytes {
+			chunks = append(chunks, blocks[start:i])
+			start, size = i, 0
+		}
+		size += blockSize
+	}
+	if start < len(blocks) {
+		chunks = append(chunks, blocks[start:])
 	}
+	return chunks
 }
@@ -0,0 +1,152 @@
+package dix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// shuffledReader answers ranges out of order
+type shuffledReader struct {
+	ChainReader
+}
+
+func (r *shuffledReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error) {
+	blocks := make([]BlockData, 0, len(blockIDs))
+	for i := len(blockIDs) - 1; i >= 0; i-- {
+		blocks = append(blocks, BlockData{ID: fmt.Sprintf("%d", blockIDs[i])})
+	}
+	// 9 and 10 compare differently as strings and as numbers
+	blocks[0], blocks[2] = blocks[2], blocks[0]
+	return blocks, nil
+}
+
+func (r *shuffledReader) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	return RuntimeVersion{}, fmt.Errorf("not implemented")
+}
+
+// savingDatabase records what Save receives
+type savingDatabase struct {
+	Database
+	saved       []BlockData
+	calls       [][]BlockData
+	quarantined []ParentHashMismatch
+}
+
+func (d *savingDatabase) QuarantineParentHashMismatches(blocks []BlockData, mismatches []ParentHashMismatch, relayChain, chain string) error {
+	d.quarantined = append(d.quarantined, mismatches...)
+	return nil
+}
+
+func (d *savingDatabase) Save(items []BlockData, relayChain, chain string) error {
+	d.saved = append(d.saved, items...)
+	d.calls = append(d.calls, items)
+	return nil
+}
+
+func TestProcessBlockBatchSavesInOrder(t *testing.T) {
+	db := &savingDatabase{}
+	ProcessBlockBatch(context.Background(), []int{7, 8, 9, 10, 11}, "polkadot", "polkadot", db, &shuffledReader{}, 0)
+
+	expected := []string{"7", "8", "9", "10", "11"}
+	if len(db.saved) != len(expected) {
+		t.Fatalf("Expected %d saved blocks, got %d", len(expected), len(db.saved))
+	}
+	for i, block := range db.saved {
+		if block.ID != expected[i] {
+			t.Errorf("Block %d: expected ID %s, got %s", i, expected[i], block.ID)
+		}
+	}
+}
+
+// largeReader answers blocks carrying 1000 bytes of extrinsics each
+type largeReader struct {
+	ChainReader
+}
+
+func (r *largeReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error) {
+	blocks := make([]BlockData, 0, len(blockIDs))
+	for _, id := range blockIDs {
+		blocks = append(blocks, BlockData{
+			ID:         fmt.Sprintf("%d", id),
+			Extrinsics: json.RawMessage(`"` + strings.Repeat("x", 998) + `"`),
+		})
+	}
+	return blocks, nil
+}
+
+func (r *largeReader) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	return RuntimeVersion{}, fmt.Errorf("not implemented")
+}
+
+func TestProcessBlockBatchFlushesBySize(t *testing.T) {
+	db := &savingDatabase{}
+	// each block is a bit over 1000 bytes, two of them exceed the limit
+	ProcessBlockBatch(context.Background(), []int{1, 2, 3, 4, 5}, "polkadot", "polkadot", db, &largeReader{}, 2000)
+
+	if len(db.saved) != 5 {
+		t.Fatalf("Expected 5 saved blocks, got %d", len(db.saved))
+	}
+	if len(db.calls) != 5 {
+		t.Errorf("Expected one save per oversized block, got %d saves", len(db.calls))
+	}
+
+	db = &savingDatabase{}
+	ProcessBlockBatch(context.Background(), []int{1, 2, 3, 4, 5}, "polkadot", "polkadot", db, &largeReader{}, 0)
+	if len(db.calls) != 1 {
+		t.Errorf("Expected a single save under the default limit, got %d", len(db.calls))
+	}
+}
+
+// fullDatabase saves until it reaches block full
+type fullDatabase struct {
+	savingDatabase
+	full string
+}
+
+func (d *fullDatabase) Save(items []BlockData, relayChain, chain string) error {
+	for _, item := range items {
+		if item.ID == d.full {
+			return fmt.Errorf("disk full")
+		}
+	}
+	return d.savingDatabase.Save(items, relayChain, chain)
+}
+
+func TestProcessBlockBatchReturnsTheUnsavedBlocks(t *testing.T) {
+	db := &fullDatabase{full: "3"}
+	// one save per block, the ones after the failed save are left too
+	unsaved := ProcessBlockBatch(context.Background(), []int{1, 2, 3, 4, 5}, "polkadot", "polkadot", db, &largeReader{}, 2000)
+	if fmt.Sprint(unsaved) != "[3 4 5]" {
+		t.Errorf("Expected blocks 3 to 5 unsaved, got %v", unsaved)
+	}
+	if len(db.saved) != 2 {
+		t.Errorf("Expected 2 saved blocks, got %d", len(db.saved))
+	}
+
+	if unsaved := ProcessBlockBatch(context.Background(), []int{1, 2}, "polkadot", "polkadot", &savingDatabase{}, &largeReader{}, 0); len(unsaved) != 0 {
+		t.Errorf("Expected every block saved, got %v unsaved", unsaved)
+	}
+}
+
+func TestSplitBlocksBySize(t *testing.T) {
+	block := func(id string, size int) BlockData {
+		return BlockData{ID: id, Extrinsics: json.RawMessage(strings.Repeat("x", size-len(id)))}
+	}
+	blocks := []BlockData{block("1", 400), block("2", 400), block("3", 1500), block("4", 100), block("5", 100)}
+
+	chunks := SplitBlocksBySize(blocks, 1000)
+	sizes := make([]int, len(chunks))
+	for i := range chunks {
+		sizes[i] = len(chunks[i])
+	}
+	expected := []int{2, 1, 2}
+	if fmt.Sprint(sizes) != fmt.Sprint(expected) {
+		t.Errorf("Expected chunks of %v blocks, got %v", expected, sizes)
+	}
+	if len(SplitBlocksBySize(nil, 1000)) != 0 {
+		t.Errorf("Expected no chunk for no block")
+	}
+}
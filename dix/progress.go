@@ -0,0 +1,68 @@
+package dix
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Progress tracks how many blocks of a range have been indexed. It is safe
+// to update from several workers.
+type Progress struct {
+	start time.Time
+	total atomic.Int64
+	done  atomic.Int64
+}
+
+func NewProgress(total int) *Progress {
+	p := &Progress{start: time.Now()}
+	p.total.Store(int64(total))
+	return p
+}
+
+// Done records blocks indexed by a worker
+func (p *Progress) Done(n int) {
+	p.done.Add(int64(n))
+}
+
+// Skip removes blocks which are already indexed from the total
+func (p *Progress) Skip(n int) {
+	p.total.Add(-int64(n))
+}
+
+// Grow adds blocks to the total, when the head moves forward
+func (p *Progress) Grow(n int) {
+	p.total.Add(int64(n))
+}
+
+// String reports done/total, the rate since start and the ETA
+func (p *Progress) String() string {
+	done := int(p.done.Load())
+	total := int(p.total.Load())
+	elapsed := time.Since(p.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(done) / elapsed.Seconds()
+	}
+	percent := 0.0
+	if total > 0 {
+		percent = float64(done) / float64(total) * 100
+	}
+	eta := "unknown"
+	if d, ok := ETA(total-done, rate); ok {
+		eta = d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d/%d blocks (%.1f%%) | %.1f blocks/sec | ETA %s", done, total, percent, rate, eta)
+}
+
+// ETA returns the time needed to index remaining blocks at rate blocks per
+// second, ok is false while no rate has been observed
+func ETA(remaining int, rate float64) (eta time.Duration, ok bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+	if rate <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
@@ -0,0 +1,37 @@
+package dix
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETA(t *testing.T) {
+	eta, ok := ETA(36_000, 10)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, eta)
+
+	eta, ok = ETA(150, 2.5)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, eta)
+
+	eta, ok = ETA(0, 0)
+	assert.True(t, ok, "nothing left to do")
+	assert.Equal(t, time.Duration(0), eta)
+
+	_, ok = ETA(100, 0)
+	assert.False(t, ok, "no rate observed yet")
+}
+
+func TestProgress(t *testing.T) {
+	progress := NewProgress(1000)
+	progress.Skip(400)
+	progress.Grow(100)
+	progress.Done(350)
+
+	report := progress.String()
+	assert.True(t, strings.HasPrefix(report, "350/700 blocks (50.0%)"), report)
+	assert.Contains(t, report, "ETA")
+}
@@ -0,0 +1,144 @@
+package dix
+
+import "fmt"
+
+// monthlyQueries are the statistics computed per chain and per month, they
+// are refreshed by dixcron and on demand by the frontend
+var monthlyQueries = []struct {
+	name        string
+	sqlTemplate string
+	description string
+	// how the months add up into a year, nil when they do not
+	rollup *Rollup
+}{
+	{
+		"total_blocks_in_month",
+		`
+SELECT COUNT(*) as total_blocks
+FROM
+  {{.Schema}}.blocks_{{.Relaychain}}_{{.Chain}}
+WHERE
+  EXTRACT(YEAR FROM created_at) = {{.Year}}
+AND
+  EXTRACT(MONTH FROM created_at) = {{.Month}};
+`,
+		"Counts total blocks in a given month and year.",
+		&Rollup{Sum: []string{"total_blocks"}},
+	},
+	{
+		"total_addresses_in_month",
+		`
+WITH Boundaries (minBlock, maxBlock) AS (
+    SELECT
+        MIN(block_id) AS minBlock,
+        MAX(block_id) AS maxBlock
+    FROM
+        {{.Schema}}.blocks_{{.Relaychain}}_{{.Chain}}
+    WHERE
+        EXTRACT(YEAR FROM created_at) = {{.Year}}
+    AND
+        EXTRACT(MONTH FROM created_at) = {{.Month}}
+)
+SELECT
+  count(distinct address) AS total_addresses
+FROM
+  {{.Schema}}.address2blocks_{{.Relaychain}}_{{.Chain}}
+WHERE
+  block_id <= (SELECT maxBlock FROM Boundaries)
+AND
+  block_id >= (SELECT minBlock FROM Boundaries)
+;
+`,
+		"Counts unique addresses active in a given month and year.",
+		nil,
+	},
+	{
+		"average_extrinsics_in_month",
+		`
+SELECT
+  AVG(jsonb_array_length(extrinsics)) AS average_extrinsics
+FROM
+  {{.Schema}}.blocks_{{.Relaychain}}_{{.Chain}}
+WHERE
+  EXTRACT(YEAR FROM created_at) = {{.Year}}
+AND
+  EXTRACT(MONTH FROM created_at) = {{.Month}};
+`,
+		"Average number of extrinsics per block in a given month and year.",
+		nil,
+	},
+	{
+		"authors_in_month",
+		`
+SELECT
+  author_id,
+  COUNT(*) AS blocks
+FROM
+  {{.Schema}}.blocks_{{.Relaychain}}_{{.Chain}}
+WHERE
+  EXTRACT(YEAR FROM created_at) = {{.Year}}
+AND
+  EXTRACT(MONTH FROM created_at) = {{.Month}}
+GROUP BY
+  author_id
+ORDER BY
+  blocks DESC;
+`,
+		"Number of blocks authored by each validator or collator in a given month and year.",
+		&Rollup{Keys: []string{"author_id"}, Sum: []string{"blocks"}, OrderBy: "blocks"},
+	},
+	{
+		"largest_transfers_in_month",
+		`
+SELECT
+  block_id,
+  extrinsic -> 'signature' -> 'signer' ->> 'id' AS sender,
+  extrinsic -> 'args' -> 'dest' ->> 'id' AS receiver,
+  (extrinsic -> 'args' ->> 'value')::numeric AS amount
+FROM
+  {{.Schema}}.blocks_{{.Relaychain}}_{{.Chain}},
+  jsonb_array_elements(extrinsics) AS extrinsic
+WHERE
+  EXTRACT(YEAR FROM created_at) = {{.Year}}
+AND
+  EXTRACT(MONTH FROM created_at) = {{.Month}}
+AND
+  extrinsic -> 'method' ->> 'pallet' = 'balances'
+AND
+  extrinsic -> 'method' ->> 'method' IN ('transfer', 'transferKeepAlive', 'transferAllowDeath')
+ORDER BY
+  amount DESC
+LIMIT 20;
+`,
+		"The 20 largest balance transfers in a given month and year.",
+		&Rollup{OrderBy: "amount", Limit: 20},
+	},
+}
+
+func init() {
+	if err := RegisterMonthlyQueries(); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterMonthlyQueries registers the monthly statistics queries, the ones
+// already registered are left alone. init registers them when the package is
+// loaded so calling it again is a no-op.
+func RegisterMonthlyQueries() error {
+	for _, q := range monthlyQueries {
+		registryMutex.RLock()
+		_, exists := queryRegistry[q.name]
+		registryMutex.RUnlock()
+		if exists {
+			continue
+		}
+		tmpl, err := parseNamedQuery(q.name, q.sqlTemplate)
+		if err != nil {
+			return fmt.Errorf("error registering query '%s': %w", q.name, err)
+		}
+		if err := registerNamedQuery(q.name, tmpl, q.description); err != nil {
+			return fmt.Errorf("error registering query '%s': %w", q.name, err)
+		}
+	}
+	return nil
+}
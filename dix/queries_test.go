@@ -0,0 +1,60 @@
+package dix
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMonthlyQueriesRender(t *testing.T) {
+	for _, q := range monthlyQueries {
+		t.Run(q.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Error creating mock database: %v", err)
+			}
+			defer db.Close()
+			database := NewSQLDatabaseWithDB(db)
+
+			registryMutex.RLock()
+			namedQuery, exists := queryRegistry[q.name]
+			registryMutex.RUnlock()
+			if !exists {
+				t.Fatalf("Query %s is not registered", q.name)
+			}
+			if namedQuery.Description == "" {
+				t.Errorf("Query %s has no description", q.name)
+			}
+
+			sqlString, err := renderNamedQuery(namedQuery.SQLTemplate, NamedQueryParameters{
+				Relaychain: "kusama",
+				Chain:      "assethub",
+				Year:       2025,
+				Month:      3,
+			})
+			if err != nil {
+				t.Fatalf("Error rendering %s: %v", q.name, err)
+			}
+			if strings.Contains(sqlString, "{{") || strings.Contains(sqlString, "<no value>") {
+				t.Errorf("Query %s is not fully rendered: %s", q.name, sqlString)
+			}
+			for _, want := range []string{"_kusama_assethub", "= 2025", "= 3"} {
+				if !strings.Contains(sqlString, want) {
+					t.Errorf("Expected %q in %s", want, sqlString)
+				}
+			}
+
+			mock.ExpectQuery(regexp.QuoteMeta(sqlString)).
+				WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(1))
+			if _, err := database.ExecuteNamedQuery(context.Background(), "kusama", "assethub", q.name, 2025, 3); err != nil {
+				t.Errorf("ExecuteNamedQuery: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// MisdatedBlock is a row whose created_at is not the timestamp of its block,
+// typically a block saved with the now fallback of an earlier version
+type MisdatedBlock struct {
+	BlockID int
+	Hash    string
+	// created_at as saved and the timestamp of the block
+	CreatedAt string
+	Timestamp string
+	// created_at as read from the database, to find the row again
+	savedAt any
+}
+
+// ChangesPartition reports whether the row moves to another monthly
+// partition
+func (m MisdatedBlock) ChangesPartition() bool {
+	return m.CreatedAt[:len("2006-01")] != m.Timestamp[:len("2006-01")]
+}
+
+func (m MisdatedBlock) String() string {
+	return fmt.Sprintf("block %d %s saved at %s, produced at %s", m.BlockID, m.Hash, m.CreatedAt, m.Timestamp)
+}
+
+// normalizeCreatedAt formats a created_at read from the database, a
+// time.Time with PostgreSQL and a string with SQLite, like Save writes it
+func normalizeCreatedAt(value any) (string, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(createdAtLayout), nil
+	case []byte:
+		return normalizeCreatedAt(string(v))
+	case string:
+		t, err := time.Parse(time.DateTime, v)
+		if err != nil {
+			return "", fmt.Errorf("invalid created_at %q: %w", v, err)
+		}
+		return t.Format(createdAtLayout), nil
+	}
+	return "", fmt.Errorf("unexpected created_at type %T", value)
+}
+
+// misdatedWindow is the number of block ids FindMisdatedBlocks reads at once
+var misdatedWindow = 10_000
+
+// FindMisdatedBlocks looks for the rows between startRange and endRange
+// whose created_at differs from the timestamp.set of their extrinsics. When
+// the stored extrinsics have no timestamp the block is fetched again from
+// reader, if not nil. The rows are read by windows of misdatedWindow block
+// ids, found is called with the misdated rows of each window, if any, and
+// may move them. It returns how many rows had no timestamp at all and were
+// left out.
+func (s *SQLDatabase) FindMisdatedBlocks(ctx context.Context, relayChain, chain string, startRange, endRange int, reader ChainReader, found func([]MisdatedBlock) error) (int, error) {
+	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
+
+	// the default range goes up to MaxInt32, only the saved ids are scanned
+	var first, last sql.NullInt64
+	boundsQuery := s.prepareQuery(fmt.Sprintf(
+		"SELECT MIN(block_id), MAX(block_id) FROM %s WHERE block_id BETWEEN $1 AND $2;", blocksTable))
+	if err := s.db.QueryRowContext(ctx, boundsQuery, startRange, endRange).Scan(&first, &last); err != nil {
+		return 0, fmt.Errorf("error reading blocks of %s: %w", blocksTable, err)
+	}
+	if !first.Valid {
+		return 0, nil
+	}
+
+	unknown := 0
+	for from := int(first.Int64); from <= int(last.Int64); from += misdatedWindow {
+		to := min(from+misdatedWindow-1, int(last.Int64))
+		misdated, missing, err := s.findMisdatedWindow(ctx, blocksTable, from, to, reader)
+		if err != nil {
+			return unknown, err
+		}
+		unknown += missing
+		if len(misdated) == 0 {
+			continue
+		}
+		if err := found(misdated); err != nil {
+			return unknown, err
+		}
+	}
+	return unknown, nil
+}
+
+// findMisdatedWindow is FindMisdatedBlocks for the blocks from..to, read at
+// once
+func (s *SQLDatabase) findMisdatedWindow(ctx context.Context, blocksTable string, from, to int, reader ChainReader) ([]MisdatedBlock, int, error) {
+	query := s.prepareQuery(fmt.Sprintf(
+		"SELECT block_id, hash, created_at, extrinsics FROM %s WHERE block_id BETWEEN $1 AND $2 ORDER BY block_id;",
+		blocksTable))
+
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading blocks of %s: %w", blocksTable, err)
+	}
+	defer rows.Close()
+
+	type savedBlock struct {
+		MisdatedBlock
+		extrinsics []byte
+	}
+	var saved []savedBlock
+	for rows.Next() {
+		var b savedBlock
+		if err := rows.Scan(&b.BlockID, &b.Hash, &b.savedAt, &b.extrinsics); err != nil {
+			return nil, 0, fmt.Errorf("error scanning block: %w", err)
+		}
+		if b.CreatedAt, err = normalizeCreatedAt(b.savedAt); err != nil {
+			return nil, 0, fmt.Errorf("block %d: %w", b.BlockID, err)
+		}
+		saved = append(saved, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over blocks: %w", err)
+	}
+	rows.Close()
+
+	var misdated []MisdatedBlock
+	unknown := 0
+	for _, b := range saved {
+		ts, err := ExtractTimestamp(b.extrinsics)
+		if err != nil && reader != nil {
+			block, fetchErr := reader.FetchBlock(ctx, b.BlockID)
+			if fetchErr != nil {
+				return nil, 0, fmt.Errorf("error fetching block %d: %w", b.BlockID, fetchErr)
+			}
+			ts, err = ExtractTimestamp(block.Extrinsics)
+		}
+		if err != nil {
+			// the genesis block has no timestamp
+			if b.BlockID != GenesisBlockID {
+				unknown++
+			}
+			continue
+		}
+		if ts != b.CreatedAt {
+			b.Timestamp = ts
+			misdated = append(misdated, b.MisdatedBlock)
+		}
+	}
+	return misdated, unknown, nil
+}
+
+// MoveMisdatedBlocks sets created_at to the timestamp of each block. The
+// partition key cannot be updated in place, so the row is copied with the
+// new created_at then deleted, in one transaction: the blocks of one window
+// of FindMisdatedBlocks at a time. A copy already saved at
+// the right timestamp is kept. The partition of the timestamp must exist. It
+// returns the number of rows moved.
+func (s *SQLDatabase) MoveMisdatedBlocks(ctx context.Context, relayChain, chain string, blocks []MisdatedBlock) (int, error) {
+	blocksTable := s.getTableName(GetBlocksTableName(relayChain, chain))
+	timestamp := "CAST($1 AS timestamp)"
+	if s.dialect == DialectSQLite {
+		timestamp = "$1"
+	}
+	copyQuery := s.prepareQuery(fmt.Sprintf(`
+INSERT INTO %[1]s (block_id, created_at, hash, parent_hash, state_root, extrinsics_root,
+                   author_id, finalized, on_initialize, on_finalize, logs, extrinsics)
+SELECT block_id, %[2]s, hash, parent_hash, state_root, extrinsics_root,
+       author_id, finalized, on_initialize, on_finalize, logs, extrinsics
+FROM %[1]s
+WHERE hash = $2 AND created_at = $3
+  AND NOT EXISTS (SELECT 1 FROM %[1]s WHERE hash = $4 AND created_at = $5);`, blocksTable, timestamp))
+	deleteQuery := s.prepareQuery(fmt.Sprintf(
+		"DELETE FROM %s WHERE hash = $1 AND created_at = $2;", blocksTable))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, b := range blocks {
+		if _, err := tx.ExecContext(ctx, copyQuery, b.Timestamp, b.Hash, b.savedAt, b.Hash, b.Timestamp); err != nil {
+			return 0, fmt.Errorf("error copying block %d to %s, is the partition missing? %w", b.BlockID, b.Timestamp, err)
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery, b.Hash, b.savedAt); err != nil {
+			return 0, fmt.Errorf("error deleting block %d at %s: %w", b.BlockID, b.CreatedAt, err)
+		}
+		if b.ChangesPartition() {
+			log.Printf("Moved block %d from %s to %s", b.BlockID, b.CreatedAt[:len("2006-01")], b.Timestamp[:len("2006-01")])
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing the moved blocks: %w", err)
+	}
+	return len(blocks), nil
+}
@@ -0,0 +1,150 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNormalizeCreatedAt(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{time.Date(2026, 1, 2, 3, 4, 5, 600000000, time.UTC), "2026-01-02 03:04:05.6000"},
+		{"2026-01-02 03:04:05", "2026-01-02 03:04:05.0000"},
+		{[]byte("2026-01-02 03:04:05.1234"), "2026-01-02 03:04:05.1234"},
+	}
+	for _, tc := range tests {
+		got, err := normalizeCreatedAt(tc.value)
+		if err != nil {
+			t.Errorf("normalizeCreatedAt(%v): %v", tc.value, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("normalizeCreatedAt(%v): expected %q, got %q", tc.value, tc.expected, got)
+		}
+	}
+	if _, err := normalizeCreatedAt(42); err == nil {
+		t.Errorf("Expected an error for an int")
+	}
+}
+
+func TestMoveMisdatedBlocks(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableBlocks("polkadot", "polkadot"); err != nil {
+		t.Fatalf("CreateTableBlocks: %v", err)
+	}
+	blocksTable := database.getTableName(GetBlocksTableName("polkadot", "polkadot"))
+
+	produced := time.Date(2026, 1, 15, 8, 30, 0, 0, time.Local)
+	extrinsics := func(at time.Time) string {
+		return fmt.Sprintf(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"%d"}}]`, at.UnixMilli())
+	}
+	for _, row := range []struct {
+		id         int
+		createdAt  string
+		hash       string
+		extrinsics string
+	}{
+		// saved with the time it was indexed, a month in another partition
+		{20, "2026-10-16 12:00:00", "0x20", extrinsics(produced)},
+		// saved at the right time
+		{21, produced.Add(6 * time.Second).Format(time.DateTime), "0x21", extrinsics(produced.Add(6 * time.Second))},
+		// no timestamp to compare with
+		{22, "2026-10-16 12:00:12", "0x22", `[]`},
+		// in the next window
+		{25, "2026-10-16 12:00:30", "0x25", extrinsics(produced.Add(30 * time.Second))},
+	} {
+		if _, err := db.Exec(`INSERT INTO `+blocksTable+` (block_id, created_at, hash, parent_hash, state_root,
+			extrinsics_root, author_id, finalized, extrinsics) VALUES (?, ?, ?, '', '', '', '', true, ?)`,
+			row.id, row.createdAt, row.hash, row.extrinsics); err != nil {
+			t.Fatalf("Error inserting block %d: %v", row.id, err)
+		}
+	}
+
+	defer func(window int) { misdatedWindow = window }(misdatedWindow)
+	misdatedWindow = 3
+
+	ctx := context.Background()
+	var windows [][]MisdatedBlock
+	unknown, err := database.FindMisdatedBlocks(ctx, "polkadot", "polkadot", 0, 100, nil, func(misdated []MisdatedBlock) error {
+		windows = append(windows, misdated)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FindMisdatedBlocks: %v", err)
+	}
+	if unknown != 1 {
+		t.Errorf("Expected 1 block without timestamp, got %d", unknown)
+	}
+	// blocks 20-22 then 23-25
+	if len(windows) != 2 || len(windows[0]) != 1 || windows[0][0].BlockID != 20 ||
+		len(windows[1]) != 1 || windows[1][0].BlockID != 25 {
+		t.Fatalf("Expected blocks 20 and 25 to be misdated in two windows, got %v", windows)
+	}
+	misdated := windows[0]
+	if expected := produced.Format(createdAtLayout); misdated[0].Timestamp != expected {
+		t.Errorf("Expected timestamp %s, got %s", expected, misdated[0].Timestamp)
+	}
+	if !misdated[0].ChangesPartition() {
+		t.Errorf("Expected %v to change partition", misdated[0])
+	}
+
+	moved, err := database.MoveMisdatedBlocks(ctx, "polkadot", "polkadot", misdated)
+	if err != nil {
+		t.Fatalf("MoveMisdatedBlocks: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("Expected 1 block moved, got %d", moved)
+	}
+
+	rows, err := db.Query(`SELECT created_at, extrinsics FROM `+blocksTable+` WHERE block_id = ?`, 20)
+	if err != nil {
+		t.Fatalf("Error reading block 20: %v", err)
+	}
+	defer rows.Close()
+	var saved []string
+	for rows.Next() {
+		var createdAt any
+		var extrinsicsSaved string
+		if err := rows.Scan(&createdAt, &extrinsicsSaved); err != nil {
+			t.Fatalf("Error scanning block: %v", err)
+		}
+		if extrinsicsSaved != extrinsics(produced) {
+			t.Errorf("Expected the extrinsics to be copied, got %s", extrinsicsSaved)
+		}
+		normalized, err := normalizeCreatedAt(createdAt)
+		if err != nil {
+			t.Fatalf("normalizeCreatedAt: %v", err)
+		}
+		saved = append(saved, normalized)
+	}
+	if len(saved) != 1 || saved[0] != produced.Format(createdAtLayout) {
+		t.Errorf("Expected block 20 only at %s, got %v", produced.Format(createdAtLayout), saved)
+	}
+
+	// each window is moved as it is found
+	_, err = database.FindMisdatedBlocks(ctx, "polkadot", "polkadot", 0, 100, nil, func(misdated []MisdatedBlock) error {
+		_, err := database.MoveMisdatedBlocks(ctx, "polkadot", "polkadot", misdated)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("FindMisdatedBlocks: %v", err)
+	}
+	_, err = database.FindMisdatedBlocks(ctx, "polkadot", "polkadot", 0, math.MaxInt32, nil, func(misdated []MisdatedBlock) error {
+		t.Errorf("Expected no misdated block left, got %v", misdated)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FindMisdatedBlocks: %v", err)
+	}
+}
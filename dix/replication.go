@@ -0,0 +1,34 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultReplicaMaxLag is the replication lag above which the replica is
+// considered stale when replica_max_lag is not set
+const DefaultReplicaMaxLag = time.Minute
+
+// ReplicationLag returns how far the replica behind db is from its primary:
+// the age of the last replayed transaction, or 0 when the replica replayed
+// all the WAL it received, as it does when the primary is idle
+func ReplicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var inRecovery bool
+	var seconds float64
+	err := db.QueryRowContext(ctx, `
+SELECT
+  pg_is_in_recovery(),
+  CASE
+    WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+  END;`).Scan(&inRecovery, &seconds)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the replication lag: %w", err)
+	}
+	if !inRecovery {
+		return 0, fmt.Errorf("the database is not a replica")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
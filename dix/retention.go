@@ -0,0 +1,152 @@
+package dix
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlocksPartition is one monthly partition of a blocks table
+type BlocksPartition struct {
+	Name  string
+	Year  int
+	Month int
+}
+
+// ParseBlocksPartition recognises the monthly partitions created by
+// CreateTableBlocksPartitions, named <blocks table>_YYYY_MM
+func ParseBlocksPartition(blocksTable, name string) (BlocksPartition, bool) {
+	suffix, ok := strings.CutPrefix(name, blocksTable+"_")
+	if !ok || len(suffix) != len("2006_01") || suffix[4] != '_' {
+		return BlocksPartition{}, false
+	}
+	year, err := strconv.Atoi(suffix[:4])
+	if err != nil {
+		return BlocksPartition{}, false
+	}
+	month, err := strconv.Atoi(suffix[5:])
+	if err != nil || month < 1 || month > 12 {
+		return BlocksPartition{}, false
+	}
+	return BlocksPartition{Name: name, Year: year, Month: month}, true
+}
+
+// BlocksPartitionOf returns the monthly partition of blocksTable receiving
+// the blocks created at t
+func BlocksPartitionOf(blocksTable string, t time.Time) BlocksPartition {
+	year, month, _ := t.Date()
+	return BlocksPartition{
+		Name:  fmt.Sprintf("%s_%04d_%02d", blocksTable, year, int(month)),
+		Year:  year,
+		Month: int(month),
+	}
+}
+
+// Bounds returns the created_at range of the partition, from included and
+// to excluded. December ends on January 1st of the next year.
+func (p BlocksPartition) Bounds() (from, to time.Time) {
+	from = time.Date(p.Year, time.Month(p.Month), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// PartitionsToDrop returns, oldest first, the monthly partitions of
+// blocksTable which ended before the last keepMonths months, the current
+// month included. Names which are not monthly partitions are ignored.
+func PartitionsToDrop(blocksTable string, names []string, now time.Time, keepMonths int) []BlocksPartition {
+	if keepMonths <= 0 {
+		return nil
+	}
+	year, month, _ := now.Date()
+	cutoff := time.Date(year, month-time.Month(keepMonths-1), 1, 0, 0, 0, 0, time.UTC)
+
+	drop := make([]BlocksPartition, 0)
+	for _, name := range names {
+		partition, ok := ParseBlocksPartition(blocksTable, name)
+		if !ok {
+			continue
+		}
+		start := time.Date(partition.Year, time.Month(partition.Month), 1, 0, 0, 0, 0, time.UTC)
+		if start.Before(cutoff) {
+			drop = append(drop, partition)
+		}
+	}
+	sort.Slice(drop, func(i, j int) bool {
+		if drop[i].Year != drop[j].Year {
+			return drop[i].Year < drop[j].Year
+		}
+		return drop[i].Month < drop[j].Month
+	})
+	return drop
+}
+
+// ListBlocksPartitions returns the partitions attached to the blocks table
+// of relayChain:chain, qualified with their schema
+func (s *SQLDatabase) ListBlocksPartitions(relayChain, chain string) ([]string, error) {
+	if s.dialect == DialectSQLite {
+		return nil, nil
+	}
+	blocksTable := GetBlocksTableName(relayChain, chain)
+	query := `
+SELECT child.relname
+FROM pg_inherits
+JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+JOIN pg_namespace ns ON ns.oid = parent.relnamespace
+WHERE ns.nspname = $1 AND parent.relname = $2
+ORDER BY child.relname;`
+
+	rows, err := s.db.Query(query, schemaName, strings.TrimPrefix(blocksTable, schemaName+"."))
+	if err != nil {
+		return nil, fmt.Errorf("error listing partitions of %s: %w", blocksTable, err)
+	}
+	defer rows.Close()
+
+	partitions := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning partition of %s: %w", blocksTable, err)
+		}
+		partitions = append(partitions, schemaName+"."+name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing partitions of %s: %w", blocksTable, err)
+	}
+	return partitions, nil
+}
+
+// DropBlocksPartitions drops the given partitions, then removes the
+// address2blocks rows pointing before the first block left. The address
+// table is hash partitioned so its rows cannot be dropped by month.
+func (s *SQLDatabase) DropBlocksPartitions(relayChain, chain string, partitions []BlocksPartition) (int64, error) {
+	blocksTable := GetBlocksTableName(relayChain, chain)
+	for _, partition := range partitions {
+		if _, ok := ParseBlocksPartition(blocksTable, partition.Name); !ok {
+			return 0, fmt.Errorf("%s is not a partition of %s", partition.Name, blocksTable)
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", pqSanitizeTableName(partition.Name))); err != nil {
+			return 0, fmt.Errorf("error dropping partition %s: %w", partition.Name, err)
+		}
+		log.Printf("Dropped partition %s", partition.Name)
+	}
+
+	var firstBlock *int64
+	if err := s.db.QueryRow(fmt.Sprintf("SELECT MIN(block_id) FROM %s;", blocksTable)).Scan(&firstBlock); err != nil {
+		return 0, fmt.Errorf("error reading the first block of %s: %w", blocksTable, err)
+	}
+	if firstBlock == nil {
+		return 0, nil
+	}
+	result, err := s.db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE block_id < $1;", GetAddressTableName(relayChain, chain)),
+		*firstBlock,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error pruning addresses before block %d: %w", *firstBlock, err)
+	}
+	pruned, _ := result.RowsAffected()
+	return pruned, nil
+}
@@ -0,0 +1,73 @@
+package dix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionsToDrop(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	names := []string{
+		table + "_2025_03",
+		table + "_2024_11",
+		table + "_2024_12",
+		table + "_2025_01",
+		table + "_2025_02",
+		table + "_2025_04",
+		table + "_2025_13",
+		table + "_old",
+		GetBlocksTableName("polkadot", "assethub") + "_2020_01",
+	}
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name       string
+		keepMonths int
+		want       []string
+	}{
+		{"keep all", 0, nil},
+		{"current month only", 1, []string{"2024_11", "2024_12", "2025_01", "2025_02"}},
+		{"across the year", 3, []string{"2024_11", "2024_12"}},
+		{"longer than the data", 12, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := PartitionsToDrop(table, names, now, tc.keepMonths)
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected %d partitions, got %v", len(tc.want), got)
+			}
+			for i := range got {
+				if got[i].Name != table+"_"+tc.want[i] {
+					t.Errorf("Partition %d: expected %s_%s, got %s", i, table, tc.want[i], got[i].Name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBlocksPartition(t *testing.T) {
+	table := GetBlocksTableName("kusama", "kusama")
+	partition, ok := ParseBlocksPartition(table, table+"_2019_10")
+	if !ok || partition.Year != 2019 || partition.Month != 10 {
+		t.Errorf("Expected 2019/10, got %+v %v", partition, ok)
+	}
+	for _, name := range []string{table, table + "_2019", table + "_2019_00", table + "_19_10", table + "x_2019_10"} {
+		if _, ok := ParseBlocksPartition(table, name); ok {
+			t.Errorf("Expected %s not to be a monthly partition", name)
+		}
+	}
+}
+
+func TestBlocksPartitionOf(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	partition := BlocksPartitionOf(table, time.Date(2024, 12, 31, 23, 59, 59, 999_000_000, time.UTC))
+	if partition.Name != table+"_2024_12" || partition.Year != 2024 || partition.Month != 12 {
+		t.Errorf("Expected the December 2024 partition, got %+v", partition)
+	}
+	from, to := partition.Bounds()
+	if !from.Equal(time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected December to end on January 1st, got %v to %v", from, to)
+	}
+	if parsed, ok := ParseBlocksPartition(table, partition.Name); !ok || parsed != partition {
+		t.Errorf("Expected %s to parse back, got %+v %v", partition.Name, parsed, ok)
+	}
+}
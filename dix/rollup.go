@@ -0,0 +1,195 @@
+package dix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// YearlyRollupMonth is the month under which the yearly rollup of a monthly
+// query is stored, next to the results of months 1 to 12
+const YearlyRollupMonth = 0
+
+// Rollup says how the monthly results of a query combine into the result of
+// a year. Rows with the same Keys are merged and their Sum columns added up,
+// the other columns keep the value of the first month. Without Keys nor Sum
+// the rows are kept as they are, which with OrderBy and Limit keeps the top
+// rows of the year.
+type Rollup struct {
+	Keys []string
+	Sum  []string
+	// column the rows are sorted on, largest first
+	OrderBy string
+	// maximum number of rows, 0 keeps them all
+	Limit int
+}
+
+// QueryRollup returns how the monthly query name rolls up into a year. The
+// distinct counts and the averages do not add up and have no rollup.
+func QueryRollup(name string) (Rollup, bool) {
+	for _, q := range monthlyQueries {
+		if q.name == name && q.rollup != nil {
+			return *q.rollup, true
+		}
+	}
+	return Rollup{}, false
+}
+
+// Aggregate combines the results of the months of a year, a partial year
+// simply has fewer months
+func (r Rollup) Aggregate(months []SqlResult) SqlResult {
+	merge := len(r.Keys) > 0 || len(r.Sum) > 0
+	result := make(SqlResult, 0)
+	sums := make([]map[string]*big.Rat, 0)
+	index := make(map[string]int)
+	for _, month := range months {
+		for _, row := range month {
+			key := r.key(row)
+			i, seen := index[key]
+			if !merge || !seen {
+				i = len(result)
+				index[key] = i
+				copied := make(map[string]interface{}, len(row))
+				for column, value := range row {
+					copied[column] = value
+				}
+				result = append(result, copied)
+				sums = append(sums, make(map[string]*big.Rat))
+			}
+			for _, column := range r.Sum {
+				n, ok := numericValue(row[column])
+				if !ok {
+					continue
+				}
+				if sums[i][column] == nil {
+					sums[i][column] = new(big.Rat)
+				}
+				sums[i][column].Add(sums[i][column], n)
+			}
+		}
+	}
+	for i := range result {
+		for column, sum := range sums[i] {
+			result[i][column] = ratValue(sum)
+		}
+	}
+
+	if r.OrderBy != "" {
+		sort.SliceStable(result, func(i, j int) bool {
+			a, okA := numericValue(result[i][r.OrderBy])
+			b, okB := numericValue(result[j][r.OrderBy])
+			if okA && okB {
+				return a.Cmp(b) > 0
+			}
+			// rows without a number go last
+			return okA && !okB
+		})
+	}
+	if r.Limit > 0 && len(result) > r.Limit {
+		result = result[:r.Limit]
+	}
+	return result
+}
+
+// key identifies the rows merged together
+func (r Rollup) key(row map[string]interface{}) string {
+	parts := make([]string, len(r.Keys))
+	for i, column := range r.Keys {
+		parts[i] = fmt.Sprint(row[column])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// numericValue reads a number as scanned from the database, where NUMERIC
+// comes back as a string, or as decoded from the stored JSON
+func numericValue(value interface{}) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+	case float64:
+		n := new(big.Rat)
+		if n.SetFloat64(v) == nil {
+			return nil, false
+		}
+		return n, true
+	case string:
+		return new(big.Rat).SetString(v)
+	case json.Number:
+		return new(big.Rat).SetString(v.String())
+	}
+	return nil, false
+}
+
+// ratValue turns a sum back into an int64 when it is one, a string when it
+// is an integer too large for it, like NUMERIC, and a float64 otherwise
+func ratValue(n *big.Rat) interface{} {
+	if n.IsInt() {
+		if n.Num().IsInt64() {
+			return n.Num().Int64()
+		}
+		return n.Num().String()
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// RollupYear aggregates the stored monthly results of queryName for year and
+// stores them under YearlyRollupMonth. It returns the number of months
+// rolled up, 0 when the query has no rollup or no month was computed yet.
+func (s *SQLDatabase) RollupYear(ctx context.Context, relayChain, chain, queryName string, year int) (int, error) {
+	rollup, ok := QueryRollup(queryName)
+	if !ok {
+		return 0, nil
+	}
+
+	query := s.prepareQuery(fmt.Sprintf(`
+SELECT
+  results
+FROM
+  %s
+WHERE
+  relay_chain = $1
+  AND chain = $2
+  AND query_name = $3
+  AND year = $4
+  AND month BETWEEN 1 AND 12
+ORDER BY month;`,
+		MonthlyQueryResultsTableName(),
+	))
+
+	rows, err := s.db.QueryContext(ctx, query, relayChain, chain, queryName, year)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the monthly results of '%s' for %d: %w", queryName, year, err)
+	}
+	defer rows.Close()
+
+	months := make([]SqlResult, 0, 12)
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return 0, fmt.Errorf("error scanning the monthly results of '%s': %w", queryName, err)
+		}
+		var month SqlResult
+		if err := json.Unmarshal(data, &month); err != nil {
+			return 0, fmt.Errorf("error decoding the monthly results of '%s': %w", queryName, err)
+		}
+		months = append(months, month)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over the monthly results of '%s': %w", queryName, err)
+	}
+	rows.Close()
+	if len(months) == 0 {
+		return 0, nil
+	}
+
+	if err := s.StoreMonthlyQueryResult(ctx, relayChain, chain, queryName, year, YearlyRollupMonth, rollup.Aggregate(months)); err != nil {
+		return 0, err
+	}
+	return len(months), nil
+}
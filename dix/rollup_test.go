@@ -0,0 +1,112 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestRollupAggregateCount(t *testing.T) {
+	rollup, ok := QueryRollup("total_blocks_in_month")
+	if !ok {
+		t.Fatal("Expected total_blocks_in_month to roll up")
+	}
+	// as scanned from the database and as decoded from the stored JSON
+	months := []SqlResult{
+		{{"total_blocks": int64(100)}},
+		{{"total_blocks": float64(250)}},
+		{{"total_blocks": "50"}},
+	}
+	got := rollup.Aggregate(months)
+	expected := SqlResult{{"total_blocks": int64(400)}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	// the months are left as they are
+	if months[0][0]["total_blocks"] != int64(100) {
+		t.Errorf("Expected the first month to be unchanged, got %v", months[0])
+	}
+
+	if got := rollup.Aggregate(nil); len(got) != 0 {
+		t.Errorf("Expected an empty rollup without months, got %v", got)
+	}
+}
+
+func TestRollupAggregateKeysAndTop(t *testing.T) {
+	authors, _ := QueryRollup("authors_in_month")
+	got := authors.Aggregate([]SqlResult{
+		{{"author_id": "alice", "blocks": float64(3)}, {"author_id": "bob", "blocks": float64(2)}},
+		{{"author_id": "bob", "blocks": float64(4)}, {"author_id": "carol", "blocks": float64(1)}},
+	})
+	expected := SqlResult{
+		{"author_id": "bob", "blocks": int64(6)},
+		{"author_id": "alice", "blocks": int64(3)},
+		{"author_id": "carol", "blocks": int64(1)},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	transfers := Rollup{OrderBy: "amount", Limit: 2}
+	got = transfers.Aggregate([]SqlResult{
+		{{"block_id": float64(1), "amount": "5"}, {"block_id": float64(2), "amount": "300000000000000000000"}},
+		{{"block_id": float64(3), "amount": "40"}},
+	})
+	if len(got) != 2 || got[0]["block_id"] != float64(2) || got[1]["block_id"] != float64(3) {
+		t.Errorf("Expected the two largest transfers, got %v", got)
+	}
+
+	if _, ok := QueryRollup("total_addresses_in_month"); ok {
+		t.Error("Expected no rollup for a distinct count")
+	}
+}
+
+func TestRollupYear(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableMonthlyQueryResults(); err != nil {
+		t.Fatalf("CreateTableMonthlyQueryResults: %v", err)
+	}
+
+	ctx := context.Background()
+	months, err := database.RollupYear(ctx, "polkadot", "polkadot", "total_blocks_in_month", 2025)
+	if err != nil || months != 0 {
+		t.Fatalf("Expected nothing to roll up, got %d %v", months, err)
+	}
+
+	// a partial year, and another year left out
+	for _, m := range []struct {
+		year, month int
+		blocks      int64
+	}{{2025, 1, 10}, {2025, 2, 20}, {2025, 3, 30}, {2024, 12, 1000}} {
+		result := SqlResult{{"total_blocks": m.blocks}}
+		if err := database.StoreMonthlyQueryResult(ctx, "polkadot", "polkadot", "total_blocks_in_month", m.year, m.month, result); err != nil {
+			t.Fatalf("StoreMonthlyQueryResult: %v", err)
+		}
+	}
+
+	// rolling up twice replaces the rollup rather than counting it
+	for range 2 {
+		months, err = database.RollupYear(ctx, "polkadot", "polkadot", "total_blocks_in_month", 2025)
+		if err != nil {
+			t.Fatalf("RollupYear: %v", err)
+		}
+	}
+	if months != 3 {
+		t.Errorf("Expected 3 months rolled up, got %d", months)
+	}
+
+	var results string
+	if err := db.QueryRow(`SELECT results FROM chain_dotidx_monthly_query_results WHERE year = 2025 AND month = ?`,
+		YearlyRollupMonth).Scan(&results); err != nil {
+		t.Fatalf("Error reading the rollup: %v", err)
+	}
+	if results != `[{"total_blocks":60}]` {
+		t.Errorf("Expected 60 blocks in 2025, got %s", results)
+	}
+}
@@ -0,0 +1,304 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// RuntimeUpgrade is a spec version transition, BlockID is the first block
+// executed with the new runtime
+type RuntimeUpgrade struct {
+	BlockID        int       `json:"blockId"`
+	SpecName       string    `json:"specName"`
+	OldSpecVersion int       `json:"oldSpecVersion"`
+	NewSpecVersion int       `json:"newSpecVersion"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// GetRuntimeSpecsTableName returns the table keeping one row per runtime
+// spec version with the first block where it was seen
+func GetRuntimeSpecsTableName(relayChain, chain string) string {
+	chainName := sanitizeChainName(relayChain, chain)
+	return fmt.Sprintf("%s.runtime_specs_%s_%s", schemaName, sanitizeRelayChainName(relayChain), chainName)
+}
+
+func (s *SQLDatabase) CreateTableRuntimeSpecs(relayChain, chain string) error {
+	runtimeTable := s.getTableName(GetRuntimeSpecsTableName(relayChain, chain))
+
+	template := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    spec_version        INTEGER NOT NULL,
+    spec_name           TEXT NOT NULL,
+    impl_version        INTEGER NOT NULL,
+    transaction_version INTEGER NOT NULL,
+    first_block_id      INTEGER NOT NULL,
+    PRIMARY KEY (spec_version)
+);`, runtimeTable)
+
+	if _, err := s.db.Exec(template); err != nil {
+		s.LogSQL(template)
+		return fmt.Errorf("error creating runtime specs table: %w", err)
+	}
+	return nil
+}
+
+// SaveRuntimeSpec records that runtime was live at blockID. Blocks are not
+// indexed in order, so the first block of a spec only moves backward.
+func (s *SQLDatabase) SaveRuntimeSpec(relayChain, chain string, blockID int, runtime RuntimeVersion) error {
+	runtimeTable := s.getTableName(GetRuntimeSpecsTableName(relayChain, chain))
+
+	least := "LEAST"
+	if s.dialect == DialectSQLite {
+		least = "MIN"
+	}
+
+	query := s.prepareQuery(fmt.Sprintf(`
+INSERT INTO %[1]s (spec_version, spec_name, impl_version, transaction_version, first_block_id)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (spec_version)
+DO UPDATE SET first_block_id = %[2]s(%[1]s.first_block_id, EXCLUDED.first_block_id);`,
+		runtimeTable,
+		least,
+	))
+
+	_, err := s.db.Exec(query,
+		runtime.SpecVersion,
+		runtime.SpecName,
+		runtime.ImplVersion,
+		runtime.TransactionVersion,
+		blockID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving runtime spec %d at block %d: %w", runtime.SpecVersion, blockID, err)
+	}
+	return nil
+}
+
+// ErrNoRuntimeSpec is returned by GetRuntimeSpecAt for a block older than
+// every recorded runtime
+var ErrNoRuntimeSpec = errors.New("no runtime known")
+
+// GetRuntimeSpecAt returns the runtime which was live at blockID, as far as
+// the indexed blocks tell, with the first block it was seen at.
+func (s *SQLDatabase) GetRuntimeSpecAt(relayChain, chain string, blockID int) (RuntimeVersion, int, error) {
+	runtimeTable := s.getTableName(GetRuntimeSpecsTableName(relayChain, chain))
+
+	query := s.prepareQuery(fmt.Sprintf(`
+SELECT spec_version, spec_name, impl_version, transaction_version, first_block_id
+FROM %s
+WHERE first_block_id <= $1
+ORDER BY first_block_id DESC
+LIMIT 1;`,
+		runtimeTable,
+	))
+
+	var runtime RuntimeVersion
+	var firstBlockID int
+	err := s.db.QueryRow(query, blockID).Scan(
+		&runtime.SpecVersion,
+		&runtime.SpecName,
+		&runtime.ImplVersion,
+		&runtime.TransactionVersion,
+		&firstBlockID,
+	)
+	if err == sql.ErrNoRows {
+		return RuntimeVersion{}, 0, fmt.Errorf("%w at block %d", ErrNoRuntimeSpec, blockID)
+	}
+	if err != nil {
+		return RuntimeVersion{}, 0, fmt.Errorf("error reading runtime at block %d: %w", blockID, err)
+	}
+	return runtime, firstBlockID, nil
+}
+
+func (s *SQLDatabase) CreateTableRuntimeUpgrades() error {
+	tableName := s.getTableName(RuntimeUpgradesTableName())
+
+	timestampType := "TIMESTAMP(4) WITHOUT TIME ZONE"
+	if s.dialect == DialectSQLite {
+		timestampType = "TIMESTAMP"
+	}
+
+	query := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    relay_chain      TEXT NOT NULL,
+    chain            TEXT NOT NULL,
+    block_id         INTEGER NOT NULL,
+    spec_name        TEXT NOT NULL,
+    old_spec_version INTEGER NOT NULL,
+    new_spec_version INTEGER NOT NULL,
+    created_at       %s NOT NULL,
+    PRIMARY KEY (relay_chain, chain, block_id)
+);`, tableName, timestampType)
+
+	if _, err := s.db.Exec(query); err != nil {
+		s.LogSQL(query)
+		return fmt.Errorf("error creating %s table: %w", tableName, err)
+	}
+	return nil
+}
+
+// SaveRuntimeUpgrade records an upgrade which happened at timestamp, recording
+// it again is a no-op
+func (s *SQLDatabase) SaveRuntimeUpgrade(relayChain, chain string, upgrade RuntimeUpgrade, timestamp string) error {
+	query := s.prepareQuery(fmt.Sprintf(`
+INSERT INTO %s (relay_chain, chain, block_id, spec_name, old_spec_version, new_spec_version, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (relay_chain, chain, block_id) DO NOTHING;`,
+		s.getTableName(RuntimeUpgradesTableName()),
+	))
+
+	_, err := s.db.Exec(query,
+		relayChain,
+		chain,
+		upgrade.BlockID,
+		upgrade.SpecName,
+		upgrade.OldSpecVersion,
+		upgrade.NewSpecVersion,
+		timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving runtime upgrade at block %d: %w", upgrade.BlockID, err)
+	}
+	return nil
+}
+
+func (s *SQLDatabase) GetRuntimeUpgrades(relayChain, chain string) ([]RuntimeUpgrade, error) {
+	query := s.prepareQuery(fmt.Sprintf(`
+SELECT block_id, spec_name, old_spec_version, new_spec_version, created_at
+FROM %s
+WHERE relay_chain = $1 AND chain = $2
+ORDER BY block_id;`,
+		s.getTableName(RuntimeUpgradesTableName()),
+	))
+
+	rows, err := s.db.Query(query, relayChain, chain)
+	if err != nil {
+		return nil, fmt.Errorf("error querying runtime upgrades: %w", err)
+	}
+	defer rows.Close()
+
+	upgrades := make([]RuntimeUpgrade, 0)
+	for rows.Next() {
+		var upgrade RuntimeUpgrade
+		if err := rows.Scan(
+			&upgrade.BlockID,
+			&upgrade.SpecName,
+			&upgrade.OldSpecVersion,
+			&upgrade.NewSpecVersion,
+			&upgrade.Timestamp,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning runtime upgrade: %w", err)
+		}
+		upgrades = append(upgrades, upgrade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating runtime upgrades: %w", err)
+	}
+	return upgrades, nil
+}
+
+// TrackRuntimeUpgrades compares the runtime at the end of a fetched range
+// with the one recorded for its start in runtime_specs. A range without an
+// upgrade costs one runtime version call; otherwise the blocks from where the
+// recorded runtime was first seen are bisected to find the first block of
+// each new runtime, which also finds an upgrade at the start of the range.
+func TrackRuntimeUpgrades(ctx context.Context, blocks []BlockData, relayChain, chain string, db Database, reader ChainReader) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	byID := make(map[int]BlockData, len(blocks))
+	first, last := -1, -1
+	for _, block := range blocks {
+		id, err := strconv.Atoi(block.ID)
+		if err != nil {
+			return fmt.Errorf("invalid block id %q: %w", block.ID, err)
+		}
+		byID[id] = block
+		if first == -1 || id < first {
+			first = id
+		}
+		if id > last {
+			last = id
+		}
+	}
+
+	high, err := reader.GetRuntimeVersion(ctx, last)
+	if err != nil {
+		return err
+	}
+	low, lo, err := db.GetRuntimeSpecAt(relayChain, chain, first)
+	if errors.Is(err, ErrNoRuntimeSpec) {
+		// nothing indexed before this range
+		lo = first
+		if low, err = reader.GetRuntimeVersion(ctx, first); err != nil {
+			return err
+		}
+		if err := db.SaveRuntimeSpec(relayChain, chain, first, low); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// invariant: spec(lo) == low and spec(last) == high, spec versions
+	// only go up
+	for low.SpecVersion != high.SpecVersion {
+		hi, next := last, high
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			runtime, err := reader.GetRuntimeVersion(ctx, mid)
+			if err != nil {
+				return err
+			}
+			if runtime.SpecVersion == low.SpecVersion {
+				lo = mid
+			} else {
+				hi, next = mid, runtime
+			}
+		}
+
+		// read before the spec is saved: without it the next range finds
+		// the upgrade again
+		timestamp, err := upgradeTimestamp(ctx, byID, hi, reader)
+		if err != nil {
+			return err
+		}
+		if err := db.SaveRuntimeSpec(relayChain, chain, hi, next); err != nil {
+			return err
+		}
+		upgrade := RuntimeUpgrade{
+			BlockID:        hi,
+			SpecName:       next.SpecName,
+			OldSpecVersion: low.SpecVersion,
+			NewSpecVersion: next.SpecVersion,
+		}
+		log.Printf("Runtime upgrade on %s:%s at block %d: %d -> %d", relayChain, chain, hi, low.SpecVersion, next.SpecVersion)
+		if err := db.SaveRuntimeUpgrade(relayChain, chain, upgrade, timestamp); err != nil {
+			return err
+		}
+		lo, low = hi, next
+	}
+	return nil
+}
+
+// upgradeTimestamp returns the timestamp of the first block of a runtime,
+// fetched when the upgrade is before the range
+func upgradeTimestamp(ctx context.Context, byID map[int]BlockData, blockID int, reader ChainReader) (string, error) {
+	block, ok := byID[blockID]
+	if !ok {
+		var err error
+		if block, err = reader.FetchBlock(ctx, blockID); err != nil {
+			return "", fmt.Errorf("error fetching runtime upgrade block %d: %w", blockID, err)
+		}
+	}
+	timestamp, err := ExtractTimestamp(block.Extrinsics)
+	if err != nil {
+		return "", fmt.Errorf("no timestamp for runtime upgrade block %d: %w", blockID, err)
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,206 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRuntimeTestDatabase(t *testing.T) *SQLDatabase {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableRuntimeSpecs("polkadot", "polkadot"); err != nil {
+		t.Fatalf("Error creating runtime specs table: %v", err)
+	}
+	if err := database.CreateTableRuntimeUpgrades(); err != nil {
+		t.Fatalf("Error creating runtime upgrades table: %v", err)
+	}
+	return database
+}
+
+func TestRuntimeSpecBoundaries(t *testing.T) {
+	database := newRuntimeTestDatabase(t)
+
+	v1 := RuntimeVersion{SpecName: "polkadot", SpecVersion: 1000, TransactionVersion: 1}
+	v2 := RuntimeVersion{SpecName: "polkadot", SpecVersion: 1001, TransactionVersion: 2}
+
+	// blocks arrive out of order, the boundary must move backward only
+	assert.NoError(t, database.SaveRuntimeSpec("polkadot", "polkadot", 150, v2))
+	assert.NoError(t, database.SaveRuntimeSpec("polkadot", "polkadot", 10, v1))
+	assert.NoError(t, database.SaveRuntimeSpec("polkadot", "polkadot", 100, v2))
+	assert.NoError(t, database.SaveRuntimeSpec("polkadot", "polkadot", 120, v2))
+	assert.NoError(t, database.SaveRuntimeSpec("polkadot", "polkadot", 50, v1))
+
+	tests := []struct {
+		blockID     int
+		specVersion int
+	}{
+		{10, 1000},
+		{99, 1000},
+		{100, 1001},
+		{5000, 1001},
+	}
+	for _, tt := range tests {
+		runtime, _, err := database.GetRuntimeSpecAt("polkadot", "polkadot", tt.blockID)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.specVersion, runtime.SpecVersion, "spec at block %d", tt.blockID)
+	}
+
+	_, _, err := database.GetRuntimeSpecAt("polkadot", "polkadot", 1)
+	assert.ErrorIs(t, err, ErrNoRuntimeSpec, "no runtime is known before the first indexed block")
+}
+
+// timestampedBlock is a block whose only extrinsic is timestamp.set
+func timestampedBlock(id int) BlockData {
+	return BlockData{
+		ID:         strconv.Itoa(id),
+		Extrinsics: json.RawMessage(fmt.Sprintf(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"%d"}}]`, 1700000000000+6000*id)),
+	}
+}
+
+// upgradeReader serves runtime 1000 below upgradeAt and 1001 from it, and
+// blocks without a timestamp when untimed
+type upgradeReader struct {
+	upgradeAt int
+	calls     int
+	untimed   bool
+}
+
+func (r *upgradeReader) GetChainHeadID() (int, error)     { return 0, nil }
+func (r *upgradeReader) GetFinalizedHeadID() (int, error) { return 0, nil }
+func (r *upgradeReader) FetchBlockRange(ctx context.Context, blockIDs []int) ([]BlockData, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (r *upgradeReader) FetchBlock(ctx context.Context, id int) (BlockData, error) {
+	if r.untimed {
+		return BlockData{ID: strconv.Itoa(id)}, nil
+	}
+	return timestampedBlock(id), nil
+}
+func (r *upgradeReader) Ping() error             { return nil }
+func (r *upgradeReader) GetStats() *MetricsStats { return nil }
+
+func (r *upgradeReader) GetRuntimeVersion(ctx context.Context, blockID int) (RuntimeVersion, error) {
+	r.calls++
+	if blockID < r.upgradeAt {
+		return RuntimeVersion{SpecName: "polkadot", SpecVersion: 1000}, nil
+	}
+	return RuntimeVersion{SpecName: "polkadot", SpecVersion: 1001}, nil
+}
+
+func TestTrackRuntimeUpgrades(t *testing.T) {
+	database := newRuntimeTestDatabase(t)
+	reader := &upgradeReader{upgradeAt: 101}
+
+	blocks := make([]BlockData, 0)
+	for id := 95; id <= 105; id++ {
+		blocks = append(blocks, timestampedBlock(id))
+	}
+
+	// indexing the same range twice must not duplicate the upgrade
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, TrackRuntimeUpgrades(context.Background(), blocks, "polkadot", "polkadot", database, reader))
+	}
+	assert.Less(t, reader.calls, 2*len(blocks), "the range is bisected, not scanned")
+
+	upgrades, err := database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	if assert.Len(t, upgrades, 1) {
+		assert.Equal(t, 101, upgrades[0].BlockID)
+		assert.Equal(t, 1000, upgrades[0].OldSpecVersion)
+		assert.Equal(t, 1001, upgrades[0].NewSpecVersion)
+		assert.Equal(t, int64(1700000000000+6000*101), upgrades[0].Timestamp.UnixMilli())
+	}
+
+	runtime, firstBlockID, err := database.GetRuntimeSpecAt("polkadot", "polkadot", 101)
+	assert.NoError(t, err)
+	assert.Equal(t, 1001, runtime.SpecVersion)
+	assert.Equal(t, 101, firstBlockID)
+
+	// a range without an upgrade records nothing
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), blocks[:3], "polkadot", "polkadot", database, reader))
+	upgrades, err = database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	assert.Len(t, upgrades, 1)
+}
+
+func TestTrackRuntimeUpgradesAtBatchBoundary(t *testing.T) {
+	database := newRuntimeTestDatabase(t)
+	reader := &upgradeReader{upgradeAt: 101}
+	batch := func(first, last int) []BlockData {
+		blocks := make([]BlockData, 0)
+		for id := first; id <= last; id++ {
+			blocks = append(blocks, timestampedBlock(id))
+		}
+		return blocks
+	}
+
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(81, 90), "polkadot", "polkadot", database, reader))
+	// the runtime is known from here, a batch without upgrade costs one call
+	reader.calls = 0
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(91, 100), "polkadot", "polkadot", database, reader))
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(81, 90), "polkadot", "polkadot", database, reader))
+	assert.Equal(t, 2, reader.calls)
+
+	// the upgrade is the first block of the batch
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(101, 110), "polkadot", "polkadot", database, reader))
+	upgrades, err := database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	if assert.Len(t, upgrades, 1) {
+		assert.Equal(t, 101, upgrades[0].BlockID)
+		assert.Equal(t, 1000, upgrades[0].OldSpecVersion)
+		assert.Equal(t, 1001, upgrades[0].NewSpecVersion)
+	}
+
+	reader.calls = 0
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(111, 120), "polkadot", "polkadot", database, reader))
+	assert.Equal(t, 1, reader.calls)
+}
+
+func TestTrackRuntimeUpgradesBeforeTheRange(t *testing.T) {
+	batch := func(first, last int) []BlockData {
+		blocks := make([]BlockData, 0)
+		for id := first; id <= last; id++ {
+			blocks = append(blocks, timestampedBlock(id))
+		}
+		return blocks
+	}
+
+	// the upgrade block is fetched for its timestamp
+	database := newRuntimeTestDatabase(t)
+	reader := &upgradeReader{upgradeAt: 101}
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(81, 90), "polkadot", "polkadot", database, reader))
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(111, 120), "polkadot", "polkadot", database, reader))
+	upgrades, err := database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	if assert.Len(t, upgrades, 1) {
+		assert.Equal(t, 101, upgrades[0].BlockID)
+		assert.Equal(t, int64(1700000000000+6000*101), upgrades[0].Timestamp.UnixMilli())
+	}
+
+	// without a timestamp nothing is saved, the next range tries again
+	database = newRuntimeTestDatabase(t)
+	reader = &upgradeReader{upgradeAt: 101, untimed: true}
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(81, 90), "polkadot", "polkadot", database, reader))
+	assert.Error(t, TrackRuntimeUpgrades(context.Background(), batch(111, 120), "polkadot", "polkadot", database, reader))
+	upgrades, err = database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	assert.Empty(t, upgrades)
+
+	reader.untimed = false
+	assert.NoError(t, TrackRuntimeUpgrades(context.Background(), batch(121, 130), "polkadot", "polkadot", database, reader))
+	upgrades, err = database.GetRuntimeUpgrades("polkadot", "polkadot")
+	assert.NoError(t, err)
+	if assert.Len(t, upgrades, 1) {
+		assert.Equal(t, 101, upgrades[0].BlockID)
+	}
+}
@@ -0,0 +1,141 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+type saveJob struct {
+	// context of the batch, its span is the parent of the save
+	ctx               context.Context
+	items             []BlockData
+	relayChain, chain string
+	// slot of the batch of items, see InFlightBatches
+	slot *batchSlot
+}
+
+// SaveQueue decouples fetching from saving: Save hands the blocks to a pool
+// of savers and returns. The queue is bounded, when the database falls
+// behind Save blocks and the fetchers wait instead of piling blocks up in
+// memory. Once a batch failed, the queue cancels the run given to
+// CancelOnFailure, refuses the next batches and Drain returns the failure.
+// The other Database methods go straight to the database.
+type SaveQueue struct {
+	Database
+	jobs    chan saveJob
+	wg      sync.WaitGroup
+	pending atomic.Int64
+	failed  atomic.Int64
+	drained sync.Once
+	// first batch which could not be saved
+	errMu sync.Mutex
+	err   error
+	// cancels the run feeding the queue, nil when not set
+	cancel context.CancelFunc
+}
+
+// NewSaveQueue starts savers goroutines saving to db, at most capacity
+// batches wait for them
+func NewSaveQueue(db Database, capacity, savers int) *SaveQueue {
+	q := &SaveQueue{
+		Database: db,
+		jobs:     make(chan saveJob, max(capacity, 0)),
+	}
+	for range max(savers, 1) {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				if err := saveChunk(job.ctx, q.Database, job.items, job.relayChain, job.chain); err != nil {
+					err = fmt.Errorf("error saving blocks %s-%s of %s:%s: %w",
+						job.items[0].ID, job.items[len(job.items)-1].ID, job.relayChain, job.chain, err)
+					log.Print(err)
+					q.fail(err)
+				}
+				if job.slot != nil {
+					job.slot.release()
+				}
+				q.pending.Add(-1)
+			}
+		}()
+	}
+	return q
+}
+
+// Save queues the blocks, waiting while the queue is full. A batch failing
+// later is reported by the next Save and by Drain since the caller has moved
+// on.
+func (q *SaveQueue) Save(items []BlockData, relayChain, chain string) error {
+	return q.SaveContext(context.Background(), items, relayChain, chain)
+}
+
+// SaveContext is Save, the blocks are saved with ctx and the in-flight slot
+// carried by ctx, if any, is held until they are
+func (q *SaveQueue) SaveContext(ctx context.Context, items []BlockData, relayChain, chain string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := q.Err(); err != nil {
+		q.failed.Add(1)
+		return fmt.Errorf("save queue stopped: %w", err)
+	}
+	slot := batchSlotFrom(ctx)
+	if slot != nil {
+		slot.retain()
+	}
+	q.pending.Add(1)
+	q.jobs <- saveJob{ctx: ctx, items: items, relayChain: relayChain, chain: chain, slot: slot}
+	return nil
+}
+
+// CancelOnFailure makes the first failed batch call cancel, the fetchers
+// stop rather than fetching blocks the queue would refuse
+func (q *SaveQueue) CancelOnFailure(cancel context.CancelFunc) {
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+	q.cancel = cancel
+}
+
+// Backlog returns the number of batches queued or being saved
+func (q *SaveQueue) Backlog() int {
+	return int(q.pending.Load())
+}
+
+// Failed returns the number of batches which could not be saved, the ones
+// refused after a failure included
+func (q *SaveQueue) Failed() int {
+	return int(q.failed.Load())
+}
+
+// Err returns the error of the first batch which could not be saved
+func (q *SaveQueue) Err() error {
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+	return q.err
+}
+
+func (q *SaveQueue) fail(err error) {
+	q.failed.Add(1)
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+	if q.err == nil {
+		q.err = err
+		if q.cancel != nil {
+			q.cancel()
+		}
+	}
+}
+
+// Drain waits for the queued batches to be saved and returns the first
+// failure, if any. Save must not be called afterwards.
+func (q *SaveQueue) Drain() error {
+	q.drained.Do(func() { close(q.jobs) })
+	q.wg.Wait()
+	if err := q.Err(); err != nil {
+		return fmt.Errorf("%d batches could not be saved: %w", q.Failed(), err)
+	}
+	return nil
+}
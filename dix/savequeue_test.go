@@ -0,0 +1,146 @@
+package dix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// slowDatabase holds every Save until release is closed
+type slowDatabase struct {
+	Database
+	release chan struct{}
+	saved   atomic.Int64
+}
+
+func (d *slowDatabase) Save(items []BlockData, relayChain, chain string) error {
+	<-d.release
+	d.saved.Add(int64(len(items)))
+	return nil
+}
+
+func TestSaveQueueBackpressure(t *testing.T) {
+	db := &slowDatabase{release: make(chan struct{})}
+	// one batch being saved and two waiting
+	q := NewSaveQueue(db, 2, 1)
+
+	fetched := make(chan int, 10)
+	go func() {
+		for i := range 10 {
+			q.Save([]BlockData{{ID: fmt.Sprint(i)}}, "polkadot", "polkadot")
+			fetched <- i
+		}
+		close(fetched)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	// the fourth Save blocks until the database catches up
+	if n := len(fetched); n > 3 {
+		t.Errorf("Expected the fetcher to stall after 3 batches, it went through %d", n)
+	}
+	if backlog := q.Backlog(); backlog > 4 {
+		t.Errorf("Expected a backlog bounded by the queue, got %d", backlog)
+	}
+
+	close(db.release)
+	for range fetched {
+	}
+	if err := q.Drain(); err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+	if got := db.saved.Load(); got != 10 {
+		t.Errorf("Expected 10 saved blocks, got %d", got)
+	}
+	if q.Backlog() != 0 {
+		t.Errorf("Expected an empty backlog after Drain, got %d", q.Backlog())
+	}
+}
+
+// failingDatabase fails every Save
+type failingDatabase struct {
+	Database
+	saves atomic.Int64
+}
+
+func (d *failingDatabase) Save(items []BlockData, relayChain, chain string) error {
+	d.saves.Add(1)
+	return errors.New("disk full")
+}
+
+func TestSaveQueueReportsFailures(t *testing.T) {
+	db := &failingDatabase{}
+	q := NewSaveQueue(db, 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.CancelOnFailure(cancel)
+	if err := q.Save([]BlockData{{ID: "1"}}, "polkadot", "polkadot"); err != nil {
+		t.Fatalf("Expected the first batch to be queued, got %v", err)
+	}
+	for q.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	if ctx.Err() == nil {
+		t.Errorf("Expected the failure to cancel the run")
+	}
+
+	// the next batches are refused rather than lost
+	err := q.Save([]BlockData{{ID: "2"}}, "polkadot", "polkadot")
+	if err == nil || !strings.Contains(err.Error(), "error saving blocks 1-1 of polkadot:polkadot: disk full") {
+		t.Errorf("Expected the failure of block 1, got %v", err)
+	}
+	err = q.Drain()
+	if err == nil || !strings.Contains(err.Error(), "2 batches could not be saved") {
+		t.Errorf("Expected Drain to report both batches, got %v", err)
+	}
+	if saves := db.saves.Load(); saves != 1 {
+		t.Errorf("Expected a single save, got %d", saves)
+	}
+}
+
+// contextDatabase records the context of the last save
+type contextDatabase struct {
+	Database
+	ctx context.Context
+}
+
+func (d *contextDatabase) SaveContext(ctx context.Context, items []BlockData, relayChain, chain string) error {
+	d.ctx = ctx
+	return nil
+}
+
+func TestSaveQueueKeepsTheBatchContext(t *testing.T) {
+	recorder := recordSpans(t)
+	db := &contextDatabase{}
+	q := NewSaveQueue(db, 1, 1)
+
+	ctx, span := startSpan(context.Background(), "process-batch")
+	ctx, cancel := context.WithCancel(ctx)
+	if err := q.SaveContext(ctx, []BlockData{{ID: "1"}}, "polkadot", "polkadot"); err != nil {
+		t.Fatalf("SaveContext: %v", err)
+	}
+	cancel()
+	span.End()
+	if err := q.Drain(); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if db.ctx == nil || db.ctx.Err() == nil {
+		t.Errorf("Expected the save to see the batch cancelled, got %v", db.ctx)
+	}
+	var save sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "save-batch" {
+			save = ended
+		}
+	}
+	if save == nil || save.Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("Expected a save-batch span under the batch span, got %v", save)
+	}
+}
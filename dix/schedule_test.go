@@ -0,0 +1,89 @@
+package dix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.DateTime, s)
+		if err != nil {
+			t.Fatalf("bad time %s", s)
+		}
+		return ts
+	}
+	// 2026-10-16 is a Friday
+	tests := []struct {
+		spec    string
+		time    string
+		matches bool
+	}{
+		{"* * * * *", "2026-10-16 13:37:00", true},
+		{"@hourly", "2026-10-16 13:00:00", true},
+		{"@hourly", "2026-10-16 13:01:00", false},
+		{"@daily", "2026-10-16 00:00:59", true},
+		{"*/15 * * * *", "2026-10-16 13:45:00", true},
+		{"*/15 * * * *", "2026-10-16 13:50:00", false},
+		{"30 2 * * 1-5", "2026-10-16 02:30:00", true},
+		{"30 2 * * 1-5", "2026-10-17 02:30:00", false},
+		{"0 0 * * 7", "2026-10-18 00:00:00", true},
+		{"0 4,16 1 * *", "2026-11-01 16:00:00", true},
+		{"0 4,16 1 * *", "2026-11-02 16:00:00", false},
+		{"10-20/5 * * 10 *", "2026-10-16 13:15:00", true},
+		{"10-20/5 * * 10 *", "2026-10-16 13:25:00", false},
+		// both day fields restricted: either one matches
+		{"0 0 1 * 5", "2026-10-16 00:00:00", true},
+		{"0 0 1 * 5", "2026-10-01 00:00:00", true},
+		{"0 0 1 * 5", "2026-10-15 00:00:00", false},
+	}
+	for _, tc := range tests {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tc.spec, err)
+			continue
+		}
+		if got := schedule.Matches(at(tc.time)); got != tc.matches {
+			t.Errorf("%q at %s: expected %v, got %v", tc.spec, tc.time, tc.matches, got)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	schedule, err := ParseSchedule("0 3 * * *")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	now := time.Date(2026, 10, 16, 3, 0, 30, 0, time.UTC)
+	if next := schedule.Next(now); !next.Equal(time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run tomorrow at 03:00, got %s", next)
+	}
+	never, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	if next := never.Next(now); !next.IsZero() {
+		t.Errorf("Expected no run on 30 February, got %s", next)
+	}
+}
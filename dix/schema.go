@@ -0,0 +1,96 @@
+package dix
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultSchemaName is the schema of the dotidx tables when dotidx_db.schema
+// is not set
+const DefaultSchemaName = "chain"
+
+// schemaName prefixes every table name built by the package. It is set once
+// at startup by SetSchemaName, before any table name is computed.
+var schemaName = DefaultSchemaName
+
+// a lower case PostgreSQL identifier which needs no quoting, short enough to
+// leave room for the table and partition suffixes in 63 bytes
+var schemaNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,15}$`)
+
+// ValidateSchemaName checks that name can be interpolated in SQL as is
+func ValidateSchemaName(name string) error {
+	if !schemaNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid schema %q: expected [a-z_][a-z0-9_]* and at most 16 characters", name)
+	}
+	return nil
+}
+
+// relay chain and chain names as written in the parachains section
+var chainNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ValidateChainName checks that a relay chain or chain name is made of
+// lower case letters, digits and _ only. The table names are derived from
+// it and interpolated in SQL.
+func ValidateChainName(name string) error {
+	if !chainNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid chain name %q: expected [a-z0-9_]+", name)
+	}
+	return nil
+}
+
+// SetSchemaName changes the schema of the dotidx tables, "" restores the
+// default. Several dotidx instances can share a database with a schema each.
+func SetSchemaName(name string) error {
+	if name == "" {
+		name = DefaultSchemaName
+	}
+	if err := ValidateSchemaName(name); err != nil {
+		return err
+	}
+	schemaName = name
+	return nil
+}
+
+// SchemaName returns the schema of the dotidx tables
+func SchemaName() string {
+	return schemaName
+}
+
+// SchemaName returns the configured schema or the default one
+func (db DotidxDB) SchemaName() string {
+	if db.Schema == "" {
+		return DefaultSchemaName
+	}
+	return db.Schema
+}
+
+// RuntimeUpgradesTableName returns the table of the runtime upgrades of all
+// the chains
+func RuntimeUpgradesTableName() string {
+	return schemaName + ".runtime_upgrades"
+}
+
+// MonthlyQueryResultsTableName returns the table of the results of the
+// monthly named queries
+func MonthlyQueryResultsTableName() string {
+	return schemaName + ".dotidx_monthly_query_results"
+}
+
+// RangeQueryResultsTableName returns the table of the results of the named
+// queries run over a date range
+func RangeQueryResultsTableName() string {
+	return schemaName + ".dotidx_range_query_results"
+}
+
+// createSchema creates the schema of the dotidx tables, SQLite has none and
+// prefixes the table names instead
+func (s *SQLDatabase) createSchema() error {
+	if s.dialect == DialectSQLite {
+		return nil
+	}
+	query := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", schemaName)
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("error creating schema %s: %w", schemaName, err)
+	}
+	return nil
+}
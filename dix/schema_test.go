@@ -0,0 +1,128 @@
+package dix
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// useSchema switches the schema for the duration of the test
+func useSchema(t *testing.T, name string) {
+	t.Helper()
+	if err := SetSchemaName(name); err != nil {
+		t.Fatalf("SetSchemaName(%q): %v", name, err)
+	}
+	t.Cleanup(func() {
+		if err := SetSchemaName(""); err != nil {
+			t.Errorf("Error restoring the default schema: %v", err)
+		}
+	})
+}
+
+func TestSetSchemaName(t *testing.T) {
+	for _, name := range []string{"Chain", "dotidx-2", "chain;drop", "chain.x", "1chain", `"chain"`, "a_very_long_schema_name"} {
+		if err := SetSchemaName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+		if SchemaName() != DefaultSchemaName {
+			t.Errorf("Expected a rejected schema to keep %q, got %q", DefaultSchemaName, SchemaName())
+		}
+	}
+
+	useSchema(t, "dotidx2")
+	for _, table := range []string{
+		GetBlocksTableName("polkadot", "assethub"),
+		GetAddressTableName("polkadot", "assethub"),
+		GetStatsPerMonthTableName("polkadot", "assethub"),
+		GetRuntimeSpecsTableName("polkadot", "assethub"),
+		RuntimeUpgradesTableName(),
+		MonthlyQueryResultsTableName(),
+		RangeQueryResultsTableName(),
+	} {
+		if !strings.HasPrefix(table, "dotidx2.") {
+			t.Errorf("Expected %s in schema dotidx2", table)
+		}
+	}
+
+	if err := SetSchemaName(""); err != nil || SchemaName() != DefaultSchemaName {
+		t.Errorf("Expected an empty schema to restore %q, got %q %v", DefaultSchemaName, SchemaName(), err)
+	}
+}
+
+func TestSchemaInDDL(t *testing.T) {
+	useSchema(t, "dotidx2")
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE SCHEMA IF NOT EXISTS dotidx2;")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS dotidx2.blocks_polkadot_polkadot")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := database.createSchema(); err != nil {
+		t.Fatalf("createSchema: %v", err)
+	}
+	if err := database.CreateTableBlocks("polkadot", "polkadot"); err != nil {
+		t.Fatalf("CreateTableBlocks: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %s", err)
+	}
+
+	query, err := renderNamedQuery(queryRegistry["total_blocks_in_month"].SQLTemplate, sampleQueryParameters("polkadot", "polkadot"))
+	if err != nil {
+		t.Fatalf("renderNamedQuery: %v", err)
+	}
+	if !strings.Contains(query, "dotidx2.blocks_polkadot_polkadot") {
+		t.Errorf("Expected the named query to read from dotidx2, got %s", query)
+	}
+}
+
+func TestSchemaWithSQLite(t *testing.T) {
+	useSchema(t, "dotidx2")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(db, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.CreateTableBlocks("polkadot", "polkadot"); err != nil {
+		t.Fatalf("CreateTableBlocks: %v", err)
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table'").Scan(&name); err != nil {
+		t.Fatalf("Error listing tables: %v", err)
+	}
+	if name != "dotidx2_blocks_polkadot_polkadot" {
+		t.Errorf("Expected dotidx2_blocks_polkadot_polkadot, got %s", name)
+	}
+	if query := database.prepareQuery("SELECT * FROM dotidx2.blocks_polkadot_polkadot"); !strings.Contains(query, "dotidx2_blocks_polkadot_polkadot") {
+		t.Errorf("Expected the schema to be folded in the table name, got %s", query)
+	}
+}
+
+func TestTableNamesAreIdentifiers(t *testing.T) {
+	identifier := regexp.MustCompile(`^[a-z_][a-z0-9_]*\.[a-z0-9_]+$`)
+	for _, table := range []string{
+		GetBlocksTableName("polkadot'; --", "asset-hub"),
+		GetAddressTableName("Kusama", "kusama-assethub"),
+		GetStatsPerMonthTableName("polkadot", `people"`),
+		GetRuntimeSpecsTableName("polkadot.x", "collectives"),
+	} {
+		if !identifier.MatchString(table) {
+			t.Errorf("Expected %q to be a plain identifier", table)
+		}
+	}
+	if got := pqSanitizeTableName(`chain.blocks_"x`); got != `"chain"."blocks_""x"` {
+		t.Errorf("Unexpected quoting %s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package dix
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SelfTest fetches the head block and runs it through the same decoding and
+// extraction as Save without writing anything, so a misconfigured reader
+// fails before a long run starts.
+func SelfTest(ctx context.Context, reader ChainReader) error {
+	headID, err := reader.GetChainHeadID()
+	if err != nil {
+		return fmt.Errorf("cannot get head block: %w", err)
+	}
+	block, err := reader.FetchBlock(ctx, headID)
+	if err != nil {
+		return fmt.Errorf("cannot fetch head block %d: %w", headID, err)
+	}
+
+	if err := checkBlockFields(block); err != nil {
+		return fmt.Errorf("head block %d: %w", headID, err)
+	}
+	if id, err := strconv.Atoi(block.ID); err != nil || id != headID {
+		return fmt.Errorf("head block %d: reader answered block %q", headID, block.ID)
+	}
+
+	addresses, err := extractAddressesFromExtrinsics(block.Extrinsics)
+	if err != nil {
+		return fmt.Errorf("head block %d: %w", headID, err)
+	}
+	timestamps, fallbacks := blockTimestamps([]BlockData{block}, time.Now())
+	if fallbacks > 0 {
+		log.Printf("Self-test: head block %d has no timestamp extrinsic, using %s", headID, timestamps[0])
+	}
+
+	log.Printf("Self-test passed: block %d at %s, %d addresses", headID, timestamps[0], len(addresses))
+	return nil
+}
+
+// checkBlockFields reports the fields Save needs which are empty
+func checkBlockFields(block BlockData) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"number", block.ID},
+		{"hash", block.Hash},
+		{"parentHash", block.ParentHash},
+		{"stateRoot", block.StateRoot},
+		{"extrinsicsRoot", block.ExtrinsicsRoot},
+		{"extrinsics", string(block.Extrinsics)},
+	}
+	var missing []string
+	for _, field := range fields {
+		if field.value == "" || field.value == "null" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("empty fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
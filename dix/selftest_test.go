@@ -0,0 +1,83 @@
+package dix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fixtureReader answers a single head block
+type fixtureReader struct {
+	ChainReader
+	head  int
+	block BlockData
+	err   error
+}
+
+func (r *fixtureReader) GetChainHeadID() (int, error) {
+	return r.head, nil
+}
+
+func (r *fixtureReader) FetchBlock(ctx context.Context, id int) (BlockData, error) {
+	if r.err != nil {
+		return BlockData{}, r.err
+	}
+	return r.block, nil
+}
+
+func selfTestBlock() BlockData {
+	return BlockData{
+		ID:             "42",
+		Hash:           "0x42",
+		ParentHash:     "0x41",
+		StateRoot:      "0x01",
+		ExtrinsicsRoot: "0x02",
+		Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"}}]`),
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	noHash := selfTestBlock()
+	noHash.Hash = ""
+	noExtrinsics := selfTestBlock()
+	noExtrinsics.Extrinsics = nil
+	badExtrinsics := selfTestBlock()
+	badExtrinsics.Extrinsics = json.RawMessage(`[{"method":`)
+	wrongID := selfTestBlock()
+	wrongID.ID = "41"
+	noTimestamp := selfTestBlock()
+	noTimestamp.Extrinsics = json.RawMessage(`[]`)
+
+	tests := []struct {
+		name    string
+		reader  *fixtureReader
+		wantErr string
+	}{
+		{"valid block", &fixtureReader{head: 42, block: selfTestBlock()}, ""},
+		{"no timestamp extrinsic", &fixtureReader{head: 42, block: noTimestamp}, ""},
+		{"fetch fails", &fixtureReader{head: 42, err: fmt.Errorf("connection refused")}, "connection refused"},
+		{"empty hash", &fixtureReader{head: 42, block: noHash}, "hash"},
+		{"empty extrinsics", &fixtureReader{head: 42, block: noExtrinsics}, "extrinsics"},
+		{"undecodable extrinsics", &fixtureReader{head: 42, block: badExtrinsics}, "extrinsics JSON"},
+		{"wrong block", &fixtureReader{head: 42, block: wrongID}, `"41"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SelfTest(context.Background(), tt.reader)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected self-test to pass, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected self-test to fail with %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error to mention %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package dix
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"unicode/utf8"
+)
+
+// maxLoggedSQL bounds the logged statements, a batch insert can be
+// megabytes long
+const maxLoggedSQL = 2048
+
+// the secrets a statement can carry: PASSWORD 'x' of CREATE/ALTER ROLE,
+// password=x of a connection string and the password of a url
+var sqlSecrets = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`(?i)(password\s*=?\s*)'(?:[^']|'')*'`), "${1}'******'"},
+	{regexp.MustCompile(`(?i)(password=)[^\s']+`), "${1}******"},
+	{regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`), "${1}******@"},
+}
+
+// SetDebugSQL makes the methods log the statements which failed, off by
+// default. The statements are redacted and truncated.
+func (s *SQLDatabase) SetDebugSQL(debug bool) {
+	s.debugSQL = debug
+}
+
+// LogSQL logs query when debug_sql is set, see SetDebugSQL. A nil
+// SQLDatabase logs nothing.
+func (s *SQLDatabase) LogSQL(query string) {
+	if s != nil && s.debugSQL {
+		log.Printf("sql %s", formatSQL(query))
+	}
+}
+
+// formatSQL redacts the secrets of query and cuts it at maxLoggedSQL
+// bytes
+func formatSQL(query string) string {
+	for _, secret := range sqlSecrets {
+		query = secret.re.ReplaceAllString(query, secret.with)
+	}
+	if len(query) <= maxLoggedSQL {
+		return query
+	}
+	cut := maxLoggedSQL
+	for cut > 0 && !utf8.RuneStart(query[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d bytes)", query[:cut], len(query))
+}
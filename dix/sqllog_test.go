@@ -0,0 +1,67 @@
+package dix
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLogSQL(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	query := "INSERT INTO chain.blocks_polkadot_polkadot VALUES ('" + strings.Repeat("x", 3*maxLoggedSQL) + "');"
+	database.LogSQL(query)
+	if logs.Len() != 0 {
+		t.Fatalf("Expected nothing logged without debug_sql, got %q", logs.String())
+	}
+
+	database.SetDebugSQL(true)
+	database.LogSQL(query)
+	logged := logs.String()
+	if !strings.Contains(logged, "sql INSERT INTO chain.blocks_polkadot_polkadot") {
+		t.Errorf("Expected the statement to be logged, got %q", logged)
+	}
+	if len(logged) > maxLoggedSQL+100 {
+		t.Errorf("Expected the statement to be cut at %d bytes, logged %d", maxLoggedSQL, len(logged))
+	}
+	if !strings.Contains(logged, fmt.Sprintf("... (%d bytes)", len(query))) {
+		t.Errorf("Expected the size of the statement, got %q", logged[len(logged)-40:])
+	}
+}
+
+func TestFormatSQL(t *testing.T) {
+	tests := []struct {
+		query, expected string
+	}{
+		{"SELECT 1;", "SELECT 1;"},
+		{"ALTER ROLE dotidx PASSWORD 'it''s secret';", "ALTER ROLE dotidx PASSWORD '******';"},
+		{"CREATE ROLE r WITH LOGIN password='x';", "CREATE ROLE r WITH LOGIN password='******';"},
+		{"SELECT dblink_connect('host=db password=hunter2 dbname=dotidx');", "SELECT dblink_connect('host=db password=****** dbname=dotidx');"},
+		{"SELECT dblink('postgres://dotidx:hunter2@db:5432/dotidx', 'SELECT 1');", "SELECT dblink('postgres://dotidx:******@db:5432/dotidx', 'SELECT 1');"},
+	}
+	for _, tc := range tests {
+		if got := formatSQL(tc.query); got != tc.expected {
+			t.Errorf("formatSQL(%q): expected %q, got %q", tc.query, tc.expected, got)
+		}
+	}
+
+	// never cut inside a character
+	query := strings.Repeat("é", maxLoggedSQL)
+	if got := formatSQL(query); !strings.HasPrefix(got, strings.Repeat("é", maxLoggedSQL/2)+"...") {
+		t.Errorf("Expected the statement to be cut between two characters, got %q", got[maxLoggedSQL-10:])
+	}
+}
@@ -0,0 +1,98 @@
+package dix
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// the tablespaces created for dotidx, see TablespacePaths
+var tablespaceRegexp = regexp.MustCompile(`^dotidx_(` + fastTablespaceRoot + `|` + slowTablespaceRoot + `)[0-9]+$`)
+
+// blocksPartitionTablespace returns the tablespace of the monthly partitions
+// of year for a chain whose first partition is in firstYear. The last
+// fastYears years, the current one included, and the following ones go to
+// the fast tablespaces, the older ones to the slow tablespaces, one
+// tablespace per year while there are enough of them.
+func blocksPartitionTablespace(firstYear, year, fastYears int, now time.Time) string {
+	fastFrom := now.Year() - max(fastYears, 1) + 1
+	if year >= fastFrom {
+		fastYear := max(firstYear, fastFrom)
+		return fmt.Sprintf("dotidx_%s%d", fastTablespaceRoot, min(year-fastYear, fastTablespaceNumber-1))
+	}
+	return fmt.Sprintf("dotidx_%s%d", slowTablespaceRoot, min(year-firstYear, slowTablespaceNumber-1))
+}
+
+// isFastTablespace reports whether tablespace is one of the fast ones
+func isFastTablespace(tablespace string) bool {
+	return strings.HasPrefix(tablespace, "dotidx_"+fastTablespaceRoot)
+}
+
+// isSlowTablespace reports whether tablespace is one of the slow ones
+func isSlowTablespace(tablespace string) bool {
+	return strings.HasPrefix(tablespace, "dotidx_"+slowTablespaceRoot)
+}
+
+// PartitionMove is a partition to move to another tablespace
+type PartitionMove struct {
+	Name string
+	From string
+	To   string
+}
+
+func (m PartitionMove) String() string {
+	return fmt.Sprintf("%s: %s -> %s", m.Name, m.From, m.To)
+}
+
+// PartitionsToRebalance returns the monthly partitions of blocksTable, as
+// listed by GetPartitionStats, which are on a fast tablespace but are now
+// older than fastYears, or on a slow tablespace but are recent. They move to
+// the tablespace CreateTableBlocksPartitions would give them today with the
+// same fastYears, see SQLDatabase.FastYears. A partition already on
+// the right kind of tablespace stays where it is, so do the partitions on
+// other tablespaces and the partitions of other tables.
+func PartitionsToRebalance(blocksTable string, stats []PartitionStat, fastYears int, now time.Time) []PartitionMove {
+	partitions := make([]BlocksPartition, 0, len(stats))
+	tablespaces := make([]string, 0, len(stats))
+	firstYear := 0
+	for _, stat := range stats {
+		partition, ok := ParseBlocksPartition(blocksTable, stat.Name)
+		if !ok {
+			continue
+		}
+		if firstYear == 0 || partition.Year < firstYear {
+			firstYear = partition.Year
+		}
+		partitions = append(partitions, partition)
+		tablespaces = append(tablespaces, stat.Tablespace)
+	}
+
+	moves := make([]PartitionMove, 0)
+	for i, partition := range partitions {
+		current := tablespaces[i]
+		target := blocksPartitionTablespace(firstYear, partition.Year, fastYears, now)
+		if (isFastTablespace(current) && isSlowTablespace(target)) ||
+			(isSlowTablespace(current) && isFastTablespace(target)) {
+			moves = append(moves, PartitionMove{Name: partition.Name, From: current, To: target})
+		}
+	}
+	return moves
+}
+
+// MovePartitions moves each partition to its new tablespace. The partition
+// is rewritten and locked while it moves, its indexes stay where they are.
+func (s *SQLDatabase) MovePartitions(moves []PartitionMove) error {
+	for _, move := range moves {
+		if !tablespaceRegexp.MatchString(move.To) {
+			return fmt.Errorf("%s is not a dotidx tablespace", move.To)
+		}
+		query := fmt.Sprintf("ALTER TABLE %s SET TABLESPACE %s;", pqSanitizeTableName(move.Name), move.To)
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("error moving %s to %s: %w", move.Name, move.To, err)
+		}
+		log.Printf("Moved %s from %s to %s", move.Name, move.From, move.To)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package dix
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPartitionsToRebalance(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	partition := func(month, tablespace string) PartitionStat {
+		return PartitionStat{Table: table, Name: table + "_" + month, Tablespace: tablespace}
+	}
+	// created in 2024, when 2024 and 2025 went fast
+	stats := []PartitionStat{
+		partition("2023_11", "dotidx_slow0"),
+		partition("2023_12", "dotidx_slow0"),
+		partition("2024_01", "dotidx_fast0"),
+		partition("2024_12", "dotidx_fast0"),
+		partition("2025_01", "dotidx_fast1"),
+		// moved by hand
+		partition("2025_02", "pg_default"),
+		partition("2026_01", "dotidx_slow5"),
+		{Table: GetAddressTableName("polkadot", "polkadot"), Name: GetAddressTableName("polkadot", "polkadot") + "_0", Tablespace: "dotidx_fast0"},
+	}
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	moves := PartitionsToRebalance(table, stats, 1, now)
+	expected := []PartitionMove{
+		{Name: table + "_2024_01", From: "dotidx_fast0", To: "dotidx_slow1"},
+		{Name: table + "_2024_12", From: "dotidx_fast0", To: "dotidx_slow1"},
+		{Name: table + "_2026_01", From: "dotidx_slow5", To: "dotidx_fast1"},
+	}
+	if !slices.Equal(moves, expected) {
+		t.Errorf("Expected %v, got %v", expected, moves)
+	}
+
+	// nothing moves until the year changes
+	if moves := PartitionsToRebalance(table, stats[:5], 1, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)); len(moves) != 0 {
+		t.Errorf("Expected no move in 2024, got %v", moves)
+	}
+}
+
+func TestBlocksPartitionTablespace(t *testing.T) {
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+	var got []string
+	for year := 2019; year <= 2031; year++ {
+		got = append(got, blocksPartitionTablespace(2019, year, 1, now))
+	}
+	expected := []string{
+		"dotidx_slow0", "dotidx_slow1", "dotidx_slow2", "dotidx_slow3", "dotidx_slow4", "dotidx_slow5",
+		"dotidx_fast0", "dotidx_fast1", "dotidx_fast2", "dotidx_fast3", "dotidx_fast3", "dotidx_fast3", "dotidx_fast3",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestBlocksPartitionTablespaceTwoFastYears(t *testing.T) {
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+	var got []string
+	for year := 2019; year <= 2030; year++ {
+		got = append(got, blocksPartitionTablespace(2019, year, 2, now))
+	}
+	expected := []string{
+		"dotidx_slow0", "dotidx_slow1", "dotidx_slow2", "dotidx_slow3", "dotidx_slow4",
+		"dotidx_fast0", "dotidx_fast1", "dotidx_fast2", "dotidx_fast3", "dotidx_fast3", "dotidx_fast3", "dotidx_fast3",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// a chain younger than the window starts on the first fast tablespace
+	if got := blocksPartitionTablespace(2025, 2025, 2, now); got != "dotidx_fast0" {
+		t.Errorf("Expected dotidx_fast0, got %s", got)
+	}
+}
+
+func TestPartitionsToRebalanceTwoFastYears(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	partition := func(month, tablespace string) PartitionStat {
+		return PartitionStat{Table: table, Name: table + "_" + month, Tablespace: tablespace}
+	}
+	// created in 2025 with the current year only on the fast tablespaces
+	stats := []PartitionStat{
+		partition("2023_12", "dotidx_slow0"),
+		partition("2024_01", "dotidx_slow1"),
+		partition("2024_12", "dotidx_slow1"),
+		partition("2025_01", "dotidx_fast0"),
+		partition("2026_01", "dotidx_fast1"),
+	}
+	now := time.Date(2025, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	// 2024 comes back, each year keeps the tablespace the creation gives it
+	moves := PartitionsToRebalance(table, stats, 2, now)
+	expected := []PartitionMove{
+		{Name: table + "_2024_01", From: "dotidx_slow1", To: "dotidx_fast0"},
+		{Name: table + "_2024_12", From: "dotidx_slow1", To: "dotidx_fast0"},
+	}
+	if !slices.Equal(moves, expected) {
+		t.Errorf("Expected %v, got %v", expected, moves)
+	}
+	for _, move := range moves {
+		if want := blocksPartitionTablespace(2023, 2024, 2, now); move.To != want {
+			t.Errorf("Expected %s to go to %s like a new partition, got %s", move.Name, want, move.To)
+		}
+	}
+}
+
+func TestMovePartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "chain"."blocks_polkadot_polkadot_2024_01" SET TABLESPACE dotidx_slow1;`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = database.MovePartitions([]PartitionMove{
+		{Name: "chain.blocks_polkadot_polkadot_2024_01", From: "dotidx_fast0", To: "dotidx_slow1"},
+	})
+	if err != nil {
+		t.Fatalf("MovePartitions: %v", err)
+	}
+
+	// the tablespace is interpolated, only the dotidx ones are accepted
+	err = database.MovePartitions([]PartitionMove{
+		{Name: "chain.blocks_polkadot_polkadot_2024_01", To: "dotidx_slow1; DROP TABLE x"},
+	})
+	if err == nil {
+		t.Error("Expected an unknown tablespace to be rejected")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
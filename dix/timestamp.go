@@ -7,15 +7,37 @@ import (
 	"time"
 )
 
+// createdAtLayout is the format of created_at written by Save, the column
+// is a timestamp(4)
+const createdAtLayout = "2006-01-02 15:04:05.0000"
+
+// createdAtPrecision is the precision of createdAtLayout
+const createdAtPrecision = 100 * time.Microsecond
+
+// FormatCreatedAt formats t as created_at, in local time like the
+// timestamps of the extrinsics. It truncates to timestamp(4): PostgreSQL
+// would round a more precise value, which moves an instant just before a
+// month boundary to the partition of the next month.
+func FormatCreatedAt(t time.Time) string {
+	return t.Local().Truncate(createdAtPrecision).Format(createdAtLayout)
+}
+
+// secondsThreshold separates unix timestamps in seconds from the ones in
+// milliseconds: 1e11 seconds is year 5138, 1e11 milliseconds is 1973
+const secondsThreshold = 100_000_000_000
+
 // ParseTimestamp parses a timestamp string in different formats and returns a time.Time.
 // It tries multiple formats:
-// - Unix timestamp (seconds since epoch)
+// - Unix timestamp (seconds or milliseconds since epoch)
 // - RFC3339 format
 // - ISO8601 format
 func ParseTimestamp(timestamp string) (time.Time, error) {
-	// Try parsing as Unix timestamp (seconds since epoch)
+	// Try parsing as Unix timestamp (seconds or milliseconds since epoch)
 	seconds, err := strconv.ParseInt(timestamp, 10, 64)
 	if err == nil {
+		if seconds >= secondsThreshold {
+			return time.UnixMilli(seconds), nil
+		}
 		return time.Unix(seconds, 0), nil
 	}
 
@@ -0,0 +1,209 @@
+package dix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// blockFixtures are the blocks of testdata/blocks, in the format of the
+// sidecar /blocks/{id} answer of their spec version, with the "now" of their
+// timestamp.set
+var blockFixtures = []struct {
+	file string
+	now  string
+	// the fallback reading a block cut short only knows sidecar
+	rpc bool
+}{
+	// calls named "pallet.method"
+	{"polkadot-spec0-1.json", "1590507378000", false},
+	{"polkadot-spec9050-6000000.json", "1626981270000", false},
+	{"polkadot-spec1002000-22000000.json", "1725003660000", false},
+	// timestamp.set follows the validation data
+	{"assethub-spec1002000-7000000.json", "1725003648000", false},
+	// decoder fields, saved by the RPC reader
+	{"polkadot-rpc-18203581.json", "1700000000000", true},
+}
+
+func readBlockFixture(t *testing.T, file string) BlockData {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "blocks", file))
+	if err != nil {
+		t.Fatalf("Cannot read fixture: %v", err)
+	}
+	var block BlockData
+	if err := json.Unmarshal(data, &block); err != nil {
+		t.Fatalf("Cannot decode fixture %s: %v", file, err)
+	}
+	return block
+}
+
+func TestBlockFixturesAreCovered(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "blocks", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := make(map[string]bool)
+	for _, fixture := range blockFixtures {
+		covered[fixture.file] = true
+	}
+	for _, file := range files {
+		if !covered[filepath.Base(file)] {
+			t.Errorf("Fixture %s is not in blockFixtures", file)
+		}
+	}
+}
+
+func TestExtractTimestampFormats(t *testing.T) {
+	for _, fixture := range blockFixtures {
+		t.Run(fixture.file, func(t *testing.T) {
+			block := readBlockFixture(t, fixture.file)
+			want, err := ParseTimestamp(fixture.now)
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q): %v", fixture.now, err)
+			}
+			got, err := ExtractTimestamp(block.Extrinsics)
+			if err != nil {
+				t.Fatalf("ExtractTimestamp: %v", err)
+			}
+			if got != FormatCreatedAt(want) {
+				t.Errorf("Expected %s, got %s", FormatCreatedAt(want), got)
+			}
+
+			if fixture.rpc {
+				return
+			}
+			// a block cut short still has its timestamp.set, the other
+			// extrinsics come after it
+			end := bytes.Index(block.Extrinsics, []byte(fixture.now)) + len(fixture.now) + 1
+			if got, err := ExtractTimestamp(block.Extrinsics[:end]); err != nil || got != FormatCreatedAt(want) {
+				t.Errorf("Expected %s from the truncated block, got %s %v", FormatCreatedAt(want), got, err)
+			}
+			// and not before its "now"
+			start := bytes.Index(block.Extrinsics, []byte(`"now"`))
+			if _, err := ExtractTimestamp(block.Extrinsics[:start]); !errors.Is(err, ErrNoTimestamp) {
+				t.Errorf("Expected ErrNoTimestamp before \"now\", got %v", err)
+			}
+		})
+	}
+}
+
+// The argument of timestamp.set in the shapes the blocks were not seen in
+func TestExtractTimestampVariants(t *testing.T) {
+	const millis = 1700000000000
+	want := time.UnixMilli(millis).Format("2006-01-02 15:04:05.0000")
+
+	for _, tc := range []struct {
+		name       string
+		extrinsics string
+	}{
+		{"sidecar number", `[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":1700000000000}}]`},
+		{"sidecar indented", "[\n\t{\n\t\t\"method\": {\"pallet\": \"timestamp\", \"method\": \"set\"},\n\t\t\"args\": {\n\t\t\t\"now\":\t\"1700000000000\"\n\t\t}\n\t}\n]"},
+		{"sidecar seconds", `[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000"}}]`},
+		{"sidecar other now first", `[{"method":{"pallet":"scheduler","method":"schedule"},"args":{"now":"42"}},{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"}}]`},
+		{"rpc decoder without name", `[{"call_module":"Timestamp","params":[{"type":"Compact<Moment>","value":1700000000000}]}]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ExtractTimestamp([]byte(tc.extrinsics))
+			if err != nil {
+				t.Fatalf("ExtractTimestamp: %v", err)
+			}
+			if got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		name       string
+		extrinsics string
+	}{
+		{"genesis", `[]`},
+		{"no timestamp", `[{"method":{"pallet":"balances","method":"transfer"},"args":{"dest":"5F"}}]`},
+		{"zero", `[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"0"}}]`},
+		{"rpc other call", `[{"call_module":"Timestamp","call_module_function":"other","params":[{"value":1700000000000}]}]`},
+		// a "now" which is not the argument of timestamp.set
+		{"truncated other now", `[{"method":{"pallet":"scheduler","method":"schedule"},"args":{"now":"1700000000000"}},{"method":{"pallet":"timesta`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ExtractTimestamp([]byte(tc.extrinsics)); !errors.Is(err, ErrNoTimestamp) {
+				t.Errorf("Expected ErrNoTimestamp, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTimestampFormats(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  time.Time
+	}{
+		{"1700000000", time.Unix(1700000000, 0)},
+		{"1700000000123", time.UnixMilli(1700000000123)},
+		{"2023-11-14T22:13:20Z", time.Unix(1700000000, 0)},
+		{"2023-11-14T22:13:20.5+01:00", time.Date(2023, 11, 14, 22, 13, 20, 500000000, time.FixedZone("", 3600))},
+		{"2023-11-14 22:13:20", time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)},
+		{"2023-11-14", time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)},
+	} {
+		got, err := ParseTimestamp(tc.input)
+		if err != nil {
+			t.Errorf("ParseTimestamp(%q): %v", tc.input, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tc.input, got, tc.want)
+		}
+	}
+	// the timestamp.set of the blocks are milliseconds, all after the
+	// genesis of polkadot
+	genesis := time.Date(2020, 5, 26, 0, 0, 0, 0, time.UTC)
+	for _, fixture := range blockFixtures {
+		got, err := ParseTimestamp(fixture.now)
+		if err != nil || got.Before(genesis) || got.After(time.Now()) {
+			t.Errorf("ParseTimestamp(%q) of %s = %v %v", fixture.now, fixture.file, got, err)
+		}
+	}
+	if _, err := ParseTimestamp("yesterday"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestFormatCreatedAtMonthBoundary(t *testing.T) {
+	table := GetBlocksTableName("polkadot", "polkadot")
+	boundary := time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local)
+	february := BlocksPartitionOf(table, boundary)
+	from, _ := february.Bounds()
+
+	// a block produced exactly on the boundary opens the February partition,
+	// whose lower bound is included
+	created := FormatCreatedAt(boundary)
+	if created != from.Format(createdAtLayout) {
+		t.Errorf("Expected the boundary block at %s, got %s", from.Format(createdAtLayout), created)
+	}
+	ts, err := ExtractTimestamp([]byte(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"` +
+		strconv.FormatInt(boundary.UnixMilli(), 10) + `"}}]`))
+	if err != nil || ts != created {
+		t.Errorf("Expected the extrinsic timestamp %s, got %s %v", created, ts, err)
+	}
+
+	// a header timestamp more precise than timestamp(4), in another zone,
+	// stays in January instead of being rounded up to the boundary
+	before := boundary.Add(-10 * time.Microsecond).In(time.FixedZone("east", 5*3600))
+	created = FormatCreatedAt(before)
+	if created != "2024-01-31 23:59:59.9999" {
+		t.Errorf("Expected the last instant of January, got %s", created)
+	}
+	if created >= from.Format(createdAtLayout) {
+		t.Errorf("Expected %s before the February partition", created)
+	}
+
+	timestamps, _ := blockTimestamps([]BlockData{{ID: "1", Timestamp: before, Extrinsics: []byte(`[]`)}}, time.Now())
+	if timestamps[0] != created {
+		t.Errorf("Expected the block saved at %s, got %s", created, timestamps[0])
+	}
+}
@@ -0,0 +1,164 @@
+package dix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans records the spans ended until the test is over
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return recorder
+}
+
+// spanAttribute returns the value of the attribute key of span
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestProcessBlockBatchSpans(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blocks" || r.URL.Query().Get("range") != "1-2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]BlockData{
+			{ID: "1", Hash: "0x01", ParentHash: "0x00", StateRoot: "0x10", ExtrinsicsRoot: "0x11", Extrinsics: json.RawMessage(`[]`)},
+			{ID: "2", Hash: "0x02", ParentHash: "0x01", StateRoot: "0x20", ExtrinsicsRoot: "0x21", Extrinsics: json.RawMessage(`[]`)},
+		})
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectBegin()
+	for range 2 {
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	}
+	mock.ExpectCommit()
+
+	recorder := recordSpans(t)
+	ProcessBlockBatch(context.Background(), []int{1, 2}, "polkadot", "chain", NewSQLDatabaseWithDB(db), NewSidecar("polkadot", "chain", server.URL), 0)
+
+	ended := recorder.Ended()
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range ended {
+		spans[span.Name()] = span
+	}
+	parents := map[string]string{
+		"process-batch":     "",
+		"fetch-range":       "process-batch",
+		"decode":            "fetch-range",
+		"save-batch":        "process-batch",
+		"extract-addresses": "save-batch",
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Missing span %s", name)
+			continue
+		}
+		if span.SpanContext().TraceID() != spans["process-batch"].SpanContext().TraceID() {
+			t.Errorf("Span %s is not in the batch trace", name)
+		}
+		if parent == "" {
+			if span.Parent().IsValid() {
+				t.Errorf("Span %s should be a root span", name)
+			}
+		} else if spans[parent] == nil || span.Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Errorf("Span %s should be a child of %s", name, parent)
+		}
+		if got := spanAttribute(span, "blocks"); got.AsInt64() != 2 {
+			t.Errorf("Span %s: expected blocks=2, got %v", name, got.Emit())
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("Span %s failed: %s", name, span.Status().Description)
+		}
+	}
+	if len(ended) != len(parents) {
+		t.Errorf("Expected %d spans, got %d", len(parents), len(ended))
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := recordSpans(t)
+	_, span := startSpan(context.Background(), "save-batch")
+	recordError(span, nil)
+	recordError(span, io.ErrUnexpectedEOF)
+	span.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("Expected one span, got %d", len(ended))
+	}
+	if status := ended[0].Status(); status.Code != codes.Error || status.Description != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("Expected the span to fail with %v, got %+v", io.ErrUnexpectedEOF, status)
+	}
+	if events := ended[0].Events(); len(events) != 1 {
+		t.Errorf("Expected one recorded error, got %d events", len(events))
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Expected a post to /v1/traces, got %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer server.Close()
+
+	stop, err := SetupTracing(context.Background(), server.URL+"/", "dixbatch", time.Hour)
+	if err != nil {
+		t.Fatalf("SetupTracing: %v", err)
+	}
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	ctx, root := startSpan(context.Background(), "process-batch")
+	_, child := startSpan(ctx, "save-batch", attribute.Int("blocks", 3))
+	child.End()
+	root.End()
+
+	// the spans wait for the interval, stopping exports them
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	select {
+	case body := <-received:
+		for _, expected := range []string{"dixbatch", "process-batch", "save-batch", "blocks"} {
+			if !bytes.Contains(body, []byte(expected)) {
+				t.Errorf("Expected %s in the exported spans", expected)
+			}
+		}
+	default:
+		t.Fatal("Expected the spans to be exported")
+	}
+}
@@ -0,0 +1,292 @@
+package dix
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// configProblems collects the problems of a configuration, each prefixed
+// with the key it comes from
+type configProblems struct {
+	errs []error
+}
+
+func (p *configProblems) add(key, format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (p *configProblems) nonNegative(key string, value int64) {
+	if value < 0 {
+		p.add(key, "must not be negative, got %d", value)
+	}
+}
+
+func (p *configProblems) duration(key string, value Duration) {
+	if value < 0 {
+		p.add(key, "must not be negative, got %s", time.Duration(value))
+	}
+}
+
+// port accepts 0, the port is then not set
+func (p *configProblems) port(key string, port int) {
+	if port < 0 || port > 65535 {
+		p.add(key, "%d is not a port", port)
+	}
+}
+
+// path rejects the blanks the generated units and scripts cannot quote
+func (p *configProblems) path(key, path string) {
+	if strings.ContainsFunc(path, unicode.IsSpace) {
+		p.add(key, "%q contains a blank", path)
+	}
+}
+
+func (p *configProblems) httpURL(key, raw string) {
+	if raw == "" {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		p.add(key, "%v", err)
+		return
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add(key, "%q is not an http or https url", raw)
+	}
+}
+
+func (p *configProblems) oneOf(key, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		p.add(key, "%q is not one of %q", value, allowed)
+	}
+}
+
+// blockRange checks a range of blocks where end -1 means the head
+func (p *configProblems) blockRange(startKey, endKey string, start, end int) {
+	p.nonNegative(startKey, int64(start))
+	if end != -1 && end < start {
+		p.add(endKey, "%d is before %s %d, use -1 for the head", end, startKey, start)
+	}
+}
+
+func (p *configProblems) err() error {
+	return errors.Join(p.errs...)
+}
+
+// Validate reports every problem of the command line configuration at
+// once
+func (c Config) Validate() error {
+	p := &configProblems{}
+	p.blockRange("start", "end", c.StartRange, c.EndRange)
+	if c.BatchSize <= 0 {
+		p.add("batch", "must be positive, got %d", c.BatchSize)
+	}
+	if c.MaxWorkers <= 0 {
+		p.add("workers", "must be positive, got %d", c.MaxWorkers)
+	}
+	p.duration("flush", Duration(c.FlushTimeout))
+	p.nonNegative("flush-bytes", c.FlushBytes)
+	p.httpURL("chainreader", c.ChainReaderURL)
+	if c.DatabaseURL != "" {
+		if _, err := url.Parse(c.DatabaseURL); err != nil {
+			p.add("database", "%v", err)
+		}
+	}
+	p.port("frontend-port", c.FrontendPort)
+
+	// minimise the risk of writing to the wrong database
+	if c.ChainReaderURL != "" && strings.ToLower(c.Relaychain) == "polkadot" {
+		expectedPort := conventionalSidecarPort(strings.ToLower(c.Chain))
+		if !checkPortFollowConvention(c.ChainReaderURL, expectedPort) {
+			p.add("chainreader", "%s:%s sidecar port should be %d got %s",
+				strings.ToLower(c.Relaychain), strings.ToLower(c.Chain), expectedPort, c.ChainReaderURL)
+		}
+	}
+	return p.err()
+}
+
+// Validate reports every problem of the configuration at once, so that
+// they can all be fixed before the next start. Each problem names its key.
+func (c MgrConfig) Validate() error {
+	p := &configProblems{}
+
+	// written in the generated units and scripts
+	for _, path := range []struct{ key, value string }{
+		{"target_dir", c.TargetDir},
+		{"dotidx_root", c.DotidxRoot},
+		{"dotidx_backup", c.DotidxBackup},
+		{"dotidx_run", c.DotidxRun},
+		{"dotidx_runtime", c.DotidxRuntime},
+		{"dotidx_logs", c.DotidxLogs},
+		{"dotidx_bin", c.DotidxBin},
+		{"dotidx_static", c.DotidxStatic},
+	} {
+		p.path(path.key, path.value)
+	}
+
+	c.DotidxDB.validate(p)
+	c.DotidxBatch.validate(p)
+	c.DotidxFE.validate(p)
+	c.DotidxCron.validate(p)
+	c.Monitoring.validate(p)
+	validateParachains(p, c.Parachains)
+
+	p.nonNegative("watcher.max_restarts", int64(c.Watcher.MaxRestarts))
+	for i, webhook := range c.Webhooks {
+		key := fmt.Sprintf("webhooks[%d]", i)
+		if webhook.URL == "" {
+			p.add(key+".url", "is required")
+		}
+		p.httpURL(key+".url", webhook.URL)
+		if webhook.RelayChain != "" && webhook.Chain != "" {
+			if _, ok := c.Parachains[webhook.RelayChain][webhook.Chain]; !ok {
+				p.add(key, "%s:%s is not a configured chain", webhook.RelayChain, webhook.Chain)
+			}
+		}
+	}
+	return p.err()
+}
+
+func (db DotidxDB) validate(p *configProblems) {
+	p.oneOf("dotidx_db.type", strings.ToLower(db.Type), "", "postgres", "sqlite")
+	p.port("dotidx_db.port", db.Port)
+	p.port("dotidx_db.replica_port", db.ReplicaPort)
+	p.duration("dotidx_db.replica_max_lag", db.ReplicaMaxLag)
+	p.nonNegative("dotidx_db.max_open_conns", int64(db.MaxOpenConns))
+	p.nonNegative("dotidx_db.address_partitions", int64(db.AddressPartitions))
+	p.nonNegative("dotidx_db.fast_years", int64(db.FastYears))
+	p.nonNegative("dotidx_db.retention_months", int64(db.RetentionMonths))
+	p.duration("dotidx_db.maintenance_interval", db.MaintenanceInterval)
+	if db.Schema != "" {
+		if err := ValidateSchemaName(db.Schema); err != nil {
+			p.add("dotidx_db.schema", "%v", err)
+		}
+	}
+	for _, ip := range db.WhitelistedIP {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				p.add("dotidx_db.whitelisted_ip", "%q is neither an address nor a network", ip)
+			}
+		}
+	}
+}
+
+func (batch DotidxBatch) validate(p *configProblems) {
+	p.blockRange("dotidx_batch.start_range", "dotidx_batch.end_range", batch.StartRange, batch.EndRange)
+	p.nonNegative("dotidx_batch.batch_size", int64(batch.BatchSize))
+	p.nonNegative("dotidx_batch.max_workers", int64(batch.MaxWorkers))
+	if batch.MaxWorkers > 0 && batch.BatchSize == 0 {
+		p.add("dotidx_batch.batch_size", "must be set when max_workers is")
+	}
+	p.duration("dotidx_batch.flush_timeout", batch.FlushTimeout)
+	p.duration("dotidx_batch.progress_interval", batch.ProgressInterval)
+	p.oneOf("dotidx_batch.stats_format", batch.StatsFormat, "", "text", "json")
+	p.nonNegative("dotidx_batch.max_response_bytes", batch.MaxResponseBytes)
+	p.nonNegative("dotidx_batch.flush_bytes", batch.FlushBytes)
+	p.nonNegative("dotidx_batch.save_queue", int64(batch.SaveQueue))
+	p.nonNegative("dotidx_batch.gap_tolerance", int64(batch.GapTolerance))
+	p.nonNegative("dotidx_batch.max_inflight_batches", int64(batch.MaxInFlightBatches))
+	p.nonNegative("dotidx_batch.global_workers", int64(batch.GlobalWorkers))
+	p.httpURL("dotidx_batch.tracing_endpoint", batch.TracingEndpoint)
+}
+
+func (fe DotidxFE) validate(p *configProblems) {
+	p.port("dotidx_fe.port", fe.Port)
+	p.port("dotidx_fe.admin_port", fe.AdminPort)
+	if fe.AdminPort != 0 && fe.AdminPort == fe.Port && fe.AdminIP == fe.IP {
+		p.add("dotidx_fe.admin_port", "%d is the public port as well", fe.AdminPort)
+	}
+	p.duration("dotidx_fe.query_timeout", fe.QueryTimeout)
+	p.duration("dotidx_fe.explain_slow_queries", fe.ExplainSlowQueries)
+	p.nonNegative("dotidx_fe.address_cache_size", int64(fe.AddressCacheSize))
+	p.duration("dotidx_fe.address_cache_ttl", fe.AddressCacheTTL)
+}
+
+func (cron DotidxCron) validate(p *configProblems) {
+	for _, schedule := range []struct{ key, spec string }{
+		{"dotidx_cron.stats", cron.Stats},
+		{"dotidx_cron.queries", cron.Queries},
+		{"dotidx_cron.partitions", cron.Partitions},
+		{"dotidx_cron.analyze", cron.Analyze},
+		{"dotidx_cron.backup", cron.Backup},
+	} {
+		if schedule.spec == "" || schedule.spec == "off" {
+			continue
+		}
+		if _, err := ParseSchedule(schedule.spec); err != nil {
+			p.add(schedule.key, "%v", err)
+		}
+	}
+	if cron.Backup != "" && cron.Backup != "off" && cron.BackupCommand == "" {
+		p.add("dotidx_cron.backup_command", "is required by the backup schedule")
+	}
+}
+
+func (m MonitoringConfig) validate(p *configProblems) {
+	p.port("monitoring.prometheus_port", m.PrometheusPort)
+	p.port("monitoring.grafana_port", m.GrafanaPort)
+	for _, percent := range []struct {
+		key   string
+		value float64
+	}{
+		{"monitoring.disk_warning_percent", m.DiskWarningPercent},
+		{"monitoring.disk_critical_percent", m.DiskCriticalPercent},
+	} {
+		if percent.value < 0 || percent.value > 100 {
+			p.add(percent.key, "%g is not a percentage", percent.value)
+		}
+	}
+	if m.DiskWarningPercent != 0 && m.DiskCriticalPercent > m.DiskWarningPercent {
+		p.add("monitoring.disk_critical_percent", "%g is above disk_warning_percent %g",
+			m.DiskCriticalPercent, m.DiskWarningPercent)
+	}
+}
+
+func validateParachains(p *configProblems, parachains map[string]map[string]ParaChainConfig) {
+	for _, relay := range slices.Sorted(maps.Keys(parachains)) {
+		if err := ValidateChainName(relay); err != nil {
+			p.add("parachains."+relay, "%v", err)
+		}
+		for _, chain := range slices.Sorted(maps.Keys(parachains[relay])) {
+			key := fmt.Sprintf("parachains.%s.%s", relay, chain)
+			if err := ValidateChainName(chain); err != nil {
+				p.add(key, "%v", err)
+			}
+			config := parachains[relay][chain]
+			for _, port := range []struct {
+				name  string
+				value int
+			}{
+				{"port_rpc", config.PortRPC},
+				{"port_ws", config.PortWS},
+				{"chainreader_port", config.ChainreaderPort},
+				{"sidecar_port", config.SidecarPort},
+				{"sidecar_prometheus_port", config.SidecarPrometheusPort},
+				{"prometheus_port", config.PrometheusPort},
+			} {
+				p.port(key+"."+port.name, port.value)
+			}
+			p.path(key+".bin", config.Bin)
+			p.path(key+".basepath", config.Basepath)
+			p.nonNegative(key+".sidecar_count", int64(config.SidecarCount))
+			p.duration(key+".block_time", config.BlockTime)
+			p.oneOf(key+".chainreader_block_url", config.ChainreaderBlockURL, "", string(BlockURLPath), string(BlockURLQuery))
+			if (config.ChainreaderCert == "") != (config.ChainreaderKey == "") {
+				p.add(key, "chainreader_cert and chainreader_key go together")
+			}
+			if config.ChainreaderCA != "" && config.ChainreaderCert == "" {
+				p.add(key+".chainreader_ca", "requires chainreader_cert")
+			}
+		}
+	}
+	if err := CheckTableNameCollisions(parachains); err != nil {
+		p.add("parachains", "%v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package dix
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// problems returns the problems joined in err
+func problems(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected joined errors, got %T: %v", err, err)
+	}
+	var messages []string
+	for _, e := range joined.Unwrap() {
+		messages = append(messages, e.Error())
+	}
+	return messages
+}
+
+func TestMgrConfigValidate(t *testing.T) {
+	var config MgrConfig
+	config.TargetDir = "/dotidx/my etc"
+	config.DotidxDB.Port = 70000
+	// uneven over the fast tablespaces but valid
+	config.DotidxDB.AddressPartitions = 6
+	config.DotidxDB.WhitelistedIP = []string{"10.0.0.0/8", "localhost"}
+	config.DotidxBatch.StartRange = 100
+	config.DotidxBatch.EndRange = 50
+	config.DotidxBatch.MaxWorkers = 8
+	config.DotidxBatch.StatsFormat = "xml"
+	config.DotidxBatch.TracingEndpoint = "localhost:4318"
+	config.DotidxFE.Port = 8080
+	config.DotidxFE.AdminPort = 8080
+	config.DotidxCron.Backup = "0 3 * * *"
+	config.Monitoring.DiskWarningPercent = 5
+	config.Monitoring.DiskCriticalPercent = 10
+	config.Parachains = map[string]map[string]ParaChainConfig{
+		"polkadot": {
+			"assethub":  {ChainreaderPort: 10900, ChainreaderCert: "/etc/dotidx/client.pem"},
+			"asset-hub": {ChainreaderPort: 10901, ChainreaderBlockURL: "id"},
+		},
+	}
+	config.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", RelayChain: "kusama", Chain: "assethub"}}
+
+	got := problems(t, config.Validate())
+	expected := []string{
+		`target_dir: "/dotidx/my etc" contains a blank`,
+		"dotidx_db.port: 70000 is not a port",
+		`dotidx_db.whitelisted_ip: "localhost" is neither an address nor a network`,
+		"dotidx_batch.end_range: 50 is before dotidx_batch.start_range 100, use -1 for the head",
+		"dotidx_batch.batch_size: must be set when max_workers is",
+		`dotidx_batch.stats_format: "xml" is not one of ["" "text" "json"]`,
+		`dotidx_batch.tracing_endpoint: "localhost:4318" is not an http or https url`,
+		"dotidx_fe.admin_port: 8080 is the public port as well",
+		"dotidx_cron.backup_command: is required by the backup schedule",
+		"monitoring.disk_critical_percent: 10 is above disk_warning_percent 5",
+		`parachains.polkadot.asset-hub: invalid chain name "asset-hub": expected [a-z0-9_]+`,
+		`parachains.polkadot.asset-hub.chainreader_block_url: "id" is not one of ["" "path" "query"]`,
+		"parachains.polkadot.assethub: chainreader_cert and chainreader_key go together",
+		"parachains: table name collision: polkadot:asset-hub and polkadot:assethub both map to chain.blocks_polkadot_assethub",
+		"webhooks[0]: kusama:assethub is not a configured chain",
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d problems, got %d:\n%s", len(expected), len(got), strings.Join(got, "\n"))
+	}
+	for _, want := range expected {
+		found := false
+		for _, problem := range got {
+			found = found || problem == want
+		}
+		if !found {
+			t.Errorf("Missing problem %q in:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestMgrConfigValidateEmpty(t *testing.T) {
+	var config MgrConfig
+	config.DotidxBatch.EndRange = -1
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected an empty configuration to be valid, got %v", err)
+	}
+}
+
+func TestShippedConfigsAreValid(t *testing.T) {
+	files, err := filepath.Glob("../conf/*.toml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected the configurations in conf: %v", err)
+	}
+	defer SetSchemaName("")
+	for _, file := range files {
+		if _, err := LoadMgrConfig(file); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestLoadMgrConfigReportsEveryProblem(t *testing.T) {
+	_, err := LoadMgrConfig(writeTestConfig(t, "retention_months = -1\nfast_years = -2\n[dotidx_batch]\nbatch_size = -5\n"))
+	if err == nil {
+		t.Fatal("Expected the configuration to be rejected")
+	}
+	for _, key := range []string{"dotidx_db.retention_months", "dotidx_db.fast_years", "dotidx_batch.batch_size"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected %s to be reported, got %v", key, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := Config{
+		StartRange:     -1,
+		EndRange:       -1,
+		ChainReaderURL: "http://127.0.0.1:10800",
+		BatchSize:      0,
+		MaxWorkers:     -2,
+		Relaychain:     "Polkadot",
+		Chain:          "assethub",
+		FrontendPort:   8080,
+	}
+	got := problems(t, config.Validate())
+	expected := []string{
+		"start: must not be negative, got -1",
+		"batch: must be positive, got 0",
+		"workers: must be positive, got -2",
+		"chainreader: polkadot:assethub sidecar port should be 10900 got http://127.0.0.1:10800",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	config = Config{EndRange: -1, BatchSize: 10, MaxWorkers: 5, Relaychain: "polkadot", Chain: "polkadot", ChainReaderURL: "http://127.0.0.1:10800"}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+}
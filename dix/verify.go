@@ -0,0 +1,89 @@
+package dix
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ParentHashMismatch is a block whose parent hash does not match any block
+// fetched at the previous height
+type ParentHashMismatch struct {
+	BlockID    int
+	ParentHash string
+	Expected   []string
+}
+
+func (m ParentHashMismatch) String() string {
+	return fmt.Sprintf("block %d has parent %s, previous block is %v", m.BlockID, m.ParentHash, m.Expected)
+}
+
+// VerifyParentHashes checks that each block links to the block fetched at
+// the previous height. With elastic scaling several blocks share a height,
+// the parent has to be one of them. Blocks without a predecessor in the
+// batch are not checked.
+func VerifyParentHashes(blocks []BlockData) []ParentHashMismatch {
+	hashes := make(map[int][]string, len(blocks))
+	for _, block := range blocks {
+		id, err := strconv.Atoi(block.ID)
+		if err != nil {
+			continue
+		}
+		hashes[id] = append(hashes[id], block.Hash)
+	}
+
+	var mismatches []ParentHashMismatch
+	for _, block := range blocks {
+		id, err := strconv.Atoi(block.ID)
+		if err != nil {
+			continue
+		}
+		previous, ok := hashes[id-1]
+		if !ok {
+			continue
+		}
+		found := false
+		for _, hash := range previous {
+			found = found || hash == block.ParentHash
+		}
+		if !found {
+			mismatches = append(mismatches, ParentHashMismatch{
+				BlockID:    id,
+				ParentHash: block.ParentHash,
+				Expected:   previous,
+			})
+		}
+	}
+	return mismatches
+}
+
+// maxPlausibleBlockID is the largest block_id the blocks tables can store
+const maxPlausibleBlockID = math.MaxInt32
+
+// ValidateBlock checks the fields of a decoded block which are required to
+// store it. A sidecar response missing them decodes to empty strings, such a
+// block is quarantined instead of saved.
+func ValidateBlock(block BlockData) error {
+	id, ok := block.Number()
+	if !ok {
+		return fmt.Errorf("invalid block_id %q", block.ID)
+	}
+	if id < GenesisBlockID || id > maxPlausibleBlockID {
+		return fmt.Errorf("implausible block_id %d", id)
+	}
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"hash", block.Hash},
+		{"parentHash", block.ParentHash},
+		{"stateRoot", block.StateRoot},
+		{"extrinsicsRoot", block.ExtrinsicsRoot},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			return fmt.Errorf("block %d has no %s", id, field.name)
+		}
+	}
+	return nil
+}
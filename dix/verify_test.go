@@ -0,0 +1,165 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyParentHashes(t *testing.T) {
+	blocks := []BlockData{
+		{ID: "10", Hash: "0xa"},
+		{ID: "11", Hash: "0xb", ParentHash: "0xa"},
+		// elastic scaling: two blocks at 12, both children of 11
+		{ID: "12", Hash: "0xc1", ParentHash: "0xb"},
+		{ID: "12", Hash: "0xc2", ParentHash: "0xb"},
+		{ID: "13", Hash: "0xd", ParentHash: "0xc2"},
+		// 15 has no predecessor in the batch
+		{ID: "15", Hash: "0xf", ParentHash: "0xe"},
+	}
+	assert.Empty(t, VerifyParentHashes(blocks))
+
+	blocks[2].ParentHash = "0xbad"
+	mismatches := VerifyParentHashes(blocks)
+	if assert.Len(t, mismatches, 1) {
+		assert.Equal(t, 12, mismatches[0].BlockID)
+		assert.Equal(t, "0xbad", mismatches[0].ParentHash)
+		assert.Equal(t, []string{"0xb"}, mismatches[0].Expected)
+	}
+}
+
+func TestProcessBlockBatchFlagsParentHashMismatch(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// 102 claims a parent which is not 101
+		fmt.Fprintln(w, `[
+			{"number": "100", "hash": "0x100", "parentHash": "0x99"},
+			{"number": "101", "hash": "0x101", "parentHash": "0x100"},
+			{"number": "102", "hash": "0x102", "parentHash": "0xdeadbeef"}
+		]`)
+	}))
+	defer server.Close()
+
+	reader := NewSidecar("polkadot", "polkadot", server.URL)
+	blocks, err := reader.FetchBlockRange(context.Background(), []int{100, 101, 102})
+	assert.NoError(t, err)
+	mismatches := VerifyParentHashes(blocks)
+	if assert.Len(t, mismatches, 1) {
+		assert.Equal(t, 102, mismatches[0].BlockID)
+	}
+
+	db := &savingDatabase{}
+	ProcessBlockBatch(context.Background(), []int{100, 101, 102}, "polkadot", "polkadot", db, reader, 0)
+	assert.Empty(t, db.saved, "a broken range must not be saved")
+
+	// the block at fault is kept and counted
+	sqlite, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer sqlite.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(sqlite, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.DoUpgrade(); err != nil {
+		t.Fatalf("DoUpgrade: %v", err)
+	}
+	requests = 0
+	ProcessBlockBatch(context.Background(), []int{100, 101, 102}, "polkadot", "polkadot", database, reader, 0)
+	assert.Equal(t, 2, requests, "a broken range is fetched again once")
+	assert.Equal(t, int64(1), database.GetStats().ParentHashMismatches)
+	assert.Equal(t, int64(1), database.QuarantinedBlocks())
+	var blockID, reason string
+	row := sqlite.QueryRow("SELECT block_id, reason FROM " + database.getTableName(FailedBlocksTableName()))
+	if assert.NoError(t, row.Scan(&blockID, &reason)) {
+		assert.Equal(t, "102", blockID)
+		assert.Contains(t, reason, "parent hash mismatch")
+	}
+}
+
+func TestProcessBlockBatchQuarantinesThroughASaveQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `[
+			{"number": "100", "hash": "0x100", "parentHash": "0x99"},
+			{"number": "101", "hash": "0x101", "parentHash": "0x100"},
+			{"number": "102", "hash": "0x102", "parentHash": "0xdeadbeef"}
+		]`)
+	}))
+	defer server.Close()
+	reader := NewSidecar("polkadot", "polkadot", server.URL)
+
+	sqlite, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer sqlite.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(sqlite, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.DoUpgrade(); err != nil {
+		t.Fatalf("DoUpgrade: %v", err)
+	}
+
+	// the queue stands between the batch and the database
+	q := NewSaveQueue(database, 1, 1)
+	ProcessBlockBatch(context.Background(), []int{100, 101, 102}, "polkadot", "polkadot", q, reader, 0)
+	assert.NoError(t, q.Drain())
+	assert.Equal(t, int64(1), database.GetStats().ParentHashMismatches)
+	assert.Equal(t, int64(1), database.QuarantinedBlocks())
+}
+
+func TestProcessBlockBatchFetchesABrokenRangeAgain(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blocks" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		// the first answer has a stale 101
+		parent := "0x100"
+		if requests == 1 {
+			parent = "0xstale"
+		}
+		fmt.Fprintf(w, `[
+			{"number": "100", "hash": "0x100", "parentHash": "0x99"},
+			{"number": "101", "hash": "0x101", "parentHash": "%s"}
+		]`, parent)
+	}))
+	defer server.Close()
+
+	db := &savingDatabase{}
+	ProcessBlockBatch(context.Background(), []int{100, 101}, "polkadot", "polkadot", db, NewSidecar("polkadot", "polkadot", server.URL), 0)
+	assert.Equal(t, 2, requests)
+	assert.Len(t, db.saved, 2, "the range fetched again is saved")
+}
+
+func TestValidateBlock(t *testing.T) {
+	valid := BlockData{ID: "12", Hash: "0xc", ParentHash: "0xb", StateRoot: "0x1", ExtrinsicsRoot: "0x2"}
+	assert.NoError(t, ValidateBlock(valid))
+
+	tests := []struct {
+		name   string
+		change func(*BlockData)
+		reason string
+	}{
+		{"no hash", func(b *BlockData) { b.Hash = "" }, "block 12 has no hash"},
+		{"no parent", func(b *BlockData) { b.ParentHash = "" }, "block 12 has no parentHash"},
+		{"no state root", func(b *BlockData) { b.StateRoot = "" }, "block 12 has no stateRoot"},
+		{"no block id", func(b *BlockData) { b.ID = "" }, `invalid block_id ""`},
+		{"negative block id", func(b *BlockData) { b.ID = "-1" }, "implausible block_id -1"},
+		{"block id too large", func(b *BlockData) { b.ID = "4294967296" }, "implausible block_id 4294967296"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := valid
+			tt.change(&block)
+			err := ValidateBlock(block)
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.reason, err.Error())
+			}
+		})
+	}
+}
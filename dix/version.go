@@ -0,0 +1,103 @@
+package dix
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Build information, injected by the Makefile with
+//
+//	-ldflags "-X github.com/pierreaubert/dotidx/dix.Version=v1.2.0 \
+//	          -X github.com/pierreaubert/dotidx/dix.Commit=abc1234 \
+//	          -X github.com/pierreaubert/dotidx/dix.BuildDate=2026-10-16T12:00:00Z"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo identifies the build of a binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// GetBuildInfo returns the injected build information, the commit and date
+// recorded by the go tool are used when they were not injected
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", b.Version, b.Commit, b.BuildDate, b.GoVersion)
+}
+
+// VersionFlag registers -version on the command line, check it with
+// PrintVersion after flag.Parse
+func VersionFlag() *bool {
+	return flag.Bool("version", false, "print the build information and exit")
+}
+
+// PrintVersion prints the build information of binary when requested is set
+// and reports whether it did so
+func PrintVersion(binary string, requested bool) bool {
+	if requested {
+		fmt.Printf("%s %s\n", binary, GetBuildInfo())
+	}
+	return requested
+}
+
+// HandleVersion answers the build information as JSON
+func HandleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GetBuildInfo()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// NewBuildInfoCollector returns the dotidx_build_info gauge, always 1 and
+// labeled with the build information
+func NewBuildInfoCollector() prometheus.Collector {
+	info := GetBuildInfo()
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "dotidx_build_info",
+		Help: "Build information of the binary, the value is always 1",
+		ConstLabels: prometheus.Labels{
+			"version":    info.Version,
+			"commit":     info.Commit,
+			"build_date": info.BuildDate,
+			"go_version": info.GoVersion,
+		},
+	}, func() float64 { return 1 })
+}
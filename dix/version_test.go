@@ -0,0 +1,63 @@
+package dix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// injectBuildInfo sets the variables as -ldflags -X would
+func injectBuildInfo(t *testing.T) {
+	version, commit, date := Version, Commit, BuildDate
+	t.Cleanup(func() { Version, Commit, BuildDate = version, commit, date })
+	Version, Commit, BuildDate = "v1.2.0", "abc1234", "2026-10-16T12:00:00Z"
+}
+
+func TestHandleVersion(t *testing.T) {
+	injectBuildInfo(t)
+
+	rec := httptest.NewRecorder()
+	HandleVersion(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("Invalid body: %v", err)
+	}
+	if info.Version != "v1.2.0" || info.Commit != "abc1234" || info.BuildDate != "2026-10-16T12:00:00Z" {
+		t.Errorf("Expected the injected build information, got %+v", info)
+	}
+	if info.GoVersion == "" {
+		t.Errorf("Expected the go version")
+	}
+}
+
+func TestBuildInfoCollector(t *testing.T) {
+	injectBuildInfo(t)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewBuildInfoCollector())
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`build_date="2026-10-16T12:00:00Z"`,
+		`commit="abc1234"`,
+		`version="v1.2.0"`,
+		`} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Missing %s in\n%s", expected, body)
+		}
+	}
+}
+
+func TestGetBuildInfoDefaults(t *testing.T) {
+	info := GetBuildInfo()
+	if info.Version != Version || info.Commit == "" || info.BuildDate == "" {
+		t.Errorf("Expected defaults for the missing build information, got %+v", info)
+	}
+}
@@ -0,0 +1,353 @@
+package dix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAlertedAddresses bounds how many addresses seen in a block the
+	// watch list remembers to alert only once on a block indexed twice
+	maxAlertedAddresses = 4096
+	// the watch list reads the addresses added at runtime this often
+	watchListReload = 30 * time.Second
+	watchListBuffer = 1024
+)
+
+// WatchedAddressesTableName returns the table of the addresses watched on
+// top of the configured ones, shared by all the chains
+func WatchedAddressesTableName() string {
+	return schemaName + ".watched_addresses"
+}
+
+// CreateTableWatchedAddresses creates the table of the addresses added to
+// the watch list at runtime
+func (s *SQLDatabase) CreateTableWatchedAddresses() error {
+	tableName := s.getTableName(WatchedAddressesTableName())
+
+	timestampType := "TIMESTAMP WITH TIME ZONE"
+	if s.dialect == DialectSQLite {
+		timestampType = "TIMESTAMP"
+	}
+
+	query := fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    address  TEXT NOT NULL PRIMARY KEY,
+    added_at %s DEFAULT CURRENT_TIMESTAMP
+);`, tableName, timestampType)
+
+	if _, err := s.db.Exec(query); err != nil {
+		s.LogSQL(query)
+		return fmt.Errorf("error creating %s table: %w", tableName, err)
+	}
+	return nil
+}
+
+// WatchAddress adds address to the watch list of every indexer, it must be
+// a valid SS58 address
+func (s *SQLDatabase) WatchAddress(address string) error {
+	if !IsValidAddress(address) {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	query := s.prepareQuery(fmt.Sprintf(
+		"INSERT INTO %s (address) VALUES ($1) ON CONFLICT (address) DO NOTHING;",
+		s.getTableName(WatchedAddressesTableName())))
+	if _, err := s.db.Exec(query, address); err != nil {
+		return fmt.Errorf("error watching address %s: %w", address, err)
+	}
+	return nil
+}
+
+// UnwatchAddress removes address from the watch list, the configured
+// addresses stay watched
+func (s *SQLDatabase) UnwatchAddress(address string) error {
+	query := s.prepareQuery(fmt.Sprintf("DELETE FROM %s WHERE address = $1;",
+		s.getTableName(WatchedAddressesTableName())))
+	if _, err := s.db.Exec(query, address); err != nil {
+		return fmt.Errorf("error unwatching address %s: %w", address, err)
+	}
+	return nil
+}
+
+// WatchedAddresses returns the addresses added at runtime, sorted
+func (s *SQLDatabase) WatchedAddresses() ([]string, error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT address FROM %s ORDER BY address;",
+		s.getTableName(WatchedAddressesTableName())))
+	if err != nil {
+		return nil, fmt.Errorf("error reading watched addresses: %w", err)
+	}
+	defer rows.Close()
+	addresses := make([]string, 0)
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, fmt.Errorf("error reading watched addresses: %w", err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// WatchedAddressStore keeps the addresses added to the watch list at
+// runtime, SQLDatabase is one
+type WatchedAddressStore interface {
+	WatchedAddresses() ([]string, error)
+}
+
+// WatchAlert is a block touching watched addresses
+type WatchAlert struct {
+	RelayChain string
+	Chain      string
+	BlockID    string
+	Addresses  []string
+}
+
+func (a WatchAlert) String() string {
+	return fmt.Sprintf("Watched address %s seen in block %s of %s:%s",
+		strings.Join(a.Addresses, ", "), a.BlockID, a.RelayChain, a.Chain)
+}
+
+// WatchAlerter delivers the alerts of a WatchList
+type WatchAlerter func(ctx context.Context, alert WatchAlert) error
+
+// alertedAddress is a watched address seen in a block of a chain
+type alertedAddress struct {
+	relayChain, chain, block, address string
+}
+
+// WatchList alerts when a saved block touches a watched address: one of
+// the configured ones or of the ones added at runtime to its store.
+type WatchList struct {
+	mu         sync.RWMutex
+	configured []string
+	addresses  map[string]struct{}
+	store      WatchedAddressStore
+	alert      WatchAlerter
+	// the last maxAlertedAddresses alerted, oldest first in alertedOrder
+	alerted      map[alertedAddress]struct{}
+	alertedOrder []alertedAddress
+}
+
+// NewWatchList watches addresses and the ones of store, which may be nil,
+// and alerts through alert
+func NewWatchList(addresses []string, store WatchedAddressStore, alert WatchAlerter) *WatchList {
+	wl := &WatchList{
+		configured: slices.Clone(addresses),
+		addresses:  make(map[string]struct{}, len(addresses)),
+		store:      store,
+		alert:      alert,
+		alerted:    make(map[alertedAddress]struct{}),
+	}
+	for _, address := range addresses {
+		wl.addresses[address] = struct{}{}
+	}
+	return wl
+}
+
+// Reload reads the addresses of the store again, the configured ones are
+// always watched
+func (wl *WatchList) Reload() error {
+	if wl.store == nil {
+		return nil
+	}
+	stored, err := wl.store.WatchedAddresses()
+	if err != nil {
+		return err
+	}
+	addresses := make(map[string]struct{}, len(wl.configured)+len(stored))
+	for _, address := range slices.Concat(wl.configured, stored) {
+		addresses[address] = struct{}{}
+	}
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	wl.addresses = addresses
+	return nil
+}
+
+// List returns the watched addresses sorted
+func (wl *WatchList) List() []string {
+	wl.mu.RLock()
+	defer wl.mu.RUnlock()
+	addresses := make([]string, 0, len(wl.addresses))
+	for address := range wl.addresses {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	return addresses
+}
+
+// Start alerts on the addresses the chains of parachains publish on bus,
+// which must be the event bus of the database saving their blocks, until
+// ctx is done. The chains are subscribed when it returns. With a nil bus it
+// only reloads the store, the blocks go through Check.
+func (wl *WatchList) Start(ctx context.Context, bus *EventBus, parachains map[string]map[string]ParaChainConfig) {
+	if err := wl.Reload(); err != nil {
+		log.Printf("Error reading the watched addresses: %v", err)
+	}
+	for relayChain := range parachains {
+		if bus == nil {
+			break
+		}
+		for chain := range parachains[relayChain] {
+			events, cancel := bus.Subscribe(TopicNewAddress, relayChain, chain, watchListBuffer)
+			go wl.watch(ctx, bus, relayChain, chain, events, cancel)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(watchListReload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := wl.Reload(); err != nil {
+					log.Printf("Error reading the watched addresses: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// watch checks the addresses of relayChain:chain, subscribing again when
+// the bus dropped it
+func (wl *WatchList) watch(ctx context.Context, bus *EventBus, relayChain, chain string, events <-chan Event, cancel func()) {
+	for {
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case event, ok := <-events:
+				if !ok {
+					log.Printf("Watch list of %s:%s fell behind, some addresses were not checked", relayChain, chain)
+					open = false
+					continue
+				}
+				wl.notify(ctx, event.RelayChain, event.Chain, event.BlockID, []string{event.Address})
+			}
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		events, cancel = bus.Subscribe(TopicNewAddress, relayChain, chain, watchListBuffer)
+	}
+}
+
+// Check alerts on the blocks touching watched addresses, for the blocks
+// saved by a database without an event bus
+func (wl *WatchList) Check(ctx context.Context, relayChain, chain string, blocks []BlockData) {
+	for _, block := range blocks {
+		addresses, err := ExtractAddresses(block.Extrinsics)
+		if err != nil {
+			log.Printf("Warning: cannot extract addresses of block %s: %v", block.ID, err)
+			continue
+		}
+		wl.notify(ctx, relayChain, chain, block.ID, addresses)
+	}
+}
+
+// notify fires one alert for the watched addresses among the ones of a
+// block, once per address and block even when the block is indexed twice
+func (wl *WatchList) notify(ctx context.Context, relayChain, chain, block string, addresses []string) {
+	seen := wl.firstSeen(relayChain, chain, block, addresses)
+	if len(seen) == 0 {
+		return
+	}
+	alert := WatchAlert{RelayChain: relayChain, Chain: chain, BlockID: block, Addresses: seen}
+	if err := wl.alert(ctx, alert); err != nil {
+		log.Printf("Failed to alert on block %s of %s:%s: %v", block, relayChain, chain, err)
+	}
+}
+
+// firstSeen returns the watched addresses not alerted yet for the block,
+// sorted, and remembers them
+func (wl *WatchList) firstSeen(relayChain, chain, block string, addresses []string) []string {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	seen := make([]string, 0)
+	for _, address := range addresses {
+		if _, ok := wl.addresses[address]; !ok {
+			continue
+		}
+		key := alertedAddress{relayChain: relayChain, chain: chain, block: block, address: address}
+		if _, ok := wl.alerted[key]; ok {
+			continue
+		}
+		wl.alerted[key] = struct{}{}
+		wl.alertedOrder = append(wl.alertedOrder, key)
+		if len(wl.alertedOrder) > maxAlertedAddresses {
+			delete(wl.alerted, wl.alertedOrder[0])
+			wl.alertedOrder = wl.alertedOrder[1:]
+		}
+		seen = append(seen, address)
+	}
+	slices.Sort(seen)
+	return seen
+}
+
+// LogWatchAlert logs the alert, the alerter of the indexers without a
+// watch_webhook
+func LogWatchAlert(ctx context.Context, alert WatchAlert) error {
+	log.Printf("ALERT: %s", alert)
+	return nil
+}
+
+// WatchWebhookAlerter posts the alerts to url as JSON. The message is in
+// "text", which a Slack incoming webhook displays.
+func WatchWebhookAlerter(url string) WatchAlerter {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context, alert WatchAlert) error {
+		body, err := json.Marshal(map[string]any{
+			"text":        alert.String(),
+			"relay_chain": alert.RelayChain,
+			"chain":       alert.Chain,
+			"block":       alert.BlockID,
+			"addresses":   alert.Addresses,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("watch webhook request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("watch webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// StartWatchList watches the saved blocks of database when the monitoring
+// configuration sets watch_addresses or watch_webhook: it publishes them on
+// bus and runs the watch list until ctx is done. It must be called before
+// the first Save, it returns nil when nothing is watched.
+func StartWatchList(ctx context.Context, config MgrConfig, database *SQLDatabase, bus *EventBus) *WatchList {
+	if len(config.Monitoring.WatchAddresses) == 0 && config.Monitoring.WatchWebhook == "" {
+		return nil
+	}
+	alert := LogWatchAlert
+	if config.Monitoring.WatchWebhook != "" {
+		alert = WatchWebhookAlerter(config.Monitoring.WatchWebhook)
+	}
+	wl := NewWatchList(config.Monitoring.WatchAddresses, database, alert)
+	database.SetEventBus(bus)
+	wl.Start(ctx, bus, config.Parachains)
+	return wl
+}
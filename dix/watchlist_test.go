@@ -0,0 +1,150 @@
+package dix
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const watchedAddress = "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+
+// recordedAlerts keeps the alerts of a WatchList
+type recordedAlerts struct {
+	mu     sync.Mutex
+	alerts []WatchAlert
+}
+
+func (r *recordedAlerts) alert(ctx context.Context, alert WatchAlert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+// wait returns the alerts once there are n of them, or after a second
+func (r *recordedAlerts) wait(n int) []WatchAlert {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		r.mu.Lock()
+		if len(r.alerts) >= n {
+			r.mu.Unlock()
+			break
+		}
+		r.mu.Unlock()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]WatchAlert(nil), r.alerts...)
+}
+
+func TestWatchListAlertsOncePerSavedBlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	database := NewSQLDatabaseWithDB(db)
+	bus := NewEventBus()
+	database.SetEventBus(bus)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := &recordedAlerts{}
+	wl := NewWatchList([]string{watchedAddress}, nil, recorded.alert)
+	wl.Start(ctx, bus, map[string]map[string]ParaChainConfig{"polkadot": {"chain": {}}})
+
+	block := func(id, signer string) BlockData {
+		return BlockData{
+			ID:             id,
+			Hash:           "0x0" + id,
+			ParentHash:     "0x00",
+			StateRoot:      "0x10",
+			ExtrinsicsRoot: "0x11",
+			Extrinsics:     json.RawMessage(`[{"method":{"pallet":"timestamp","method":"set"},"args":{"now":"1700000000000"},"signature":{"signer":{"id":"` + signer + `"}}}]`),
+		}
+	}
+	// block 1 is indexed twice, block 3 touches another address
+	for _, b := range []BlockData{block("1", watchedAddress), block("1", watchedAddress), block("3", "1zugcag7cJVBtVRnFxv5Qftn7xKAnR6YJ9x4x3XLgGgmNnS")} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO chain\\.blocks_polkadot_chain ").
+			WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectExec("^INSERT INTO chain\\.address2blocks_polkadot_chain ").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if err := database.Save([]BlockData{b}, "polkadot", "chain"); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	alerts := recorded.wait(2)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 alert after saving block 1 twice, got %v", alerts)
+	}
+	if alert := alerts[0]; alert.RelayChain != "polkadot" || alert.Chain != "chain" ||
+		alert.BlockID != "1" || fmt.Sprint(alert.Addresses) != "["+watchedAddress+"]" {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+}
+
+func TestWatchListForgetsTheOldestBlocks(t *testing.T) {
+	wl := NewWatchList([]string{watchedAddress}, nil, LogWatchAlert)
+	for id := range maxAlertedAddresses + 1 {
+		if seen := wl.firstSeen("polkadot", "assethub", fmt.Sprint(id), []string{watchedAddress}); len(seen) != 1 {
+			t.Fatalf("Expected block %d to be seen first, got %v", id, seen)
+		}
+	}
+	if n := len(wl.alerted); n != maxAlertedAddresses {
+		t.Errorf("Expected %d addresses remembered, got %d", maxAlertedAddresses, n)
+	}
+	if seen := wl.firstSeen("polkadot", "assethub", fmt.Sprint(maxAlertedAddresses), []string{watchedAddress}); len(seen) != 0 {
+		t.Errorf("Expected the last block to be remembered, got %v", seen)
+	}
+	if seen := wl.firstSeen("polkadot", "assethub", "0", []string{watchedAddress}); len(seen) != 1 {
+		t.Errorf("Expected the oldest block to be forgotten, got %v", seen)
+	}
+}
+
+func TestWatchListReadsTheAddressesAddedAtRuntime(t *testing.T) {
+	sqlite, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening sqlite database: %v", err)
+	}
+	defer sqlite.Close()
+	database := NewSQLDatabaseWithPoolAndDialect(sqlite, DefaultDBPoolConfig(), DialectSQLite)
+	if err := database.DoUpgrade(); err != nil {
+		t.Fatalf("DoUpgrade: %v", err)
+	}
+
+	const configured = "14E5nqKAp3oAJcmzgZhUD2RcptBeUBScxKHgJKU4HPNcKVf3"
+	wl := NewWatchList([]string{configured}, database, LogWatchAlert)
+	if err := database.WatchAddress(watchedAddress); err != nil {
+		t.Fatalf("WatchAddress: %v", err)
+	}
+	if err := database.WatchAddress("0x1234"); err == nil {
+		t.Errorf("Expected an invalid address to be rejected")
+	}
+	if err := wl.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if list := fmt.Sprint(wl.List()); list != fmt.Sprint([]string{configured, watchedAddress}) {
+		t.Errorf("Expected both addresses watched, got %s", list)
+	}
+
+	// the configured addresses cannot be removed
+	for _, address := range []string{watchedAddress, configured} {
+		if err := database.UnwatchAddress(address); err != nil {
+			t.Fatalf("UnwatchAddress: %v", err)
+		}
+	}
+	if err := wl.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if list := fmt.Sprint(wl.List()); list != fmt.Sprint([]string{configured}) {
+		t.Errorf("Expected only the configured address watched, got %s", list)
+	}
+}
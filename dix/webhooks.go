@@ -0,0 +1,263 @@
+package dix
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader carries the HMAC-SHA256 of the body keyed with the
+// webhook secret, as "sha256=<hex>"
+const WebhookSignatureHeader = "X-Dotidx-Signature"
+
+const (
+	webhookBuffer     = 64
+	webhookRetries    = 3
+	webhookRetryDelay = time.Second
+)
+
+// WebhookConfig is a [[webhooks]] subscription. The blocks of
+// RelayChain:Chain touching one of Addresses or with an event of one of
+// Pallets are POSTed to URL; with neither set every block is.
+type WebhookConfig struct {
+	URL        string   `toml:"url"`
+	Secret     string   `toml:"secret" json:"-"`
+	RelayChain string   `toml:"relay_chain"`
+	Chain      string   `toml:"chain"`
+	Addresses  []string `toml:"addresses"`
+	Pallets    []string `toml:"pallets"`
+}
+
+// WebhookPayload is the body POSTed for a matching block
+type WebhookPayload struct {
+	RelayChain string   `json:"relay_chain"`
+	Chain      string   `json:"chain"`
+	Number     string   `json:"number"`
+	Hash       string   `json:"hash"`
+	Addresses  []string `json:"addresses,omitempty"`
+	Pallets    []string `json:"pallets,omitempty"`
+}
+
+// ValidateWebhooks checks that each webhook targets a configured chain and
+// can be signed
+func ValidateWebhooks(hooks []WebhookConfig, parachains map[string]map[string]ParaChainConfig) error {
+	for i, hook := range hooks {
+		u, err := url.Parse(hook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %d: invalid url %q", i, hook.URL)
+		}
+		if hook.Secret == "" {
+			return fmt.Errorf("webhook %d: secret is required", i)
+		}
+		if _, ok := parachains[hook.RelayChain][hook.Chain]; !ok {
+			return fmt.Errorf("webhook %d: unknown chain %s:%s", i, hook.RelayChain, hook.Chain)
+		}
+	}
+	return nil
+}
+
+// MatchWebhook returns the watched addresses and pallets found in block, ok
+// is false when the block does not match
+func MatchWebhook(hook WebhookConfig, block BlockData) (addresses, pallets []string, ok bool) {
+	if len(hook.Addresses) == 0 && len(hook.Pallets) == 0 {
+		return nil, nil, true
+	}
+	if len(hook.Addresses) > 0 {
+		found, err := extractAddressesFromExtrinsics(block.Extrinsics)
+		if err != nil {
+			log.Printf("warning: error extracting addresses of block %s: %v", block.ID, err)
+		}
+		for _, address := range hook.Addresses {
+			if slices.Contains(found, address) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	if len(hook.Pallets) > 0 {
+		found := blockEventPallets(block)
+		for _, pallet := range hook.Pallets {
+			if _, seen := found[strings.ToLower(pallet)]; seen {
+				pallets = append(pallets, pallet)
+			}
+		}
+	}
+	return addresses, pallets, len(addresses) > 0 || len(pallets) > 0
+}
+
+// blockEventPallets returns the lowercased pallets of the events of a block,
+// from its extrinsics and from onInitialize and onFinalize
+func blockEventPallets(block BlockData) map[string]struct{} {
+	type event struct {
+		Method struct {
+			Pallet string `json:"pallet"`
+		} `json:"method"`
+	}
+	pallets := make(map[string]struct{})
+	add := func(events []event) {
+		for _, e := range events {
+			if e.Method.Pallet != "" {
+				pallets[strings.ToLower(e.Method.Pallet)] = struct{}{}
+			}
+		}
+	}
+
+	var extrinsics []struct {
+		Events []event `json:"events"`
+	}
+	if err := json.Unmarshal(block.Extrinsics, &extrinsics); err == nil {
+		for _, extrinsic := range extrinsics {
+			add(extrinsic.Events)
+		}
+	}
+	for _, hook := range []json.RawMessage{block.OnInitialize, block.OnFinalize} {
+		var phase struct {
+			Events []event `json:"events"`
+		}
+		if err := json.Unmarshal(hook, &phase); err == nil {
+			add(phase.Events)
+		}
+	}
+	return pallets
+}
+
+// SignWebhook returns the value of WebhookSignatureHeader for body
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher posts the new blocks published on an EventBus to the
+// webhooks they match
+type WebhookDispatcher struct {
+	bus        *EventBus
+	hooks      []WebhookConfig
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+}
+
+func NewWebhookDispatcher(bus *EventBus, hooks []WebhookConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		bus:        bus,
+		hooks:      hooks,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		retries:    webhookRetries,
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// Run delivers the webhooks until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	for _, hook := range d.hooks {
+		deliveries := make(chan []byte, webhookBuffer)
+		go d.match(ctx, hook, deliveries)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case body := <-deliveries:
+					if err := d.deliver(ctx, hook, body); err != nil {
+						log.Printf("Webhook %s: %v", hook.URL, err)
+					}
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+}
+
+// match queues the payloads of the blocks matching hook, it never waits on
+// deliveries so that the bus does not drop it
+func (d *WebhookDispatcher) match(ctx context.Context, hook WebhookConfig, deliveries chan<- []byte) {
+	for ctx.Err() == nil {
+		events, cancel := d.bus.Subscribe(TopicNewBlock, hook.RelayChain, hook.Chain, webhookBuffer)
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				cancel()
+				return
+			case event, ok := <-events:
+				if !ok {
+					log.Printf("Webhook %s fell behind, some blocks were not checked", hook.URL)
+					open = false
+					continue
+				}
+				addresses, pallets, matched := MatchWebhook(hook, event.Block)
+				if !matched {
+					continue
+				}
+				body, err := json.Marshal(WebhookPayload{
+					RelayChain: event.RelayChain,
+					Chain:      event.Chain,
+					Number:     event.Block.ID,
+					Hash:       event.Block.Hash,
+					Addresses:  addresses,
+					Pallets:    pallets,
+				})
+				if err != nil {
+					log.Printf("Webhook %s: error encoding block %s: %v", hook.URL, event.Block.ID, err)
+					continue
+				}
+				select {
+				case deliveries <- body:
+				default:
+					log.Printf("Webhook %s is too slow, skipping block %s", hook.URL, event.Block.ID)
+				}
+			}
+		}
+		cancel()
+	}
+}
+
+// deliver POSTs body, retrying with an exponential backoff until the
+// webhook answers 2xx
+func (d *WebhookDispatcher) deliver(ctx context.Context, hook WebhookConfig, body []byte) error {
+	signature := SignWebhook(hook.Secret, body)
+	delay := d.retryDelay
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		if err = d.post(ctx, hook.URL, signature, body); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", d.retries+1, err)
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, target, signature string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
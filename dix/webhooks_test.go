@@ -0,0 +1,135 @@
+package dix
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const webhookAddress = "15oF4uVJwmo4TdGW7VfQxNLavjCXviqxT9S1MgbjMNHr6Sp5"
+
+func webhookBlock() BlockData {
+	return BlockData{
+		ID:   "7",
+		Hash: "0x07",
+		Extrinsics: json.RawMessage(`[{
+			"method": {"pallet": "balances", "method": "transferKeepAlive"},
+			"signature": {"signer": {"id": "` + webhookAddress + `"}},
+			"events": [{"method": {"pallet": "balances", "method": "Transfer"}}]
+		}]`),
+		OnFinalize: json.RawMessage(`{"events": [{"method": {"pallet": "treasury", "method": "Burnt"}}]}`),
+	}
+}
+
+func TestMatchWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		hook      WebhookConfig
+		addresses []string
+		pallets   []string
+		ok        bool
+	}{
+		{"no filter", WebhookConfig{}, nil, nil, true},
+		{"address", WebhookConfig{Addresses: []string{webhookAddress}}, []string{webhookAddress}, nil, true},
+		{"other address", WebhookConfig{Addresses: []string{"1zugcag7cJVBtVRnFxv5Qftn7xKAnR6YJ9x4x3XLgGgmNnS"}}, nil, nil, false},
+		{"extrinsic event pallet", WebhookConfig{Pallets: []string{"Balances"}}, nil, []string{"Balances"}, true},
+		{"on finalize event pallet", WebhookConfig{Pallets: []string{"treasury"}}, nil, []string{"treasury"}, true},
+		{"other pallet", WebhookConfig{Pallets: []string{"staking"}}, nil, nil, false},
+		{"either", WebhookConfig{Addresses: []string{"1zugcag7cJVBtVRnFxv5Qftn7xKAnR6YJ9x4x3XLgGgmNnS"}, Pallets: []string{"balances", "staking"}}, nil, []string{"balances"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addresses, pallets, ok := MatchWebhook(tt.hook, webhookBlock())
+			if ok != tt.ok || !slices.Equal(addresses, tt.addresses) || !slices.Equal(pallets, tt.pallets) {
+				t.Errorf("MatchWebhook = %v, %v, %v; expected %v, %v, %v", addresses, pallets, ok, tt.addresses, tt.pallets, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// RFC 4231 test case 2
+	got := SignWebhook("Jefe", []byte("what do ya want for nothing?"))
+	expected := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != expected {
+		t.Errorf("SignWebhook = %s, expected %s", got, expected)
+	}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	parachains := map[string]map[string]ParaChainConfig{"polkadot": {"assethub": {}}}
+	valid := WebhookConfig{URL: "https://example.org/hook", Secret: "s", RelayChain: "polkadot", Chain: "assethub"}
+	if err := ValidateWebhooks([]WebhookConfig{valid}, parachains); err != nil {
+		t.Errorf("Expected a valid webhook, got %v", err)
+	}
+	noSecret, badURL, badChain := valid, valid, valid
+	noSecret.Secret = ""
+	badURL.URL = "ftp://example.org"
+	badChain.Chain = "people"
+	for _, hook := range []WebhookConfig{noSecret, badURL, badChain} {
+		if err := ValidateWebhooks([]WebhookConfig{hook}, parachains); err == nil {
+			t.Errorf("Expected %+v to be rejected", hook)
+		}
+	}
+}
+
+func TestWebhookDispatcherDelivers(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan WebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt fails to exercise the retry
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhook("secret", body) {
+			t.Errorf("Unexpected signature %s", r.Header.Get(WebhookSignatureHeader))
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Error decoding payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	bus := NewEventBus()
+	dispatcher := NewWebhookDispatcher(bus, []WebhookConfig{{
+		URL:        server.URL,
+		Secret:     "secret",
+		RelayChain: "polkadot",
+		Chain:      "assethub",
+		Pallets:    []string{"balances"},
+	}})
+	dispatcher.retryDelay = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	for bus.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(
+		Event{Topic: TopicNewBlock, RelayChain: "polkadot", Chain: "assethub", Block: BlockData{ID: "6", Extrinsics: json.RawMessage(`[]`)}},
+		Event{Topic: TopicNewBlock, RelayChain: "polkadot", Chain: "assethub", Block: webhookBlock()},
+	)
+
+	select {
+	case payload := <-received:
+		if payload.Number != "7" || payload.Hash != "0x07" || !slices.Equal(payload.Pallets, []string{"balances"}) {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not delivered")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("Expected 2 attempts, got %d", n)
+	}
+}